@@ -0,0 +1,167 @@
+package config
+
+import (
+	"GuestList/internal/auth"
+	"GuestList/internal/logging"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Minimum length of the shared secret of the HS256 tokens, the length of the SHA-256 it is used with
+const minJWTSecretLength = 32
+
+// Minimum length of the secret of the pseudonyms in the log entries, the length of the SHA-256 it is used with
+const minLogRedactKeyLength = 32
+
+// Config of the service
+type Config struct {
+	DatabaseDSN        string        // DSN of the MySQL database
+	ListenAddr         string        // Address the REST API listens on
+	InvitationTemplate string        // Path of the invitation template
+	APIDocsDir         string        // Directory of the OpenAPI document and the documentation page
+	DefaultLimit       int           // Number of guests returned by the lists if no limit is given
+	DefaultOffset      int           // Offset of the lists if no offset is given
+	MaxPartySize       int           // Maximum number of people per guest including the guest
+	FreezeBefore       time.Duration // Time before an event its guest list is frozen, never frozen if 0
+	NoShowAfter        time.Duration // Time after the start of an event its guests are no-shows, never marked if 0
+	MaxBodyBytes       int64         // Maximum size of a request body
+	IdempotencyWindow  time.Duration // Time the response to a request with an Idempotency-Key is replayed
+	RequestTimeout     time.Duration // Default time limit of a request
+	InvitationTimeout  time.Duration // Time limit for generating an invitation
+	ReadHeaderTimeout  time.Duration // Time limit for reading the request headers
+	ReadTimeout        time.Duration // Time limit for reading the whole request
+	WriteTimeout       time.Duration // Time limit for writing the response
+	IdleTimeout        time.Duration // Time a keep-alive connection is kept open
+	ShutdownTimeout    time.Duration // Time given to the in-flight requests on shutdown
+	ShutdownDelay      time.Duration // Time between reporting not ready and stopping the listener
+	SchedulerInterval  time.Duration // Time between two checks for due jobs
+	TLSCertFile        string        // Path of the TLS certificate, TLS is disabled if empty
+	TLSKeyFile         string        // Path of the TLS private key
+	LogLevel           logging.Level // Entries below the level are dropped
+	LogRedactNames     bool          // Replace the names of the guests in the log entries by a pseudonym
+	LogRedactKey       string        // Secret of the pseudonyms, the names are replaced by a placeholder if empty
+	TraceOutput        string        // Destination of the spans: stdout or the path of a file, disabled if empty
+	AuthEnabled        bool          // Require an API key or a JWT for the routes of the guest list
+	AuthInsecureDev    bool          // Allow the authentication to be disabled, for local development only
+	AuthAdminKeyHash   string        // SHA-256 of the API key of the administrator, disabled if empty
+	JWTSecret          string        // Shared secret of the HS256 tokens, disabled if empty
+	JWTPublicKeyFile   string        // PEM file of the public keys of the RS256 and ES256 tokens, disabled if empty
+	JWTIssuer          string        // Required iss claim of the tokens, not checked if empty
+	JWTAudience        string        // Required aud claim of the tokens, not checked if empty
+}
+
+/* This function returns the default configuration of the service.
+Return:
+	Config - configuration given by the constants
+*/
+func Default() Config {
+	return Config{
+		DatabaseDSN:        MYSQL_DSN + MYSQL_DATABASE,
+		ListenAddr:         API_PORT,
+		InvitationTemplate: INVITATION_TEMPLATE,
+		APIDocsDir:         API_DOCS_DIR,
+		DefaultLimit:       DEFAULT_LIMIT,
+		DefaultOffset:      DEFAULT_OFFSET,
+		MaxPartySize:       MAX_PARTY_SIZE,
+		FreezeBefore:       FREEZE_BEFORE,
+		NoShowAfter:        NO_SHOW_AFTER,
+		MaxBodyBytes:       MAX_BODY_BYTES,
+		IdempotencyWindow:  IDEMPOTENCY_WINDOW,
+		RequestTimeout:     REQUEST_TIMEOUT,
+		InvitationTimeout:  INVITATION_TIMEOUT,
+		ReadHeaderTimeout:  READ_HEADER_TIMEOUT,
+		ReadTimeout:        READ_TIMEOUT,
+		WriteTimeout:       WRITE_TIMEOUT,
+		IdleTimeout:        IDLE_TIMEOUT,
+		ShutdownTimeout:    SHUTDOWN_TIMEOUT,
+		ShutdownDelay:      SHUTDOWN_DELAY,
+		SchedulerInterval:  SCHEDULER_INTERVAL,
+		LogLevel:           LOG_LEVEL,
+		LogRedactNames:     LOG_REDACT_NAMES,
+		TraceOutput:        TRACE_OUTPUT,
+		AuthEnabled:        AUTH_ENABLED,
+		AuthInsecureDev:    AUTH_INSECURE_DEV,
+	}
+}
+
+/* This function checks that the configuration can be used to run the service.
+Return:
+	error - all problems found in the configuration, or nil if it is valid
+*/
+func (c Config) Validate() error {
+	var problems []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Errorf(format, args...))
+		}
+	}
+
+	_, err := mysql.ParseDSN(c.DatabaseDSN)
+	check(c.DatabaseDSN != "" && err == nil, "db_dsn: invalid MySQL DSN")
+	check(c.ListenAddr != "", "listen_addr: must not be empty")
+	_, err = os.Stat(c.InvitationTemplate)
+	check(err == nil, "invitation_template: %v", err)
+	check(c.DefaultLimit > 0, "default_limit: must be positive")
+	check(c.DefaultOffset >= 0, "default_offset: must not be negative")
+	check(c.MaxPartySize > 0, "max_party_size: must be positive")
+	check(c.FreezeBefore >= 0, "freeze_before: must not be negative")
+	check(c.NoShowAfter >= 0, "no_show_after: must not be negative")
+	check(c.MaxBodyBytes > 0, "max_body_bytes: must be positive")
+	check(c.IdempotencyWindow > 0, "idempotency_window: must be positive")
+	check(c.RequestTimeout > 0, "request_timeout: must be positive")
+	check(c.InvitationTimeout > 0, "invitation_timeout: must be positive")
+	check(c.ReadHeaderTimeout > 0, "read_header_timeout: must be positive")
+	check(c.ReadTimeout >= c.ReadHeaderTimeout, "read_timeout: must not be shorter than read_header_timeout")
+	// The response of a request which timed out has to be written before the connection is closed
+	check(c.WriteTimeout > c.RequestTimeout && c.WriteTimeout > c.InvitationTimeout,
+		"write_timeout: must be longer than request_timeout and invitation_timeout")
+	check(c.IdleTimeout > 0, "idle_timeout: must be positive")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout: must be positive")
+	check(c.ShutdownDelay >= 0, "shutdown_delay: must not be negative")
+	check(c.SchedulerInterval > 0, "scheduler_interval: must be positive")
+	check((c.TLSCertFile == "") == (c.TLSKeyFile == ""), "tls_cert_file, tls_key_file: must be given together")
+	if c.TLSCertFile != "" {
+		_, err = os.Stat(c.TLSCertFile)
+		check(err == nil, "tls_cert_file: %v", err)
+		_, err = os.Stat(c.TLSKeyFile)
+		check(err == nil, "tls_key_file: %v", err)
+	}
+	if c.TraceOutput != "" && c.TraceOutput != "stdout" {
+		_, err = os.Stat(filepath.Dir(c.TraceOutput))
+		check(err == nil, "trace_output: %v", err)
+	}
+
+	check(c.LogRedactKey == "" || len(c.LogRedactKey) >= minLogRedactKeyLength,
+		"log_redact_key: must have at least %d characters", minLogRedactKeyLength)
+	check(c.AuthAdminKeyHash == "" || auth.IsKeyHash(c.AuthAdminKeyHash),
+		"auth_admin_key_hash: must be the hex encoded SHA-256 of the key")
+	check(c.JWTSecret == "" || len(c.JWTSecret) >= minJWTSecretLength,
+		"jwt_secret: must have at least %d characters", minJWTSecretLength)
+	if c.JWTPublicKeyFile != "" {
+		data, err := ioutil.ReadFile(c.JWTPublicKeyFile)
+		if err == nil {
+			_, err = auth.ParsePublicKeys(data)
+		}
+		check(err == nil, "jwt_public_key_file: %v", err)
+	}
+	// Without the authentication every caller is an administrator, which is only acceptable on a developer machine
+	check(c.AuthEnabled || c.AuthInsecureDev,
+		"auth_enabled: must be true, unless auth_insecure_dev is set for local development")
+	// Without any of them no one could authenticate to create the first API key
+	check(!c.AuthEnabled || c.AuthAdminKeyHash != "" || c.JWTSecret != "" || c.JWTPublicKeyFile != "",
+		"auth_enabled: requires auth_admin_key_hash, jwt_secret or jwt_public_key_file")
+
+	if len(problems) == 0 {
+		return nil
+	}
+	msg := "invalid configuration"
+	for _, problem := range problems {
+		msg += "\n\t" + problem.Error()
+	}
+	return errors.New(msg)
+}
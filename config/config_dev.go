@@ -1,8 +1,76 @@
 package config
 
-// Constants for database connection
+import (
+	"GuestList/internal/logging"
+	"time"
+)
+
+// Default constants for database connection
 const (
 	MYSQL_DSN      = "root:@tcp(localhost:3306)/"
 	MYSQL_DATABASE = "party"
 	API_PORT       = ":8000"
 )
+
+// Default constants for the party policy
+const (
+	MAX_PARTY_SIZE = 10                 // Maximum number of people per guest including the guest
+	FREEZE_BEFORE  = 7 * 24 * time.Hour // Time before an event its guest list is frozen for the caterer
+	NO_SHOW_AFTER  = time.Hour          // Time after the start of an event its guests who have not arrived are no-shows
+)
+
+// Default constants for the pagination
+const (
+	DEFAULT_LIMIT  = 100
+	DEFAULT_OFFSET = 0
+)
+
+// Default constants for the HTTP requests
+const (
+	MAX_BODY_BYTES     = 1 << 16          // Maximum size of a request body
+	IDEMPOTENCY_WINDOW = 24 * time.Hour   // Time the response to a request with an Idempotency-Key is replayed
+	REQUEST_TIMEOUT    = 5 * time.Second  // Default time limit of a request
+	INVITATION_TIMEOUT = 10 * time.Second // Time limit for generating an invitation
+)
+
+// Default constants for the HTTP server
+const (
+	READ_HEADER_TIMEOUT = 5 * time.Second   // Time limit for reading the request headers
+	READ_TIMEOUT        = 10 * time.Second  // Time limit for reading the whole request
+	WRITE_TIMEOUT       = 30 * time.Second  // Time limit for writing the response
+	IDLE_TIMEOUT        = 120 * time.Second // Time a keep-alive connection is kept open
+	SHUTDOWN_TIMEOUT    = 20 * time.Second  // Time given to the in-flight requests on shutdown
+	SHUTDOWN_DELAY      = 0 * time.Second   // Time between reporting not ready and stopping the listener
+)
+
+// Default constants for the scheduled jobs
+const (
+	SCHEDULER_INTERVAL = time.Minute // Time between two checks for due jobs
+)
+
+// Default constants for the templates
+const (
+	INVITATION_TEMPLATE = "templates/invitation.html"
+)
+
+// Default constants for the API documentation
+const (
+	API_DOCS_DIR = "api" // Directory of the OpenAPI document and the documentation page
+)
+
+// Default constants for the logging
+const (
+	LOG_LEVEL        = logging.LevelInfo // Entries below the level are dropped
+	LOG_REDACT_NAMES = false             // Replace the names of the guests in the log entries by a pseudonym
+)
+
+// Default constants for the authentication, the other settings of the authentication are empty by default
+const (
+	AUTH_ENABLED      = true  // Require an API key or a JWT for the routes of the guest list
+	AUTH_INSECURE_DEV = false // Allow the authentication to be disabled, for local development only
+)
+
+// Default constants for the tracing
+const (
+	TRACE_OUTPUT = "" // Destination of the spans: stdout or the path of a file, tracing is disabled if empty
+)
@@ -0,0 +1,265 @@
+package config
+
+import (
+	"GuestList/internal/logging"
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix of the environment variables
+const envPrefix = "GUESTLIST_"
+
+// Config file read when no other file is given
+const defaultConfigFile = ".env"
+
+// setting is a single configuration value which can be given in the config file, environment and flags
+type setting struct {
+	name  string // name in the config file, the variable is GUESTLIST_<NAME> and the flag -<name-with-dashes>
+	usage string
+	apply func(cfg *Config, value string) error
+}
+
+// Settings of the service
+var settings = []setting{
+	stringSetting("db_dsn", "DSN of the MySQL database", func(c *Config) *string { return &c.DatabaseDSN }),
+	stringSetting("listen_addr", "address the REST API listens on", func(c *Config) *string { return &c.ListenAddr }),
+	stringSetting("invitation_template", "path of the invitation template",
+		func(c *Config) *string { return &c.InvitationTemplate }),
+	stringSetting("api_docs_dir", "directory of the OpenAPI document and the documentation page",
+		func(c *Config) *string { return &c.APIDocsDir }),
+	intSetting("default_limit", "number of guests returned by the lists if no limit is given",
+		func(c *Config) *int { return &c.DefaultLimit }),
+	intSetting("default_offset", "offset of the lists if no offset is given",
+		func(c *Config) *int { return &c.DefaultOffset }),
+	intSetting("max_party_size", "maximum number of people per guest including the guest",
+		func(c *Config) *int { return &c.MaxPartySize }),
+	durationSetting("freeze_before", "time before an event its guest list is frozen, never frozen if 0",
+		func(c *Config) *time.Duration { return &c.FreezeBefore }),
+	durationSetting("no_show_after", "time after the start of an event its guests who have not arrived are "+
+		"no-shows, never marked if 0", func(c *Config) *time.Duration { return &c.NoShowAfter }),
+	{"max_body_bytes", "maximum size of a request body", func(c *Config, value string) error {
+		var err error
+		c.MaxBodyBytes, err = strconv.ParseInt(value, 10, 64)
+		return err
+	}},
+	durationSetting("idempotency_window", "time the response to a request with an Idempotency-Key is replayed",
+		func(c *Config) *time.Duration { return &c.IdempotencyWindow }),
+	durationSetting("request_timeout", "default time limit of a request",
+		func(c *Config) *time.Duration { return &c.RequestTimeout }),
+	durationSetting("invitation_timeout", "time limit for generating an invitation",
+		func(c *Config) *time.Duration { return &c.InvitationTimeout }),
+	durationSetting("read_header_timeout", "time limit for reading the request headers",
+		func(c *Config) *time.Duration { return &c.ReadHeaderTimeout }),
+	durationSetting("read_timeout", "time limit for reading the whole request",
+		func(c *Config) *time.Duration { return &c.ReadTimeout }),
+	durationSetting("write_timeout", "time limit for writing the response",
+		func(c *Config) *time.Duration { return &c.WriteTimeout }),
+	durationSetting("idle_timeout", "time a keep-alive connection is kept open",
+		func(c *Config) *time.Duration { return &c.IdleTimeout }),
+	durationSetting("shutdown_timeout", "time given to the in-flight requests on shutdown",
+		func(c *Config) *time.Duration { return &c.ShutdownTimeout }),
+	durationSetting("shutdown_delay", "time between reporting not ready and stopping the listener",
+		func(c *Config) *time.Duration { return &c.ShutdownDelay }),
+	durationSetting("scheduler_interval", "time between two checks for due jobs",
+		func(c *Config) *time.Duration { return &c.SchedulerInterval }),
+	stringSetting("tls_cert_file", "path of the TLS certificate, TLS is disabled if empty",
+		func(c *Config) *string { return &c.TLSCertFile }),
+	stringSetting("tls_key_file", "path of the TLS private key", func(c *Config) *string { return &c.TLSKeyFile }),
+	{"log_level", "minimum level of the log entries: debug, info, warn or error", func(c *Config, value string) error {
+		var err error
+		c.LogLevel, err = logging.ParseLevel(value)
+		return err
+	}},
+	boolSetting("log_redact_names", "replace the names of the guests in the log entries by a pseudonym",
+		func(c *Config) *bool { return &c.LogRedactNames }),
+	stringSetting("log_redact_key", "secret of the pseudonyms, the names are replaced by a placeholder if empty",
+		func(c *Config) *string { return &c.LogRedactKey }),
+	stringSetting("trace_output", "destination of the spans: stdout or the path of a file, disabled if empty",
+		func(c *Config) *string { return &c.TraceOutput }),
+	boolSetting("auth_enabled", "require an API key or a JWT for the routes of the guest list",
+		func(c *Config) *bool { return &c.AuthEnabled }),
+	boolSetting("auth_insecure_dev", "allow the authentication to be disabled, for local development only",
+		func(c *Config) *bool { return &c.AuthInsecureDev }),
+	stringSetting("auth_admin_key_hash", "SHA-256 of the API key of the administrator, disabled if empty",
+		func(c *Config) *string { return &c.AuthAdminKeyHash }),
+	stringSetting("jwt_secret", "shared secret of the HS256 tokens, disabled if empty",
+		func(c *Config) *string { return &c.JWTSecret }),
+	stringSetting("jwt_public_key_file", "PEM file of the public keys of the RS256 and ES256 tokens, disabled if empty",
+		func(c *Config) *string { return &c.JWTPublicKeyFile }),
+	stringSetting("jwt_issuer", "required iss claim of the tokens, not checked if empty",
+		func(c *Config) *string { return &c.JWTIssuer }),
+	stringSetting("jwt_audience", "required aud claim of the tokens, not checked if empty",
+		func(c *Config) *string { return &c.JWTAudience }),
+}
+
+func stringSetting(name string, usage string, field func(*Config) *string) setting {
+	return setting{name, usage, func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}}
+}
+
+func intSetting(name string, usage string, field func(*Config) *int) setting {
+	return setting{name, usage, func(c *Config, value string) error {
+		var err error
+		*field(c), err = strconv.Atoi(value)
+		return err
+	}}
+}
+
+func durationSetting(name string, usage string, field func(*Config) *time.Duration) setting {
+	return setting{name, usage, func(c *Config, value string) error {
+		var err error
+		*field(c), err = time.ParseDuration(value)
+		return err
+	}}
+}
+
+func boolSetting(name string, usage string, field func(*Config) *bool) setting {
+	return setting{name, usage, func(c *Config, value string) error {
+		var err error
+		*field(c), err = strconv.ParseBool(value)
+		return err
+	}}
+}
+
+/* This function loads the configuration of the service. The defaults are overridden by the config file,
+then by the environment variables and finally by the flags. The config file is given by the -config flag or
+the GUESTLIST_CONFIG variable, otherwise .env is read if it exists. Files ending with .yaml or .yml are read
+as YAML, any other file as KEY=VALUE lines.
+Arguments:
+	args []string - command line arguments without the program name
+	getenv func(string) string - lookup of the environment variables
+Return:
+	Config - configuration of the service
+	error - any error that occurred while loading or validating the configuration
+*/
+func Load(args []string, getenv func(string) string) (Config, error) {
+	cfg := Default()
+
+	// Parse the flags first to find the config file
+	flags := flag.NewFlagSet("guestlist", flag.ContinueOnError)
+	configFile := flags.String("config", getenv(envPrefix+"CONFIG"), "path of the config file (.env or YAML)")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagValues[s.name] = flags.String(strings.Replace(s.name, "_", "-", -1), "", s.usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	// Read the config file
+	fileValues, err := readConfigFile(*configFile)
+	if err != nil {
+		return cfg, err
+	}
+	for name := range fileValues {
+		if findSetting(name) == nil {
+			return cfg, fmt.Errorf("config file: unknown setting %q", name)
+		}
+	}
+
+	// Collect the values from the sources in the order of precedence
+	flagsSet := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		flagsSet[strings.Replace(f.Name, "-", "_", -1)] = true
+	})
+	for _, s := range settings {
+		sources := []struct {
+			name  string
+			value string
+			set   bool
+		}{
+			{"config file", fileValues[s.name], fileValues[s.name] != ""},
+			{envPrefix + strings.ToUpper(s.name), getenv(envPrefix + strings.ToUpper(s.name)),
+				getenv(envPrefix+strings.ToUpper(s.name)) != ""},
+			{"flag -" + strings.Replace(s.name, "_", "-", -1), *flagValues[s.name], flagsSet[s.name]},
+		}
+		for _, source := range sources {
+			if !source.set {
+				continue
+			}
+			if err := s.apply(&cfg, source.value); err != nil {
+				return cfg, fmt.Errorf("%s: invalid %s: %v", source.name, s.name, err)
+			}
+		}
+	}
+	return cfg, cfg.Validate()
+}
+
+func findSetting(name string) *setting {
+	for i := range settings {
+		if settings[i].name == name {
+			return &settings[i]
+		}
+	}
+	return nil
+}
+
+/* This function reads the settings from the config file. The names are normalized to the names of the settings,
+so both GUESTLIST_DB_DSN and db_dsn can be used.
+Arguments:
+	path string - path of the config file, or empty to read .env if it exists
+Return:
+	map[string]string - values of the settings by name
+	error - any error that occurred
+*/
+func readConfigFile(path string) (map[string]string, error) {
+	values := make(map[string]string)
+	if path == "" {
+		if _, err := os.Stat(defaultConfigFile); err != nil {
+			return values, nil
+		}
+		path = defaultConfigFile
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %v", err)
+	}
+
+	normalize := func(key string) string {
+		key = strings.ToLower(strings.TrimSpace(key))
+		return strings.TrimPrefix(key, strings.ToLower(envPrefix))
+	}
+
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		var document map[string]interface{}
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			return nil, fmt.Errorf("config file %s: %v", path, err)
+		}
+		for key, value := range document {
+			values[normalize(key)] = fmt.Sprint(value)
+		}
+		return values, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+		separator := strings.Index(text, "=")
+		if separator < 0 {
+			return nil, fmt.Errorf("config file %s:%d: expected KEY=VALUE", path, line)
+		}
+		value := strings.TrimSpace(text[separator+1:])
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		values[normalize(text[:separator])] = value
+	}
+	return values, scanner.Err()
+}
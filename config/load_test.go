@@ -0,0 +1,135 @@
+package config
+
+import (
+	"GuestList/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes a file into the temporary directory and returns its path
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("an error '%s' was not expected when writing %s", err, name)
+	}
+	return path
+}
+
+// Returns a lookup of the given environment variables
+func env(vars map[string]string) func(string) string {
+	return func(key string) string {
+		return vars[key]
+	}
+}
+
+// Test the precedence of the config file, environment and flags
+func TestLoadPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a temporary directory", err)
+	}
+	defer os.RemoveAll(dir)
+	template := writeFile(t, dir, "invitation.html", "Dear {{.Name}}")
+	configFile := writeFile(t, dir, "guestlist.env", `
+# Settings of the party
+GUESTLIST_INVITATION_TEMPLATE=`+template+`
+GUESTLIST_LISTEN_ADDR=":8001"
+export GUESTLIST_MAX_PARTY_SIZE=6
+default_limit=20
+auth_enabled=false
+auth_insecure_dev=true
+`)
+
+	cfg, err := Load([]string{"-config", configFile, "-max-party-size", "8", "-log-redact-names", "true"},
+		env(map[string]string{
+			"GUESTLIST_LISTEN_ADDR":     ":8002",
+			"GUESTLIST_MAX_PARTY_SIZE":  "7",
+			"GUESTLIST_REQUEST_TIMEOUT": "2s",
+			"GUESTLIST_LOG_LEVEL":       "debug",
+		}))
+
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, template, cfg.InvitationTemplate, "Expected template from the config file")
+	assert.Equal(t, 20, cfg.DefaultLimit, "Expected limit from the config file")
+	assert.Equal(t, ":8002", cfg.ListenAddr, "Expected address from the environment")
+	assert.Equal(t, 2*time.Second, cfg.RequestTimeout, "Expected timeout from the environment")
+	assert.Equal(t, 8, cfg.MaxPartySize, "Expected party size from the flags")
+	assert.Equal(t, logging.LevelDebug, cfg.LogLevel, "Expected log level from the environment")
+	assert.True(t, cfg.LogRedactNames, "Expected redaction from the flags")
+	assert.False(t, cfg.AuthEnabled, "Expected the authentication to be disabled by the config file")
+	assert.Equal(t, MYSQL_DSN+MYSQL_DATABASE, cfg.DatabaseDSN, "Expected default DSN")
+}
+
+// Test loading the configuration from a YAML file given in the environment
+func TestLoadYAML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a temporary directory", err)
+	}
+	defer os.RemoveAll(dir)
+	template := writeFile(t, dir, "invitation.html", "Dear {{.Name}}")
+	configFile := writeFile(t, dir, "guestlist.yaml", `
+db_dsn: "party:secret@tcp(db:3306)/party"
+invitation_template: `+template+`
+max_body_bytes: 1024
+invitation_timeout: 20s
+jwt_secret: "a-shared-secret-of-at-least-32-bytes"
+`)
+
+	cfg, err := Load(nil, env(map[string]string{"GUESTLIST_CONFIG": configFile}))
+
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, "party:secret@tcp(db:3306)/party", cfg.DatabaseDSN, "Expected DSN from the config file")
+	assert.Equal(t, int64(1024), cfg.MaxBodyBytes, "Expected body limit from the config file")
+	assert.Equal(t, 20*time.Second, cfg.InvitationTimeout, "Expected timeout from the config file")
+	assert.True(t, cfg.AuthEnabled, "Expected the authentication to be enabled by default")
+}
+
+// Test rejecting invalid configurations
+func TestLoadInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a temporary directory", err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = Load([]string{"-config", writeFile(t, dir, "typo.env", "GUESTLIST_MAX_PARTY=4")}, env(nil))
+	assert.Contains(t, err.Error(), `unknown setting "max_party"`, "Expected unknown setting")
+
+	_, err = Load([]string{"-request-timeout", "soon"}, env(nil))
+	assert.Contains(t, err.Error(), "flag -request-timeout: invalid request_timeout", "Expected invalid duration")
+
+	_, err = Load(nil, env(map[string]string{"GUESTLIST_LOG_LEVEL": "verbose"}))
+	assert.Contains(t, err.Error(), "GUESTLIST_LOG_LEVEL: invalid log_level", "Expected unknown log level")
+
+	_, err = Load([]string{"-invitation-template", filepath.Join(dir, "missing.html"), "-default-limit", "0",
+		"-freeze-before", "-24h", "-no-show-after", "-1h", "-scheduler-interval", "0s"},
+		env(map[string]string{"GUESTLIST_DB_DSN": "not a dsn"}))
+	assert.Contains(t, err.Error(), "db_dsn", "Expected invalid DSN")
+	assert.Contains(t, err.Error(), "invitation_template", "Expected missing template")
+	assert.Contains(t, err.Error(), "default_limit", "Expected invalid limit")
+	assert.Contains(t, err.Error(), "freeze_before: must not be negative", "Expected a freeze before the event")
+	assert.Contains(t, err.Error(), "no_show_after: must not be negative", "Expected a cutoff after the start")
+	assert.Contains(t, err.Error(), "scheduler_interval: must be positive", "Expected an interval of the scheduler")
+
+	_, err = Load([]string{"-tls-cert-file", "cert.pem", "-write-timeout", "5s", "-log-redact-key", "too short"}, env(nil))
+	assert.Contains(t, err.Error(), "must be given together", "Expected TLS key to be required")
+	assert.Contains(t, err.Error(), "log_redact_key: must have at least 32 characters", "Expected a longer secret")
+	assert.Contains(t, err.Error(), "write_timeout", "Expected write timeout longer than the request timeouts")
+
+	_, err = Load([]string{"-auth-enabled", "true", "-jwt-secret", "too short", "-jwt-public-key-file",
+		writeFile(t, dir, "keys.pem", "not a key")}, env(map[string]string{"GUESTLIST_AUTH_ADMIN_KEY_HASH": "secret"}))
+	assert.Contains(t, err.Error(), "auth_admin_key_hash: must be the hex encoded SHA-256", "Expected a hash")
+	assert.Contains(t, err.Error(), "jwt_secret: must have at least 32 characters", "Expected a longer secret")
+	assert.Contains(t, err.Error(), "jwt_public_key_file: no public key found", "Expected a PEM file")
+
+	_, err = Load(nil, env(nil))
+	assert.Contains(t, err.Error(), "auth_enabled: requires", "Expected the authentication to be enabled by default")
+	_, err = Load([]string{"-auth-enabled", "false"}, env(nil))
+	assert.Contains(t, err.Error(), "auth_enabled: must be true, unless auth_insecure_dev is set",
+		"Expected the authentication to be disabled only for local development")
+}
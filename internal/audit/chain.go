@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"GuestList/internal/model"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// GenesisHash is the previous hash of the first entry of the chain
+var GenesisHash = strings.Repeat("0", 64)
+
+// VerifyPageSize is the number of entries read at once by the verification
+const VerifyPageSize = 500
+
+// Reasons of a break of the chain
+const (
+	BreakAltered   = "ENTRY_ALTERED"   // the hash of the entry does not match its content
+	BreakLinked    = "CHAIN_BROKEN"    // the entry is not chained to the entry before it
+	BreakUnchained = "ENTRY_UNCHAINED" // the entry has no hash although the entries before have one
+	BreakTruncated = "CHAIN_TRUNCATED" // the last entries of the chain are missing
+)
+
+// Log is the audit log as read by the verification
+type Log interface {
+	ListAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, int, error)
+	GetAuditChainHead(ctx context.Context) (string, error)
+}
+
+// content is the part of an entry covered by its hash, in a fixed order
+type content struct {
+	PrevHash      string  `json:"prev_hash"`
+	OccurredAt    string  `json:"occurred_at"`
+	Actor         string  `json:"actor"`
+	Role          string  `json:"role"`
+	Action        string  `json:"action"`
+	Subject       string  `json:"subject"`
+	Before        *string `json:"before"`
+	After         *string `json:"after"`
+	SourceIP      string  `json:"source_ip"`
+	CorrelationId string  `json:"correlation_id"`
+}
+
+/* This function computes the hash of an entry chained to the entry before it. The ID is not covered as it is
+assigned by the database, the order of the entries is kept by the chain itself.
+Arguments:
+	prevHash string - hash of the entry before, GenesisHash for the first entry
+	entry *model.AuditEntry - entry, the time is covered with the microseconds stored by the database
+Return:
+	string - hex encoded SHA-256
+*/
+func Hash(prevHash string, entry *model.AuditEntry) string {
+	data, _ := json.Marshal(content{PrevHash: prevHash,
+		OccurredAt: entry.OccurredAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano), Actor: entry.Actor,
+		Role: entry.Role, Action: entry.Action, Subject: entry.Subject, Before: record(entry.Before),
+		After: record(entry.After), SourceIP: entry.SourceIP, CorrelationId: entry.CorrelationId})
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// Returns the record as text, so that it is hashed as stored rather than re-encoded
+func record(value json.RawMessage) *string {
+	if value == nil {
+		return nil
+	}
+	text := string(value)
+	return &text
+}
+
+/* This function verifies the chain of the audit log and reports the first break. The entries appended before the
+chain was introduced have no hash and are only accepted before the first chained entry. The head of the chain is
+read first, so that the entries appended during the verification do not break it.
+Arguments:
+	ctx context.Context - context of the request
+	log Log - audit log
+	pageSize int - number of entries read at once
+Return:
+	*model.AuditVerification - result of the verification
+	error - any error that occurred reading the audit log
+*/
+func Verify(ctx context.Context, log Log, pageSize int) (*model.AuditVerification, error) {
+	head, err := log.GetAuditChainHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &model.AuditVerification{Intact: true, HeadHash: head}
+	prevHash, chained, headSeen := GenesisHash, false, head == GenesisHash
+	broken := func(entry model.AuditEntry, reason string, detail string) {
+		result.Intact = false
+		result.FirstBreak = &model.AuditBreak{EntryId: entry.Id, Reason: reason, Detail: detail}
+	}
+
+	filter := model.AuditFilter{Limit: pageSize}
+	var last model.AuditEntry
+	for {
+		entries, _, err := log.ListAuditEntries(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			last = entry
+			switch {
+			case entry.Hash == "" && !chained:
+				result.Unchained++
+				continue
+			case entry.Hash == "":
+				broken(entry, BreakUnchained, "the entry has no hash although the entries before have one")
+			case entry.PrevHash != prevHash:
+				broken(entry, BreakLinked, "an entry before was deleted or inserted, or the entries were reordered")
+			case Hash(entry.PrevHash, &entry) != entry.Hash:
+				broken(entry, BreakAltered, "the entry was changed after it was appended")
+			}
+			if !result.Intact {
+				return result, nil
+			}
+			result.Verified++
+			prevHash, chained = entry.Hash, true
+			headSeen = headSeen || entry.Hash == head
+		}
+		if len(entries) < pageSize {
+			break
+		}
+		filter.Offset += len(entries)
+	}
+	if !headSeen {
+		broken(last, BreakTruncated, "the last entries of the chain were deleted")
+	}
+	return result, nil
+}
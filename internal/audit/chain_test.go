@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"GuestList/internal/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// memoryLog is an audit log held in memory
+type memoryLog struct {
+	entries []model.AuditEntry
+	head    string
+	err     error
+}
+
+func (m *memoryLog) ListAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, int, error) {
+	if m.err != nil {
+		return nil, 0, m.err
+	}
+	entries := []model.AuditEntry{}
+	for i := filter.Offset; i < len(m.entries) && len(entries) < filter.Limit; i++ {
+		entries = append(entries, m.entries[i])
+	}
+	return entries, len(m.entries), nil
+}
+
+func (m *memoryLog) GetAuditChainHead(ctx context.Context) (string, error) {
+	return m.head, m.err
+}
+
+// Returns a log of chained entries after the unchained ones, as appended by the store
+func newChainedLog(unchained int, chained int) *memoryLog {
+	log := &memoryLog{head: GenesisHash}
+	occurred := time.Date(2020, 12, 31, 20, 0, 0, 123456789, time.UTC)
+	for i := 0; i < unchained+chained; i++ {
+		entry := model.AuditEntry{Id: int64(i + 1), OccurredAt: occurred.Add(time.Duration(i) * time.Minute),
+			Actor: "alice", Role: "organizer", Action: "GUEST_ADDED", Subject: fmt.Sprintf("Guest %d", i),
+			After: json.RawMessage(fmt.Sprintf(`{"table":%d}`, i))}
+		if i >= unchained {
+			entry.PrevHash = log.head
+			entry.Hash = Hash(log.head, &entry)
+			log.head = entry.Hash
+		}
+		log.entries = append(log.entries, entry)
+	}
+	return log
+}
+
+// Test that an untouched chain verifies over several pages, after the entries appended before the chain
+func TestVerifyIntact(t *testing.T) {
+	log := newChainedLog(2, 5)
+	result, err := Verify(context.Background(), log, 2)
+	assert.Nil(t, err, "Expected no error")
+	assert.True(t, result.Intact, "Expected an intact chain")
+	assert.Nil(t, result.FirstBreak, "Expected no break")
+	assert.Equal(t, 5, result.Verified, "Expected every chained entry to be verified")
+	assert.Equal(t, 2, result.Unchained, "Expected the entries appended before the chain")
+	assert.Equal(t, log.head, result.HeadHash, "Expected the head of the chain")
+
+	result, err = Verify(context.Background(), &memoryLog{head: GenesisHash}, 2)
+	assert.Nil(t, err, "Expected no error")
+	assert.True(t, result.Intact, "Expected an empty log to be intact")
+}
+
+// Test that the first altered, reordered or deleted entry is reported
+func TestVerifyBreaks(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(log *memoryLog)
+		entryId int64
+		reason  string
+	}{
+		{"altered record", func(log *memoryLog) { log.entries[3].After = json.RawMessage(`{"table":9}`) }, 4,
+			BreakAltered},
+		{"altered time", func(log *memoryLog) { log.entries[1].OccurredAt = log.entries[1].OccurredAt.Add(time.Second) },
+			2, BreakAltered},
+		{"rehashed entry", func(log *memoryLog) {
+			log.entries[2].Subject = "Someone Else"
+			log.entries[2].Hash = Hash(log.entries[2].PrevHash, &log.entries[2])
+		}, 4, BreakLinked},
+		{"reordered", func(log *memoryLog) { log.entries[1], log.entries[2] = log.entries[2], log.entries[1] }, 3,
+			BreakLinked},
+		{"deleted entry", func(log *memoryLog) { log.entries = append(log.entries[:2], log.entries[3:]...) }, 4,
+			BreakLinked},
+		{"deleted first entry", func(log *memoryLog) { log.entries = log.entries[1:] }, 2, BreakLinked},
+		{"deleted last entry", func(log *memoryLog) { log.entries = log.entries[:4] }, 4, BreakTruncated},
+		{"removed hash", func(log *memoryLog) { log.entries[3].Hash, log.entries[3].PrevHash = "", "" }, 4,
+			BreakUnchained},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log := newChainedLog(0, 5)
+			test.tamper(log)
+			result, err := Verify(context.Background(), log, 2)
+			assert.Nil(t, err, "Expected no error")
+			assert.False(t, result.Intact, "Expected a broken chain")
+			if assert.NotNil(t, result.FirstBreak, "Expected the first break") {
+				assert.Equal(t, test.entryId, result.FirstBreak.EntryId, "Expected the first entry which does not verify")
+				assert.Equal(t, test.reason, result.FirstBreak.Reason, "Expected the reason of the break")
+			}
+		})
+	}
+}
+
+// Test that a failure reading the audit log is returned rather than reported as break
+func TestVerifyError(t *testing.T) {
+	_, err := Verify(context.Background(), &memoryLog{err: errors.New("connection reset")}, 2)
+	assert.NotNil(t, err, "Expected the error of the audit log")
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// Roles of the principals
+const (
+	RoleAdmin     = "admin"     // manages the API keys and may call every route
+	RoleOrganizer = "organizer" // prepares the guest list and the invitations before the party
+	RoleDoor      = "door"      // checks the guests in and out at the door
+	RoleViewer    = "viewer"    // only reads
+)
+
+// Roles which can be given to an API key or claimed by a token
+var Roles = map[string]bool{RoleAdmin: true, RoleOrganizer: true, RoleDoor: true, RoleViewer: true}
+
+// Methods by which a principal is authenticated
+const (
+	MethodAPIKey = "api_key" // static API key
+	MethodJWT    = "jwt"     // JWT bearer token
+	MethodNone   = "none"    // authentication is disabled
+)
+
+// Prefix of the API keys, which tells them apart from the JWTs in the Authorization header
+const APIKeyPrefix = "gl_"
+
+/* This function generates a new API key. Only the hash of the key is stored, the key itself is shown once to the
+administrator who created it.
+Return:
+	string - API key
+	string - hash of the API key
+	error - any error that occurred
+*/
+func GenerateAPIKey() (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, HashAPIKey(key), nil
+}
+
+/* This function hashes an API key. The keys are random and long, so a plain SHA-256 cannot be reversed and the key
+can be looked up by its hash.
+Arguments:
+	key string - API key
+Return:
+	string - hex encoded SHA-256 of the key
+*/
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// IsAPIKey reports whether the credential looks like an API key rather than a JWT
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// IsKeyHash reports whether the value is a hex encoded SHA-256 as returned by HashAPIKey
+func IsKeyHash(value string) bool {
+	decoded, err := hex.DecodeString(value)
+	return err == nil && len(decoded) == sha256.Size && value == strings.ToLower(value)
+}
@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Test generating and hashing the API keys
+func TestGenerateAPIKey(t *testing.T) {
+	key, hash, err := GenerateAPIKey()
+	assert.Nil(t, err, "Expected no error")
+	assert.True(t, IsAPIKey(key), "Expected the prefix of the API keys")
+	assert.Len(t, key, len(APIKeyPrefix)+43, "Expected 32 random bytes")
+	assert.Equal(t, HashAPIKey(key), hash, "Expected the hash of the key")
+	assert.True(t, IsKeyHash(hash), "Expected a SHA-256")
+
+	other, _, _ := GenerateAPIKey()
+	assert.NotEqual(t, key, other, "Expected random keys")
+	assert.False(t, IsAPIKey("eyJhbGciOiJIUzI1NiJ9.e30.c2ln"), "Expected a JWT not to be an API key")
+	assert.False(t, IsKeyHash("ABC"), "Expected an invalid hash")
+}
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for every token which cannot be trusted, the reason is wrapped
+var ErrInvalidToken = errors.New("invalid token")
+
+// Tolerated difference between the clock of the issuer and the clock of the service
+const clockSkew = 30 * time.Second
+
+// Claims are the claims of a JWT used by the service
+type Claims struct {
+	Subject   string   `json:"sub"`  // Name of the principal
+	Role      string   `json:"role"` // Role of the principal, RoleViewer if not given
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+// audience is the aud claim, which is either a single string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+// Verifier verifies the JWTs signed with the shared secret (HS256) or one of the public keys (RS256, ES256)
+type Verifier struct {
+	secret     []byte
+	publicKeys []crypto.PublicKey
+	issuer     string
+	audience   string
+	clock      func() time.Time
+}
+
+/* This function creates a verifier of the JWTs.
+Arguments:
+	secret []byte - shared secret of the HS256 tokens, HS256 is disabled if empty
+	publicKeys []crypto.PublicKey - RSA and ECDSA public keys of the RS256 and ES256 tokens
+	issuer string - required iss claim, not checked if empty
+	audience string - required aud claim, not checked if empty
+	clock func() time.Time - source of the current time
+Return:
+	*Verifier - verifier
+*/
+func NewVerifier(secret []byte, publicKeys []crypto.PublicKey, issuer string, audience string,
+	clock func() time.Time) *Verifier {
+	return &Verifier{secret: secret, publicKeys: publicKeys, issuer: issuer, audience: audience, clock: clock}
+}
+
+// Enabled reports whether any key is configured to verify the tokens
+func (v *Verifier) Enabled() bool {
+	return len(v.secret) > 0 || len(v.publicKeys) > 0
+}
+
+/* This function verifies the signature and the claims of a JWT. Only HS256, RS256 and ES256 are accepted, so that
+an unsigned token or a token signed with a public key as HMAC secret is rejected.
+Arguments:
+	token string - JWT in the compact serialization
+Return:
+	*Claims - verified claims
+	error - ErrInvalidToken wrapping the reason
+*/
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	if !v.verifySignature(header.Algorithm, parts[0]+"."+parts[1], signature) {
+		return nil, fmt.Errorf("%w: signature not verified with %q", ErrInvalidToken, header.Algorithm)
+	}
+
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	now := v.clock()
+	switch {
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	case claims.ExpiresAt == nil:
+		return nil, fmt.Errorf("%w: no expiry", ErrInvalidToken)
+	case now.Add(-clockSkew).After(unixTime(*claims.ExpiresAt)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case claims.NotBefore != nil && now.Add(clockSkew).Before(unixTime(*claims.NotBefore)):
+		return nil, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	case v.issuer != "" && claims.Issuer != v.issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	case v.audience != "" && !claims.Audience.contains(v.audience):
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	if claims.Role == "" {
+		claims.Role = RoleViewer
+	}
+	if !Roles[claims.Role] {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidToken, claims.Role)
+	}
+	return claims, nil
+}
+
+// Checks the signature of the signed part of the token with the keys of the algorithm
+func (v *Verifier) verifySignature(algorithm string, signed string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+	switch algorithm {
+	case "HS256":
+		if len(v.secret) == 0 {
+			return false
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signed))
+		return hmac.Equal(mac.Sum(nil), signature)
+	case "RS256":
+		for _, key := range v.publicKeys {
+			if rsaKey, ok := key.(*rsa.PublicKey); ok &&
+				rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature) == nil {
+				return true
+			}
+		}
+	case "ES256":
+		// The signature is the concatenation of r and s, 32 bytes each
+		if len(signature) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		for _, key := range v.publicKeys {
+			if ecKey, ok := key.(*ecdsa.PublicKey); ok && ecKey.Curve == elliptic.P256() &&
+				ecdsa.Verify(ecKey, digest[:], r, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/* This function parses the public keys verifying the RS256 and ES256 tokens.
+Arguments:
+	data []byte - PEM blocks of RSA or ECDSA public keys or certificates
+Return:
+	[]crypto.PublicKey - public keys
+	error - any error that occurred, e.g. if no key was found
+*/
+func ParsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		var key interface{}
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var certificate *x509.Certificate
+			if certificate, err = x509.ParseCertificate(block.Bytes); err == nil {
+				key = certificate.PublicKey
+			}
+		default:
+			return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			keys = append(keys, key)
+		default:
+			return nil, fmt.Errorf("unsupported public key %T", key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no public key found")
+	}
+	return keys, nil
+}
+
+// Decodes a base64url encoded JSON segment of the token
+func decodeSegment(segment string, value interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func (a audience) contains(value string) bool {
+	for _, item := range a {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
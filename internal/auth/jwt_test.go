@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// Fixed time of the test clock
+var testNow = time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+
+// Signs the claims with the algorithm, the key is a secret for HS256 or a private key otherwise
+func sign(t *testing.T, algorithm string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": algorithm, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	var err error
+	switch algorithm {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when signing the token", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Returns the claims of a valid token with the overrides
+func claims(overrides map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{"sub": "door-tablet-1", "role": "door", "iss": "guestlist-idp",
+		"aud": "guestlist", "exp": testNow.Add(time.Hour).Unix(), "nbf": testNow.Add(-time.Minute).Unix()}
+	for name, value := range overrides {
+		if value == nil {
+			delete(result, name)
+		} else {
+			result[name] = value
+		}
+	}
+	return result
+}
+
+// Test verifying the tokens signed with every supported algorithm
+func TestVerifyAlgorithms(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err, "Expected an RSA key")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err, "Expected an ECDSA key")
+	verifier := NewVerifier(secret, []crypto.PublicKey{&rsaKey.PublicKey, &ecKey.PublicKey}, "guestlist-idp",
+		"guestlist", func() time.Time { return testNow })
+
+	for algorithm, key := range map[string]interface{}{"HS256": secret, "RS256": rsaKey, "ES256": ecKey} {
+		verified, err := verifier.Verify(sign(t, algorithm, key, claims(nil)))
+		assert.Nil(t, err, "Expected the %s token to be verified", algorithm)
+		assert.Equal(t, "door-tablet-1", verified.Subject, "Expected the subject of the %s token", algorithm)
+		assert.Equal(t, RoleDoor, verified.Role, "Expected the role of the %s token", algorithm)
+	}
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	valid := sign(t, "HS256", secret, claims(nil))
+	for name, token := range map[string]string{
+		"wrong secret":     sign(t, "HS256", []byte("another secret"), claims(nil)),
+		"wrong key":        sign(t, "ES256", otherKey, claims(nil)),
+		"no signature":     valid[:len(valid)-43],
+		"changed claims":   valid[:40] + "x" + valid[41:],
+		"none algorithm":   base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + ".e30.",
+		"not a token":      "door-tablet-1",
+		"malformed claims": sign(t, "HS256", secret, nil)[:36] + ".bm90IGpzb24.c2ln",
+	} {
+		_, err := verifier.Verify(token)
+		assert.True(t, errors.Is(err, ErrInvalidToken), "Expected the token with %s to be rejected", name)
+	}
+}
+
+// Test the checks of the claims
+func TestVerifyClaims(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	verifier := NewVerifier(secret, nil, "guestlist-idp", "guestlist", func() time.Time { return testNow })
+
+	tests := []struct {
+		name      string
+		overrides map[string]interface{}
+		valid     bool
+	}{
+		{"valid", nil, true},
+		{"admin role", map[string]interface{}{"role": "admin"}, true},
+		{"default role", map[string]interface{}{"role": nil}, true},
+		{"audience in a list", map[string]interface{}{"aud": []string{"other", "guestlist"}}, true},
+		{"expired within the clock skew", map[string]interface{}{"exp": testNow.Add(-10 * time.Second).Unix()}, true},
+		{"expired", map[string]interface{}{"exp": testNow.Add(-time.Minute).Unix()}, false},
+		{"no expiry", map[string]interface{}{"exp": nil}, false},
+		{"not valid yet", map[string]interface{}{"nbf": testNow.Add(time.Minute).Unix()}, false},
+		{"no subject", map[string]interface{}{"sub": nil}, false},
+		{"unknown role", map[string]interface{}{"role": "owner"}, false},
+		{"other issuer", map[string]interface{}{"iss": "someone-else"}, false},
+		{"other audience", map[string]interface{}{"aud": "another-service"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := verifier.Verify(sign(t, "HS256", secret, claims(test.overrides)))
+			if test.valid {
+				assert.Nil(t, err, "Expected the token to be valid")
+			} else {
+				assert.True(t, errors.Is(err, ErrInvalidToken), "Expected the token to be rejected: %v", err)
+			}
+		})
+	}
+
+	verified, err := verifier.Verify(sign(t, "HS256", secret, claims(map[string]interface{}{"role": nil})))
+	assert.Nil(t, err, "Expected the token to be valid")
+	assert.Equal(t, RoleViewer, verified.Role, "Expected the least privileged role by default")
+
+	assert.False(t, NewVerifier(nil, nil, "", "", time.Now).Enabled(), "Expected no key to disable the tokens")
+	_, err = NewVerifier(nil, nil, "", "", time.Now).Verify(sign(t, "HS256", []byte{}, claims(nil)))
+	assert.True(t, errors.Is(err, ErrInvalidToken), "Expected HS256 to be disabled without a secret")
+}
+
+// Test parsing the PEM encoded public keys
+func TestParsePublicKeys(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pkix, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(
+		&rsaKey.PublicKey)}), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix})...)
+
+	keys, err := ParsePublicKeys(data)
+	assert.Nil(t, err, "Expected no error")
+	assert.Len(t, keys, 2, "Expected both keys")
+
+	_, err = ParsePublicKeys([]byte("not a key"))
+	assert.NotNil(t, err, "Expected an error without a key")
+	private := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	_, err = ParsePublicKeys(private)
+	assert.NotNil(t, err, "Expected a private key to be rejected")
+}
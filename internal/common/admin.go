@@ -0,0 +1,89 @@
+package common
+
+import (
+	"GuestList/internal/auth"
+	"GuestList/internal/logging"
+	"GuestList/internal/model"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// Names of the API keys: letters, digits, dots, dashes and underscores, at most as long as the column
+var apiKeyNamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+const maxAPIKeyNameLength = 100
+
+/*
+This function creates an API key with the given name and role. The key is only returned in this response, the
+service keeps the hash of the key.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) CreateAPIKey(resp http.ResponseWriter, req *http.Request) {
+	var name, role *string
+	errDecoder := decodeBody(req,
+		bodyField{name: "name", required: true, min: 1, max: maxAPIKeyNameLength, pattern: apiKeyNamePattern,
+			text: &name},
+		bodyField{name: "role", required: true, min: 1, max: 20, text: &role})
+	if errDecoder == nil && !auth.Roles[*role] {
+		errDecoder = &apiError{status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+			detail: "invalid fields: role", fields: []model.FieldError{{Field: "role", Code: FieldOutOfRange,
+				Message: "field must be one of the roles"}}}
+	}
+	if errDecoder != nil {
+		s.encodeError(resp, req, errDecoder)
+		return
+	}
+
+	key, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	apiKey := &model.APIKey{Name: *name, Role: *role, Hash: hash, CreatedAt: s.clock().UTC()}
+	if err := s.store.CreateAPIKey(req.Context(), apiKey); err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	logging.FromContext(req.Context()).Info("API key created", logging.Int("key_id", int(apiKey.Id)),
+		logging.String("role", apiKey.Role))
+	apiKey.Key = key
+	resp.Header().Set("Location", fmt.Sprintf("/admin/api_keys/%d", apiKey.Id))
+	encodeResponse(resp, apiKey, http.StatusCreated)
+}
+
+/*
+This function lists the API keys including the revoked keys, without the keys themselves.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) ListAPIKeys(resp http.ResponseWriter, req *http.Request) {
+	keys, err := s.store.ListAPIKeys(req.Context())
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	encodeResponse(resp, keys, http.StatusOK)
+}
+
+/*
+This function revokes the API key identified by the ID, the key is rejected from then on.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) RevokeAPIKey(resp http.ResponseWriter, req *http.Request) {
+	// The route only matches digits, an ID out of range is parsed as 0 which no key has
+	keyId, _ := strconv.ParseInt(mux.Vars(req)["id"], 10, 64)
+	if err := s.store.RevokeAPIKey(req.Context(), keyId, s.clock().UTC()); err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	logging.FromContext(req.Context()).Info("API key revoked", logging.Int("key_id", int(keyId)))
+	encodeResponse(resp, nil, http.StatusNoContent)
+}
@@ -0,0 +1,499 @@
+package common
+
+import (
+	"GuestList/internal/audit"
+	"GuestList/internal/databse"
+	"GuestList/internal/logging"
+	"GuestList/internal/model"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditGuestAdded     = "GUEST_ADDED"
+	AuditGuestRemoved   = "GUEST_REMOVED"
+	AuditGuestArrived   = "GUEST_ARRIVED"
+	AuditGuestDeparted  = "GUEST_DEPARTED"
+	AuditGuestAnswered  = "GUEST_RSVP_CHANGED"
+	AuditAPIKeyCreated  = "API_KEY_CREATED"
+	AuditAPIKeyRevoked  = "API_KEY_REVOKED"
+	AuditEventCreated   = "EVENT_CREATED"
+	AuditEventUpdated   = "EVENT_UPDATED"
+	AuditEventCloned    = "EVENT_CLONED"
+	AuditPhaseChanged   = "EVENT_PHASE_CHANGED"
+	AuditEventClosed    = "EVENT_CLOSED"
+	AuditNoShowsMarked  = "NO_SHOWS_MARKED"
+	AuditTableSaved     = "TABLE_SAVED"
+	AuditTableDeleted   = "TABLE_DELETED"
+	auditSystemActor    = "system" // actor of the changes made without a principal
+	auditExportPageSize = 500      // entries read at once for the CSV export
+)
+
+// Actions the audit log can be filtered by
+var auditActions = map[string]bool{AuditGuestAdded: true, AuditGuestRemoved: true, AuditGuestArrived: true,
+	AuditGuestDeparted: true, AuditGuestAnswered: true, AuditAPIKeyCreated: true, AuditAPIKeyRevoked: true,
+	AuditEventCreated: true, AuditEventUpdated: true, AuditEventCloned: true, AuditPhaseChanged: true,
+	AuditEventClosed: true, AuditNoShowsMarked: true, AuditTableSaved: true, AuditTableDeleted: true}
+
+// Columns of the CSV export of the audit log
+var auditCSVHeader = []string{"id", "occurred_at", "actor", "role", "action", "subject", "before", "after",
+	"source_ip", "correlation_id", "prev_hash", "hash"}
+
+// auditedStore appends an entry to the audit log for every change of the events, their tables and guest lists, and
+// the API keys. The record is read before and after the change, so that the audit log tells what was changed.
+type auditedStore struct {
+	databse.Store
+	clock func() time.Time
+}
+
+// auditSnapshot is a record read for the audit log, or the error which occurred reading it
+type auditSnapshot struct {
+	record json.RawMessage
+	err    error
+}
+
+/* This is a helper function to append an entry to the audit log once a change succeeded. A change which is not in
+the audit log must not pass unnoticed, so the request fails if the entry cannot be appended, although the change
+cannot be undone anymore. A record which could not be read is only logged.
+Arguments:
+	ctx context.Context - context of the request, carrying the principal and the correlation id
+	action string - change which was made
+	subject string - guest or API key which was changed
+	before auditSnapshot - record before the change, empty if it was created
+	after auditSnapshot - record after the change, empty if it was deleted
+Return:
+	error - any error that occurred appending the entry
+*/
+func (a *auditedStore) record(ctx context.Context, action string, subject string, before auditSnapshot,
+	after auditSnapshot) error {
+	logger := logging.FromContext(ctx).With(logging.String("action", action))
+	for _, snapshot := range []auditSnapshot{before, after} {
+		if snapshot.err != nil {
+			logger.Warn("record not read for the audit log", logging.SensitiveErr(snapshot.err))
+		}
+	}
+	entry := &model.AuditEntry{OccurredAt: a.clock().UTC(), Actor: auditSystemActor, Action: action,
+		Subject: subject, Before: before.record, After: after.record}
+	if principal := PrincipalFromContext(ctx); principal != nil {
+		entry.Actor, entry.Role, entry.SourceIP = principal.Subject, principal.Role, principal.SourceIP
+	}
+	if id, ok := ctx.Value(requestIdKey{}).(string); ok {
+		entry.CorrelationId = id
+	}
+	// The change is made, so the entry is appended even if the request has timed out meanwhile
+	if err := a.Store.AppendAuditEntry(detachedContext{ctx}, entry); err != nil {
+		return fmt.Errorf("audit entry %s not appended: %w", action, err)
+	}
+	return nil
+}
+
+// auditedGuest is the record of a guest in the audit log, which tells the event of the guest list
+type auditedGuest struct {
+	EventId int64 `json:"event_id"`
+	*model.GuestDetails
+}
+
+// auditedTable is the record of a table in the audit log
+type auditedTable struct {
+	EventId  int64 `json:"event_id"`
+	TableId  int   `json:"table_id"`
+	Capacity int   `json:"capacity"`
+}
+
+// auditedNoShows is the record of the guests of an event marked as no-shows in the audit log
+type auditedNoShows struct {
+	EventId int64 `json:"event_id"`
+	Marked  int   `json:"marked"`
+}
+
+// Reads the record of the guest for the audit log
+func (a *auditedStore) guestRecord(ctx context.Context, eventId int64, guestName string) auditSnapshot {
+	guest, err := a.Store.GetGuestDetails(ctx, eventId, guestName)
+	if err != nil {
+		return auditSnapshot{err: err}
+	}
+	return encodeSnapshot(auditedGuest{EventId: eventId, GuestDetails: guest})
+}
+
+// Reads the record of the event for the audit log, the name of the event is returned as well
+func (a *auditedStore) eventRecord(ctx context.Context, eventId int64) (auditSnapshot, string) {
+	event, err := a.Store.GetEvent(ctx, eventId)
+	if err != nil {
+		return auditSnapshot{err: err}, ""
+	}
+	return encodeSnapshot(event), event.Name
+}
+
+// Reads the record of the table for the audit log, which is empty if the event has no such table
+func (a *auditedStore) tableRecord(ctx context.Context, eventId int64, tableId int) auditSnapshot {
+	capacity, err := a.Store.GetTableCapacity(ctx, eventId, tableId)
+	if err == databse.ErrTableNotFound {
+		return auditSnapshot{}
+	}
+	if err != nil {
+		return auditSnapshot{err: err}
+	}
+	return encodeSnapshot(auditedTable{EventId: eventId, TableId: tableId, Capacity: capacity})
+}
+
+// Returns the subject of the audit log entries of a table
+func tableSubject(tableId int) string {
+	return "Table " + strconv.Itoa(tableId)
+}
+
+// Reads the API key with the ID for the audit log, the name of the key is returned as well
+func (a *auditedStore) apiKeyRecord(ctx context.Context, keyId int64) (auditSnapshot, string) {
+	keys, err := a.Store.ListAPIKeys(ctx)
+	if err != nil {
+		return auditSnapshot{err: err}, ""
+	}
+	for _, key := range keys {
+		if key.Id == keyId {
+			return encodeSnapshot(key), key.Name
+		}
+	}
+	return auditSnapshot{err: databse.ErrAPIKeyNotFound}, ""
+}
+
+// Encodes the record of the audit log as JSON
+func encodeSnapshot(value interface{}) auditSnapshot {
+	record, err := json.Marshal(value)
+	return auditSnapshot{record: record, err: err}
+}
+
+func (a *auditedStore) CreateEvent(ctx context.Context, event *model.Event) error {
+	if err := a.Store.CreateEvent(ctx, event); err != nil {
+		return err
+	}
+	after, _ := a.eventRecord(ctx, event.Id)
+	return a.record(ctx, AuditEventCreated, event.Name, auditSnapshot{}, after)
+}
+
+func (a *auditedStore) UpdateEvent(ctx context.Context, event *model.Event) error {
+	before, _ := a.eventRecord(ctx, event.Id)
+	if err := a.Store.UpdateEvent(ctx, event); err != nil {
+		return err
+	}
+	after, _ := a.eventRecord(ctx, event.Id)
+	return a.record(ctx, AuditEventUpdated, event.Name, before, after)
+}
+
+func (a *auditedStore) CloneEvent(ctx context.Context, clone *model.EventClone) error {
+	if err := a.Store.CloneEvent(ctx, clone); err != nil {
+		return err
+	}
+	// The clone is recorded as stored, the copied guests and tables are not audited one by one
+	return a.record(ctx, AuditEventCloned, clone.Event.Name, auditSnapshot{}, encodeSnapshot(clone))
+}
+
+func (a *auditedStore) UpdateEventPhase(ctx context.Context, eventId int64, from string, to string) error {
+	before, name := a.eventRecord(ctx, eventId)
+	if err := a.Store.UpdateEventPhase(ctx, eventId, from, to); err != nil {
+		return err
+	}
+	after, _ := a.eventRecord(ctx, eventId)
+	return a.record(ctx, AuditPhaseChanged, name, before, after)
+}
+
+func (a *auditedStore) CloseEvent(ctx context.Context, eventId int64, closedAt time.Time) (*model.EventSummary,
+	error) {
+	before, name := a.eventRecord(ctx, eventId)
+	summary, err := a.Store.CloseEvent(ctx, eventId, closedAt)
+	if err != nil {
+		return nil, err
+	}
+	// The guests checked out at the closing are counted in the summary instead of being audited one by one
+	if err = a.record(ctx, AuditEventClosed, name, before, encodeSnapshot(summary)); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+func (a *auditedStore) MarkNoShows(ctx context.Context, startedBefore time.Time) (map[int64]int, error) {
+	marked, err := a.Store.MarkNoShows(ctx, startedBefore)
+	if err != nil {
+		return nil, err
+	}
+	eventIds := make([]int64, 0, len(marked))
+	for eventId := range marked {
+		eventIds = append(eventIds, eventId)
+	}
+	sort.Slice(eventIds, func(i, j int) bool { return eventIds[i] < eventIds[j] })
+	// The marked guests are listed in the no-show report of their event instead of being audited one by one
+	for _, eventId := range eventIds {
+		before, name := a.eventRecord(ctx, eventId)
+		err = a.record(ctx, AuditNoShowsMarked, name, before, encodeSnapshot(auditedNoShows{EventId: eventId,
+			Marked: marked[eventId]}))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return marked, nil
+}
+
+func (a *auditedStore) SaveTable(ctx context.Context, eventId int64, tableId int, capacity int) (bool, error) {
+	before := a.tableRecord(ctx, eventId, tableId)
+	created, err := a.Store.SaveTable(ctx, eventId, tableId, capacity)
+	if err != nil {
+		return false, err
+	}
+	err = a.record(ctx, AuditTableSaved, tableSubject(tableId), before, a.tableRecord(ctx, eventId, tableId))
+	if err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+func (a *auditedStore) DeleteTable(ctx context.Context, eventId int64, tableId int) error {
+	before := a.tableRecord(ctx, eventId, tableId)
+	if err := a.Store.DeleteTable(ctx, eventId, tableId); err != nil {
+		return err
+	}
+	return a.record(ctx, AuditTableDeleted, tableSubject(tableId), before, auditSnapshot{})
+}
+
+func (a *auditedStore) AddGuestToList(ctx context.Context, eventId int64, guest *model.GuestsList) error {
+	if err := a.Store.AddGuestToList(ctx, eventId, guest); err != nil {
+		return err
+	}
+	return a.record(ctx, AuditGuestAdded, guest.Name, auditSnapshot{}, a.guestRecord(ctx, eventId, guest.Name))
+}
+
+func (a *auditedStore) DeleteGuestFromList(ctx context.Context, eventId int64, guestName string) error {
+	before := a.guestRecord(ctx, eventId, guestName)
+	if err := a.Store.DeleteGuestFromList(ctx, eventId, guestName); err != nil {
+		return err
+	}
+	return a.record(ctx, AuditGuestRemoved, guestName, before, auditSnapshot{})
+}
+
+func (a *auditedStore) UpdateGuestStatusToArrive(ctx context.Context, eventId int64, guest *model.GuestsList,
+	arrGuests int) error {
+	before := a.guestRecord(ctx, eventId, guest.Name)
+	if err := a.Store.UpdateGuestStatusToArrive(ctx, eventId, guest, arrGuests); err != nil {
+		return err
+	}
+	return a.record(ctx, AuditGuestArrived, guest.Name, before, a.guestRecord(ctx, eventId, guest.Name))
+}
+
+func (a *auditedStore) UpdateGuestStatusToDepart(ctx context.Context, eventId int64, guestName string) error {
+	before := a.guestRecord(ctx, eventId, guestName)
+	if err := a.Store.UpdateGuestStatusToDepart(ctx, eventId, guestName); err != nil {
+		return err
+	}
+	return a.record(ctx, AuditGuestDeparted, guestName, before, a.guestRecord(ctx, eventId, guestName))
+}
+
+func (a *auditedStore) UpdateGuestRSVP(ctx context.Context, eventId int64, guestName string, rsvpStatus string) error {
+	before := a.guestRecord(ctx, eventId, guestName)
+	if err := a.Store.UpdateGuestRSVP(ctx, eventId, guestName, rsvpStatus); err != nil {
+		return err
+	}
+	return a.record(ctx, AuditGuestAnswered, guestName, before, a.guestRecord(ctx, eventId, guestName))
+}
+
+func (a *auditedStore) CreateAPIKey(ctx context.Context, key *model.APIKey) error {
+	if err := a.Store.CreateAPIKey(ctx, key); err != nil {
+		return err
+	}
+	after, _ := a.apiKeyRecord(ctx, key.Id)
+	return a.record(ctx, AuditAPIKeyCreated, key.Name, auditSnapshot{}, after)
+}
+
+func (a *auditedStore) RevokeAPIKey(ctx context.Context, keyId int64, revokedAt time.Time) error {
+	before, name := a.apiKeyRecord(ctx, keyId)
+	if err := a.Store.RevokeAPIKey(ctx, keyId, revokedAt); err != nil {
+		return err
+	}
+	after, _ := a.apiKeyRecord(ctx, keyId)
+	return a.record(ctx, AuditAPIKeyRevoked, name, before, after)
+}
+
+/* This is a helper function to get the IP address the request was sent from. Proxies are not trusted, so the
+forwarding headers are ignored.
+Arguments:
+	req *http.Request - HTTP request to the REST API
+Return:
+	string - IP address of the peer
+*/
+func sourceIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+/* This is a helper function to decode the filter of the audit log from the query parameters.
+Arguments:
+	req *http.Request - HTTP request to the REST API
+Return:
+	model.AuditFilter - filter without the limit and the offset
+	error - *apiError describing the violations, or nil if the parameters are valid
+*/
+func decodeAuditFilter(req *http.Request) (model.AuditFilter, error) {
+	params := req.URL.Query()
+	filter := model.AuditFilter{Actor: params.Get("actor"), Action: params.Get("action"),
+		Subject: params.Get("subject")}
+	var violations []model.FieldError
+	if filter.Action != "" && !auditActions[filter.Action] {
+		violations = append(violations, model.FieldError{Field: "action", Code: FieldOutOfRange,
+			Message: "parameter must be one of the actions of the audit log"})
+	}
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if text := params.Get(bound.name); text != "" {
+			parsed, err := time.Parse(time.RFC3339, text)
+			if err != nil {
+				violations = append(violations, model.FieldError{Field: bound.name, Code: FieldInvalid,
+					Message: "parameter must be a RFC 3339 time"})
+				continue
+			}
+			*bound.value = parsed.UTC()
+		}
+	}
+
+	if len(violations) > 0 {
+		names := make([]string, len(violations))
+		for i, violation := range violations {
+			names[i] = violation.Field
+		}
+		return filter, &apiError{status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+			detail: "invalid parameters: " + strings.Join(names, ", "), fields: violations}
+	}
+	return filter, nil
+}
+
+/*
+This function lists the entries of the audit log matching the filter of the query parameters in a page envelope.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) ListAuditLog(resp http.ResponseWriter, req *http.Request) {
+	limit, offset, err := decodePage(req, s.config.DefaultLimit, s.config.DefaultOffset)
+	var filter model.AuditFilter
+	if err == nil {
+		filter, err = decodeAuditFilter(req)
+	}
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	filter.Limit, filter.Offset = limit, offset
+
+	entries, total, err := s.store.ListAuditEntries(req.Context(), filter)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	page := model.AuditPage{Items: entries, Page: model.Page{Limit: limit, Offset: offset, Total: total}}
+	if limit > 0 && offset+limit < total {
+		query := req.URL.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("offset", strconv.Itoa(offset+limit))
+		next := req.URL.Path + "?" + query.Encode()
+		page.Page.Next = &next
+	}
+	encodeResponse(resp, page, http.StatusOK)
+}
+
+/*
+This function exports the entries of the audit log matching the filter of the query parameters as CSV file. The
+entries are read page by page, so that a long log is not held in memory.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) ExportAuditLog(resp http.ResponseWriter, req *http.Request) {
+	filter, err := decodeAuditFilter(req)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	filter.Limit = auditExportPageSize
+	// The first page is read before the response is started, so that a failure is still reported as problem
+	entries, _, err := s.store.ListAuditEntries(req.Context(), filter)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	resp.Header().Set("Content-Disposition", "attachment; filename=audit_log.csv")
+	resp.WriteHeader(http.StatusOK)
+	writer := csv.NewWriter(resp)
+	writer.Write(auditCSVHeader)
+	for len(entries) > 0 {
+		for _, entry := range entries {
+			writer.Write(csvRow(entry))
+		}
+		if len(entries) < filter.Limit {
+			break
+		}
+		filter.Offset += len(entries)
+		if entries, _, err = s.store.ListAuditEntries(req.Context(), filter); err != nil {
+			// The status is already sent, the truncated file is only reported in the log
+			logging.FromContext(req.Context()).Error("audit log export truncated", logging.Err(err))
+			break
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		logging.FromContext(req.Context()).Warn("writing the audit log export failed", logging.Err(err))
+	}
+}
+
+/*
+This function verifies the hash chain of the audit log. A broken chain is a result rather than an error, so the
+response tells the first entry which was altered, reordered or deleted.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) VerifyAuditLog(resp http.ResponseWriter, req *http.Request) {
+	result, err := audit.Verify(req.Context(), s.store, audit.VerifyPageSize)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	if !result.Intact {
+		logging.FromContext(req.Context()).Error("audit log chain broken",
+			logging.Int("entry_id", int(result.FirstBreak.EntryId)), logging.String("reason", result.FirstBreak.Reason))
+	}
+	encodeResponse(resp, result, http.StatusOK)
+}
+
+// Returns the row of the entry in the CSV export
+func csvRow(entry model.AuditEntry) []string {
+	return []string{strconv.FormatInt(entry.Id, 10), entry.OccurredAt.UTC().Format(time.RFC3339Nano),
+		csvCell(entry.Actor), entry.Role, entry.Action, csvCell(entry.Subject), csvRecord(entry.Before),
+		csvRecord(entry.After), entry.SourceIP, csvCell(entry.CorrelationId), entry.PrevHash, entry.Hash}
+}
+
+// Returns the record as cell of the CSV export, empty if there is no record
+func csvRecord(record json.RawMessage) string {
+	if record == nil {
+		return ""
+	}
+	return string(record)
+}
+
+// Escapes the values given by the clients which a spreadsheet would run as formula
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
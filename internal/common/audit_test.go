@@ -0,0 +1,234 @@
+package common
+
+import (
+	"GuestList/internal/model"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns the bearer token of a principal with the role
+func bearer(subject string, role string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + signHS256(fmt.Sprintf(`{"sub":"%s","role":"%s","exp":%d}`,
+		subject, role, testNow.Add(time.Hour).Unix()))}
+}
+
+// Returns the value of the field of the record of an audit entry
+func recordField(t *testing.T, record json.RawMessage, field string) interface{} {
+	var values map[string]interface{}
+	assert.Nil(t, json.Unmarshal(record, &values), "Expected a JSON record")
+	return values[field]
+}
+
+// Test that every change is audited with the principal, the records before and after, the source and the request
+func TestAuditTrail(t *testing.T) {
+	store := newPartyStore()
+	s := newAuthServer(store)
+	organizer, door := bearer("alice", "organizer"), bearer("door-tablet-1", "door")
+	organizer[CorrelationIdHeader] = "add-john"
+
+	resp := serveWithHeaders(s, "POST", "/v2/guests", `{"name": "John Smith", "table": 4}`, organizer)
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	resp = serveWithHeaders(s, "PUT", "/guests/Mary+Queen", `{"accompanying_guests": 1}`, door)
+	assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	resp = serveWithHeaders(s, "DELETE", "/v1/guests/Brad+Pitt", "", door)
+	assert.Equal(t, http.StatusNoContent, resp.Code, resp.Body.String())
+	// The guests are only removed while planning, the phase is changed behind the back of the audit log
+	store.event(defaultEventId).Phase = PhasePlanning
+	resp = serveWithHeaders(s, "DELETE", "/v1/guest_list/John+Smith", "", organizer)
+	assert.Equal(t, http.StatusNoContent, resp.Code, resp.Body.String())
+	// Rejected changes are not audited
+	resp = serveWithHeaders(s, "DELETE", "/v1/guest_list/John+Smith", "", organizer)
+	assert.Equal(t, http.StatusNotFound, resp.Code, resp.Body.String())
+
+	admin := map[string]string{APIKeyHeader: testAdminKey}
+	resp = serveWithHeaders(s, "POST", "/admin/api_keys", `{"name": "door-tablet-2", "role": "door"}`, admin)
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	resp = serveWithHeaders(s, "DELETE", "/admin/api_keys/1", "", admin)
+	assert.Equal(t, http.StatusNoContent, resp.Code, resp.Body.String())
+
+	if !assert.Len(t, store.audit, 6, "Expected an entry for every change") {
+		return
+	}
+	var actions []string
+	for _, entry := range store.audit {
+		actions = append(actions, entry.Action)
+		assert.Equal(t, "192.0.2.1", entry.SourceIP, "Expected the address of the client")
+		assert.Equal(t, testNow, entry.OccurredAt, "Expected the time of the change")
+	}
+	assert.Equal(t, []string{AuditGuestAdded, AuditGuestArrived, AuditGuestDeparted, AuditGuestRemoved,
+		AuditAPIKeyCreated, AuditAPIKeyRevoked}, actions, "Expected the changes in order")
+
+	added := store.audit[0]
+	assert.Equal(t, "alice", added.Actor, "Expected the principal who added the guest")
+	assert.Equal(t, "organizer", added.Role, "Expected the role of the principal")
+	assert.Equal(t, "John Smith", added.Subject, "Expected the guest added")
+	assert.Equal(t, "add-john", added.CorrelationId, "Expected the correlation id of the request")
+	assert.Nil(t, added.Before, "Expected no record before the guest was added")
+	assert.Equal(t, "NOT_ARRIVED", recordField(t, added.After, "status"), "Expected the added guest")
+
+	arrived := store.audit[1]
+	assert.Equal(t, "door-tablet-1", arrived.Actor, "Expected the door staff who let the guest in")
+	assert.Equal(t, "NOT_ARRIVED", recordField(t, arrived.Before, "status"), "Expected the guest before the arrival")
+	assert.Equal(t, "ARRIVED", recordField(t, arrived.After, "status"), "Expected the guest after the arrival")
+
+	removed := store.audit[3]
+	assert.Equal(t, "John Smith", recordField(t, removed.Before, "name"), "Expected the removed guest")
+	assert.Nil(t, removed.After, "Expected no record after the guest was removed")
+
+	revoked := store.audit[5]
+	assert.Equal(t, "door-tablet-2", revoked.Subject, "Expected the name of the revoked key")
+	assert.Nil(t, recordField(t, revoked.Before, "revoked_at"), "Expected the key before the revocation")
+	assert.NotNil(t, recordField(t, revoked.After, "revoked_at"), "Expected the key after the revocation")
+	assert.NotContains(t, string(store.audit[4].After), "key_hash", "Expected the hash not to be audited")
+}
+
+// Test that the actor and the correlation id given by the client fit in the columns of the audit log
+func TestAuditUntrustedHeaders(t *testing.T) {
+	store := newPartyStore()
+	store.event(defaultEventId).Phase = PhasePlanning
+	s := newAuthServer(store)
+	headers := bearer(strings.Repeat("a", 300), "organizer")
+	headers[CorrelationIdHeader] = strings.Repeat("c", 300)
+
+	resp := serveWithHeaders(s, "DELETE", "/v1/guest_list/Mary+Queen", "", headers)
+	assert.Equal(t, http.StatusNoContent, resp.Code, resp.Body.String())
+	if !assert.Len(t, store.audit, 1, "Expected the removal to be audited") {
+		return
+	}
+	entry := store.audit[0]
+	assert.Len(t, entry.Actor, 100, "Expected the actor to be cut")
+	assert.True(t, strings.HasPrefix(entry.Actor, strings.Repeat("a", 83)+"~"), "Expected the hash of the subject")
+	assert.NotEqual(t, tokenSubject(strings.Repeat("a", 301)), entry.Actor, "Expected the subjects to be told apart")
+	assert.Len(t, entry.CorrelationId, 32, "Expected a generated correlation id")
+	assert.Equal(t, entry.CorrelationId, resp.Header().Get(CorrelationIdHeader), "Expected the generated id")
+}
+
+// failingAuditStore cannot append to the audit log
+type failingAuditStore struct {
+	*fakeStore
+}
+
+func (f *failingAuditStore) AppendAuditEntry(ctx context.Context, entry *model.AuditEntry) error {
+	return errors.New("connection reset")
+}
+
+// Test that a change which cannot be audited is reported as failed, although it is made
+func TestAuditFailure(t *testing.T) {
+	store := newPartyStore()
+	store.event(defaultEventId).Phase = PhasePlanning
+	s := newTestServer(&failingAuditStore{store})
+
+	resp := serve(s, "DELETE", "/v1/guest_list/Mary+Queen", "")
+	assert.Equal(t, http.StatusInternalServerError, resp.Code, "Expected the missing audit entry to fail the request")
+	assert.Equal(t, CodeInternalError, problemCode(t, resp), "Expected the missing audit entry to fail the request")
+	assert.Nil(t, store.guest(defaultEventId, "Mary Queen"), "Expected the guest to be removed")
+}
+
+// Test querying the audit log with the filters and the pages
+func TestListAuditLog(t *testing.T) {
+	store := newPartyStore()
+	s := newAuthServer(store)
+	for i, actor := range []string{"alice", "bob", "alice", "alice"} {
+		store.audit = append(store.audit, model.AuditEntry{Id: int64(i + 1), Actor: actor, Action: AuditGuestAdded,
+			Subject: fmt.Sprintf("Guest %d", i), OccurredAt: testNow.Add(time.Duration(i) * time.Hour)})
+	}
+	admin := map[string]string{APIKeyHeader: testAdminKey}
+
+	resp := serveWithHeaders(s, "GET", "/admin/audit_log?actor=alice&from=2020-12-31T21:00:00Z&limit=1", "", admin)
+	assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var page model.AuditPage
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &page), "Expected a page of the audit log")
+	assert.Equal(t, 2, page.Page.Total, "Expected the entries of alice from the second hour")
+	if assert.Len(t, page.Items, 1, "Expected the limit") {
+		assert.Equal(t, "Guest 2", page.Items[0].Subject, "Expected the first matching entry")
+	}
+	if assert.NotNil(t, page.Page.Next, "Expected the next page") {
+		assert.Equal(t, "/admin/audit_log?actor=alice&from=2020-12-31T21%3A00%3A00Z&limit=1&offset=1", *page.Page.Next,
+			"Expected the filters in the next page")
+	}
+
+	resp = serveWithHeaders(s, "GET", "/admin/audit_log?action=GUEST_INVITED&to=tomorrow", "", admin)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code, "Expected the filters to be validated")
+	var problem model.Problem
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &problem), "Expected problem details")
+	assert.Len(t, problem.Errors, 2, "Expected every invalid filter")
+
+	resp = serveWithHeaders(s, "GET", "/admin/audit_log", "", bearer("carol", "organizer"))
+	assert.Equal(t, http.StatusForbidden, resp.Code, "Expected the audit log to be only read by administrators")
+}
+
+// Test exporting the audit log as CSV file over several pages
+func TestExportAuditLog(t *testing.T) {
+	store := newPartyStore()
+	s := newAuthServer(store)
+	for i := 0; i < auditExportPageSize+2; i++ {
+		store.audit = append(store.audit, model.AuditEntry{Id: int64(i + 1), Actor: "alice", Action: AuditGuestRemoved,
+			Subject: "Mary Queen", Before: json.RawMessage(`{"name":"Mary Queen"}`), OccurredAt: testNow})
+	}
+	store.audit = append(store.audit, model.AuditEntry{Id: int64(len(store.audit) + 1), Actor: "=HYPERLINK(1)",
+		Action: AuditGuestAdded, Subject: "John Smith", After: json.RawMessage(`{"name":"John Smith"}`),
+		OccurredAt: testNow})
+
+	resp := serveWithHeaders(s, "GET", "/admin/audit_log/export", "", map[string]string{APIKeyHeader: testAdminKey})
+	assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header().Get("Content-Type"), "Expected a CSV file")
+	assert.Contains(t, resp.Header().Get("Content-Disposition"), "audit_log.csv", "Expected an attachment")
+
+	rows, err := csv.NewReader(strings.NewReader(resp.Body.String())).ReadAll()
+	assert.Nil(t, err, "Expected a valid CSV file")
+	if !assert.Len(t, rows, auditExportPageSize+4, "Expected the header and every entry") {
+		return
+	}
+	assert.Equal(t, auditCSVHeader, rows[0], "Expected the header")
+	assert.Equal(t, []string{"1", "2020-12-31T20:00:00Z", "alice", "", AuditGuestRemoved, "Mary Queen",
+		`{"name":"Mary Queen"}`, "", "", "", "", ""}, rows[1], "Expected the first entry")
+	last := rows[len(rows)-1]
+	assert.Equal(t, "'=HYPERLINK(1)", last[2], "Expected a formula to be escaped")
+
+	resp = serveWithHeaders(s, "GET", "/admin/audit_log/export?actor=bob", "",
+		map[string]string{APIKeyHeader: testAdminKey})
+	assert.Equal(t, "id,occurred_at,actor,role,action,subject,before,after,source_ip,correlation_id,prev_hash,hash\n",
+		resp.Body.String(), "Expected only the header without a matching entry")
+}
+
+// Test that the verification tells whether the audit log was tampered with
+func TestVerifyAuditLog(t *testing.T) {
+	store := newPartyStore()
+	store.event(defaultEventId).Phase = PhasePlanning
+	s := newAuthServer(store)
+	admin := map[string]string{APIKeyHeader: testAdminKey}
+	for _, name := range []string{"Mary+Queen", "Brad+Pitt"} {
+		resp := serveWithHeaders(s, "DELETE", "/v1/guest_list/"+name, "", admin)
+		assert.Equal(t, http.StatusNoContent, resp.Code, resp.Body.String())
+	}
+
+	resp := serveWithHeaders(s, "GET", "/admin/audit_log/verify", "", admin)
+	assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var result model.AuditVerification
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &result), "Expected the result of the verification")
+	assert.True(t, result.Intact, "Expected the chain of the appended entries to be intact")
+	assert.Equal(t, 2, result.Verified, "Expected every entry to be verified")
+	assert.Equal(t, store.audit[1].Hash, result.HeadHash, "Expected the hash of the last entry")
+
+	store.audit[0].Actor = "someone-else"
+	resp = serveWithHeaders(s, "GET", "/admin/audit_log/verify", "", admin)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected a broken chain to be a result")
+	result = model.AuditVerification{}
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &result), "Expected the result of the verification")
+	assert.False(t, result.Intact, "Expected the altered entry to be detected")
+	if assert.NotNil(t, result.FirstBreak, "Expected the first break") {
+		assert.Equal(t, int64(1), result.FirstBreak.EntryId, "Expected the altered entry")
+		assert.Equal(t, "ENTRY_ALTERED", result.FirstBreak.Reason, "Expected the reason of the break")
+	}
+
+	resp = serveWithHeaders(s, "GET", "/admin/audit_log/verify", "", bearer("alice", "organizer"))
+	assert.Equal(t, http.StatusForbidden, resp.Code, "Expected the verification to be only run by administrators")
+}
@@ -0,0 +1,183 @@
+package common
+
+import (
+	"GuestList/internal/auth"
+	"GuestList/internal/databse"
+	"GuestList/internal/logging"
+	"GuestList/internal/model"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Header carrying an API key, the key can also be given as bearer token in the Authorization header
+const APIKeyHeader = "X-API-Key"
+
+// Name of the administrator authenticated by the API key of the configuration
+const adminSubject = "admin"
+
+// Maximum length of the subject of a principal, the length of the actor columns
+const maxSubjectLength = 100
+
+// Key of the principal in the request context
+type principalKey struct{}
+
+// Errors reported by the authentication
+var (
+	errUnauthenticated = &apiError{status: http.StatusUnauthorized, code: CodeUnauthenticated,
+		detail: "an API key or a bearer token is required"}
+	errInvalidCredentials = &apiError{status: http.StatusUnauthorized, code: CodeUnauthenticated,
+		detail: "the API key or the bearer token is invalid"}
+	errForbidden = &apiError{status: http.StatusForbidden, code: CodeForbidden,
+		detail: "the principal is not allowed to call the route"}
+)
+
+/* This function creates the verifier of the JWTs from the configuration. The public keys were checked when the
+configuration was loaded, a file which cannot be read anymore only disables the RS256 and ES256 tokens.
+Return:
+	*auth.Verifier - verifier of the JWTs
+*/
+func (s *Server) newVerifier() *auth.Verifier {
+	var keys []crypto.PublicKey
+	if s.config.JWTPublicKeyFile != "" {
+		data, err := ioutil.ReadFile(s.config.JWTPublicKeyFile)
+		if err == nil {
+			keys, err = auth.ParsePublicKeys(data)
+		}
+		if err != nil {
+			s.logger.Error("public keys of the tokens not loaded", logging.Err(err))
+		}
+	}
+	return auth.NewVerifier([]byte(s.config.JWTSecret), keys, s.config.JWTIssuer, s.config.JWTAudience, s.clock)
+}
+
+/* This function returns the principal authenticated for the request.
+Arguments:
+	ctx context.Context - context of the request
+Return:
+	*model.Principal - principal, or nil outside of the authenticated routes
+*/
+func PrincipalFromContext(ctx context.Context) *model.Principal {
+	principal, _ := ctx.Value(principalKey{}).(*model.Principal)
+	return principal
+}
+
+/* This middleware authenticates the caller by an API key, given in the X-API-Key header or as bearer token, or by
+a JWT bearer token. The principal is stored in the request context and added to the log entries of the request.
+If the authentication is disabled, every caller is an anonymous administrator.
+*/
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		principal := &model.Principal{Subject: "anonymous", Role: auth.RoleAdmin, Method: auth.MethodNone}
+		if s.config.AuthEnabled {
+			var err error
+			if principal, err = s.principalFor(req); err != nil {
+				var apiErr *apiError
+				if errors.As(err, &apiErr) && apiErr.status == http.StatusUnauthorized {
+					resp.Header().Set("WWW-Authenticate", `Bearer realm="guestlist"`)
+				}
+				s.encodeError(resp, req, err)
+				return
+			}
+		}
+		principal.SourceIP = sourceIP(req)
+		req = withLogFields(req, logging.String("principal", principal.Subject))
+		next.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), principalKey{}, principal)))
+	})
+}
+
+/* This middleware only lets the administrators and the principals with one of the roles through.
+Arguments:
+	roles ...string - roles allowed to call the route besides the administrators
+*/
+func (s *Server) requireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			if principal := PrincipalFromContext(req.Context()); principal == nil || !hasRole(principal, roles) {
+				s.encodeError(resp, req, errForbidden)
+				return
+			}
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
+
+// Reports whether the principal is an administrator or has one of the roles
+func hasRole(principal *model.Principal, roles []string) bool {
+	if principal.Role == auth.RoleAdmin {
+		return true
+	}
+	for _, role := range roles {
+		if principal.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+/* This is a helper function to authenticate the credential of the request.
+Arguments:
+	req *http.Request - HTTP request to the REST API
+Return:
+	*model.Principal - authenticated principal
+	error - errUnauthenticated or errInvalidCredentials, or any other error that occurred
+*/
+func (s *Server) principalFor(req *http.Request) (*model.Principal, error) {
+	credential := req.Header.Get(APIKeyHeader)
+	if authorization := req.Header.Get("Authorization"); credential == "" && authorization != "" {
+		scheme := strings.SplitN(authorization, " ", 2)
+		if len(scheme) != 2 || !strings.EqualFold(scheme[0], "Bearer") {
+			return nil, errInvalidCredentials
+		}
+		credential = strings.TrimSpace(scheme[1])
+	}
+	if credential == "" {
+		return nil, errUnauthenticated
+	}
+
+	if !auth.IsAPIKey(credential) {
+		claims, err := s.verifier.Verify(credential)
+		if err != nil {
+			logging.FromContext(req.Context()).Debug("token rejected", logging.Err(err))
+			return nil, errInvalidCredentials
+		}
+		return &model.Principal{Subject: tokenSubject(claims.Subject), Role: claims.Role, Method: auth.MethodJWT}, nil
+	}
+
+	hash := auth.HashAPIKey(credential)
+	if s.config.AuthAdminKeyHash != "" &&
+		subtle.ConstantTimeCompare([]byte(hash), []byte(s.config.AuthAdminKeyHash)) == 1 {
+		return &model.Principal{Subject: adminSubject, Role: auth.RoleAdmin, Method: auth.MethodAPIKey}, nil
+	}
+	key, err := s.store.GetAPIKeyByHash(req.Context(), hash)
+	if errors.Is(err, databse.ErrAPIKeyNotFound) || (err == nil && key.RevokedAt != nil) {
+		return nil, errInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &model.Principal{Subject: key.Name, Role: key.Role, Method: auth.MethodAPIKey, KeyId: key.Id}, nil
+}
+
+/* This is a helper function to get the subject of a token as it is recorded as actor. A subject longer than the actor
+columns is cut and ended with a hash of the whole subject, so that two long subjects are still told apart.
+Arguments:
+	subject string - subject of the token
+Return:
+	string - subject of at most 100 characters
+*/
+func tokenSubject(subject string) string {
+	if utf8.RuneCountInString(subject) <= maxSubjectLength {
+		return subject
+	}
+	hash := sha256.Sum256([]byte(subject))
+	suffix := "~" + hex.EncodeToString(hash[:8])
+	return string([]rune(subject)[:maxSubjectLength-len(suffix)]) + suffix
+}
@@ -0,0 +1,192 @@
+package common
+
+import (
+	"GuestList/internal/auth"
+	"GuestList/internal/model"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testAdminKey  = "gl_bootstrap-admin-key-of-the-tests"
+	testJWTSecret = "a-shared-secret-of-at-least-32-bytes"
+)
+
+// Creates a server for the tests with the authentication enabled, the bootstrap admin key and the HS256 secret
+func newAuthServer(store *fakeStore) *Server {
+	s := newTestServer(store)
+	s.config.AuthEnabled = true
+	s.config.AuthAdminKeyHash = auth.HashAPIKey(testAdminKey)
+	s.config.JWTSecret = testJWTSecret
+	s.verifier = s.newVerifier()
+	return s
+}
+
+// Sends the request with the headers to the server and returns the recorded response
+func serveWithHeaders(s *Server, method string, path string, body string,
+	headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp := httptest.NewRecorder()
+	s.ServeHTTP(resp, req)
+	return resp
+}
+
+// Signs the claims as HS256 token with the secret of the tests
+func signHS256(claims string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(testJWTSecret))
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Test that the routes require a valid credential while the operational endpoints stay public
+func TestAuthenticate(t *testing.T) {
+	s := newAuthServer(newPartyStore())
+	expiry := testNow.Add(time.Hour).Unix()
+
+	resp := serve(s, "GET", "/v1/guest_list", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "Expected a credential to be required")
+	assert.Equal(t, CodeUnauthenticated, problemCode(t, resp))
+	assert.Contains(t, resp.Header().Get("WWW-Authenticate"), "Bearer", "Expected the challenge")
+
+	resp = serve(s, "GET", "/healthz", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the operational endpoints to be public")
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"admin key", map[string]string{APIKeyHeader: testAdminKey}, http.StatusOK},
+		{"admin key as bearer", map[string]string{"Authorization": "Bearer " + testAdminKey}, http.StatusOK},
+		{"unknown key", map[string]string{APIKeyHeader: "gl_unknown"}, http.StatusUnauthorized},
+		{"basic", map[string]string{"Authorization": "Basic YWRtaW46YWRtaW4="}, http.StatusUnauthorized},
+		{"token", map[string]string{"Authorization": "Bearer " +
+			signHS256(fmt.Sprintf(`{"sub":"door","exp":%d}`, expiry))}, http.StatusOK},
+		{"expired token", map[string]string{"Authorization": "Bearer " +
+			signHS256(fmt.Sprintf(`{"sub":"door","exp":%d}`, testNow.Add(-time.Hour).Unix()))},
+			http.StatusUnauthorized},
+		{"forged token", map[string]string{"Authorization": "Bearer " +
+			signHS256(fmt.Sprintf(`{"sub":"door","exp":%d}`, expiry)) + "x"}, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := serveWithHeaders(s, "GET", "/v1/guest_list", "", test.headers)
+			assert.Equal(t, test.status, resp.Code, resp.Body.String())
+		})
+	}
+}
+
+// Test the lifecycle of an API key: created by the administrator, used, listed and revoked
+func TestAPIKeys(t *testing.T) {
+	s := newAuthServer(newPartyStore())
+	admin := map[string]string{APIKeyHeader: testAdminKey}
+
+	resp := serveWithHeaders(s, "POST", "/admin/api_keys", `{"name": "door-tablet-1", "role": "organizer"}`, admin)
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	var created model.APIKey
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &created))
+	assert.True(t, auth.IsAPIKey(created.Key), "Expected the key in the response")
+	assert.Equal(t, fmt.Sprintf("/admin/api_keys/%d", created.Id), resp.Header().Get("Location"))
+	user := map[string]string{APIKeyHeader: created.Key}
+
+	resp = serveWithHeaders(s, "GET", "/v1/guest_list", "", user)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the key to be accepted")
+	resp = serveWithHeaders(s, "GET", "/admin/api_keys", "", user)
+	assert.Equal(t, http.StatusForbidden, resp.Code, "Expected the admin routes to be forbidden for organizers")
+	assert.Equal(t, CodeForbidden, problemCode(t, resp))
+
+	resp = serveWithHeaders(s, "GET", "/admin/api_keys", "", admin)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), created.Key, "Expected the keys not to be listed")
+
+	resp = serveWithHeaders(s, "DELETE", fmt.Sprintf("/admin/api_keys/%d", created.Id), "", admin)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	resp = serveWithHeaders(s, "GET", "/v1/guest_list", "", user)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code, "Expected the revoked key to be rejected")
+
+	resp = serveWithHeaders(s, "DELETE", "/admin/api_keys/99", "", admin)
+	assert.Equal(t, CodeAPIKeyNotFound, problemCode(t, resp))
+	resp = serveWithHeaders(s, "POST", "/admin/api_keys", `{"name": "door", "role": "owner"}`, admin)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code, "Expected an unknown role to be rejected")
+}
+
+// Test the boundaries of the roles: the organizers prepare the guest list, the door staff checks the guests in and
+// out, the viewers only read and the administrators may call every route
+func TestRoles(t *testing.T) {
+	routes := []struct {
+		method  string
+		path    string
+		body    string
+		allowed []string
+	}{
+		{"POST", "/v1/guest_list/John+Smith", `{"table": 4}`, []string{"organizer"}},
+		{"DELETE", "/v1/guest_list/Mary+Queen", "", []string{"organizer"}},
+		{"GET", "/v1/guest_list", "", []string{"organizer", "door", "viewer"}},
+		{"GET", "/v1/guest_list/Mary+Queen", "", []string{"organizer", "door", "viewer"}},
+		{"GET", "/v1/invitation/Mary+Queen", "", []string{"organizer", "viewer"}},
+		{"PUT", "/v1/guests/Mary+Queen", `{"accompanying_guests": 1}`, []string{"door"}},
+		{"DELETE", "/v1/guests/Brad+Pitt", "", []string{"door"}},
+		{"GET", "/v1/guests", "", []string{"organizer", "door", "viewer"}},
+		{"GET", "/v1/guests/Brad+Pitt", "", []string{"organizer", "door", "viewer"}},
+		{"GET", "/v1/seats_empty", "", []string{"organizer", "door", "viewer"}},
+		{"DELETE", "/guest_list/Mary+Queen", "", []string{"organizer"}},
+		{"PUT", "/guests/Mary+Queen", `{"accompanying_guests": 1}`, []string{"door"}},
+		{"POST", "/v2/guests", `{"name": "John Smith", "table": 4}`, []string{"organizer"}},
+		{"DELETE", "/v2/guests/1", "", []string{"organizer"}},
+		{"GET", "/v2/guests", "", []string{"organizer", "door", "viewer"}},
+		{"GET", "/v2/guests/1", "", []string{"organizer", "door", "viewer"}},
+		{"GET", "/v2/guests/1/invitation", "", []string{"organizer", "viewer"}},
+		{"PUT", "/v2/guests/1/arrival", `{"accompanying_guests": 1}`, []string{"door"}},
+		{"PUT", "/v2/guests/2/departure", "", []string{"door"}},
+		{"GET", "/v2/seats_empty", "", []string{"organizer", "door", "viewer"}},
+		{"GET", "/admin/api_keys", "", nil},
+		{"POST", "/admin/api_keys", `{"name": "door-tablet-1", "role": "door"}`, nil},
+	}
+	// The guests are only removed while planning, the doors of the party are open for the other routes
+	planning := map[string]bool{
+		"DELETE /v1/guest_list/Mary+Queen": true,
+		"DELETE /guest_list/Mary+Queen":    true,
+		"DELETE /v2/guests/1":              true,
+	}
+	for _, role := range []string{"admin", "organizer", "door", "viewer"} {
+		token := signHS256(fmt.Sprintf(`{"sub":"%s-1","role":"%s","exp":%d}`, role, role,
+			testNow.Add(time.Hour).Unix()))
+		for _, route := range routes {
+			allowed := role == "admin"
+			for _, other := range route.allowed {
+				allowed = allowed || other == role
+			}
+			t.Run(role+" "+route.method+" "+route.path, func(t *testing.T) {
+				// Every request gets a fresh party, so that the allowed requests succeed
+				store := newPartyStore()
+				if planning[route.method+" "+route.path] {
+					store.event(defaultEventId).Phase = PhasePlanning
+				}
+				s := newAuthServer(store)
+				resp := serveWithHeaders(s, route.method, route.path, route.body,
+					map[string]string{"Authorization": "Bearer " + token})
+				if allowed {
+					assert.Less(t, resp.Code, 300, "Expected the route to be allowed: %s", resp.Body.String())
+				} else {
+					assert.Equal(t, http.StatusForbidden, resp.Code, "Expected the route to be forbidden")
+					assert.Equal(t, CodeForbidden, problemCode(t, resp))
+				}
+			})
+		}
+	}
+}
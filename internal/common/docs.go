@@ -0,0 +1,45 @@
+package common
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+)
+
+// Files of the API documentation in the api_docs_dir directory
+const (
+	openAPIFile = "openapi.json"
+	docsFile    = "docs.html"
+)
+
+/*
+This function serves the OpenAPI document describing every route of the REST API.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) OpenAPI(resp http.ResponseWriter, req *http.Request) {
+	s.serveDocsFile(resp, req, openAPIFile, "application/json")
+}
+
+/*
+This function serves the documentation page, which renders the OpenAPI document in the browser.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) Docs(resp http.ResponseWriter, req *http.Request) {
+	s.serveDocsFile(resp, req, docsFile, "text/html; charset=utf-8")
+}
+
+// Writes a file of the API documentation, the files are read on every request like the templates
+func (s *Server) serveDocsFile(resp http.ResponseWriter, req *http.Request, name string, contentType string) {
+	content, err := ioutil.ReadFile(filepath.Join(s.config.APIDocsDir, name))
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	resp.Header().Set("Content-Type", contentType)
+	resp.WriteHeader(http.StatusOK)
+	_, _ = resp.Write(content)
+}
@@ -0,0 +1,446 @@
+package common
+
+import (
+	"GuestList/internal/logging"
+	"GuestList/internal/model"
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event the guest list and the tables of the first version were migrated to, it is served by the routes which do
+// not have an event in their path
+const defaultEventId int64 = 1
+
+// Maximum lengths of the name and the venue of an event, as long as their columns
+const (
+	maxEventNameLength  = 100
+	maxEventVenueLength = 200
+)
+
+// Statuses of the events
+var eventStatuses = map[string]bool{"ACTIVE": true, "CANCELLED": true, "ARCHIVED": true}
+
+// eventKey is the key of the event of the request in its context
+type eventKey struct{}
+
+/* This function returns a middleware to scope the request to an event. The event is the one of the path, which has
+to exist, or the default event for the routes without an event in their path. The ID of the event is added to the
+log entries of the request.
+Arguments:
+	phases ...string - phases of the event the request is allowed in, every phase if none is given
+Return:
+	func(http.Handler) http.Handler - middleware scoping the request
+*/
+func (s *Server) scopeEvent(phases ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			eventId := defaultEventId
+			id, scoped := mux.Vars(req)["event"]
+			if scoped {
+				// The route only matches digits, an ID out of range is parsed as 0 which no event has
+				eventId, _ = strconv.ParseInt(id, 10, 64)
+				req = withLogFields(req, logging.Event(eventId))
+			}
+			// The default event is only read if its phase has to be checked
+			if scoped || len(phases) > 0 {
+				event, err := s.store.GetEvent(req.Context(), eventId)
+				if err == nil && len(phases) > 0 && !inPhase(event.Phase, phases) {
+					err = errWrongPhase(event, phases)
+				}
+				if err != nil {
+					s.encodeError(resp, req, err)
+					return
+				}
+			}
+			next.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), eventKey{}, eventId)))
+		})
+	}
+}
+
+/* This function gets the event the request is scoped to.
+Arguments:
+	ctx context.Context - context of the request
+Return:
+	int64 - event ID, the default event if the request is not scoped
+*/
+func eventFromContext(ctx context.Context) int64 {
+	if eventId, ok := ctx.Value(eventKey{}).(int64); ok {
+		return eventId
+	}
+	return defaultEventId
+}
+
+/* This is a helper function to decode and validate the body of an event.
+Arguments:
+	req *http.Request - HTTP request to the REST API
+	event *model.Event - event whose fields are set from the body, the status is kept if the body has none
+Return:
+	error - *apiError describing the violations, or nil if the body is valid
+*/
+func decodeEvent(req *http.Request, event *model.Event) error {
+	var name, date, venue, status *string
+	errDecoder := decodeBody(req,
+		bodyField{name: "name", required: true, min: 1, max: maxEventNameLength, text: &name},
+		bodyField{name: "date", required: true, min: 1, max: math.MaxInt32, text: &date},
+		bodyField{name: "venue", min: 0, max: maxEventVenueLength, text: &venue},
+		bodyField{name: "status", min: 1, max: math.MaxInt32, text: &status})
+	if errDecoder != nil {
+		return errDecoder
+	}
+
+	var violations []model.FieldError
+	parsed, err := time.Parse(time.RFC3339, *date)
+	if err != nil {
+		violations = append(violations, model.FieldError{Field: "date", Code: FieldInvalid,
+			Message: "field must be a RFC 3339 time"})
+	}
+	if status != nil && !eventStatuses[*status] {
+		violations = append(violations, model.FieldError{Field: "status", Code: FieldOutOfRange,
+			Message: "field must be ACTIVE, CANCELLED or ARCHIVED"})
+	}
+	if len(violations) > 0 {
+		names := make([]string, len(violations))
+		for i, violation := range violations {
+			names[i] = violation.Field
+		}
+		return &apiError{status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+			detail: "invalid fields: " + strings.Join(names, ", "), fields: violations}
+	}
+
+	event.Name, event.Date, event.Venue = *name, parsed.UTC(), ""
+	if venue != nil {
+		event.Venue = *venue
+	}
+	if status != nil {
+		event.Status = *status
+	}
+	return nil
+}
+
+/*
+This function creates an event without any guest or table and responds with the event and its location.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) CreateEvent(resp http.ResponseWriter, req *http.Request) {
+	event := &model.Event{Status: "ACTIVE", Phase: PhasePlanning}
+	if err := decodeEvent(req, event); err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	if err := s.store.CreateEvent(req.Context(), event); err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	resp.Header().Set("Location", fmt.Sprintf("%s/%d", strings.TrimSuffix(req.URL.Path, "/"), event.Id))
+	encodeResponse(resp, event, http.StatusCreated)
+}
+
+/*
+This function lists the events by date, optionally only those with the given status, in a page envelope.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) ListEvents(resp http.ResponseWriter, req *http.Request) {
+	limit, offset, errPage := decodePage(req, s.config.DefaultLimit, s.config.DefaultOffset)
+	if errPage != nil {
+		s.encodeError(resp, req, errPage)
+		return
+	}
+	status := req.URL.Query().Get("status")
+	if status != "" && !eventStatuses[status] {
+		s.encodeError(resp, req, &apiError{status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+			detail: "invalid parameters: status", fields: []model.FieldError{{Field: "status",
+				Code: FieldOutOfRange, Message: "parameter must be ACTIVE, CANCELLED or ARCHIVED"}}})
+		return
+	}
+
+	events, total, err := s.store.ListEvents(req.Context(), status, limit, offset)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	page := model.EventPage{Items: events, Page: model.Page{Limit: limit, Offset: offset, Total: total}}
+	if limit > 0 && offset+limit < total {
+		query := url.Values{"limit": {strconv.Itoa(limit)}, "offset": {strconv.Itoa(offset + limit)}}
+		if status != "" {
+			query.Set("status", status)
+		}
+		next := req.URL.Path + "?" + query.Encode()
+		page.Page.Next = &next
+	}
+	encodeResponse(resp, page, http.StatusOK)
+}
+
+/*
+This function gets the event of the path.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) GetEventById(resp http.ResponseWriter, req *http.Request) {
+	event, err := s.store.GetEvent(req.Context(), eventFromContext(req.Context()))
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	encodeResponse(resp, event, http.StatusOK)
+}
+
+/*
+This function replaces the name, date, venue and status of the event of the path and responds with the event.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) UpdateEvent(resp http.ResponseWriter, req *http.Request) {
+	event, err := s.store.GetEvent(req.Context(), eventFromContext(req.Context()))
+	if err == nil {
+		err = decodeEvent(req, event)
+	}
+	if err == nil {
+		err = s.store.UpdateEvent(req.Context(), event)
+	}
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	encodeResponse(resp, event, http.StatusOK)
+}
+
+/*
+This function lists the tables of the event with the people seated at them in a page envelope.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) ListTables(resp http.ResponseWriter, req *http.Request) {
+	limit, offset, errPage := decodePage(req, s.config.DefaultLimit, s.config.DefaultOffset)
+	if errPage != nil {
+		s.encodeError(resp, req, errPage)
+		return
+	}
+	tables, total, err := s.store.ListTables(req.Context(), eventFromContext(req.Context()), limit, offset)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	page := model.TablePage{Items: tables, Page: model.Page{Limit: limit, Offset: offset, Total: total}}
+	if limit > 0 && offset+limit < total {
+		query := url.Values{"limit": {strconv.Itoa(limit)}, "offset": {strconv.Itoa(offset + limit)}}
+		next := req.URL.Path + "?" + query.Encode()
+		page.Page.Next = &next
+	}
+	encodeResponse(resp, page, http.StatusOK)
+}
+
+// Gets the table number of the path, the route only matches digits and a number out of range is parsed as 0
+func tableFromPath(req *http.Request) int {
+	tableId, err := strconv.Atoi(mux.Vars(req)["table"])
+	if err != nil || tableId > math.MaxInt32 {
+		return 0
+	}
+	return tableId
+}
+
+/*
+This function adds the table of the path to the event, or changes its number of seats if the event has it.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) SaveTable(resp http.ResponseWriter, req *http.Request) {
+	table := model.Table{TableId: tableFromPath(req)}
+	var capacity *int
+	errDecoder := decodeBody(req,
+		bodyField{name: "capacity", required: true, min: 1, max: math.MaxInt32, value: &capacity})
+	if errDecoder == nil && table.TableId < 1 {
+		errDecoder = &apiError{status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+			detail: "invalid parameters: table", fields: []model.FieldError{{Field: "table",
+				Code: FieldOutOfRange, Message: fmt.Sprintf("parameter must be between 1 and %d", math.MaxInt32)}}}
+	}
+	if errDecoder != nil {
+		s.encodeError(resp, req, errDecoder)
+		return
+	}
+	table.Capacity = *capacity
+	req = withLogFields(req, logging.Table(table.TableId))
+
+	created, err := s.store.SaveTable(req.Context(), eventFromContext(req.Context()), table.TableId, table.Capacity)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	encodeResponse(resp, table, status)
+}
+
+/*
+This function removes the table of the path from the event unless a guest has reserved it.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) DeleteTable(resp http.ResponseWriter, req *http.Request) {
+	tableId := tableFromPath(req)
+	req = withLogFields(req, logging.Table(tableId))
+	if err := s.store.DeleteTable(req.Context(), eventFromContext(req.Context()), tableId); err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	encodeResponse(resp, nil, http.StatusNoContent)
+}
+
+// Maximum number of days the dates of a cloned event can be shifted by in either direction
+const maxCloneShiftDays = 3660
+
+/* This is a helper function to clone the event of the path with the options of the body. Nothing is stored, the
+same body results in the same clone as long as the event is not changed.
+Arguments:
+	req *http.Request - HTTP request to the REST API
+Return:
+	*model.EventClone - new event with the copied tables and guests
+	error - *apiError describing the violations of the body, or any error reading the event
+*/
+func (s *Server) cloneEvent(req *http.Request) (*model.EventClone, error) {
+	var name, date, venue *string
+	var shiftDays *int
+	var resetState, excludeNoShows *bool
+	errDecoder := decodeBody(req,
+		bodyField{name: "name", min: 1, max: maxEventNameLength, text: &name},
+		bodyField{name: "date", min: 1, max: math.MaxInt32, text: &date},
+		bodyField{name: "shift_days", min: -maxCloneShiftDays, max: maxCloneShiftDays, value: &shiftDays},
+		bodyField{name: "venue", min: 0, max: maxEventVenueLength, text: &venue},
+		bodyField{name: "reset_state", flag: &resetState},
+		bodyField{name: "exclude_no_shows", flag: &excludeNoShows})
+	if errDecoder != nil {
+		return nil, errDecoder
+	}
+	var parsed time.Time
+	var violation *model.FieldError
+	if date != nil {
+		var err error
+		if parsed, err = time.Parse(time.RFC3339, *date); err != nil {
+			violation = &model.FieldError{Field: "date", Code: FieldInvalid, Message: "field must be a RFC 3339 time"}
+		} else if shiftDays != nil {
+			violation = &model.FieldError{Field: "shift_days", Code: FieldInvalid,
+				Message: "field must not be given together with date"}
+		}
+	}
+	if violation != nil {
+		return nil, &apiError{status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+			detail: "invalid fields: " + violation.Field, fields: []model.FieldError{*violation}}
+	}
+
+	ctx := req.Context()
+	source, err := s.store.GetEvent(ctx, eventFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	tables, _, err := s.store.ListTables(ctx, source.Id, math.MaxInt32, 0)
+	if err != nil {
+		return nil, err
+	}
+	guests, _, err := s.store.ListGuests(ctx, source.Id, "", math.MaxInt32, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	clone := &model.EventClone{SourceId: source.Id, Event: model.Event{Name: source.Name, Date: source.Date,
+		Venue: source.Venue, Status: "ACTIVE", Phase: PhasePlanning}, Tables: []model.Table{},
+		Guests: []model.GuestDetails{}, Excluded: []string{}}
+	if name != nil {
+		clone.Event.Name = *name
+	}
+	if venue != nil {
+		clone.Event.Venue = *venue
+	}
+	if date != nil {
+		clone.Event.Date = parsed.UTC()
+	} else if shiftDays != nil {
+		clone.Event.Date = source.Date.AddDate(0, 0, *shiftDays)
+	}
+	// The times of the guests move together with the event
+	shift := clone.Event.Date.Sub(source.Date)
+	reset, excludeNoShow := resetState == nil || *resetState, excludeNoShows != nil && *excludeNoShows
+
+	for _, table := range tables {
+		clone.Tables = append(clone.Tables, model.Table{TableId: table.TableId, Capacity: table.Capacity})
+	}
+	for _, guest := range guests {
+		// A guest who never arrived without declining the invitation is a no-show, whether marked or not. Before
+		// the event is closed a guest who has not arrived may still come, so only the marked guests are no-shows.
+		noShow := guest.Status == "NO_SHOW" || (guest.Status == "NOT_ARRIVED" && source.Phase == PhaseClosed)
+		if excludeNoShow && noShow && guest.RSVPStatus != "DECLINED" {
+			clone.Excluded = append(clone.Excluded, guest.Name)
+			continue
+		}
+		details := guest.GuestDetails
+		if reset {
+			details.Status, details.RSVPStatus = "NOT_ARRIVED", "PENDING"
+			details.ActualAccompanyingGuests, details.ArrivedTime, details.DepartedTime = nil, nil, nil
+		} else {
+			details.ArrivedTime, details.DepartedTime = shiftTime(details.ArrivedTime, shift),
+				shiftTime(details.DepartedTime, shift)
+		}
+		clone.Guests = append(clone.Guests, details)
+	}
+	return clone, nil
+}
+
+// Shifts a time which may be missing
+func shiftTime(t *time.Time, shift time.Duration) *time.Time {
+	if t == nil {
+		return nil
+	}
+	shifted := t.Add(shift)
+	return &shifted
+}
+
+/*
+This function previews the clone of the event of the path with its tables and guest list, without storing it.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) PreviewEventClone(resp http.ResponseWriter, req *http.Request) {
+	clone, err := s.cloneEvent(req)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	encodeResponse(resp, clone, http.StatusOK)
+}
+
+/*
+This function creates a new event from the event of the path with its tables and guest list, as previewed with the
+same body, and responds with the clone and the location of the new event.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) CloneEvent(resp http.ResponseWriter, req *http.Request) {
+	clone, err := s.cloneEvent(req)
+	if err == nil {
+		err = s.store.CloneEvent(req.Context(), clone)
+	}
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	prefix := strings.SplitN(req.URL.Path, "/events/", 2)[0]
+	resp.Header().Set("Location", fmt.Sprintf("%s/events/%d", prefix, clone.Event.Id))
+	encodeResponse(resp, clone, http.StatusCreated)
+}
@@ -0,0 +1,162 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+// Test an event with its own tables and guest list next to the default event
+func TestServerEvents(t *testing.T) {
+	store := newPartyStore()
+	s := newTestServer(store)
+
+	resp := serve(s, "POST", "/v2/events",
+		`{"name": "Summer party", "date": "2021-07-01T18:00:00+02:00", "venue": "Rooftop"}`)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the event to be created: %s", resp.Body.String())
+	assert.Equal(t, "/v2/events/2", resp.Header().Get("Location"), "Expected the location of the event")
+	assert.JSONEq(t, `{"id": 2, "name": "Summer party", "date": "2021-07-01T16:00:00Z", "venue": "Rooftop",
+		"status": "ACTIVE", "phase": "PLANNING"}`, resp.Body.String(), "Expected the event")
+
+	resp = serve(s, "PUT", "/v2/events/2/tables/1", `{"capacity": 6}`)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the table to be added: %s", resp.Body.String())
+	resp = serve(s, "PUT", "/v2/events/2/tables/1", `{"capacity": 8}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the seats of the table to change")
+	assert.JSONEq(t, `{"table": 1, "capacity": 8}`, resp.Body.String(), "Expected the table")
+
+	// The same guest can be invited to every event
+	resp = serve(s, "POST", "/v1/events/2/guest_list/Mary+Queen", `{"table": 1, "accompanying_guests": 3}`)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the guest to be added: %s", resp.Body.String())
+	resp = serve(s, "PUT", "/v1/events/2/guests/Mary+Queen", `{"accompanying_guests": 3}`)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the doors to be closed while planning")
+	for _, phase := range []string{PhaseLocked, PhaseOpen} {
+		resp = serve(s, "PUT", "/v2/events/2/phase", `{"phase": "`+phase+`"}`)
+		assert.Equal(t, http.StatusOK, resp.Code, "Expected the event to move on: %s", resp.Body.String())
+	}
+	resp = serve(s, "PUT", "/v1/events/2/guests/Mary+Queen", `{"accompanying_guests": 3}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the guest to arrive: %s", resp.Body.String())
+
+	resp = serve(s, "GET", "/v1/events/2/guest_list", "")
+	assert.JSONEq(t, `{"guests": [{"name": "Mary Queen", "accompanying_guests": 3, "table": 1}]}`,
+		resp.Body.String(), "Expected only the guests of the event")
+	resp = serve(s, "GET", "/v2/events/2/seats_empty", "")
+	assert.JSONEq(t, `{"seats_empty": 4}`, resp.Body.String(), "Expected the empty seats of the event")
+	resp = serve(s, "GET", "/seats_empty", "")
+	assert.JSONEq(t, `{"seats_empty": 16}`, resp.Body.String(), "Expected the default event to be unchanged")
+	resp = serve(s, "GET", "/v2/events/2/tables", "")
+	assert.JSONEq(t, `{"items": [{"table": 1, "capacity": 8, "occupied": 4}],
+		"page": {"limit": 100, "offset": 0, "total": 1, "next": null}}`, resp.Body.String(),
+		"Expected the occupancy of the tables")
+
+	resp = serve(s, "GET", "/v2/events/2/guests/3/invitation", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the invitation: %s", resp.Body.String())
+	assert.Contains(t, resp.Body.String(), "Summer party", "Expected the name of the event")
+	assert.Contains(t, resp.Body.String(), "Rooftop", "Expected the venue of the event")
+	resp = serve(s, "GET", "/v2/events/1/guests/3", "")
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Expected the guest not to be on another guest list")
+
+	resp = serve(s, "DELETE", "/v2/events/2/tables/1", "")
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the reserved table to be kept")
+	resp = serve(s, "DELETE", "/v2/events/1/tables/1", "")
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the tables to be kept once the doors are open")
+	assert.Equal(t, CodeWrongPhase, problemCode(t, resp), "Expected the phase to be reported")
+	store.event(defaultEventId).Phase = PhasePlanning
+	resp = serve(s, "DELETE", "/v2/events/1/tables/1", "")
+	assert.Equal(t, http.StatusNoContent, resp.Code, "Expected the free table to be removed")
+
+	resp = serve(s, "PUT", "/v2/events/2", `{"name": "Summer party", "date": "2021-07-02T18:00:00Z",
+		"status": "CANCELLED"}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the event to change: %s", resp.Body.String())
+	assert.Contains(t, resp.Body.String(), `"venue":"","status":"CANCELLED"`, "Expected the replaced event")
+	resp = serve(s, "GET", "/v2/events?status=ACTIVE", "")
+	assert.Contains(t, resp.Body.String(), `"items":[{"id":1,`, "Expected the active events")
+	assert.Contains(t, resp.Body.String(), `"total":1`, "Expected only the active events")
+
+	entry := store.audit[len(store.audit)-1]
+	assert.Equal(t, AuditEventUpdated, entry.Action, "Expected the change of the event to be audited")
+	for _, entry := range store.audit {
+		if entry.Action == AuditGuestArrived {
+			assert.Contains(t, string(entry.After), `"event_id":2`, "Expected the event of the guest")
+		}
+	}
+}
+
+// Test that the routes of an event which does not exist are reported as not found
+func TestServerUnknownEvent(t *testing.T) {
+	s := newTestServer(newPartyStore())
+	for _, test := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"GET", "/v2/events/9", ""},
+		{"PUT", "/v2/events/9/tables/1", `{"capacity": 4}`},
+		{"GET", "/v2/events/9/guests", ""},
+		{"POST", "/v1/events/9/guest_list/John+Smith", `{"table": 1}`},
+		{"GET", "/v1/events/99999999999999999999/seats_empty", ""},
+	} {
+		resp := serve(s, test.method, test.path, test.body)
+
+		assert.Equal(t, http.StatusNotFound, resp.Code, "Expected different status for %s %s", test.method, test.path)
+		assert.Contains(t, resp.Body.String(), `"code":"`+CodeEventNotFound+`"`, "Expected different error code")
+	}
+}
+
+// Test previewing the clone of an event and creating it with the same options
+func TestServerEventClone(t *testing.T) {
+	store := newPartyStore()
+	store.event(defaultEventId).Phase = PhaseClosed
+	s := newTestServer(store)
+	body := `{"shift_days": 365, "reset_state": false, "exclude_no_shows": true}`
+
+	resp := serve(s, "POST", "/v2/events/1/clone/preview", body)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the preview: %s", resp.Body.String())
+	assert.JSONEq(t, `{"source_id": 1, "event": {"id": 0, "name": "Year end party", "date": "2021-12-31T20:00:00Z",
+		"venue": "Main hall", "status": "ACTIVE", "phase": "PLANNING"},
+		"tables": [{"table": 1, "capacity": 10}, {"table": 2, "capacity": 4}, {"table": 3, "capacity": 2},
+			{"table": 4, "capacity": 2}],
+		"guests": [{"name": "Brad Pitt", "table": 3, "planned_accompanying_guests": 1, "actual_accompanying_guests": 1,
+			"status": "ARRIVED", "rsvp_status": "PENDING", "time_arrived": "2021-12-31T20:00:00Z", "time_departed": null}],
+		"excluded": ["Mary Queen"]}`, resp.Body.String(), "Expected the shifted clone without the no-show")
+	assert.Len(t, store.events, 1, "Expected the preview not to be stored")
+
+	resp = serve(s, "POST", "/v2/events/1/clone", body)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the clone to be created: %s", resp.Body.String())
+	assert.Equal(t, "/v2/events/2", resp.Header().Get("Location"), "Expected the location of the new event")
+	resp = serve(s, "GET", "/v1/events/2/guests", "")
+	assert.JSONEq(t, `{"guests": [{"name": "Brad Pitt", "accompanying_guests": 1,
+		"time_arrived": "2021-12-31T20:00:00Z"}]}`, resp.Body.String(), "Expected the state of the guest to be kept")
+	resp = serve(s, "GET", "/v2/events/2/seats_empty", "")
+	assert.JSONEq(t, `{"seats_empty": 16}`, resp.Body.String(), "Expected the tables to be copied")
+	entry := store.audit[len(store.audit)-1]
+	assert.Equal(t, AuditEventCloned, entry.Action, "Expected the clone to be audited")
+
+	// By default the state of the guests is reset and everybody is copied
+	resp = serve(s, "POST", "/v2/events/1/clone", `{"name": "New year party", "date": "2021-01-01T00:00:00+01:00"}`)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the clone to be created: %s", resp.Body.String())
+	resp = serve(s, "GET", "/v2/events/3/guests", "")
+	assert.Contains(t, resp.Body.String(), `"total":2`, "Expected every guest to be copied")
+	assert.NotContains(t, resp.Body.String(), `"ARRIVED"`, "Expected the arrivals to be reset")
+	resp = serve(s, "GET", "/v2/events/3", "")
+	assert.Contains(t, resp.Body.String(), `"date":"2020-12-31T23:00:00Z"`, "Expected the date of the new event")
+
+	resp = serve(s, "POST", "/v2/events/1/clone", `{"date": "2021-12-31T20:00:00Z", "shift_days": 365}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code, "Expected the date and the shift to be exclusive")
+	assert.Len(t, store.events, 3, "Expected the rejected clone not to be stored")
+}
+
+// Test that only the marked no-shows are left out of the clone of an event which is not closed yet
+func TestServerEventCloneBeforeClosing(t *testing.T) {
+	store := newPartyStore().seed("Jane Doe", 4, 0, "NO_SHOW", 0)
+	s := newTestServer(store)
+	body := `{"shift_days": 365, "exclude_no_shows": true}`
+
+	for _, phase := range []string{PhasePlanning, PhaseLocked, PhaseOpen} {
+		store.event(defaultEventId).Phase = phase
+		resp := serve(s, "POST", "/v2/events/1/clone/preview", body)
+		assert.Equal(t, http.StatusOK, resp.Code, "Expected the preview: %s", resp.Body.String())
+		assert.Contains(t, resp.Body.String(), `"name":"Mary Queen"`, "Expected the guest who may still come "+
+			"while the event is %s", phase)
+		assert.Contains(t, resp.Body.String(), `"excluded":["Jane Doe"]`, "Expected only the marked no-show")
+	}
+}
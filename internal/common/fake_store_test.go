@@ -0,0 +1,941 @@
+package common
+
+import (
+	"GuestList/internal/audit"
+	"GuestList/internal/databse"
+	"GuestList/internal/model"
+	"GuestList/internal/scheduler"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fixed time of the test clock
+var testNow = time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+
+// fakeStore keeps the events with their guest lists and tables in memory
+type fakeStore struct {
+	mu      sync.Mutex
+	events  []*model.Event
+	guests  []*fakeGuest // in the order they were added
+	nextId  int64
+	tables  map[int64]map[int]int // seats of the tables by event
+	summary map[int64]*model.EventSummary
+	frozen  []model.FrozenChange
+	keys    map[string]*model.IdempotencyRecord
+	apiKeys []*model.APIKey
+	audit   []model.AuditEntry
+	jobs    map[string]*model.Job
+	runs    []*model.JobRun
+	err     error // returned by every call when set
+
+	schemaVersion uint
+	dirty         bool
+}
+
+// fakeGuest is a guest on the guest list of an event
+type fakeGuest struct {
+	id      int64
+	eventId int64
+	*model.GuestDetails
+}
+
+// Creates a store with the default event without any guest or table, its doors are open so that every change of
+// the guest list but the removal of a guest is allowed
+func newFakeStore() *fakeStore {
+	return &fakeStore{events: []*model.Event{{Id: defaultEventId, Name: "Year end party", Date: testNow,
+		Venue: "Main hall", Status: "ACTIVE", Phase: PhaseOpen}}, tables: map[int64]map[int]int{defaultEventId: {}},
+		summary: map[int64]*model.EventSummary{}, keys: make(map[string]*model.IdempotencyRecord),
+		jobs: map[string]*model.Job{}, schemaVersion: databse.SchemaVersion}
+}
+
+// Adds a guest with the given status directly to the guest list of the default event
+func (f *fakeStore) seed(name string, table int, planned int, status string, actual int) *fakeStore {
+	guest := &model.GuestDetails{Name: name, TableId: &table, PlannedAccompanyingGuests: planned,
+		Status: status, RSVPStatus: "PENDING"}
+	if status != "NOT_ARRIVED" {
+		guest.ActualAccompanyingGuests = &actual
+		guest.ArrivedTime = &testNow
+	}
+	f.add(defaultEventId, guest)
+	return f
+}
+
+// Adds the guest to the guest list of the event with the next ID
+func (f *fakeStore) add(eventId int64, guest *model.GuestDetails) int64 {
+	f.nextId++
+	f.guests = append(f.guests, &fakeGuest{id: f.nextId, eventId: eventId, GuestDetails: guest})
+	return f.nextId
+}
+
+// Returns the guest on the guest list of the event, or nil
+func (f *fakeStore) guest(eventId int64, name string) *fakeGuest {
+	for _, guest := range f.guests {
+		if guest.eventId == eventId && guest.Name == name {
+			return guest
+		}
+	}
+	return nil
+}
+
+// Returns the guests on the guest list of the event
+func (f *fakeStore) guestList(eventId int64) []*fakeGuest {
+	var guests []*fakeGuest
+	for _, guest := range f.guests {
+		if guest.eventId == eventId {
+			guests = append(guests, guest)
+		}
+	}
+	return guests
+}
+
+// Returns the event with the ID, or nil
+func (f *fakeStore) event(eventId int64) *model.Event {
+	for _, event := range f.events {
+		if event.Id == eventId {
+			return event
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) CreateEvent(ctx context.Context, event *model.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	event.Id = int64(len(f.events) + 1)
+	stored := *event
+	f.events = append(f.events, &stored)
+	f.tables[event.Id] = map[int]int{}
+	return nil
+}
+
+func (f *fakeStore) GetEvent(ctx context.Context, eventId int64) (*model.Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	event := f.event(eventId)
+	if event == nil {
+		return nil, databse.ErrEventNotFound
+	}
+	stored := *event
+	return &stored, nil
+}
+
+func (f *fakeStore) ListEvents(ctx context.Context, status string, limit int, offset int) ([]model.Event, int,
+	error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+	events := []model.Event{}
+	total := 0
+	for _, event := range f.events {
+		if status != "" && event.Status != status {
+			continue
+		}
+		if total++; total > offset && len(events) < limit {
+			events = append(events, *event)
+		}
+	}
+	return events, total, nil
+}
+
+func (f *fakeStore) UpdateEvent(ctx context.Context, event *model.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	stored := f.event(event.Id)
+	if stored == nil {
+		return databse.ErrEventNotFound
+	}
+	*stored = *event
+	return nil
+}
+
+// Returns the occupancy of the tables of the event by table number
+func (f *fakeStore) occupancy(eventId int64) []model.TableOccupancy {
+	tables := []model.TableOccupancy{}
+	for tableId, capacity := range f.tables[eventId] {
+		tables = append(tables, model.TableOccupancy{TableId: tableId, Capacity: capacity})
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].TableId < tables[j].TableId })
+	for i := range tables {
+		for _, guest := range f.guestList(eventId) {
+			if *guest.TableId == tables[i].TableId && guest.Status == "ARRIVED" {
+				tables[i].Occupied += *guest.ActualAccompanyingGuests + 1
+			}
+		}
+	}
+	return tables
+}
+
+func (f *fakeStore) ListTables(ctx context.Context, eventId int64, limit int, offset int) ([]model.TableOccupancy,
+	int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+	tables := f.occupancy(eventId)
+	total := len(tables)
+	if offset > total {
+		offset = total
+	}
+	if tables = tables[offset:]; len(tables) > limit {
+		tables = tables[:limit]
+	}
+	return tables, total, nil
+}
+
+func (f *fakeStore) SaveTable(ctx context.Context, eventId int64, tableId int, capacity int) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return false, f.err
+	}
+	_, exists := f.tables[eventId][tableId]
+	f.tables[eventId][tableId] = capacity
+	return !exists, nil
+}
+
+func (f *fakeStore) DeleteTable(ctx context.Context, eventId int64, tableId int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	if _, exists := f.tables[eventId][tableId]; !exists {
+		return databse.ErrTableNotFound
+	}
+	for _, guest := range f.guestList(eventId) {
+		if *guest.TableId == tableId {
+			return databse.ErrTableReserved
+		}
+	}
+	delete(f.tables[eventId], tableId)
+	return nil
+}
+
+func (f *fakeStore) CloneEvent(ctx context.Context, clone *model.EventClone) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	clone.Event.Id = int64(len(f.events) + 1)
+	stored := clone.Event
+	f.events = append(f.events, &stored)
+	f.tables[clone.Event.Id] = map[int]int{}
+	for _, table := range clone.Tables {
+		f.tables[clone.Event.Id][table.TableId] = table.Capacity
+	}
+	for _, guest := range clone.Guests {
+		guest := guest
+		f.add(clone.Event.Id, &guest)
+	}
+	return nil
+}
+
+func (f *fakeStore) UpdateEventPhase(ctx context.Context, eventId int64, from string, to string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	event := f.event(eventId)
+	if event == nil || event.Phase != from {
+		return databse.ErrPhaseChanged
+	}
+	event.Phase = to
+	return nil
+}
+
+func (f *fakeStore) CloseEvent(ctx context.Context, eventId int64, closedAt time.Time) (*model.EventSummary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	event := f.event(eventId)
+	if event == nil || event.Phase != PhaseOpen {
+		return nil, databse.ErrPhaseChanged
+	}
+	event.Phase = PhaseClosed
+	summary := &model.EventSummary{EventId: eventId, ClosedAt: closedAt}
+	for _, guest := range f.guestList(eventId) {
+		if guest.Status == "ARRIVED" {
+			guest.Status, guest.DepartedTime = "DEPARTED", &closedAt
+			summary.CheckedOut++
+		}
+		summary.InvitedGuests++
+		switch {
+		case guest.Status == "ARRIVED" || guest.Status == "DEPARTED":
+			summary.ArrivedGuests++
+			summary.ArrivedPeople += *guest.ActualAccompanyingGuests + 1
+		case guest.RSVPStatus != "DECLINED":
+			summary.NoShows++
+		}
+		if guest.RSVPStatus == "DECLINED" {
+			summary.Declined++
+		}
+	}
+	for _, capacity := range f.tables[eventId] {
+		summary.Seats += capacity
+	}
+	f.summary[eventId] = summary
+	return summary, nil
+}
+
+func (f *fakeStore) GetEventSummary(ctx context.Context, eventId int64) (*model.EventSummary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	summary, ok := f.summary[eventId]
+	if !ok {
+		return nil, databse.ErrSummaryNotFound
+	}
+	return summary, nil
+}
+
+func (f *fakeStore) AppendFrozenChange(ctx context.Context, change *model.FrozenChange) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	change.Id = int64(len(f.frozen) + 1)
+	f.frozen = append(f.frozen, *change)
+	return nil
+}
+
+func (f *fakeStore) ListFrozenChanges(ctx context.Context, eventId int64) ([]model.FrozenChange, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	changes := []model.FrozenChange{}
+	for _, change := range f.frozen {
+		if change.EventId == eventId {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func (f *fakeStore) AddGuestToList(ctx context.Context, eventId int64, guest *model.GuestsList) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	if f.guest(eventId, guest.Name) != nil {
+		return databse.ErrGuestExists
+	}
+	table := *guest.TableId
+	guest.Id = f.add(eventId, &model.GuestDetails{Name: guest.Name, TableId: &table,
+		PlannedAccompanyingGuests: guest.AccompanyingGuests, Status: guest.Status, RSVPStatus: "PENDING"})
+	return nil
+}
+
+func (f *fakeStore) DeleteGuestFromList(ctx context.Context, eventId int64, guestName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	for i, guest := range f.guests {
+		if guest.eventId == eventId && guest.Name == guestName {
+			f.guests = append(f.guests[:i], f.guests[i+1:]...)
+			return nil
+		}
+	}
+	return databse.ErrGuestNotFound
+}
+
+func (f *fakeStore) list(eventId int64, limit int, offset int, keep func(*fakeGuest) bool) []model.GuestsList {
+	var guestList []model.GuestsList
+	for _, guest := range f.guestList(eventId) {
+		if !keep(guest) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if len(guestList) == limit {
+			break
+		}
+		entry := model.GuestsList{Name: guest.Name, AccompanyingGuests: guest.PlannedAccompanyingGuests,
+			TableId: guest.TableId, Status: guest.Status}
+		if guest.Status == "ARRIVED" {
+			entry = model.GuestsList{Name: guest.Name, AccompanyingGuests: *guest.ActualAccompanyingGuests,
+				ArrivedTime: guest.ArrivedTime}
+		}
+		guestList = append(guestList, entry)
+	}
+	return guestList
+}
+
+func (f *fakeStore) GetAllGuests(ctx context.Context, eventId int64, limit int, offset int) ([]model.GuestsList,
+	error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	guestList := f.list(eventId, limit, offset, func(*fakeGuest) bool { return true })
+	for i := range guestList {
+		guest := f.guest(eventId, guestList[i].Name)
+		guestList[i] = model.GuestsList{Name: guest.Name, AccompanyingGuests: guest.PlannedAccompanyingGuests,
+			TableId: guest.TableId}
+	}
+	return guestList, nil
+}
+
+func (f *fakeStore) GetGuestDetails(ctx context.Context, eventId int64, guestName string) (*model.GuestDetails,
+	error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	guest := f.guest(eventId, guestName)
+	if guest == nil {
+		return nil, databse.ErrGuestNotFound
+	}
+	details := *guest.GuestDetails
+	return &details, nil
+}
+
+func (f *fakeStore) GetGuest(ctx context.Context, eventId int64, guestId int64) (*model.Guest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, guest := range f.guestList(eventId) {
+		if guest.id == guestId {
+			return &model.Guest{Id: guest.id, GuestDetails: *guest.GuestDetails}, nil
+		}
+	}
+	return nil, databse.ErrGuestNotFound
+}
+
+func (f *fakeStore) ListGuests(ctx context.Context, eventId int64, status string, limit int,
+	offset int) ([]model.Guest, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+	guests := []model.Guest{}
+	total := 0
+	for _, guest := range f.guestList(eventId) {
+		if status != "" && guest.Status != status {
+			continue
+		}
+		if total++; total > offset && len(guests) < limit {
+			guests = append(guests, model.Guest{Id: guest.id, GuestDetails: *guest.GuestDetails})
+		}
+	}
+	return guests, total, nil
+}
+
+func (f *fakeStore) GetGuestInvite(ctx context.Context, eventId int64, guestName string) (*model.GuestsList, error) {
+	guest, err := f.GetGuestDetails(ctx, eventId, guestName)
+	if err != nil {
+		return nil, err
+	}
+	return &model.GuestsList{Name: guest.Name, TableId: guest.TableId}, nil
+}
+
+func (f *fakeStore) GetEntryFromGuestList(ctx context.Context, eventId int64, guestName string) (*model.GuestsList,
+	error) {
+	guest, err := f.GetGuestDetails(ctx, eventId, guestName)
+	if err != nil {
+		return nil, err
+	}
+	return &model.GuestsList{Name: guest.Name, AccompanyingGuests: guest.PlannedAccompanyingGuests,
+		TableId: guest.TableId, Status: guest.Status}, nil
+}
+
+func (f *fakeStore) GetTableCapacity(ctx context.Context, eventId int64, tableId int) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	capacity, exists := f.tables[eventId][tableId]
+	if !exists {
+		return 0, databse.ErrTableNotFound
+	}
+	return capacity, nil
+}
+
+func (f *fakeStore) CheckTableForGuest(ctx context.Context, eventId int64, tableId int, partySize int) error {
+	capacity, err := f.GetTableCapacity(ctx, eventId, tableId)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, guest := range f.guestList(eventId) {
+		if *guest.TableId == tableId && guest.Status != "DEPARTED" && guest.Status != "NO_SHOW" {
+			return databse.ErrTableReserved
+		}
+	}
+	if partySize > capacity {
+		return databse.ErrInsufficientSeats
+	}
+	return nil
+}
+
+func (f *fakeStore) UpdateGuestStatusToArrive(ctx context.Context, eventId int64, guest *model.GuestsList,
+	arrGuests int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	entry := f.guest(eventId, guest.Name)
+	if entry == nil || (entry.Status != "NOT_ARRIVED" && entry.Status != "NO_SHOW") {
+		return databse.ErrGuestArrived
+	}
+	entry.Status = "ARRIVED"
+	entry.ActualAccompanyingGuests = &arrGuests
+	entry.ArrivedTime = &testNow
+	return nil
+}
+
+func (f *fakeStore) UpdateGuestStatusToDepart(ctx context.Context, eventId int64, guestName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	entry := f.guest(eventId, guestName)
+	if entry == nil || entry.Status != "ARRIVED" {
+		return databse.ErrGuestNotFound
+	}
+	entry.Status = "DEPARTED"
+	entry.DepartedTime = &testNow
+	return nil
+}
+
+func (f *fakeStore) UpdateGuestRSVP(ctx context.Context, eventId int64, guestName string, rsvpStatus string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	entry := f.guest(eventId, guestName)
+	if entry == nil {
+		return databse.ErrGuestNotFound
+	}
+	entry.RSVPStatus = rsvpStatus
+	return nil
+}
+
+func (f *fakeStore) GetArrivedGuests(ctx context.Context, eventId int64, limit int, offset int) ([]model.GuestsList,
+	error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.list(eventId, limit, offset, func(guest *fakeGuest) bool { return guest.Status == "ARRIVED" }), nil
+}
+
+func (f *fakeStore) MarkNoShows(ctx context.Context, startedBefore time.Time) (map[int64]int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	marked := make(map[int64]int)
+	for _, guest := range f.guests {
+		event := f.event(guest.eventId)
+		if guest.Status == "NOT_ARRIVED" && guest.RSVPStatus != "DECLINED" && event.Phase == PhaseOpen &&
+			!event.Date.After(startedBefore) {
+			guest.Status = "NO_SHOW"
+			marked[guest.eventId]++
+		}
+	}
+	return marked, nil
+}
+
+func (f *fakeStore) ListNoShows(ctx context.Context, eventId int64) ([]model.Guest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	guests := []model.Guest{}
+	for _, guest := range f.guestList(eventId) {
+		if guest.Status == "NO_SHOW" {
+			guests = append(guests, model.Guest{Id: guest.id, GuestDetails: *guest.GuestDetails})
+		}
+	}
+	return guests, nil
+}
+
+func (f *fakeStore) EmptySeats(ctx context.Context, eventId int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	emptySeats := 0
+	for _, capacity := range f.tables[eventId] {
+		emptySeats += capacity
+	}
+	for _, guest := range f.guestList(eventId) {
+		if guest.Status == "ARRIVED" {
+			emptySeats -= *guest.ActualAccompanyingGuests + 1
+		}
+	}
+	return emptySeats, nil
+}
+
+func (f *fakeStore) CreateIdempotencyRecord(ctx context.Context, record *model.IdempotencyRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	if _, ok := f.keys[record.Key]; ok {
+		return databse.ErrIdempotencyKeyExists
+	}
+	stored := *record
+	f.keys[record.Key] = &stored
+	return nil
+}
+
+func (f *fakeStore) GetIdempotencyRecord(ctx context.Context, key string) (*model.IdempotencyRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	record, ok := f.keys[key]
+	if !ok {
+		return nil, databse.ErrIdempotencyKeyNotFound
+	}
+	stored := *record
+	return &stored, nil
+}
+
+func (f *fakeStore) CompleteIdempotencyRecord(ctx context.Context, record *model.IdempotencyRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	stored, ok := f.keys[record.Key]
+	if !ok {
+		return databse.ErrIdempotencyKeyNotFound
+	}
+	stored.Status, stored.Header, stored.Body, stored.ExpiresAt = record.Status, record.Header, record.Body,
+		record.ExpiresAt
+	return nil
+}
+
+func (f *fakeStore) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	delete(f.keys, key)
+	return nil
+}
+
+func (f *fakeStore) PurgeIdempotencyRecords(ctx context.Context, before time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	deleted := 0
+	for key, record := range f.keys {
+		if record.ExpiresAt.Before(before) {
+			delete(f.keys, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeStore) CreateAPIKey(ctx context.Context, key *model.APIKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	key.Id = int64(len(f.apiKeys) + 1)
+	stored := *key
+	stored.Key = ""
+	f.apiKeys = append(f.apiKeys, &stored)
+	return nil
+}
+
+func (f *fakeStore) GetAPIKeyByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, key := range f.apiKeys {
+		if key.Hash == hash {
+			stored := *key
+			return &stored, nil
+		}
+	}
+	return nil, databse.ErrAPIKeyNotFound
+}
+
+func (f *fakeStore) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	keys := []model.APIKey{}
+	for _, key := range f.apiKeys {
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+func (f *fakeStore) RevokeAPIKey(ctx context.Context, keyId int64, revokedAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	if keyId < 1 || keyId > int64(len(f.apiKeys)) {
+		return databse.ErrAPIKeyNotFound
+	}
+	if key := f.apiKeys[keyId-1]; key.RevokedAt == nil {
+		key.RevokedAt = &revokedAt
+	}
+	return nil
+}
+
+func (f *fakeStore) AppendAuditEntry(ctx context.Context, entry *model.AuditEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	entry.Id = int64(len(f.audit) + 1)
+	entry.PrevHash = audit.GenesisHash
+	if len(f.audit) > 0 {
+		entry.PrevHash = f.audit[len(f.audit)-1].Hash
+	}
+	entry.Hash = audit.Hash(entry.PrevHash, entry)
+	f.audit = append(f.audit, *entry)
+	return nil
+}
+
+func (f *fakeStore) GetAuditChainHead(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return "", f.err
+	}
+	if len(f.audit) == 0 {
+		return audit.GenesisHash, nil
+	}
+	return f.audit[len(f.audit)-1].Hash, nil
+}
+
+func (f *fakeStore) ListAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, int,
+	error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+	entries := []model.AuditEntry{}
+	total := 0
+	for _, entry := range f.audit {
+		if (filter.Actor != "" && entry.Actor != filter.Actor) || (filter.Action != "" && entry.Action != filter.Action) ||
+			(filter.Subject != "" && entry.Subject != filter.Subject) ||
+			(!filter.From.IsZero() && entry.OccurredAt.Before(filter.From)) ||
+			(!filter.To.IsZero() && !entry.OccurredAt.Before(filter.To)) {
+			continue
+		}
+		if total >= filter.Offset && len(entries) < filter.Limit {
+			entries = append(entries, entry)
+		}
+		total++
+	}
+	return entries, total, nil
+}
+
+func (f *fakeStore) SaveJob(ctx context.Context, job *model.Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	if stored, ok := f.jobs[job.Name]; ok {
+		stored.Description, stored.IntervalSeconds = job.Description, job.IntervalSeconds
+		return nil
+	}
+	saved := *job
+	f.jobs[job.Name] = &saved
+	return nil
+}
+
+func (f *fakeStore) GetJob(ctx context.Context, name string) (*model.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	job, ok := f.jobs[name]
+	if !ok {
+		return nil, databse.ErrJobNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func (f *fakeStore) ListJobs(ctx context.Context) ([]model.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	jobs := []model.Job{}
+	for _, job := range f.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs, nil
+}
+
+func (f *fakeStore) UpdateJobPaused(ctx context.Context, name string, paused bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	job, ok := f.jobs[name]
+	if !ok {
+		return databse.ErrJobNotFound
+	}
+	job.Paused = paused
+	return nil
+}
+
+func (f *fakeStore) ClaimJobRun(ctx context.Context, run *model.JobRun, abandonBefore time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	job, ok := f.jobs[run.JobName]
+	if !ok {
+		return databse.ErrJobNotFound
+	}
+	run.ScheduledAt = run.StartedAt
+	if run.Trigger == scheduler.TriggerScheduled {
+		if job.Paused || job.NextRunAt.After(run.StartedAt) {
+			return databse.ErrJobNotDue
+		}
+		run.ScheduledAt = job.NextRunAt
+	}
+	for _, other := range f.runs {
+		if other.JobName == run.JobName && other.Status == scheduler.StatusRunning {
+			if !other.StartedAt.Before(abandonBefore) {
+				return databse.ErrJobRunning
+			}
+			other.Status, other.FinishedAt = scheduler.StatusAbandoned, &run.StartedAt
+		}
+	}
+	if run.Trigger == scheduler.TriggerScheduled {
+		interval := time.Duration(job.IntervalSeconds) * time.Second
+		job.NextRunAt = job.NextRunAt.Add(interval)
+		if !job.NextRunAt.After(run.StartedAt) {
+			job.NextRunAt = run.StartedAt.Add(interval)
+		}
+	}
+	run.Id, run.Status = int64(len(f.runs)+1), scheduler.StatusRunning
+	stored := *run
+	f.runs = append(f.runs, &stored)
+	return nil
+}
+
+func (f *fakeStore) FinishJobRun(ctx context.Context, run *model.JobRun) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	if stored := f.runs[run.Id-1]; stored.Status == scheduler.StatusRunning {
+		*stored = *run
+	}
+	return nil
+}
+
+func (f *fakeStore) ListJobRuns(ctx context.Context, name string, limit int, offset int) ([]model.JobRun, int,
+	error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+	var all []model.JobRun
+	for i := len(f.runs) - 1; i >= 0; i-- {
+		if f.runs[i].JobName == name {
+			all = append(all, *f.runs[i])
+		}
+	}
+	runs := []model.JobRun{}
+	for i := offset; i < len(all) && i < offset+limit; i++ {
+		runs = append(runs, all[i])
+	}
+	return runs, len(all), nil
+}
+
+func (f *fakeStore) Ping(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *fakeStore) GetSchemaVersion(ctx context.Context) (uint, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.schemaVersion, f.dirty, f.err
+}
+
+func (f *fakeStore) GetPartyStats(ctx context.Context, eventId int64) (*model.PartyStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	stats := &model.PartyStats{InvitedGuests: len(f.guestList(eventId))}
+	for _, occupancy := range f.occupancy(eventId) {
+		stats.Tables = append(stats.Tables, occupancy)
+		stats.ArrivedPeople += occupancy.Occupied
+		stats.EmptySeats += occupancy.Capacity - occupancy.Occupied
+	}
+	return stats, nil
+}
@@ -0,0 +1,132 @@
+package common
+
+import (
+	"GuestList/internal/auth"
+	"GuestList/internal/logging"
+	"GuestList/internal/model"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Header carrying the reason of an organizer changing the guest list after it was frozen
+const OverrideReasonHeader = "Override-Reason"
+
+// Maximum length of the reason of an override, the length of the column
+const maxOverrideReasonLength = 500
+
+// Error reported for a reason of an override which does not fit
+var errInvalidOverrideReason = &apiError{status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+	detail: "invalid header: " + OverrideReasonHeader, fields: []model.FieldError{{Field: OverrideReasonHeader,
+		Code: FieldOutOfRange, Message: fmt.Sprintf("header must have at most %d characters",
+			maxOverrideReasonLength)}}}
+
+// Error reported for an override of a principal who is not an organizer
+var errOverrideForbidden = &apiError{status: http.StatusForbidden, code: CodeForbidden,
+	detail: "only an organizer may override the freeze of the guest list"}
+
+/* This function returns the time the guest list of the event is frozen from.
+Arguments:
+	event *model.Event - event
+Return:
+	*time.Time - time the guest list is frozen from, nil if the guest lists are never frozen
+*/
+func (s *Server) frozenSince(event *model.Event) *time.Time {
+	if s.config.FreezeBefore == 0 {
+		return nil
+	}
+	since := event.Date.Add(-s.config.FreezeBefore).UTC()
+	return &since
+}
+
+/* This function checks whether the guest list of the event of the request is frozen. The catering numbers are final
+once the guest list is frozen, so a guest is only added or removed, or a party larger than planned let in, by an
+organizer or an administrator overriding the freeze with the reason in the Override-Reason header. The override of
+any other principal, e.g. of the door staff, is forbidden.
+Arguments:
+	req *http.Request - HTTP request changing the guest list
+Return:
+	*model.FrozenChange - change to be recorded with the reason of the override, nil if the guest list is not frozen
+	error - *apiError if the guest list is frozen and the freeze is not overridden, or any other error that occurred
+*/
+func (s *Server) checkFreeze(req *http.Request) (*model.FrozenChange, error) {
+	if s.config.FreezeBefore == 0 {
+		return nil, nil
+	}
+	ctx := req.Context()
+	event, err := s.store.GetEvent(ctx, eventFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock()
+	since := s.frozenSince(event)
+	if now.Before(*since) {
+		return nil, nil
+	}
+	reason := strings.TrimSpace(req.Header.Get(OverrideReasonHeader))
+	if reason == "" {
+		return nil, &apiError{status: http.StatusConflict, code: CodeGuestListFrozen,
+			detail: fmt.Sprintf("the guest list is frozen since %s, an organizer has to give the reason in the %s "+
+				"header", since.Format(time.RFC3339), OverrideReasonHeader)}
+	}
+	principal := PrincipalFromContext(ctx)
+	if principal == nil || !hasRole(principal, []string{auth.RoleOrganizer}) {
+		return nil, errOverrideForbidden
+	}
+	if len(reason) > maxOverrideReasonLength {
+		return nil, errInvalidOverrideReason
+	}
+	return &model.FrozenChange{EventId: event.Id, OccurredAt: now, Actor: principal.Subject, Reason: reason}, nil
+}
+
+/* This function records a change of the frozen guest list for the report of the caterer. The change is already
+made, so a failure is only logged.
+Arguments:
+	ctx context.Context - context of the request
+	change *model.FrozenChange - change with the reason of the override, nothing is recorded if nil
+*/
+func (s *Server) recordFrozenChange(ctx context.Context, change *model.FrozenChange) {
+	if change == nil {
+		return
+	}
+	logger := logging.FromContext(ctx).With(logging.String("action", change.Action))
+	// The entry is appended even if the request has timed out meanwhile
+	if err := s.store.AppendFrozenChange(detachedContext{ctx}, change); err != nil {
+		logger.Error("frozen change not recorded", logging.SensitiveErr(err))
+		return
+	}
+	logger.Info("guest list freeze overridden")
+}
+
+/*
+This function reports the changes made to the guest list of the event of the path after it was frozen, with the
+number of people added and removed, for the caterer.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) GetFreezeReport(resp http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	event, err := s.store.GetEvent(ctx, eventFromContext(ctx))
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	changes, err := s.store.ListFrozenChanges(ctx, event.Id)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	report := &model.FreezeReport{EventId: event.Id, FrozenSince: s.frozenSince(event), Changes: changes}
+	report.Frozen = report.FrozenSince != nil && !s.clock().Before(*report.FrozenSince)
+	for _, change := range changes {
+		if change.Action == AuditGuestRemoved {
+			report.PeopleRemoved += change.People
+		} else {
+			report.PeopleAdded += change.People
+		}
+	}
+	encodeResponse(resp, report, http.StatusOK)
+}
@@ -0,0 +1,124 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that the frozen guest list is only changed with the reason of an override, which is reported to the caterer
+func TestServerFreeze(t *testing.T) {
+	store := newPartyStore()
+	store.event(defaultEventId).Phase = PhasePlanning
+	s := newTestServer(store)
+	s.config.FreezeBefore = 7 * 24 * time.Hour
+	override := map[string]string{OverrideReasonHeader: "  Plus one of the CEO "}
+
+	resp := serve(s, "POST", "/v1/guest_list/John+Smith", `{"table": 1, "accompanying_guests": 1}`)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the frozen guest list to be kept")
+	assert.Equal(t, CodeGuestListFrozen, problemCode(t, resp), "Expected the freeze to be reported")
+	assert.Contains(t, resp.Body.String(), "frozen since 2020-12-24T20:00:00Z", "Expected the time of the freeze")
+	resp = serveWithHeaders(s, "DELETE", "/v2/guests/1", "", map[string]string{OverrideReasonHeader: "  "})
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected a reason to be required")
+	resp = serveWithHeaders(s, "POST", "/v2/guests", `{"name": "John Smith", "table": 1}`,
+		map[string]string{OverrideReasonHeader: strings.Repeat("r", 501)})
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code, "Expected the reason to be too long")
+	assert.Empty(t, store.frozen, "Expected no change to be recorded")
+
+	resp = serveWithHeaders(s, "POST", "/v1/guest_list/John+Smith", `{"table": 1, "accompanying_guests": 1}`,
+		override)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the override to add the guest: %s", resp.Body.String())
+	resp = serveWithHeaders(s, "DELETE", "/v2/guests/1", "", map[string]string{OverrideReasonHeader: "Sick"})
+	assert.Equal(t, http.StatusNoContent, resp.Code, "Expected the override to remove the guest")
+	resp = serveWithHeaders(s, "DELETE", "/v1/guest_list/Jane+Doe", "", override)
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Expected an unknown guest not to be recorded")
+
+	resp = serve(s, "GET", "/v2/events/1/freeze_report", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the report: %s", resp.Body.String())
+	assert.JSONEq(t, `{"event_id": 1, "frozen_since": "2020-12-24T20:00:00Z", "frozen": true, "people_added": 2,
+		"people_removed": 2, "changes": [
+			{"id": 1, "event_id": 1, "occurred_at": "2020-12-31T20:00:00Z", "actor": "anonymous",
+				"action": "GUEST_ADDED", "guest_name": "John Smith", "people": 2, "table": 1,
+				"reason": "Plus one of the CEO"},
+			{"id": 2, "event_id": 1, "occurred_at": "2020-12-31T20:00:00Z", "actor": "anonymous",
+				"action": "GUEST_REMOVED", "guest_name": "Mary Queen", "people": 2, "table": 2, "reason": "Sick"}]}`,
+		resp.Body.String(), "Expected the changes after the freeze")
+}
+
+// Test that the guest list of an event far ahead is changed freely and that its report is empty
+func TestServerNotFrozen(t *testing.T) {
+	store := newPartyStore()
+	s := newTestServer(store)
+	s.config.FreezeBefore = 7 * 24 * time.Hour
+	resp := serve(s, "POST", "/v2/events", `{"name": "Summer party", "date": "2021-07-01T18:00:00Z"}`)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the event to be created: %s", resp.Body.String())
+	resp = serve(s, "PUT", "/v2/events/2/tables/1", `{"capacity": 4}`)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the table to be added: %s", resp.Body.String())
+
+	resp = serveWithHeaders(s, "POST", "/v2/events/2/guests", `{"name": "Mary Queen", "table": 1}`, nil)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the guest to be added: %s", resp.Body.String())
+	assert.Empty(t, store.frozen, "Expected no change to be recorded")
+
+	resp = serve(s, "GET", "/v2/events/2/freeze_report", "")
+	assert.JSONEq(t, `{"event_id": 2, "frozen_since": "2021-06-24T18:00:00Z", "frozen": false, "people_added": 0,
+		"people_removed": 0, "changes": []}`, resp.Body.String(), "Expected an empty report")
+	s.config.FreezeBefore = 0
+	resp = serve(s, "GET", "/v2/events/2/freeze_report", "")
+	assert.Contains(t, resp.Body.String(), `"frozen_since":null,"frozen":false`, "Expected no freeze")
+}
+
+// Test that a party larger than planned is only let in with an override once the guest list is frozen
+func TestServerFreezeArrival(t *testing.T) {
+	store := newPartyStore().seed("Jane Doe", 4, 1, "NOT_ARRIVED", 0)
+	s := newTestServer(store)
+	s.config.FreezeBefore = 7 * 24 * time.Hour
+
+	resp := serve(s, "PUT", "/v2/guests/1/arrival", `{"accompanying_guests": 3}`)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the larger party to be kept out")
+	assert.Equal(t, CodeGuestListFrozen, problemCode(t, resp), "Expected the freeze to be reported")
+	assert.Equal(t, "NOT_ARRIVED", store.guest(defaultEventId, "Mary Queen").Status, "Expected no arrival")
+
+	resp = serveWithHeaders(s, "PUT", "/v1/guests/Mary+Queen", `{"accompanying_guests": 3}`,
+		map[string]string{OverrideReasonHeader: "Brought her cousins"})
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the override to let the party in: %s", resp.Body.String())
+	// The planned party or a smaller one is let in without an override
+	resp = serve(s, "PUT", "/v2/guests/3/arrival", `{"accompanying_guests": 1}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the planned party to be let in: %s", resp.Body.String())
+
+	resp = serve(s, "GET", "/v2/events/1/freeze_report", "")
+	assert.JSONEq(t, `{"event_id": 1, "frozen_since": "2020-12-24T20:00:00Z", "frozen": true, "people_added": 2,
+		"people_removed": 0, "changes": [
+			{"id": 1, "event_id": 1, "occurred_at": "2020-12-31T20:00:00Z", "actor": "anonymous",
+				"action": "GUEST_ARRIVED", "guest_name": "Mary Queen", "people": 2, "table": 2,
+				"reason": "Brought her cousins"}]}`, resp.Body.String(), "Expected the people beyond the planned party")
+}
+
+// Test that only an organizer or an administrator overrides the freeze, the door staff is forbidden to
+func TestServerFreezeOverrideRole(t *testing.T) {
+	store := newPartyStore()
+	s := newAuthServer(store)
+	s.config.FreezeBefore = 7 * 24 * time.Hour
+	withReason := func(headers map[string]string) map[string]string {
+		headers[OverrideReasonHeader] = "Brought her cousins"
+		return headers
+	}
+
+	resp := serveWithHeaders(s, "PUT", "/v1/guests/Mary+Queen", `{"accompanying_guests": 3}`,
+		withReason(bearer("door-tablet-1", "door")))
+	assert.Equal(t, http.StatusForbidden, resp.Code, "Expected the override of the door staff to be rejected")
+	assert.Equal(t, CodeForbidden, problemCode(t, resp), "Expected the override to be forbidden")
+	assert.Equal(t, "NOT_ARRIVED", store.guest(defaultEventId, "Mary Queen").Status, "Expected no arrival")
+	assert.Empty(t, store.frozen, "Expected no change to be recorded")
+
+	resp = serveWithHeaders(s, "PUT", "/v1/guests/Mary+Queen", `{"accompanying_guests": 3}`,
+		withReason(map[string]string{APIKeyHeader: testAdminKey}))
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the override of the administrator: %s", resp.Body.String())
+	resp = serveWithHeaders(s, "POST", "/v2/guests", `{"name": "John Smith", "table": 1}`,
+		withReason(bearer("planner", "organizer")))
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the override of the organizer: %s", resp.Body.String())
+	if assert.Len(t, store.frozen, 2, "Expected the overrides to be recorded") {
+		assert.Equal(t, "planner", store.frozen[1].Actor, "Expected the organizer to be recorded")
+	}
+}
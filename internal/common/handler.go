@@ -2,14 +2,12 @@ package common
 
 import (
 	"GuestList/internal/databse"
+	"GuestList/internal/logging"
 	"GuestList/internal/model"
-	"database/sql"
-	"encoding/json"
 	"github.com/gorilla/mux"
 	"html/template"
-	"log"
+	"math"
 	"net/http"
-	"strconv"
 	"strings"
 )
 
@@ -18,65 +16,101 @@ This function adds a new guest to guest list and writes an appropriate message i
 Arguments:
 	resp http.ResponseWriter - HTTP response writer
 	req *http.Request - HTTP request to the REST API
-	db *sql.DB -  MySQL db
 */
-func AddGuest(resp http.ResponseWriter, req *http.Request, db *sql.DB) {
+func (s *Server) AddGuest(resp http.ResponseWriter, req *http.Request) {
 	guest := &model.GuestsList{}
 	// Get the request parameters
 	params := mux.Vars(req)
 
-	// Get the request body
-	errDecoder := json.NewDecoder(req.Body).Decode(&guest)
+	// Get and validate the request body
+	var accompanyingGuests *int
+	errDecoder := decodeBody(req,
+		bodyField{name: "table", required: true, min: 1, max: math.MaxInt32, value: &guest.TableId},
+		bodyField{name: "accompanying_guests", min: 0, max: s.config.MaxPartySize - 1, value: &accompanyingGuests})
 	if errDecoder != nil {
-		log.Println(errDecoder)
-		encodeResponse(resp, map[string]string{"error": errDecoder.Error()}, http.StatusInternalServerError)
+		s.encodeError(resp, req, errDecoder)
 		return
 	}
+	if accompanyingGuests != nil {
+		guest.AccompanyingGuests = *accompanyingGuests
+	}
 
 	// Retrieve name from params
 	guest.Name = strings.Replace(params["name"], "+", " ", -1)
 	// Set the default status for the guest
 	guest.Status = "NOT_ARRIVED"
+	req = withLogFields(req, logging.Guest(guest.Name), logging.Table(*guest.TableId))
 
-	// Check if the table is available
-	free, err := databse.IsTableFree(db, *guest.TableId)
-	if err!= nil {
-		log.Println(errDecoder)
-		encodeResponse(resp, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
-		return
-	}
-	// If the table is already reserved, return the error
-	if !free {
-		log.Println("The table is already reserved")
-		encodeResponse(resp, map[string]string{"error": "table is already reserved"}, http.StatusBadRequest)
+	// Add the guest to a guest list
+	if err := s.addGuest(req, guest); err != nil {
+		s.encodeError(resp, req, err)
 		return
 	}
+	// Encode the response
+	encodeResponse(resp, map[string]string{"name": guest.Name}, http.StatusCreated)
+}
 
-	// Get the available seats on the table
-	availableSeats, err := databse.GetTableCapacity(db, *guest.TableId)
+/* This function adds a guest to the guest list of the event of the request if the table exists, is not reserved
+and has enough empty seats for the guest and the entourage. A guest added to the frozen guest list is recorded for
+the caterer.
+Arguments:
+	req *http.Request - HTTP request to the REST API, carrying the event
+	guest *model.GuestsList - guest to be added, the ID of the added guest is set
+Return:
+	error - any error that occurred
+*/
+func (s *Server) addGuest(req *http.Request, guest *model.GuestsList) error {
+	frozen, err := s.checkFreeze(req)
 	if err != nil {
-		log.Println(errDecoder)
-		encodeResponse(resp, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
-		return
+		return err
 	}
-
-	// Check if the table have enough empty seats
-	if guest.AccompanyingGuests + 1 > availableSeats {
-		log.Println("Not enough seats at the specified table")
-		encodeResponse(resp, map[string]string{"error": "insufficient space at the specified table"}, http.StatusBadRequest)
-		return
+	ctx := req.Context()
+	eventId := eventFromContext(ctx)
+	if err := s.store.CheckTableForGuest(ctx, eventId, *guest.TableId, guest.AccompanyingGuests+1); err != nil {
+		return err
+	}
+	if err := s.store.AddGuestToList(ctx, eventId, guest); err != nil {
+		return err
+	}
+	if frozen != nil {
+		frozen.Action, frozen.GuestName, frozen.People, frozen.TableId = AuditGuestAdded, guest.Name,
+			guest.AccompanyingGuests+1, guest.TableId
+		s.recordFrozenChange(ctx, frozen)
 	}
+	return nil
+}
 
-	// Add the guest to a guest list
-	errDB := databse.AddGuestToList(db, guest)
-	// Error while adding the guest
-	if errDB != nil {
-		log.Println(errDB)
-		encodeResponse(resp, map[string]string{"error": errDB.Error()}, http.StatusInternalServerError)
-		return
+/* This function removes a guest from the guest list of the event of the request. A guest removed from the frozen
+guest list is recorded for the caterer.
+Arguments:
+	req *http.Request - HTTP request to the REST API, carrying the event
+	guestName string - name of the guest
+Return:
+	error - any error that occurred
+*/
+func (s *Server) removeGuest(req *http.Request, guestName string) error {
+	frozen, err := s.checkFreeze(req)
+	if err != nil {
+		return err
 	}
-	// Encode the response
-	encodeResponse(resp, map[string]string{"name": guest.Name}, http.StatusCreated)
+	ctx := req.Context()
+	eventId := eventFromContext(ctx)
+	var guest *model.GuestDetails
+	if frozen != nil {
+		// The caterer is told the number of people and the table the guest had
+		if guest, err = s.store.GetGuestDetails(ctx, eventId, guestName); err != nil {
+			return err
+		}
+	}
+	if err := s.store.DeleteGuestFromList(ctx, eventId, guestName); err != nil {
+		return err
+	}
+	if frozen != nil {
+		frozen.Action, frozen.GuestName, frozen.People, frozen.TableId = AuditGuestRemoved, guestName,
+			guest.PlannedAccompanyingGuests+1, guest.TableId
+		s.recordFrozenChange(ctx, frozen)
+	}
+	return nil
 }
 
 /*
@@ -84,20 +118,20 @@ This function deletes a guest from guest list and writes an appropriate message
 Arguments:
 	resp http.ResponseWriter - HTTP response writer
 	req *http.Request - HTTP request to the REST API
-	db *sql.DB -  MySQL db
 */
-func DeleteGuest(resp http.ResponseWriter, req *http.Request, db *sql.DB) {
+func (s *Server) DeleteGuest(resp http.ResponseWriter, req *http.Request) {
 	// Get the request parameters
 	params := mux.Vars(req)
 
 	// Retrieve name from params. Here, the space in the name will be given as + in the REST API url.
 	// Hence, we replace "+" in guest name with " ".
 	guestName := strings.Replace(params["name"], "+", " ", -1)
+	req = withLogFields(req, logging.Guest(guestName))
 
 	// Deleting guest from the guest list
-	errDB := databse.DeleteGuestFromList(db, guestName)
+	errDB := s.removeGuest(req, guestName)
 	if errDB != nil {
-		encodeResponse(resp, map[string]string{"error": errDB.Error()}, http.StatusBadRequest)
+		s.encodeError(resp, req, errDB)
 		return
 	}
 	// Encode the response
@@ -109,32 +143,19 @@ This function gets all guest from guest list and writes an appropriate message i
 Arguments:
 	resp http.ResponseWriter - HTTP response writer
 	req *http.Request - HTTP request to the REST API
-	db *sql.DB -  MySQL db
 */
-func GetGuestList(resp http.ResponseWriter, req *http.Request, db *sql.DB) {
-	var limit, offset int
-
-	// Get the request parameters
-	params := req.URL.Query()
-	limitVal := params.Get("limit")
-	offsetVal := params.Get("offset")
-
-	// Check if limit and offset are in the request
-	if limitVal != "" {
-		limit, _ = strconv.Atoi(limitVal)
-	} else {
-		limit = model.LIMIT
-	}
-	if offsetVal != "" {
-		offset, _ = strconv.Atoi(offsetVal)
-	} else {
-		offset = model.OFFSET
+func (s *Server) GetGuestList(resp http.ResponseWriter, req *http.Request) {
+	// Get and validate the pagination parameters
+	limit, offset, errPage := decodePage(req, s.config.DefaultLimit, s.config.DefaultOffset)
+	if errPage != nil {
+		s.encodeError(resp, req, errPage)
+		return
 	}
 
 	// Retrieve all guests
-	guestList, err := databse.GetAllGuests(db, limit, offset)
+	guestList, err := s.store.GetAllGuests(req.Context(), eventFromContext(req.Context()), limit, offset)
 	if err != nil {
-		encodeResponse(resp, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
+		s.encodeError(resp, req, err)
 		return
 	}
 	// Encode the response
@@ -142,37 +163,73 @@ func GetGuestList(resp http.ResponseWriter, req *http.Request, db *sql.DB) {
 }
 
 /*
-This function gets all the guests who have arrived to the party and writes
-	an appropriate message in response to the incoming request.
+This function gets the full record of a guest from the guest list and writes an appropriate message in response
+to the incoming request.
 Arguments:
 	resp http.ResponseWriter - HTTP response writer
 	req *http.Request - HTTP request to the REST API
-	db *sql.DB -  MySQL db
 */
-func GetArrivedGuests(resp http.ResponseWriter, req *http.Request, db *sql.DB) {
-	var limit, offset int
+func (s *Server) GetGuest(resp http.ResponseWriter, req *http.Request) {
+	// Get the request parameters
+	params := mux.Vars(req)
+
+	// Retrieve name from params
+	guestName := strings.Replace(params["name"], "+", " ", -1)
+	req = withLogFields(req, logging.Guest(guestName))
+	guest, err := s.store.GetGuestDetails(req.Context(), eventFromContext(req.Context()), guestName)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	// Encode the response
+	encodeResponse(resp, guest, http.StatusOK)
+}
 
+/*
+This function gets the full record of a guest who has arrived to the party and writes an appropriate message
+in response to the incoming request. Guests who have not arrived yet or never arrived are reported as not found.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) GetArrivedGuest(resp http.ResponseWriter, req *http.Request) {
 	// Get the request parameters
-	params := req.URL.Query()
-	limitVal := params.Get("limit")
-	offsetVal := params.Get("offset")
+	params := mux.Vars(req)
 
-	// Check if limit and offset is in the request
-	if limitVal != "" {
-		limit, _ = strconv.Atoi(limitVal)
-	} else {
-		limit = model.LIMIT
+	// Retrieve name from params
+	guestName := strings.Replace(params["name"], "+", " ", -1)
+	req = withLogFields(req, logging.Guest(guestName))
+	guest, err := s.store.GetGuestDetails(req.Context(), eventFromContext(req.Context()), guestName)
+	if err == nil && (guest.Status == "NOT_ARRIVED" || guest.Status == "NO_SHOW") {
+		err = databse.ErrGuestNotFound
 	}
-	if offsetVal != "" {
-		offset, _ = strconv.Atoi(offsetVal)
-	} else {
-		offset = model.OFFSET
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	// Encode the response
+	encodeResponse(resp, guest, http.StatusOK)
+}
+
+/*
+This function gets all the guests who have arrived to the party and writes
+	an appropriate message in response to the incoming request.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) GetArrivedGuests(resp http.ResponseWriter, req *http.Request) {
+	// Get and validate the pagination parameters
+	limit, offset, errPage := decodePage(req, s.config.DefaultLimit, s.config.DefaultOffset)
+	if errPage != nil {
+		s.encodeError(resp, req, errPage)
+		return
 	}
 
 	// Retrieve arrived guests
-	guestList, err := databse.GetArrivedGuests(db, limit, offset)
+	guestList, err := s.store.GetArrivedGuests(req.Context(), eventFromContext(req.Context()), limit, offset)
 	if err != nil {
-		encodeResponse(resp, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
+		s.encodeError(resp, req, err)
 		return
 	}
 	// Encode the response
@@ -185,75 +242,138 @@ in response to the incoming request.
 Arguments:
 	resp http.ResponseWriter - HTTP response writer
 	req *http.Request - HTTP request to the REST API
-	db *sql.DB -  MySQL db
 */
-func UpdateArrivedGuest(resp http.ResponseWriter, req *http.Request, db *sql.DB) {
+func (s *Server) UpdateArrivedGuest(resp http.ResponseWriter, req *http.Request) {
 	// Get the request parameters
 	params := mux.Vars(req)
 
+	// Get and validate the request body
 	guest := &model.GuestsList{}
-	errDecoder := json.NewDecoder(req.Body).Decode(&guest)
+	var accompanyingGuests *int
+	errDecoder := decodeBody(req,
+		bodyField{name: "accompanying_guests", min: 0, max: s.config.MaxPartySize - 1, value: &accompanyingGuests})
 	if errDecoder != nil {
-		log.Println(errDecoder)
-		encodeResponse(resp, map[string]string{"error": errDecoder.Error()}, http.StatusInternalServerError)
+		s.rejectAdmission(resp, req, errDecoder)
 		return
 	}
+	if accompanyingGuests != nil {
+		guest.AccompanyingGuests = *accompanyingGuests
+	}
 	// Retrieve name from params
 	guest.Name = strings.Replace(params["name"], "+", " ", -1)
+	req = withLogFields(req, logging.Guest(guest.Name))
+
+	// Let the guest in
+	if err := s.admitGuest(req, guest); err != nil {
+		s.rejectAdmission(resp, req, err)
+		return
+	}
+	// Encode the response
+	encodeResponse(resp, map[string]string{"name": guest.Name}, http.StatusOK)
+}
+
+/* This function lets a guest in with the accompanying guests if the reserved table has enough seats and records
+the arrival time. A guest who has already arrived or departed is not let in again. A party larger than planned changes the catering numbers, so once the guest list is frozen it is
+only let in with an override, which is reported to the caterer.
+Arguments:
+	req *http.Request - HTTP request to the REST API
+	guest *model.GuestsList - name of the guest and the number of accompanying guests who arrived
+Return:
+	error - any error that occurred
+*/
+func (s *Server) admitGuest(req *http.Request, guest *model.GuestsList) error {
+	eventId := eventFromContext(req.Context())
 	// Get the entry from the guest list
-	entry, err := databse.GetEntryFromGuestList(db, guest.Name)
+	entry, err := s.store.GetEntryFromGuestList(req.Context(), eventId, guest.Name)
 	if err != nil {
-		log.Println(err)
-		encodeResponse(resp, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
-		return
+		return err
+	}
+	if entry.TableId == nil {
+		return databse.ErrTableNotFound
+	}
+	req = withLogFields(req, logging.Table(*entry.TableId))
+	// The table of a departed guest was released, checking the guest in again would hand out the seats twice
+	if entry.Status == "ARRIVED" || entry.Status == "DEPARTED" {
+		return databse.ErrGuestArrived
 	}
 
 	// Get accompanying guests upon arrival
 	arrGuests := guest.AccompanyingGuests
 
+	// The table of a no-show was released, a late guest is only let in if nobody has taken the table meanwhile
+	if entry.Status == "NO_SHOW" {
+		if err := s.store.CheckTableForGuest(req.Context(), eventId, *entry.TableId, arrGuests+1); err != nil {
+			return err
+		}
+	}
+
 	// If a guest arrives with an entourage that is more than the size indicated at the guest list.
 	// Check the capacity of the table and if enough seats are available allow them to come.
+	var change *model.FrozenChange
 	if arrGuests > entry.AccompanyingGuests {
+		if change, err = s.checkFreeze(req); err != nil {
+			return err
+		}
 		// Get the capacity of the reserved table
-		tableCapacity, err := databse.GetTableCapacity(db, *entry.TableId)
+		tableCapacity, err := s.store.GetTableCapacity(req.Context(), eventId, *entry.TableId)
 		if err != nil {
-			log.Println(err)
-			encodeResponse(resp, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
-			return
+			return err
 		}
 
 		if tableCapacity < arrGuests + 1 {
-			encodeResponse(resp, map[string]string{"error": "table cannot accommodate the accompanying guests"}, http.StatusBadRequest)
-			return
+			return databse.ErrInsufficientSeats
 		}
 	}
 
 	// Update the arrival status of the guest in the guest list. This will also record the arrival time.
-	errDB := databse.UpdateGuestStatusToArrive(db, guest, arrGuests)
+	if err := s.store.UpdateGuestStatusToArrive(req.Context(), eventId, guest, arrGuests); err != nil {
+		return err
+	}
+	if change != nil {
+		change.Action, change.GuestName, change.TableId = AuditGuestArrived, guest.Name, entry.TableId
+		change.People = arrGuests - entry.AccompanyingGuests
+		s.recordFrozenChange(req.Context(), change)
+	}
+	return nil
+}
+
+/*
+This function records the departure of a guest from the party together with the departure time and writes
+an appropriate message in response to the incoming request.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) DepartGuest(resp http.ResponseWriter, req *http.Request) {
+	// Get the request parameters
+	params := mux.Vars(req)
+
+	// Retrieve name from params
+	guestName := strings.Replace(params["name"], "+", " ", -1)
+	req = withLogFields(req, logging.Guest(guestName))
 
-	// Error while adding the guest
+	// Record the departure of the guest
+	errDB := s.store.UpdateGuestStatusToDepart(req.Context(), eventFromContext(req.Context()), guestName)
 	if errDB != nil {
-		encodeResponse(resp, map[string]string{"error": errDB.Error()}, http.StatusInternalServerError)
+		s.encodeError(resp, req, errDB)
 		return
 	}
 	// Encode the response
-	encodeResponse(resp, map[string]string{"name": guest.Name}, http.StatusOK)
+	encodeResponse(resp, nil, http.StatusNoContent)
 }
 
 /*
-This function counts all empty seats and writes an appropriate message in response to the incoming request.
+This function counts all empty seats of the event and writes an appropriate message in response to the incoming request.
 Arguments:
 	resp http.ResponseWriter - HTTP response writer
 	req *http.Request - HTTP request to the REST API
-	db *sql.DB -  MySQL db
 */
-func CountEmptySeats(resp http.ResponseWriter, db *sql.DB) {
+func (s *Server) CountEmptySeats(resp http.ResponseWriter, req *http.Request) {
 
 	// Get number of empty seats
-	emptySeats, err := databse.EmptySeats(db)
+	emptySeats, err := s.store.EmptySeats(req.Context(), eventFromContext(req.Context()))
 	if err != nil {
-		log.Println(err)
-		encodeResponse(resp, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
+		s.encodeError(resp, req, err)
 		return
 	}
 	// Encode the response
@@ -265,29 +385,50 @@ This function generates and downloads HTML invitation.
 Arguments:
 	resp http.ResponseWriter - HTTP response writer
 	req *http.Request - HTTP request to the REST API
-	db *sql.DB -  MySQL db
 */
-func GenerateInvitation (resp http.ResponseWriter, req *http.Request,  db *sql.DB) {
+func (s *Server) GenerateInvitation(resp http.ResponseWriter, req *http.Request) {
 	// Get the request parameters
 	params := mux.Vars(req)
 
 	// Retrieve name from params
 	guestName := strings.Replace(params["name"], "+", " ", -1)
-	guest, err := databse.GetGuestInvite(db, guestName)
+	req = withLogFields(req, logging.Guest(guestName))
+	guest, err := s.store.GetGuestInvite(req.Context(), eventFromContext(req.Context()), guestName)
 	if err != nil {
-		log.Println(err)
-		encodeResponse(resp, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
+		s.encodeError(resp, req, err)
+		return
+	}
+	s.writeInvitation(resp, req, guest)
+}
+
+// invitation is the data the invitation template is rendered with
+type invitation struct {
+	*model.GuestsList
+	Event *model.Event
+}
+
+/* This function renders the invitation of the guest to the event of the request as an HTML attachment.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+	guest *model.GuestsList - name and table of the guest
+*/
+func (s *Server) writeInvitation(resp http.ResponseWriter, req *http.Request, guest *model.GuestsList) {
+	event, err := s.store.GetEvent(req.Context(), eventFromContext(req.Context()))
+	if err != nil {
+		s.encodeError(resp, req, err)
 		return
 	}
 	// Parse template
-	tmpl, err := template.ParseFiles("templates/invitation.html")
+	tmpl, err := template.ParseFiles(s.config.InvitationTemplate)
 	if err != nil {
-		log.Println(err)
-		encodeResponse(resp, map[string]string{"error": err.Error()}, http.StatusInternalServerError)
+		s.encodeError(resp, req, err)
 		return
 	}
 	resp.Header().Set("Content-Disposition", "attachment; filename=invitation_"+
-		strings.Replace(guestName, " ", "_", -1)+".html")
-	resp.Header().Set("Content-Type", req.Header.Get("Content-Type"))
-	tmpl.Execute(resp, guest)
+		strings.Replace(guest.Name, " ", "_", -1)+".html")
+	resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(resp, invitation{GuestsList: guest, Event: event}); err != nil {
+		logging.FromContext(req.Context()).Error("rendering the invitation failed", logging.Err(err))
+	}
 }
\ No newline at end of file
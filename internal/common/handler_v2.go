@@ -0,0 +1,277 @@
+package common
+
+import (
+	"GuestList/internal/logging"
+	"GuestList/internal/model"
+	"fmt"
+	"github.com/gorilla/mux"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Names of the guests: letters separated by single spaces, at most as long as the column of the guest list
+var guestNamePattern = regexp.MustCompile(`^[a-zA-Z]+( [a-zA-Z]+)*$`)
+
+const maxGuestNameLength = 50
+
+// Statuses the guests can be listed by
+var guestStatuses = map[string]bool{"NOT_ARRIVED": true, "ARRIVED": true, "DEPARTED": true, "NO_SHOW": true}
+
+// Answers of the guests to the invitation
+var rsvpStatuses = map[string]bool{"PENDING": true, "ACCEPTED": true, "DECLINED": true}
+
+/* This is a helper function to get the guest identified by the ID in the path. The name of the guest is added
+to the log entries of the request.
+Arguments:
+	req *http.Request - HTTP request to the REST API
+Return:
+	*model.Guest - guest
+	*http.Request - request with the logger carrying the guest
+	error - ErrGuestNotFound if no guest has the ID, or any other error that occurred
+*/
+func (s *Server) guestFromPath(req *http.Request) (*model.Guest, *http.Request, error) {
+	// The route only matches digits, an ID out of range is parsed as 0 which no guest has
+	guestId, _ := strconv.ParseInt(mux.Vars(req)["id"], 10, 64)
+	guest, err := s.store.GetGuest(req.Context(), eventFromContext(req.Context()), guestId)
+	if err != nil {
+		return nil, req, err
+	}
+	return guest, withLogFields(req, logging.Guest(guest.Name)), nil
+}
+
+/*
+This function adds a new guest to the guest list and responds with the record of the guest and its location.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) CreateGuest(resp http.ResponseWriter, req *http.Request) {
+	guest := &model.GuestsList{Status: "NOT_ARRIVED"}
+	var name *string
+	var accompanyingGuests *int
+	errDecoder := decodeBody(req,
+		bodyField{name: "name", required: true, min: 1, max: maxGuestNameLength, pattern: guestNamePattern,
+			text: &name},
+		bodyField{name: "table", required: true, min: 1, max: math.MaxInt32, value: &guest.TableId},
+		bodyField{name: "accompanying_guests", min: 0, max: s.config.MaxPartySize - 1, value: &accompanyingGuests})
+	if errDecoder != nil {
+		s.encodeError(resp, req, errDecoder)
+		return
+	}
+	guest.Name = *name
+	if accompanyingGuests != nil {
+		guest.AccompanyingGuests = *accompanyingGuests
+	}
+	req = withLogFields(req, logging.Guest(guest.Name), logging.Table(*guest.TableId))
+
+	if err := s.addGuest(req, guest); err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	created, err := s.store.GetGuest(req.Context(), eventFromContext(req.Context()), guest.Id)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	resp.Header().Set("Location", fmt.Sprintf("%s/%d", strings.TrimSuffix(req.URL.Path, "/"), created.Id))
+	encodeResponse(resp, created, http.StatusCreated)
+}
+
+/*
+This function lists the guests, optionally only those with the given status, in a page envelope.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) ListGuests(resp http.ResponseWriter, req *http.Request) {
+	limit, offset, errPage := decodePage(req, s.config.DefaultLimit, s.config.DefaultOffset)
+	if errPage != nil {
+		s.encodeError(resp, req, errPage)
+		return
+	}
+	status := req.URL.Query().Get("status")
+	if status != "" && !guestStatuses[status] {
+		s.encodeError(resp, req, &apiError{status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+			detail: "invalid parameters: status", fields: []model.FieldError{{Field: "status",
+				Code: FieldOutOfRange, Message: "parameter must be NOT_ARRIVED, ARRIVED, DEPARTED or NO_SHOW"}}})
+		return
+	}
+
+	guests, total, err := s.store.ListGuests(req.Context(), eventFromContext(req.Context()), status, limit, offset)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	page := model.GuestPage{Items: guests, Page: model.Page{Limit: limit, Offset: offset, Total: total}}
+	if limit > 0 && offset+limit < total {
+		query := url.Values{"limit": {strconv.Itoa(limit)}, "offset": {strconv.Itoa(offset + limit)}}
+		if status != "" {
+			query.Set("status", status)
+		}
+		next := req.URL.Path + "?" + query.Encode()
+		page.Page.Next = &next
+	}
+	encodeResponse(resp, page, http.StatusOK)
+}
+
+/*
+This function gets the full record of the guest identified by the ID.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) GetGuestById(resp http.ResponseWriter, req *http.Request) {
+	guest, req, err := s.guestFromPath(req)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	encodeResponse(resp, guest, http.StatusOK)
+}
+
+/*
+This function removes the guest identified by the ID from the guest list.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) DeleteGuestById(resp http.ResponseWriter, req *http.Request) {
+	guest, req, err := s.guestFromPath(req)
+	if err == nil {
+		err = s.removeGuest(req, guest.Name)
+	}
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	encodeResponse(resp, nil, http.StatusNoContent)
+}
+
+/*
+This function generates the invitation of the guest identified by the ID.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) GenerateGuestInvitation(resp http.ResponseWriter, req *http.Request) {
+	guest, req, err := s.guestFromPath(req)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	s.writeInvitation(resp, req, &model.GuestsList{Name: guest.Name, TableId: guest.TableId})
+}
+
+/*
+This function records the arrival of the guest identified by the ID and responds with the updated record.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) RecordArrival(resp http.ResponseWriter, req *http.Request) {
+	var accompanyingGuests *int
+	errDecoder := decodeBody(req,
+		bodyField{name: "accompanying_guests", min: 0, max: s.config.MaxPartySize - 1, value: &accompanyingGuests})
+	if errDecoder != nil {
+		s.rejectAdmission(resp, req, errDecoder)
+		return
+	}
+	guest, req, err := s.guestFromPath(req)
+	if err != nil {
+		s.rejectAdmission(resp, req, err)
+		return
+	}
+	arrival := &model.GuestsList{Name: guest.Name}
+	if accompanyingGuests != nil {
+		arrival.AccompanyingGuests = *accompanyingGuests
+	}
+	if err := s.admitGuest(req, arrival); err != nil {
+		s.rejectAdmission(resp, req, err)
+		return
+	}
+	s.respondWithGuest(resp, req, guest.Id)
+}
+
+/*
+This function records the departure of the guest identified by the ID and responds with the updated record.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) RecordDeparture(resp http.ResponseWriter, req *http.Request) {
+	guest, req, err := s.guestFromPath(req)
+	if err == nil {
+		err = s.store.UpdateGuestStatusToDepart(req.Context(), eventFromContext(req.Context()), guest.Name)
+	}
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	s.respondWithGuest(resp, req, guest.Id)
+}
+
+/*
+This function records the answer of the guest identified by the ID to the invitation and responds with the updated
+record. A guest who declined is not expected at the party, so the guest is never marked as no-show.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) UpdateRSVP(resp http.ResponseWriter, req *http.Request) {
+	var rsvpStatus *string
+	errDecoder := decodeBody(req, bodyField{name: "rsvp_status", required: true, min: 1, max: 20, text: &rsvpStatus})
+	if errDecoder == nil && !rsvpStatuses[*rsvpStatus] {
+		errDecoder = &apiError{status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+			detail: "invalid fields: rsvp_status", fields: []model.FieldError{{Field: "rsvp_status",
+				Code: FieldOutOfRange, Message: "field must be PENDING, ACCEPTED or DECLINED"}}}
+	}
+	if errDecoder != nil {
+		s.encodeError(resp, req, errDecoder)
+		return
+	}
+	guest, req, err := s.guestFromPath(req)
+	if err == nil {
+		err = s.store.UpdateGuestRSVP(req.Context(), eventFromContext(req.Context()), guest.Name, *rsvpStatus)
+	}
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	s.respondWithGuest(resp, req, guest.Id)
+}
+
+// Writes the current record of the guest after a change
+func (s *Server) respondWithGuest(resp http.ResponseWriter, req *http.Request, guestId int64) {
+	guest, err := s.store.GetGuest(req.Context(), eventFromContext(req.Context()), guestId)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	encodeResponse(resp, guest, http.StatusOK)
+}
+
+/*
+This function reports that no route of the version 2 of the REST API matches the path.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) RouteNotFound(resp http.ResponseWriter, req *http.Request) {
+	s.encodeError(resp, req, &apiError{status: http.StatusNotFound, code: CodeRouteNotFound,
+		detail: "no route matches the path"})
+}
+
+/*
+This function reports that the route of the version 2 of the REST API does not support the method.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) MethodNotAllowed(resp http.ResponseWriter, req *http.Request) {
+	s.encodeError(resp, req, &apiError{status: http.StatusMethodNotAllowed, code: CodeMethodNotAllowed,
+		detail: "method " + req.Method + " is not allowed on the path"})
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"GuestList/internal/databse"
+	"GuestList/internal/logging"
+	"GuestList/internal/version"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sync/atomic"
+)
+
+/*
+This function reports that the process is alive. It does not check any dependency.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) Healthz(resp http.ResponseWriter, req *http.Request) {
+	encodeResponse(resp, map[string]string{"status": "ok"}, http.StatusOK)
+}
+
+/*
+This function reports if the service can serve requests: the database is reachable, migrated to the expected
+version and the templates can be parsed. The service is not ready once the shutdown has started.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) Readyz(resp http.ResponseWriter, req *http.Request) {
+	checks := map[string]string{"database": "ok", "migrations": "ok", "templates": "ok", "shutdown": "ok"}
+	ready := true
+	fail := func(check string, result string) {
+		checks[check] = result
+		ready = false
+	}
+
+	if atomic.LoadInt32(&s.shuttingDown) == 1 {
+		fail("shutdown", "shutting down")
+	}
+	// Check if the database is reachable
+	logger := logging.FromContext(req.Context())
+	if err := s.store.Ping(req.Context()); err != nil {
+		logger.Warn("readiness check failed", logging.String("check", "database"), logging.Err(err))
+		fail("database", "unreachable")
+		fail("migrations", "unknown")
+	} else if version, dirty, err := s.store.GetSchemaVersion(req.Context()); err != nil {
+		logger.Warn("readiness check failed", logging.String("check", "migrations"), logging.Err(err))
+		fail("migrations", "unknown")
+	} else if dirty || version != databse.SchemaVersion {
+		fail("migrations", fmt.Sprintf("version %d (dirty: %t), expected %d", version, dirty,
+			databse.SchemaVersion))
+	}
+	// Check if the templates can be parsed
+	if _, err := template.ParseFiles(s.config.InvitationTemplate); err != nil {
+		logger.Warn("readiness check failed", logging.String("check", "templates"), logging.Err(err))
+		fail("templates", "not parseable")
+	}
+
+	status, statusCode := "ready", http.StatusOK
+	if !ready {
+		status, statusCode = "not ready", http.StatusServiceUnavailable
+	}
+	encodeResponse(resp, map[string]interface{}{"status": status, "checks": checks}, statusCode)
+}
+
+/*
+This function reports the build information of the service.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) Version(resp http.ResponseWriter, req *http.Request) {
+	encodeResponse(resp, version.Get(), http.StatusOK)
+}
+
+// StartShutdown marks the service as not ready, so that no new requests are routed to it
+func (s *Server) StartShutdown() {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+}
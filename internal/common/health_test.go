@@ -0,0 +1,67 @@
+package common
+
+import (
+	"GuestList/internal/databse"
+	"GuestList/internal/version"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+// Test the liveness and version endpoints
+func TestHealthzAndVersion(t *testing.T) {
+	store := newPartyStore()
+	store.err = errors.New("dial tcp 127.0.0.1:3306: connect: connection refused")
+	s := newTestServer(store)
+
+	resp := serve(s, "GET", "/healthz", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected alive even without the database")
+	assert.JSONEq(t, `{"status": "ok"}`, resp.Body.String(), "Expected status ok")
+
+	resp = serve(s, "GET", "/version", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected build information")
+	assert.Contains(t, resp.Body.String(), `"version":"`+version.Version+`"`, "Expected version")
+}
+
+// Test the readiness of the service
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name     string
+		prepare  func(*fakeStore, *Server)
+		status   int
+		contains string
+	}{
+		{"ready", func(*fakeStore, *Server) {}, http.StatusOK, `"status":"ready"`},
+		{"database unreachable", func(store *fakeStore, s *Server) {
+			store.err = errors.New("dial tcp 127.0.0.1:3306: connect: connection refused")
+		}, http.StatusServiceUnavailable, `"database":"unreachable"`},
+		{"migrations behind", func(store *fakeStore, s *Server) {
+			store.schemaVersion = 1
+		}, http.StatusServiceUnavailable, fmt.Sprintf(`"migrations":"version 1 (dirty: false), expected %d"`,
+			databse.SchemaVersion)},
+		{"migration failed", func(store *fakeStore, s *Server) {
+			store.dirty = true
+		}, http.StatusServiceUnavailable, `(dirty: true)`},
+		{"template missing", func(store *fakeStore, s *Server) {
+			s.config.InvitationTemplate = "missing.html"
+		}, http.StatusServiceUnavailable, `"templates":"not parseable"`},
+		{"shutting down", func(store *fakeStore, s *Server) {
+			s.StartShutdown()
+		}, http.StatusServiceUnavailable, `"shutdown":"shutting down"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newPartyStore()
+			s := newTestServer(store)
+			test.prepare(store, s)
+
+			resp := serve(s, "GET", "/readyz", "")
+
+			assert.Equal(t, test.status, resp.Code, "Expected different status")
+			assert.Contains(t, resp.Body.String(), test.contains, "Expected different checks")
+			assert.NotContains(t, resp.Body.String(), "127.0.0.1", "Expected no database details")
+		})
+	}
+}
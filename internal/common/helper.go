@@ -1,8 +1,8 @@
 package common
 
 import (
+	"GuestList/internal/logging"
 	"encoding/json"
-	"log"
 	"net/http"
 )
 
@@ -18,7 +18,7 @@ func encodeResponse(response http.ResponseWriter, result interface{}, statusCode
 	if result != nil {
 		err := json.NewEncoder(response).Encode(result)
 		if err != nil {
-			log.Println(err)
+			logging.Default().Error("encoding the response failed", logging.Err(err))
 			errorMsg := []byte("Error while encoding the response")
 			response.WriteHeader(http.StatusInternalServerError)
 			_, _ = response.Write(errorMsg)
@@ -0,0 +1,265 @@
+package common
+
+import (
+	"GuestList/internal/databse"
+	"GuestList/internal/logging"
+	"GuestList/internal/model"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Header carrying the idempotency key of a mutating request
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Header marking a response which was replayed for a repeated request
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// Maximum length of an idempotency key, the length of the column
+const maxIdempotencyKeyLength = 255
+
+// Methods of the requests which change the guest list and can be sent with an idempotency key
+var mutatingMethods = map[string]bool{"POST": true, "PUT": true, "DELETE": true, "PATCH": true}
+
+// Errors reported for the idempotency keys
+var (
+	errIdempotencyKeyReused = &apiError{status: http.StatusUnprocessableEntity, code: CodeIdempotencyKeyReused,
+		detail: "the idempotency key was already used for a different request"}
+	errIdempotencyKeyInUse = &apiError{status: http.StatusConflict, code: CodeIdempotencyKeyInUse,
+		detail: "a request with the idempotency key is still being processed"}
+	errInvalidIdempotencyKey = &apiError{status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+		detail: "invalid header: " + IdempotencyKeyHeader, fields: []model.FieldError{{Field: IdempotencyKeyHeader,
+			Code: FieldInvalid, Message: "header must be 1 to 255 printable ASCII characters without spaces"}}}
+)
+
+/* This middleware makes the mutating requests sent with the Idempotency-Key header safe to retry. The first
+response to a key is stored for idempotency_window and replayed for every repeated request with the header
+Idempotent-Replayed, without calling the handler again. A request which reuses the key for another principal,
+method, path or body is rejected, as is a repeated request while the first one is still processed. Failures of the server are
+not stored, so that the request can be retried with the same key. A request which timed out keeps its key reserved
+until the handler really finishes, the response of the handler is stored then.
+*/
+func (s *Server) idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(IdempotencyKeyHeader)
+		if !mutatingMethods[req.Method] || key == "" {
+			next.ServeHTTP(resp, req)
+			return
+		}
+		if !validIdempotencyKey(key) {
+			s.encodeError(resp, req, errInvalidIdempotencyKey)
+			return
+		}
+		// The body is part of the fingerprint of the request, so it is read here and handed over to the handler
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			if isBodyTooLarge(err) {
+				err = errBodyTooLarge
+			}
+			s.encodeError(resp, req, err)
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req = withLogFields(req, logging.String("idempotency_key", key))
+
+		// The key is released or completed even if the client went away, e.g. on a flaky network
+		ctx := detachedContext{req.Context()}
+		record := &model.IdempotencyRecord{Key: key, Fingerprint: fingerprint(req, body),
+			// The request cannot outlive the write timeout, a key left behind by a crash is free again after it
+			ExpiresAt: s.clock().Add(s.config.WriteTimeout)}
+		stored, err := s.reserveIdempotencyKey(ctx, record)
+		if err != nil {
+			s.encodeError(resp, req, err)
+			return
+		}
+		if stored != nil {
+			s.replay(resp, req, record, stored)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: resp, status: http.StatusOK}
+		// The headers set in front of the handler, e.g. Deprecation, are kept for a late response
+		header := resp.Header().Clone()
+		req, late := withLateHandler(req)
+		handled := false
+		defer func() {
+			// The handler panicked, the request can be retried with the same key
+			if !handled {
+				s.releaseIdempotencyKey(ctx, req, key)
+			}
+		}()
+		next.ServeHTTP(recorder, req)
+		handled = true
+		if late.timedOut() {
+			// The mutation may still be applied, so a retry has to wait for the handler instead of running it again
+			go func() {
+				<-late.finished
+				for name, values := range late.response.header {
+					header[name] = values
+				}
+				s.completeIdempotencyKey(ctx, req, record, late.response.status, header, late.response.body.Bytes())
+			}()
+			return
+		}
+		s.completeIdempotencyKey(ctx, req, record, recorder.status, resp.Header(), recorder.body.Bytes())
+	})
+}
+
+/* This is a helper function to store the response of a request under its idempotency key. The key is released
+instead if the server failed, so that the request can be retried with the same key.
+Arguments:
+	ctx context.Context - context of the request, which is never cancelled
+	req *http.Request - request sent with the key
+	record *model.IdempotencyRecord - key and fingerprint of the request
+	status int - status of the response
+	header http.Header - headers of the response
+	body []byte - body of the response
+*/
+func (s *Server) completeIdempotencyKey(ctx context.Context, req *http.Request, record *model.IdempotencyRecord,
+	status int, header http.Header, body []byte) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status >= http.StatusInternalServerError {
+		s.releaseIdempotencyKey(ctx, req, record.Key)
+		return
+	}
+	record.Status, record.Body = status, body
+	record.Header = make(map[string][]string)
+	for name, values := range header {
+		// The correlation id belongs to the request which is replaying the response
+		if name != http.CanonicalHeaderKey(CorrelationIdHeader) {
+			record.Header[name] = values
+		}
+	}
+	record.ExpiresAt = s.clock().Add(s.config.IdempotencyWindow)
+	if err := s.store.CompleteIdempotencyRecord(ctx, record); err != nil {
+		// The key stays reserved until it expires, the response is not known to a retry
+		logging.FromContext(req.Context()).Error("response not stored for the idempotency key", logging.Err(err))
+	}
+}
+
+// Releases the idempotency key of a request which failed, so that the request can be retried with the same key
+func (s *Server) releaseIdempotencyKey(ctx context.Context, req *http.Request, key string) {
+	if err := s.store.DeleteIdempotencyRecord(ctx, key); err != nil {
+		logging.FromContext(req.Context()).Error("idempotency key not released", logging.Err(err))
+	}
+}
+
+/* This is a helper function to reserve the idempotency key of a request. A key whose window has passed is
+released and reserved again.
+Arguments:
+	ctx context.Context - context of the request
+	record *model.IdempotencyRecord - key, fingerprint and expiry of the request
+Return:
+	*model.IdempotencyRecord - request stored under the key, or nil if the key was reserved for this request
+	error - any error that occurred
+*/
+func (s *Server) reserveIdempotencyKey(ctx context.Context, record *model.IdempotencyRecord) (
+	*model.IdempotencyRecord, error) {
+	// Another request may release or reserve the key in the meantime, so the reservation is tried again
+	for attempt := 0; attempt < 3; attempt++ {
+		err := s.store.CreateIdempotencyRecord(ctx, record)
+		if !errors.Is(err, databse.ErrIdempotencyKeyExists) {
+			return nil, err
+		}
+		stored, err := s.store.GetIdempotencyRecord(ctx, record.Key)
+		if errors.Is(err, databse.ErrIdempotencyKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if stored.ExpiresAt.After(s.clock()) {
+			return stored, nil
+		}
+		if err := s.store.DeleteIdempotencyRecord(ctx, record.Key); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errIdempotencyKeyInUse
+}
+
+// Writes the stored response again if the repeated request is the same as the first one
+func (s *Server) replay(resp http.ResponseWriter, req *http.Request, record *model.IdempotencyRecord,
+	stored *model.IdempotencyRecord) {
+	switch {
+	case stored.Fingerprint != record.Fingerprint:
+		s.encodeError(resp, req, errIdempotencyKeyReused)
+		return
+	case stored.Status == 0:
+		s.encodeError(resp, req, errIdempotencyKeyInUse)
+		return
+	}
+	for name, values := range stored.Header {
+		resp.Header()[name] = values
+	}
+	resp.Header().Set(IdempotentReplayedHeader, "true")
+	logging.FromContext(req.Context()).Debug("response replayed", logging.Int("status", stored.Status))
+	resp.WriteHeader(stored.Status)
+	_, _ = resp.Write(stored.Body)
+}
+
+// Returns whether the key consists of printable ASCII characters without spaces and fits in the column
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the SHA-256 of the principal, method, path and body of the request
+func fingerprint(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	// A key reused by another principal is rejected instead of replaying the response of the first principal
+	if principal := PrincipalFromContext(req.Context()); principal != nil {
+		_, _ = hash.Write([]byte(principal.Method + ":" + principal.Subject + "\n"))
+	}
+	_, _ = hash.Write([]byte(req.Method + " " + req.URL.RequestURI() + "\n"))
+	_, _ = hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// detachedContext keeps the values of the request context, e.g. the logger, but is never cancelled
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+// responseRecorder writes the response and keeps a copy of its status and body
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,175 @@
+package common
+
+import (
+	"GuestList/internal/auth"
+	"GuestList/internal/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sends the request with the idempotency key to the server and returns the recorded response
+func serveWithKey(s *Server, method string, path string, body string, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdempotencyKeyHeader, key)
+	resp := httptest.NewRecorder()
+	s.ServeHTTP(resp, req)
+	return resp
+}
+
+// Returns the code of the problem details in the response
+func problemCode(t *testing.T, resp *httptest.ResponseRecorder) string {
+	var problem model.Problem
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &problem), "Expected problem details")
+	return problem.Code
+}
+
+// Test that a retried request is answered with the first response instead of failing on the duplicate guest
+func TestIdempotencyReplay(t *testing.T) {
+	store := newPartyStore()
+	s := newTestServer(store)
+
+	first := serveWithKey(s, "POST", "/v1/guest_list/John+Smith", `{"table": 1}`, "door-1")
+	assert.Equal(t, http.StatusCreated, first.Code, "Expected guest to be added: %s", first.Body.String())
+	assert.Empty(t, first.Header().Get(IdempotentReplayedHeader), "Expected the first response not to be replayed")
+
+	retry := serveWithKey(s, "POST", "/v1/guest_list/John+Smith", `{"table": 1}`, "door-1")
+	assert.Equal(t, http.StatusCreated, retry.Code, "Expected the first response: %s", retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader), "Expected the response to be replayed")
+	assert.Equal(t, first.Body.String(), retry.Body.String(), "Expected the body of the first response")
+	assert.Equal(t, "application/json", retry.Header().Get("Content-Type"), "Expected the headers of the first response")
+	assert.NotEqual(t, first.Header().Get(CorrelationIdHeader), retry.Header().Get(CorrelationIdHeader),
+		"Expected the correlation id of the retry")
+	assert.Len(t, store.guests, 3, "Expected the guest to be added once")
+
+	// Without a key the retry is processed again and fails
+	resp := serve(s, "POST", "/v1/guest_list/John+Smith", `{"table": 1}`)
+	assert.NotEqual(t, http.StatusCreated, resp.Code, "Expected the retry to be processed again")
+
+	// Rejections are replayed as well, even once the request would succeed
+	resp = serveWithKey(s, "PUT", "/v2/guests/1/arrival", `{"accompanying_guests": 5}`, "door-2")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code, "Expected the table to be too small")
+	store.tables[defaultEventId][2] = 10
+	resp = serveWithKey(s, "PUT", "/v2/guests/1/arrival", `{"accompanying_guests": 5}`, "door-2")
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code, "Expected the first response")
+	assert.Equal(t, CodeInsufficientSeats, problemCode(t, resp), "Expected the first response")
+}
+
+// Test the requests which cannot be answered with the stored response
+func TestIdempotencyConflicts(t *testing.T) {
+	store := newPartyStore()
+	// The guests are only removed while planning
+	store.event(defaultEventId).Phase = PhasePlanning
+	s := newTestServer(store)
+
+	resp := serveWithKey(s, "POST", "/v1/guest_list/John+Smith", `{"table": 1}`, "door-1")
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected guest to be added")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		key    string
+		status int
+		code   string
+	}{
+		{"different body", "POST", "/v1/guest_list/John+Smith", `{"table": 4}`, "door-1",
+			http.StatusUnprocessableEntity, CodeIdempotencyKeyReused},
+		{"different path", "POST", "/v1/guest_list/Jane+Smith", `{"table": 1}`, "door-1",
+			http.StatusUnprocessableEntity, CodeIdempotencyKeyReused},
+		{"different method", "DELETE", "/v1/guest_list/John+Smith", `{"table": 1}`, "door-1",
+			http.StatusUnprocessableEntity, CodeIdempotencyKeyReused},
+		{"key with spaces", "POST", "/v1/guest_list/Jane+Smith", `{"table": 1}`, "door 1",
+			http.StatusUnprocessableEntity, CodeValidationFailed},
+		{"key too long", "POST", "/v1/guest_list/Jane+Smith", `{"table": 1}`, strings.Repeat("k", 256),
+			http.StatusUnprocessableEntity, CodeValidationFailed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := serveWithKey(s, test.method, test.path, test.body, test.key)
+			assert.Equal(t, test.status, resp.Code, "Expected different status: %s", resp.Body.String())
+			assert.Equal(t, test.code, problemCode(t, resp), "Expected different code")
+		})
+	}
+
+	// The first request with the key is still processed
+	first := httptest.NewRequest("POST", "/v1/guest_list/Jane+Smith", nil)
+	first = first.WithContext(context.WithValue(first.Context(), principalKey{},
+		&model.Principal{Subject: "anonymous", Role: auth.RoleAdmin, Method: auth.MethodNone}))
+	store.keys["door-2"] = &model.IdempotencyRecord{Key: "door-2", Fingerprint: fingerprint(first,
+		[]byte(`{"table": 1}`)), ExpiresAt: testNow.Add(time.Second)}
+	resp = serveWithKey(s, "POST", "/v1/guest_list/Jane+Smith", `{"table": 1}`, "door-2")
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the key to be in use")
+	assert.Equal(t, CodeIdempotencyKeyInUse, problemCode(t, resp), "Expected the key to be in use")
+
+	// Reads are not affected by the key
+	resp = serveWithKey(s, "GET", "/v1/guest_list/John+Smith", "", "door-1")
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the guest")
+}
+
+// Test that a key can be used again once the window has passed or the request failed
+func TestIdempotencyRelease(t *testing.T) {
+	store := newPartyStore()
+	s := newTestServer(store)
+
+	store.keys["door-1"] = &model.IdempotencyRecord{Key: "door-1", Fingerprint: "other", Status: http.StatusCreated,
+		ExpiresAt: testNow}
+	resp := serveWithKey(s, "POST", "/v1/guest_list/John+Smith", `{"table": 1}`, "door-1")
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the expired key to be used again")
+	assert.Equal(t, testNow.Add(s.config.IdempotencyWindow), store.keys["door-1"].ExpiresAt,
+		"Expected the response to be stored for the window")
+
+	store.err = errors.New("dial tcp 127.0.0.1:3306: connect: connection refused")
+	resp = serveWithKey(s, "POST", "/v1/guest_list/Jane+Smith", `{"table": 4}`, "door-2")
+	assert.Equal(t, http.StatusInternalServerError, resp.Code, "Expected the store to fail")
+	store.err = nil
+	assert.NotContains(t, store.keys, "door-2", "Expected the key to be released")
+
+	resp = serveWithKey(s, "POST", "/v1/guest_list/Jane+Smith", `{"table": 4}`, "door-2")
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the retry to be processed")
+	assert.Empty(t, resp.Header().Get(IdempotentReplayedHeader), "Expected the retry not to be replayed")
+}
+
+// Test that the key of a request which timed out stays reserved until the handler finishes and stores its response
+func TestIdempotencyTimeout(t *testing.T) {
+	s := newTestServer(newFakeStore())
+	release := make(chan struct{})
+	calls := 0
+	handler := Chain(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		calls++
+		<-release
+		encodeResponse(resp, map[string]int{"event_id": 2}, http.StatusCreated)
+	}), s.idempotency, Timeout(10*time.Millisecond))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v2/events/1/clone", strings.NewReader(`{"date": "2021-12-31"}`))
+		req.Header.Set(IdempotencyKeyHeader, "clone-1")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := send()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code, "Expected the request to time out")
+	resp = send()
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the key to stay reserved")
+	assert.Equal(t, CodeIdempotencyKeyInUse, problemCode(t, resp), "Expected the key to be in use")
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		record, err := s.store.GetIdempotencyRecord(context.Background(), "clone-1")
+		return err == nil && record.Status == http.StatusCreated
+	}, time.Second, time.Millisecond, "Expected the late response to be stored")
+	resp = send()
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the late response: %s", resp.Body.String())
+	assert.JSONEq(t, `{"event_id": 2}`, resp.Body.String(), "Expected the late response")
+	assert.Equal(t, "true", resp.Header().Get(IdempotentReplayedHeader), "Expected the response to be replayed")
+	assert.Equal(t, 1, calls, "Expected the handler to be called once")
+}
@@ -0,0 +1,419 @@
+package common
+
+import (
+	"GuestList/internal/databse"
+	"GuestList/internal/model"
+	"GuestList/internal/tracing"
+	"context"
+	"time"
+)
+
+// instrumentedStore measures the latency of every call to the store and traces it in a span
+type instrumentedStore struct {
+	store   databse.Store
+	metrics *serverMetrics
+	tracer  *tracing.Tracer
+	clock   func() time.Time
+}
+
+/* This function starts the span of a call to the store. The returned function has to be called with the result
+of the call, it records the latency and ends the span.
+Arguments:
+	ctx context.Context - context of the request
+	function string - name of the store function
+Return:
+	context.Context - context carrying the span of the call
+	func(error) - function finishing the call
+*/
+func (i *instrumentedStore) begin(ctx context.Context, function string) (context.Context, func(error)) {
+	start := i.clock()
+	ctx, span := i.tracer.Start(ctx, "store."+function, tracing.KindClient)
+	span.SetAttribute("db.system", "mysql")
+	span.SetAttribute("db.operation", function)
+	return ctx, func(err error) {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		i.metrics.queryDuration.Observe(i.clock().Sub(start).Seconds(), function, result)
+		span.SetError(err)
+		span.End()
+	}
+}
+
+func (i *instrumentedStore) CreateEvent(ctx context.Context, event *model.Event) error {
+	ctx, done := i.begin(ctx, "CreateEvent")
+	err := i.store.CreateEvent(ctx, event)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) GetEvent(ctx context.Context, eventId int64) (*model.Event, error) {
+	ctx, done := i.begin(ctx, "GetEvent")
+	event, err := i.store.GetEvent(ctx, eventId)
+	done(err)
+	return event, err
+}
+
+func (i *instrumentedStore) ListEvents(ctx context.Context, status string, limit int, offset int) ([]model.Event, int,
+	error) {
+	ctx, done := i.begin(ctx, "ListEvents")
+	events, total, err := i.store.ListEvents(ctx, status, limit, offset)
+	done(err)
+	return events, total, err
+}
+
+func (i *instrumentedStore) UpdateEvent(ctx context.Context, event *model.Event) error {
+	ctx, done := i.begin(ctx, "UpdateEvent")
+	err := i.store.UpdateEvent(ctx, event)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) ListTables(ctx context.Context, eventId int64, limit int,
+	offset int) ([]model.TableOccupancy, int, error) {
+	ctx, done := i.begin(ctx, "ListTables")
+	tables, total, err := i.store.ListTables(ctx, eventId, limit, offset)
+	done(err)
+	return tables, total, err
+}
+
+func (i *instrumentedStore) SaveTable(ctx context.Context, eventId int64, tableId int, capacity int) (bool, error) {
+	ctx, done := i.begin(ctx, "SaveTable")
+	created, err := i.store.SaveTable(ctx, eventId, tableId, capacity)
+	done(err)
+	return created, err
+}
+
+func (i *instrumentedStore) DeleteTable(ctx context.Context, eventId int64, tableId int) error {
+	ctx, done := i.begin(ctx, "DeleteTable")
+	err := i.store.DeleteTable(ctx, eventId, tableId)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) CloneEvent(ctx context.Context, clone *model.EventClone) error {
+	ctx, done := i.begin(ctx, "CloneEvent")
+	err := i.store.CloneEvent(ctx, clone)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) UpdateEventPhase(ctx context.Context, eventId int64, from string, to string) error {
+	ctx, done := i.begin(ctx, "UpdateEventPhase")
+	err := i.store.UpdateEventPhase(ctx, eventId, from, to)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) CloseEvent(ctx context.Context, eventId int64, closedAt time.Time) (*model.EventSummary,
+	error) {
+	ctx, done := i.begin(ctx, "CloseEvent")
+	summary, err := i.store.CloseEvent(ctx, eventId, closedAt)
+	done(err)
+	return summary, err
+}
+
+func (i *instrumentedStore) GetEventSummary(ctx context.Context, eventId int64) (*model.EventSummary, error) {
+	ctx, done := i.begin(ctx, "GetEventSummary")
+	summary, err := i.store.GetEventSummary(ctx, eventId)
+	done(err)
+	return summary, err
+}
+
+func (i *instrumentedStore) AppendFrozenChange(ctx context.Context, change *model.FrozenChange) error {
+	ctx, done := i.begin(ctx, "AppendFrozenChange")
+	err := i.store.AppendFrozenChange(ctx, change)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) ListFrozenChanges(ctx context.Context, eventId int64) ([]model.FrozenChange, error) {
+	ctx, done := i.begin(ctx, "ListFrozenChanges")
+	changes, err := i.store.ListFrozenChanges(ctx, eventId)
+	done(err)
+	return changes, err
+}
+
+func (i *instrumentedStore) AddGuestToList(ctx context.Context, eventId int64, guest *model.GuestsList) error {
+	ctx, done := i.begin(ctx, "AddGuestToList")
+	err := i.store.AddGuestToList(ctx, eventId, guest)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) DeleteGuestFromList(ctx context.Context, eventId int64, guestName string) error {
+	ctx, done := i.begin(ctx, "DeleteGuestFromList")
+	err := i.store.DeleteGuestFromList(ctx, eventId, guestName)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) GetAllGuests(ctx context.Context, eventId int64, limit int, offset int) ([]model.GuestsList,
+	error) {
+	ctx, done := i.begin(ctx, "GetAllGuests")
+	guestList, err := i.store.GetAllGuests(ctx, eventId, limit, offset)
+	done(err)
+	return guestList, err
+}
+
+func (i *instrumentedStore) GetGuestDetails(ctx context.Context, eventId int64, guestName string) (*model.GuestDetails,
+	error) {
+	ctx, done := i.begin(ctx, "GetGuestDetails")
+	guest, err := i.store.GetGuestDetails(ctx, eventId, guestName)
+	done(err)
+	return guest, err
+}
+
+func (i *instrumentedStore) GetGuest(ctx context.Context, eventId int64, guestId int64) (*model.Guest, error) {
+	ctx, done := i.begin(ctx, "GetGuest")
+	guest, err := i.store.GetGuest(ctx, eventId, guestId)
+	done(err)
+	return guest, err
+}
+
+func (i *instrumentedStore) ListGuests(ctx context.Context, eventId int64, status string, limit int,
+	offset int) ([]model.Guest, int, error) {
+	ctx, done := i.begin(ctx, "ListGuests")
+	guests, total, err := i.store.ListGuests(ctx, eventId, status, limit, offset)
+	done(err)
+	return guests, total, err
+}
+
+func (i *instrumentedStore) GetGuestInvite(ctx context.Context, eventId int64, guestName string) (*model.GuestsList,
+	error) {
+	ctx, done := i.begin(ctx, "GetGuestInvite")
+	guest, err := i.store.GetGuestInvite(ctx, eventId, guestName)
+	done(err)
+	return guest, err
+}
+
+func (i *instrumentedStore) GetEntryFromGuestList(ctx context.Context, eventId int64,
+	guestName string) (*model.GuestsList, error) {
+	ctx, done := i.begin(ctx, "GetEntryFromGuestList")
+	guest, err := i.store.GetEntryFromGuestList(ctx, eventId, guestName)
+	done(err)
+	return guest, err
+}
+
+func (i *instrumentedStore) GetTableCapacity(ctx context.Context, eventId int64, tableId int) (int, error) {
+	ctx, done := i.begin(ctx, "GetTableCapacity")
+	capacity, err := i.store.GetTableCapacity(ctx, eventId, tableId)
+	done(err)
+	return capacity, err
+}
+
+func (i *instrumentedStore) CheckTableForGuest(ctx context.Context, eventId int64, tableId int, partySize int) error {
+	ctx, done := i.begin(ctx, "CheckTableForGuest")
+	err := i.store.CheckTableForGuest(ctx, eventId, tableId, partySize)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) UpdateGuestStatusToArrive(ctx context.Context, eventId int64, guest *model.GuestsList,
+	arrGuests int) error {
+	ctx, done := i.begin(ctx, "UpdateGuestStatusToArrive")
+	err := i.store.UpdateGuestStatusToArrive(ctx, eventId, guest, arrGuests)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) UpdateGuestStatusToDepart(ctx context.Context, eventId int64, guestName string) error {
+	ctx, done := i.begin(ctx, "UpdateGuestStatusToDepart")
+	err := i.store.UpdateGuestStatusToDepart(ctx, eventId, guestName)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) UpdateGuestRSVP(ctx context.Context, eventId int64, guestName string,
+	rsvpStatus string) error {
+	ctx, done := i.begin(ctx, "UpdateGuestRSVP")
+	err := i.store.UpdateGuestRSVP(ctx, eventId, guestName, rsvpStatus)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) GetArrivedGuests(ctx context.Context, eventId int64, limit int,
+	offset int) ([]model.GuestsList, error) {
+	ctx, done := i.begin(ctx, "GetArrivedGuests")
+	guestList, err := i.store.GetArrivedGuests(ctx, eventId, limit, offset)
+	done(err)
+	return guestList, err
+}
+
+func (i *instrumentedStore) MarkNoShows(ctx context.Context, startedBefore time.Time) (map[int64]int, error) {
+	ctx, done := i.begin(ctx, "MarkNoShows")
+	marked, err := i.store.MarkNoShows(ctx, startedBefore)
+	done(err)
+	return marked, err
+}
+
+func (i *instrumentedStore) ListNoShows(ctx context.Context, eventId int64) ([]model.Guest, error) {
+	ctx, done := i.begin(ctx, "ListNoShows")
+	guests, err := i.store.ListNoShows(ctx, eventId)
+	done(err)
+	return guests, err
+}
+
+func (i *instrumentedStore) EmptySeats(ctx context.Context, eventId int64) (int, error) {
+	ctx, done := i.begin(ctx, "EmptySeats")
+	emptySeats, err := i.store.EmptySeats(ctx, eventId)
+	done(err)
+	return emptySeats, err
+}
+
+func (i *instrumentedStore) GetPartyStats(ctx context.Context, eventId int64) (*model.PartyStats, error) {
+	ctx, done := i.begin(ctx, "GetPartyStats")
+	stats, err := i.store.GetPartyStats(ctx, eventId)
+	done(err)
+	return stats, err
+}
+
+func (i *instrumentedStore) CreateIdempotencyRecord(ctx context.Context, record *model.IdempotencyRecord) error {
+	ctx, done := i.begin(ctx, "CreateIdempotencyRecord")
+	err := i.store.CreateIdempotencyRecord(ctx, record)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) GetIdempotencyRecord(ctx context.Context, key string) (*model.IdempotencyRecord, error) {
+	ctx, done := i.begin(ctx, "GetIdempotencyRecord")
+	record, err := i.store.GetIdempotencyRecord(ctx, key)
+	done(err)
+	return record, err
+}
+
+func (i *instrumentedStore) CompleteIdempotencyRecord(ctx context.Context, record *model.IdempotencyRecord) error {
+	ctx, done := i.begin(ctx, "CompleteIdempotencyRecord")
+	err := i.store.CompleteIdempotencyRecord(ctx, record)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	ctx, done := i.begin(ctx, "DeleteIdempotencyRecord")
+	err := i.store.DeleteIdempotencyRecord(ctx, key)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) PurgeIdempotencyRecords(ctx context.Context, before time.Time) (int, error) {
+	ctx, done := i.begin(ctx, "PurgeIdempotencyRecords")
+	deleted, err := i.store.PurgeIdempotencyRecords(ctx, before)
+	done(err)
+	return deleted, err
+}
+
+func (i *instrumentedStore) CreateAPIKey(ctx context.Context, key *model.APIKey) error {
+	ctx, done := i.begin(ctx, "CreateAPIKey")
+	err := i.store.CreateAPIKey(ctx, key)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) GetAPIKeyByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	ctx, done := i.begin(ctx, "GetAPIKeyByHash")
+	key, err := i.store.GetAPIKeyByHash(ctx, hash)
+	done(err)
+	return key, err
+}
+
+func (i *instrumentedStore) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	ctx, done := i.begin(ctx, "ListAPIKeys")
+	keys, err := i.store.ListAPIKeys(ctx)
+	done(err)
+	return keys, err
+}
+
+func (i *instrumentedStore) RevokeAPIKey(ctx context.Context, keyId int64, revokedAt time.Time) error {
+	ctx, done := i.begin(ctx, "RevokeAPIKey")
+	err := i.store.RevokeAPIKey(ctx, keyId, revokedAt)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) AppendAuditEntry(ctx context.Context, entry *model.AuditEntry) error {
+	ctx, done := i.begin(ctx, "AppendAuditEntry")
+	err := i.store.AppendAuditEntry(ctx, entry)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) ListAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, int,
+	error) {
+	ctx, done := i.begin(ctx, "ListAuditEntries")
+	entries, total, err := i.store.ListAuditEntries(ctx, filter)
+	done(err)
+	return entries, total, err
+}
+
+func (i *instrumentedStore) GetAuditChainHead(ctx context.Context) (string, error) {
+	ctx, done := i.begin(ctx, "GetAuditChainHead")
+	head, err := i.store.GetAuditChainHead(ctx)
+	done(err)
+	return head, err
+}
+
+func (i *instrumentedStore) SaveJob(ctx context.Context, job *model.Job) error {
+	ctx, done := i.begin(ctx, "SaveJob")
+	err := i.store.SaveJob(ctx, job)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) GetJob(ctx context.Context, name string) (*model.Job, error) {
+	ctx, done := i.begin(ctx, "GetJob")
+	job, err := i.store.GetJob(ctx, name)
+	done(err)
+	return job, err
+}
+
+func (i *instrumentedStore) ListJobs(ctx context.Context) ([]model.Job, error) {
+	ctx, done := i.begin(ctx, "ListJobs")
+	jobs, err := i.store.ListJobs(ctx)
+	done(err)
+	return jobs, err
+}
+
+func (i *instrumentedStore) UpdateJobPaused(ctx context.Context, name string, paused bool) error {
+	ctx, done := i.begin(ctx, "UpdateJobPaused")
+	err := i.store.UpdateJobPaused(ctx, name, paused)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) ClaimJobRun(ctx context.Context, run *model.JobRun, abandonBefore time.Time) error {
+	ctx, done := i.begin(ctx, "ClaimJobRun")
+	err := i.store.ClaimJobRun(ctx, run, abandonBefore)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) FinishJobRun(ctx context.Context, run *model.JobRun) error {
+	ctx, done := i.begin(ctx, "FinishJobRun")
+	err := i.store.FinishJobRun(ctx, run)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) ListJobRuns(ctx context.Context, name string, limit int, offset int) ([]model.JobRun,
+	int, error) {
+	ctx, done := i.begin(ctx, "ListJobRuns")
+	runs, total, err := i.store.ListJobRuns(ctx, name, limit, offset)
+	done(err)
+	return runs, total, err
+}
+
+func (i *instrumentedStore) Ping(ctx context.Context) error {
+	ctx, done := i.begin(ctx, "Ping")
+	err := i.store.Ping(ctx)
+	done(err)
+	return err
+}
+
+func (i *instrumentedStore) GetSchemaVersion(ctx context.Context) (uint, bool, error) {
+	ctx, done := i.begin(ctx, "GetSchemaVersion")
+	version, dirty, err := i.store.GetSchemaVersion(ctx)
+	done(err)
+	return version, dirty, err
+}
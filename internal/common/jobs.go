@@ -0,0 +1,154 @@
+package common
+
+import (
+	"GuestList/internal/logging"
+	"GuestList/internal/model"
+	"GuestList/internal/scheduler"
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Names of the jobs run by the scheduler
+const (
+	JobPurgeIdempotencyKeys = "purge_idempotency_keys"
+	JobMarkNoShows          = "mark_no_shows"
+)
+
+// Time a run of a job may take
+const jobTimeout = 5 * time.Minute
+
+// Registers the jobs run by the scheduler, their definitions are stored when the scheduler is started
+func (s *Server) registerJobs() {
+	s.scheduler.Register(scheduler.Job{Name: JobPurgeIdempotencyKeys,
+		Description: "Delete the idempotency keys whose responses are not replayed anymore", Interval: time.Hour,
+		Timeout: jobTimeout, Run: func(ctx context.Context, now time.Time) (int, error) {
+			return s.store.PurgeIdempotencyRecords(ctx, now)
+		}})
+	s.scheduler.Register(scheduler.Job{Name: JobMarkNoShows,
+		Description: "Mark the guests who have not arrived no_show_after the start of an open event as no-shows and " +
+			"release their tables", Interval: time.Minute, Timeout: jobTimeout,
+		Run: func(ctx context.Context, now time.Time) (int, error) {
+			if s.config.NoShowAfter == 0 {
+				return 0, nil
+			}
+			marked, err := s.store.MarkNoShows(ctx, now.Add(-s.config.NoShowAfter))
+			total := 0
+			for _, guests := range marked {
+				total += guests
+			}
+			return total, err
+		}})
+}
+
+// StartJobs stores the jobs and runs them when they are due, checking every scheduler_interval
+func (s *Server) StartJobs() error {
+	return s.scheduler.Start(context.Background(), s.config.SchedulerInterval)
+}
+
+// StopJobs stops running the due jobs and waits for the runs in progress
+func (s *Server) StopJobs() {
+	s.scheduler.Stop()
+}
+
+/*
+This function lists the jobs with their schedule.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) ListJobs(resp http.ResponseWriter, req *http.Request) {
+	jobs, err := s.store.ListJobs(req.Context())
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	encodeResponse(resp, jobs, http.StatusOK)
+}
+
+/*
+This function pauses or resumes the scheduled runs of a job, the body is {"paused": bool}. A paused job can still be
+triggered.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) UpdateJob(resp http.ResponseWriter, req *http.Request) {
+	var paused *bool
+	if err := decodeBody(req, bodyField{name: "paused", required: true, flag: &paused}); err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	name := mux.Vars(req)["name"]
+	if err := s.store.UpdateJobPaused(req.Context(), name, *paused); err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	job, err := s.store.GetJob(req.Context(), name)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	logging.FromContext(req.Context()).Info("job updated", logging.String("job", name),
+		logging.Bool("paused", job.Paused))
+	encodeResponse(resp, job, http.StatusOK)
+}
+
+/*
+This function triggers a run of a job, which runs in the background. The response is the run as claimed, the
+outcome of the run is listed in the runs of the job.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) TriggerJob(resp http.ResponseWriter, req *http.Request) {
+	actor := auditSystemActor
+	if principal := PrincipalFromContext(req.Context()); principal != nil {
+		actor = principal.Subject
+	}
+	name := mux.Vars(req)["name"]
+	run, err := s.scheduler.Trigger(req.Context(), name, actor)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	resp.Header().Set("Location", fmt.Sprintf("/admin/jobs/%s/runs", name))
+	encodeResponse(resp, run, http.StatusAccepted)
+}
+
+/*
+This function lists the runs of a job, the latest first.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) ListJobRuns(resp http.ResponseWriter, req *http.Request) {
+	limit, offset, err := decodePage(req, s.config.DefaultLimit, s.config.DefaultOffset)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	name := mux.Vars(req)["name"]
+	if _, err := s.store.GetJob(req.Context(), name); err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+
+	runs, total, err := s.store.ListJobRuns(req.Context(), name, limit, offset)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	page := model.JobRunPage{Items: runs, Page: model.Page{Limit: limit, Offset: offset, Total: total}}
+	if limit > 0 && offset+limit < total {
+		query := req.URL.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("offset", strconv.Itoa(offset+limit))
+		next := req.URL.Path + "?" + query.Encode()
+		page.Page.Next = &next
+	}
+	encodeResponse(resp, page, http.StatusOK)
+}
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"GuestList/internal/model"
+	"GuestList/internal/scheduler"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Test listing, pausing and triggering the jobs, and the history of their runs
+func TestServerJobs(t *testing.T) {
+	store := newFakeStore()
+	store.keys["expired"] = &model.IdempotencyRecord{Key: "expired", ExpiresAt: testNow.Add(-time.Minute)}
+	store.keys["replayed"] = &model.IdempotencyRecord{Key: "replayed", ExpiresAt: testNow.Add(time.Hour)}
+	s := newTestServer(store)
+	s.config.SchedulerInterval = time.Hour
+	assert.Nil(t, s.StartJobs(), "Expected the jobs to be started")
+	defer s.StopJobs()
+
+	resp := serve(s, "GET", "/admin/jobs", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the jobs: %s", resp.Body.String())
+	assert.JSONEq(t, `[{"name": "mark_no_shows", "description": "Mark the guests who have not arrived `+
+		`no_show_after the start of an open event as no-shows and release their tables", "interval_seconds": 60,
+		"paused": false, "next_run_at": "2020-12-31T20:00:00Z"},
+		{"name": "purge_idempotency_keys", "description": "Delete the idempotency keys whose `+
+		`responses are not replayed anymore", "interval_seconds": 3600, "paused": false,
+		"next_run_at": "2020-12-31T20:00:00Z"}]`, resp.Body.String(), "Expected the stored jobs")
+
+	s.scheduler.RunDue(context.Background())
+	_, replayed := store.keys["replayed"]
+	assert.Len(t, store.keys, 1, "Expected the expired key to be purged")
+	assert.True(t, replayed, "Expected the key to be kept until it expires")
+
+	resp = serve(s, "PUT", "/admin/jobs/purge_idempotency_keys", `{"paused": true}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the job to be paused: %s", resp.Body.String())
+	assert.Contains(t, resp.Body.String(), `"paused":true,"next_run_at":"2020-12-31T21:00:00Z"`,
+		"Expected the paused job with its schedule")
+	resp = serve(s, "POST", "/admin/jobs/purge_idempotency_keys/runs", "")
+	assert.Equal(t, http.StatusAccepted, resp.Code, "Expected the paused job to be triggered: %s",
+		resp.Body.String())
+	assert.Equal(t, "/admin/jobs/purge_idempotency_keys/runs", resp.Header().Get("Location"),
+		"Expected the location of the runs")
+	assert.Contains(t, resp.Body.String(), `"trigger":"MANUAL","actor":"anonymous"`, "Expected the triggered run")
+	s.scheduler.Wait()
+
+	resp = serve(s, "GET", "/admin/jobs/purge_idempotency_keys/runs?limit=1", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the runs: %s", resp.Body.String())
+	assert.JSONEq(t, `{"items": [{"id": 3, "job_name": "purge_idempotency_keys", "trigger": "MANUAL",
+		"actor": "anonymous", "scheduled_at": "2020-12-31T20:00:00Z", "started_at": "2020-12-31T20:00:00Z",
+		"finished_at": "2020-12-31T20:00:00Z", "status": "SUCCEEDED", "affected": 0, "error": ""}],
+		"page": {"limit": 1, "offset": 0, "total": 2,
+			"next": "/admin/jobs/purge_idempotency_keys/runs?limit=1&offset=1"}}`, resp.Body.String(),
+		"Expected the latest run first")
+}
+
+// Test that an unknown job, a job still running and an invalid body are rejected
+func TestServerJobErrors(t *testing.T) {
+	store := newFakeStore()
+	s := newTestServer(store)
+	s.config.SchedulerInterval = time.Hour
+	assert.Nil(t, s.StartJobs(), "Expected the jobs to be started")
+	defer s.StopJobs()
+	store.runs = append(store.runs, &model.JobRun{Id: 1, JobName: JobPurgeIdempotencyKeys,
+		Trigger: scheduler.TriggerScheduled, Actor: scheduler.SystemActor, StartedAt: testNow,
+		Status: scheduler.StatusRunning})
+
+	resp := serve(s, "POST", "/admin/jobs/purge_idempotency_keys/runs", "")
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the running job not to be triggered")
+	assert.Equal(t, CodeJobRunning, problemCode(t, resp), "Expected the job to be running")
+	resp = serve(s, "PUT", "/admin/jobs/purge_idempotency_keys", `{"paused": "yes"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code, "Expected the body to be rejected")
+
+	for _, test := range []struct{ method, path, body string }{
+		{"PUT", "/admin/jobs/unknown", `{"paused": true}`},
+		{"POST", "/admin/jobs/unknown/runs", ""},
+		{"GET", "/admin/jobs/unknown/runs", ""},
+	} {
+		resp = serve(s, test.method, test.path, test.body)
+		assert.Equal(t, http.StatusNotFound, resp.Code, "Expected %s %s to be not found", test.method, test.path)
+		assert.Equal(t, CodeJobNotFound, problemCode(t, resp), "Expected %s %s to be not found", test.method,
+			test.path)
+	}
+}
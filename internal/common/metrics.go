@@ -0,0 +1,129 @@
+package common
+
+import (
+	"GuestList/internal/databse"
+	"GuestList/internal/logging"
+	"GuestList/internal/metrics"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Maximum number of active events whose party gauges are exposed
+const maxMetricEvents = 100
+
+// serverMetrics are the metrics exposed by the server on /metrics
+type serverMetrics struct {
+	registry *metrics.Registry
+
+	requests        *metrics.CounterVec
+	requestDuration *metrics.HistogramVec
+	queryDuration   *metrics.HistogramVec
+	rejections      *metrics.CounterVec
+
+	invitedGuests  *metrics.GaugeVec
+	arrivedPeople  *metrics.GaugeVec
+	emptySeats     *metrics.GaugeVec
+	tableOccupancy *metrics.GaugeVec
+	tableCapacity  *metrics.GaugeVec
+}
+
+// Creates the metrics of the server, the party gauges of the active events are read from the store on every scrape
+func newServerMetrics(store databse.Store, logger *logging.Logger) *serverMetrics {
+	registry := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry: registry,
+		requests: registry.NewCounterVec("guestlist_http_requests_total",
+			"Number of HTTP requests by route, method and status.", "route", "method", "status"),
+		requestDuration: registry.NewHistogramVec("guestlist_http_request_duration_seconds",
+			"Latency of the HTTP requests by route, method and status.", metrics.DefaultBuckets,
+			"route", "method", "status"),
+		queryDuration: registry.NewHistogramVec("guestlist_db_query_duration_seconds",
+			"Latency of the database queries by function and result.", metrics.DefaultBuckets,
+			"function", "result"),
+		rejections: registry.NewCounterVec("guestlist_admissions_rejected_total",
+			"Number of guests turned away at the door by reason.", "reason"),
+		invitedGuests: registry.NewGaugeVec("guestlist_invited_guests",
+			"Number of guests on the guest list of the event.", "event"),
+		arrivedPeople: registry.NewGaugeVec("guestlist_arrived_people",
+			"Number of people at the event including the accompanying guests.", "event"),
+		emptySeats: registry.NewGaugeVec("guestlist_empty_seats",
+			"Number of empty seats at the event.", "event"),
+		tableOccupancy: registry.NewGaugeVec("guestlist_table_occupied_seats",
+			"Number of people seated at the table.", "event", "table"),
+		tableCapacity: registry.NewGaugeVec("guestlist_table_capacity_seats",
+			"Number of seats at the table.", "event", "table"),
+	}
+	registry.OnCollect(func() {
+		ctx := logging.NewContext(context.Background(), logger)
+		events, _, err := store.ListEvents(ctx, "ACTIVE", maxMetricEvents, 0)
+		if err != nil {
+			logger.Error("collecting the party statistics failed", logging.Err(err))
+			return
+		}
+		// The events which are not active anymore are dropped from the gauges
+		for _, gauge := range []*metrics.GaugeVec{m.invitedGuests, m.arrivedPeople, m.emptySeats, m.tableOccupancy,
+			m.tableCapacity} {
+			gauge.Reset()
+		}
+		for _, event := range events {
+			stats, err := store.GetPartyStats(ctx, event.Id)
+			if err != nil {
+				logger.Error("collecting the party statistics failed", logging.Event(event.Id), logging.Err(err))
+				continue
+			}
+			eventId := strconv.FormatInt(event.Id, 10)
+			m.invitedGuests.Set(float64(stats.InvitedGuests), eventId)
+			m.arrivedPeople.Set(float64(stats.ArrivedPeople), eventId)
+			m.emptySeats.Set(float64(stats.EmptySeats), eventId)
+			for _, table := range stats.Tables {
+				m.tableOccupancy.Set(float64(table.Occupied), eventId, strconv.Itoa(table.TableId))
+				m.tableCapacity.Set(float64(table.Capacity), eventId, strconv.Itoa(table.TableId))
+			}
+		}
+	})
+	return m
+}
+
+/*
+This function writes the metrics in the Prometheus text exposition format.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) Metrics(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", metrics.ContentType)
+	if err := s.metrics.registry.Write(resp); err != nil {
+		logging.FromContext(req.Context()).Error("writing the metrics failed", logging.Err(err))
+	}
+}
+
+/* This middleware counts the requests and measures their latency by route template, so that the guest names
+do not end up in the labels.
+*/
+func (s *Server) measure(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		start := s.clock()
+		recorder := &statusRecorder{ResponseWriter: resp, status: http.StatusOK}
+		next.ServeHTTP(recorder, req)
+
+		route := routeTemplate(req)
+		status := strconv.Itoa(recorder.status)
+		s.metrics.requests.Inc(route, req.Method, status)
+		s.metrics.requestDuration.Observe(s.clock().Sub(start).Seconds(), route, req.Method, status)
+	})
+}
+
+/* This function rejects the admission of a guest at the door and counts the rejection by reason.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+	err error - reason of the rejection
+*/
+func (s *Server) rejectAdmission(resp http.ResponseWriter, req *http.Request, err error) {
+	if problem := problemFor(err); problem.Status < http.StatusInternalServerError {
+		s.metrics.rejections.Inc(strings.ToLower(problem.Code))
+	}
+	s.encodeError(resp, req, err)
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"GuestList/internal/model"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+// Test the metrics of the API traffic and the party
+func TestMetrics(t *testing.T) {
+	store := newPartyStore()
+	store.events = append(store.events, &model.Event{Id: 2, Name: "Summer party", Status: "ACTIVE"},
+		&model.Event{Id: 3, Name: "Spring party", Status: "CANCELLED"})
+	store.tables[2] = map[int]int{1: 6}
+	store.tables[3] = map[int]int{1: 8}
+	s := newTestServer(store)
+	serve(s, "PUT", "/guests/Mary+Queen", `{"accompanying_guests": 9}`)
+	serve(s, "PUT", "/guests/Mary+Queen", `{"accompanying_guests": 2}`)
+	serve(s, "PUT", "/guests/John+Smith", `{"accompanying_guests": 2}`)
+	serve(s, "PUT", "/guests/Mary+Queen", `{"accompanying_guests": 2}`)
+	serve(s, "PUT", "/guests/Mary+Queen", `{"accompanying_guests": -1}`)
+	serve(s, "GET", "/guest_list/Mary+Queen", "")
+
+	resp := serve(s, "GET", "/metrics", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected metrics")
+	body := resp.Body.String()
+
+	for _, expected := range []string{
+		`guestlist_http_requests_total{route="/guests/{name:[a-zA-Z\\+]+}",method="PUT",status="200"} 1`,
+		`guestlist_http_requests_total{route="/guests/{name:[a-zA-Z\\+]+}",method="PUT",status="404"} 1`,
+		`guestlist_http_request_duration_seconds_count{route="/guest_list/{name:[a-zA-Z\\+]+}",method="GET",status="200"} 1`,
+		`guestlist_db_query_duration_seconds_count{function="GetEntryFromGuestList",result="error"} 1`,
+		`guestlist_db_query_duration_seconds_count{function="UpdateGuestStatusToArrive",result="ok"} 1`,
+		`guestlist_admissions_rejected_total{reason="guest_not_found"} 1`,
+		`guestlist_admissions_rejected_total{reason="guest_already_arrived"} 1`,
+		`guestlist_admissions_rejected_total{reason="insufficient_seats"} 1`,
+		`guestlist_admissions_rejected_total{reason="validation_failed"} 1`,
+		`guestlist_invited_guests{event="1"} 2`,
+		`guestlist_arrived_people{event="1"} 5`,
+		`guestlist_empty_seats{event="1"} 13`,
+		`guestlist_table_occupied_seats{event="1",table="2"} 3`,
+		`guestlist_table_capacity_seats{event="1",table="2"} 4`,
+		`guestlist_invited_guests{event="2"} 0`,
+		`guestlist_empty_seats{event="2"} 6`,
+	} {
+		assert.Contains(t, body, expected, "Expected metric")
+	}
+	assert.NotContains(t, body, `event="3"`, "Expected only the active events")
+	assert.NotContains(t, body, "Mary Queen", "Expected no guest names in the labels")
+}
@@ -0,0 +1,315 @@
+package common
+
+import (
+	"GuestList/internal/logging"
+	"GuestList/internal/tracing"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// Key of the request id in the request context
+type requestIdKey struct{}
+
+/* This middleware assigns an id to every request. The id given by the client in the X-Correlation-ID header
+is used if present. The id is stored in the request context and returned in the response header.
+*/
+func RequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		id := correlationId(req)
+		resp.Header().Set(CorrelationIdHeader, id)
+		next.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), requestIdKey{}, id)))
+	})
+}
+
+/* This middleware stores the logger of the server in the request context with the id of the request, so that
+every entry logged for the request can be correlated.
+*/
+func (s *Server) requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		logger := s.logger.With(logging.RequestId(correlationId(req)))
+		next.ServeHTTP(resp, req.WithContext(logging.NewContext(req.Context(), logger)))
+	})
+}
+
+/* This middleware traces every request in a span named after the method and the route template, so that the guest
+names do not end up in the traces. The trace of the client is continued if the request has the traceparent header.
+The id of the trace is added to the log entries of the request.
+*/
+func (s *Server) trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		if remote, ok := tracing.ParseTraceparent(req.Header.Get(tracing.TraceparentHeader)); ok {
+			ctx = tracing.ContextWithRemote(ctx, remote)
+		}
+		route := routeTemplate(req)
+		ctx, span := s.tracer.Start(ctx, req.Method+" "+route, tracing.KindServer)
+		defer span.End()
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.route", route)
+		logger := logging.FromContext(ctx).With(logging.String("trace_id", span.Context().TraceId.String()))
+
+		recorder := &statusRecorder{ResponseWriter: resp, status: http.StatusOK}
+		next.ServeHTTP(recorder, req.WithContext(logging.NewContext(ctx, logger)))
+		span.SetAttribute("http.status_code", recorder.status)
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(recorder.status)))
+		}
+	})
+}
+
+/* This middleware logs every request together with the status, size and duration of the response.
+The path may contain the name of a guest and is redacted together with the names.
+*/
+func (s *Server) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		start := s.clock()
+		recorder := &statusRecorder{ResponseWriter: resp, status: http.StatusOK}
+		next.ServeHTTP(recorder, req)
+		logging.FromContext(req.Context()).Info("request served", logging.String("method", req.Method),
+			logging.Sensitive("path", req.URL.Path), logging.Int("status", recorder.status),
+			logging.Int("bytes", recorder.size), logging.Duration("duration_ms", s.clock().Sub(start)))
+	})
+}
+
+/* This middleware recovers from a panic in the handler, logs the stack and returns 500 to the client.
+ */
+func (s *Server) recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				stack := debug.Stack()
+				// The panic may have been raised in another goroutine, e.g. by the Timeout middleware
+				if handlerPanic, ok := recovered.(*panicError); ok {
+					recovered, stack = handlerPanic.value, handlerPanic.stack
+				}
+				logging.FromContext(req.Context()).Error("panic", logging.String("panic", fmt.Sprint(recovered)),
+					logging.String("stack", string(stack)))
+				encodeError(resp, req, fmt.Errorf("panic: %v", recovered))
+			}
+		}()
+		next.ServeHTTP(resp, req)
+	})
+}
+
+// Returns the path template of the route matching the request, e.g. /guests/{name:[a-zA-Z\+]+}
+func routeTemplate(req *http.Request) string {
+	if current := mux.CurrentRoute(req); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unknown"
+}
+
+/* This middleware limits the size of the request body.
+Arguments:
+	maxBytes int64 - maximum size of the request body
+*/
+func LimitBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			if req.ContentLength > maxBytes {
+				encodeError(resp, req, errBodyTooLarge)
+				return
+			}
+			req.Body = http.MaxBytesReader(resp, req.Body, maxBytes)
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
+
+// Key of the late handler in the request context
+type lateHandlerKey struct{}
+
+/* lateHandler tells the middlewares in front of Timeout about a handler which did not finish in time. The
+handler keeps running after the client was answered with 503, its response is only known once finished is closed.
+*/
+type lateHandler struct {
+	finished <-chan struct{}
+	response *bufferedWriter
+}
+
+// Returns the request with a late handler which is filled in by Timeout if the handler does not finish in time
+func withLateHandler(req *http.Request) (*http.Request, *lateHandler) {
+	late := &lateHandler{}
+	return req.WithContext(context.WithValue(req.Context(), lateHandlerKey{}, late)), late
+}
+
+// Returns whether the handler did not finish in time and is still running or has finished late
+func (l *lateHandler) timedOut() bool {
+	return l.finished != nil
+}
+
+/* This middleware limits the time in which the handler has to respond. The response of the handler is buffered
+and 503 is returned to the client if the handler does not finish in time. The request context is cancelled
+at the deadline. A middleware in front of it learns through withLateHandler when such a handler really finishes,
+and a late handler which panics is logged at the error level.
+Arguments:
+	timeout time.Duration - time limit of the request
+*/
+func Timeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			ctx, cancel := context.WithTimeout(req.Context(), timeout)
+			defer cancel()
+			req = req.WithContext(ctx)
+
+			buffered := &bufferedWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			finished := make(chan struct{})
+			panicked := make(chan *panicError, 1)
+			go func() {
+				defer close(finished)
+				defer func() {
+					if recovered := recover(); recovered != nil {
+						// The response of a late handler which panicked is a failure
+						buffered.status = http.StatusInternalServerError
+						panicked <- &panicError{value: recovered, stack: debug.Stack()}
+						return
+					}
+					close(done)
+				}()
+				next.ServeHTTP(buffered, req)
+			}()
+
+			select {
+			case handlerPanic := <-panicked:
+				panic(handlerPanic)
+			case <-done:
+				for key, values := range buffered.header {
+					resp.Header()[key] = values
+				}
+				if buffered.status == 0 {
+					buffered.status = http.StatusOK
+				}
+				resp.WriteHeader(buffered.status)
+				_, _ = resp.Write(buffered.body.Bytes())
+			case <-ctx.Done():
+				if late, ok := req.Context().Value(lateHandlerKey{}).(*lateHandler); ok {
+					late.finished, late.response = finished, buffered
+				}
+				// Nobody recovers the panic of a late handler anymore, so it is logged once the handler finishes
+				go func() {
+					<-finished
+					select {
+					case handlerPanic := <-panicked:
+						logging.FromContext(req.Context()).Error("panic after the timeout",
+							logging.String("panic", fmt.Sprint(handlerPanic.value)),
+							logging.String("stack", string(handlerPanic.stack)))
+					default:
+					}
+				}()
+				encodeError(resp, req, errTimeout)
+			}
+		})
+	}
+}
+
+/* This middleware marks the responses of a legacy route as deprecated with the Deprecation header and links to
+the same route in the successor version.
+Arguments:
+	successor string - prefix of the successor version, e.g. /v1
+*/
+func Deprecated(successor string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			link := successor + req.URL.Path
+			if req.URL.RawQuery != "" {
+				link += "?" + req.URL.RawQuery
+			}
+			resp.Header().Set("Deprecation", "true")
+			resp.Header().Set("Link", "<"+link+`>; rel="successor-version"`)
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
+
+/* This function chains the middlewares, the first one is the outermost.
+Arguments:
+	handler http.Handler - handler to be wrapped
+	middlewares ...func(http.Handler) http.Handler - middlewares to be applied
+Return:
+	http.Handler - wrapped handler
+*/
+func Chain(handler http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Errors reported by the middlewares
+var (
+	errBodyTooLarge = &apiError{status: http.StatusRequestEntityTooLarge, code: CodeBodyTooLarge,
+		detail: "request body is too large"}
+	errTimeout = &apiError{status: http.StatusServiceUnavailable, code: CodeTimeout,
+		detail: "request took too long to process"}
+)
+
+// panicError carries a panic raised by a handler together with its stack
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprint(e.value)
+}
+
+// statusRecorder records the status and size of the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(data)
+	r.size += n
+	return n, err
+}
+
+// bufferedWriter keeps the response in memory until the handler finishes
+type bufferedWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (w *bufferedWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+// isBodyTooLarge reports whether the error was returned by a body limited by LimitBody
+func isBodyTooLarge(err error) bool {
+	return err != nil && err.Error() == "http: request body too large"
+}
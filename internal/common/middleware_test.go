@@ -0,0 +1,208 @@
+package common
+
+import (
+	"GuestList/internal/logging"
+	"GuestList/internal/tracing"
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test recovering from a panic in a handler, also when it is raised behind the timeout
+func TestRecover(t *testing.T) {
+	panicking := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		var table *int
+		_ = *table
+	})
+	s := newTestServer(newFakeStore())
+	for _, handler := range []http.Handler{
+		Chain(panicking, RequestId, s.recover),
+		Chain(panicking, RequestId, s.recover, Timeout(time.Second)),
+	} {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest(http.MethodPut, "/guests/John", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, resp.Code, "Expected internal error")
+		assert.Contains(t, resp.Body.String(), CodeInternalError, "Expected problem details")
+	}
+}
+
+// Test assigning the request id
+func TestRequestId(t *testing.T) {
+	var seen string
+	handler := RequestId(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		seen = correlationId(req)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/guests", nil)
+	req.Header.Set(CorrelationIdHeader, "door-1")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, "door-1", seen, "Expected id given by the client")
+	assert.Equal(t, "door-1", resp.Header().Get(CorrelationIdHeader), "Expected id in the response")
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/guests", nil))
+	assert.NotEmpty(t, seen, "Expected generated id")
+	assert.Equal(t, seen, resp.Header().Get(CorrelationIdHeader), "Expected the same id in the response")
+
+	for _, invalid := range []string{"door 1", "door-1\r\nX-Admin: true", strings.Repeat("d", 65)} {
+		req = httptest.NewRequest(http.MethodGet, "/guests", nil)
+		req.Header[CorrelationIdHeader] = []string{invalid}
+		resp = httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		assert.Len(t, seen, 32, "Expected generated id instead of %q", invalid)
+		assert.Equal(t, seen, resp.Header().Get(CorrelationIdHeader), "Expected the generated id in the response")
+	}
+}
+
+// Test limiting the size of the request body
+func TestLimitBody(t *testing.T) {
+	handler := Chain(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		var table *int
+		if err := decodeBody(req, bodyField{name: "table", max: 100, value: &table}); err != nil {
+			encodeError(resp, req, err)
+		}
+	}), LimitBody(16))
+
+	resp := httptest.NewRecorder()
+	body := `{"table": 1` + strings.Repeat(" ", 32) + `}`
+	req := httptest.NewRequest(http.MethodPost, "/guest_list/John", strings.NewReader(body))
+	req.ContentLength = -1
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code, "Expected request entity too large")
+}
+
+// Test the time limit of a request
+func TestTimeout(t *testing.T) {
+	handler := Timeout(10 * time.Millisecond)(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+		resp.WriteHeader(http.StatusOK)
+	}))
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/guests", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code, "Expected service unavailable")
+
+	handler = Timeout(time.Second)(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		encodeResponse(resp, map[string]int{"seats_empty": 6}, http.StatusOK)
+	}))
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/seats_empty", nil))
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected response of the handler")
+	assert.JSONEq(t, `{"seats_empty": 6}`, resp.Body.String(), "Expected response of the handler")
+}
+
+// Test logging a panic raised by a handler after the timeout, with the request id
+func TestTimeoutLatePanic(t *testing.T) {
+	out := &lockedBuffer{}
+	s := newTestServer(newFakeStore())
+	s.logger = logging.New(out, logging.LevelDebug, false, "")
+	handler := Chain(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+		var table *int
+		_ = *table
+	}), RequestId, s.requestLogger, s.recover, Timeout(10*time.Millisecond))
+
+	req := httptest.NewRequest(http.MethodPut, "/guests/John", nil)
+	req.Header.Set(CorrelationIdHeader, "door-1")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code, "Expected service unavailable")
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), `"level":"error","msg":"panic after the timeout","request_id":"door-1",`+
+			`"panic":"runtime error: invalid memory address or nil pointer dereference","stack":`)
+	}, time.Second, time.Millisecond, "Expected the late panic to be logged")
+}
+
+// Test the request id, the trace id and the guest in the log entries of a request, with the names redacted
+func TestRequestLogging(t *testing.T) {
+	store := newPartyStore()
+	s := newTestServer(store)
+	out := &bytes.Buffer{}
+	s.logger = logging.New(out, logging.LevelDebug, true, "a-secret-of-at-least-32-characters")
+
+	store.err = errors.New("Error 1062: Duplicate entry '1-Mary Queen' for key 'guest_list_event_name'")
+	req := httptest.NewRequest(http.MethodGet, "/guests/Mary+Queen", nil)
+	req.Header.Set(CorrelationIdHeader, "door-1")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp := httptest.NewRecorder()
+	s.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusInternalServerError, resp.Code, "Expected internal error")
+	entries := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, entries, 2, "Expected the error and the access log")
+	assert.Regexp(t, `"level":"error","msg":"request failed","request_id":"door-1",`+
+		`"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","principal":"anonymous","guest":"redacted:\w+",`+
+		`"code":"INTERNAL_ERROR","error":"redacted:\w+"`, entries[0], "Expected the failed request")
+	assert.Regexp(t, `"level":"info","msg":"request served","request_id":"door-1",`+
+		`"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","method":"GET","path":"redacted:\w+","status":500`, entries[1], "Expected the access log")
+	assert.NotContains(t, out.String(), "Mary", "Expected the name to be redacted")
+}
+
+// Collects the log entries written by the goroutines of the requests
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Collects the exported spans
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(span tracing.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+// Test the spans of a check-in continuing the trace of the client
+func TestTrace(t *testing.T) {
+	spans := &spanRecorder{}
+	s := newTestServer(newPartyStore())
+	s.tracer = tracing.NewTracer(spans, s.clock)
+	s.store.(*auditedStore).Store.(*instrumentedStore).tracer = s.tracer
+
+	req := httptest.NewRequest(http.MethodPut, "/guests/Mary+Queen", strings.NewReader(`{"accompanying_guests": 3}`))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp := httptest.NewRecorder()
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the guest to be let in")
+
+	names := make([]string, len(spans.spans))
+	for i, span := range spans.spans {
+		names[i] = span.Name
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceId, "Expected the trace of the client")
+	}
+	assert.Equal(t, []string{"store.GetEvent", "store.GetEntryFromGuestList", "store.GetTableCapacity", "store.GetGuestDetails",
+		"store.UpdateGuestStatusToArrive", "store.GetGuestDetails", "store.AppendAuditEntry",
+		`PUT /guests/{name:[a-zA-Z\+]+}`}, names, "Expected the spans of the phase check, of the check-in and of its audit entry")
+	server := spans.spans[7]
+	assert.Equal(t, "00f067aa0ba902b7", server.ParentSpanId, "Expected the span of the client as parent")
+	assert.Equal(t, 200, server.Attributes["http.status_code"], "Expected the status of the response")
+	for _, span := range spans.spans[:7] {
+		assert.Equal(t, server.SpanId, span.ParentSpanId, "Expected the request as parent of %s", span.Name)
+		assert.Equal(t, "client", span.Kind, "Expected a call to the database")
+	}
+}
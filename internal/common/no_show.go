@@ -0,0 +1,47 @@
+package common
+
+import (
+	"GuestList/internal/model"
+	"net/http"
+	"time"
+)
+
+/* This function returns the time from which the guests of the event who have not arrived are no-shows.
+Arguments:
+	event *model.Event - event
+Return:
+	*time.Time - cutoff after the start of the event, nil if the guests are never marked
+*/
+func (s *Server) noShowCutoff(event *model.Event) *time.Time {
+	if s.config.NoShowAfter == 0 {
+		return nil
+	}
+	cutoff := event.Date.Add(s.config.NoShowAfter).UTC()
+	return &cutoff
+}
+
+/*
+This function reports the guests of the event of the path who were marked as no-show, with the number of seats
+released at their tables.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) GetNoShowReport(resp http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	event, err := s.store.GetEvent(ctx, eventFromContext(ctx))
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	guests, err := s.store.ListNoShows(ctx, event.Id)
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	report := &model.NoShowReport{EventId: event.Id, Cutoff: s.noShowCutoff(event), Guests: guests}
+	for _, guest := range guests {
+		report.ReleasedSeats += guest.PlannedAccompanyingGuests + 1
+	}
+	encodeResponse(resp, report, http.StatusOK)
+}
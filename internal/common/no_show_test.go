@@ -0,0 +1,87 @@
+package common
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Test that the guests who have not arrived by the cutoff are marked as no-shows and that their tables are released
+func TestServerNoShows(t *testing.T) {
+	store := newPartyStore().seed("Jane Doe", 4, 0, "NOT_ARRIVED", 0).seed("Tom Hanks", 3, 0, "NOT_ARRIVED", 0)
+	store.event(defaultEventId).Date = testNow.Add(-90 * time.Minute)
+	s := newTestServer(store)
+	resp := serve(s, "PUT", "/v2/guests/4/rsvp", `{"rsvp_status": "DECLINED"}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the guest to decline: %s", resp.Body.String())
+	store.audit = nil
+	s.config.NoShowAfter = time.Hour
+	s.config.SchedulerInterval = time.Hour
+	assert.Nil(t, s.StartJobs(), "Expected the jobs to be started")
+	defer s.StopJobs()
+
+	resp = serve(s, "POST", "/v2/guests", `{"name": "John Smith", "table": 2}`)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the table to be reserved before the cutoff")
+	s.scheduler.RunDue(context.Background())
+
+	resp = serve(s, "GET", "/v2/events/1/no_shows", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the report: %s", resp.Body.String())
+	assert.JSONEq(t, `{"event_id": 1, "cutoff": "2020-12-31T19:30:00Z", "released_seats": 3, "guests": [
+		{"id": 1, "name": "Mary Queen", "table": 2, "planned_accompanying_guests": 1,
+			"actual_accompanying_guests": null, "status": "NO_SHOW", "rsvp_status": "PENDING", "time_arrived": null,
+			"time_departed": null},
+		{"id": 3, "name": "Jane Doe", "table": 4, "planned_accompanying_guests": 0,
+			"actual_accompanying_guests": null, "status": "NO_SHOW", "rsvp_status": "PENDING", "time_arrived": null,
+			"time_departed": null}]}`, resp.Body.String(), "Expected the guests who have not arrived")
+	assert.Equal(t, "NOT_ARRIVED", store.guest(defaultEventId, "Tom Hanks").Status,
+		"Expected the guest who declined not to be marked")
+	if assert.Len(t, store.audit, 1, "Expected the marking to be audited") {
+		assert.Equal(t, AuditNoShowsMarked, store.audit[0].Action, "Expected the marking of the event")
+		assert.Equal(t, auditSystemActor, store.audit[0].Actor, "Expected the marking by the system")
+		assert.JSONEq(t, `{"event_id": 1, "marked": 2}`, string(store.audit[0].After), "Expected the marked guests")
+	}
+	resp = serve(s, "GET", "/v2/guests?status=NO_SHOW", "")
+	assert.Contains(t, resp.Body.String(), `"total":2`, "Expected the no-shows to be listed by status")
+	resp = serve(s, "GET", "/v1/guests/Mary+Queen", "")
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Expected a no-show not to be at the party")
+
+	resp = serve(s, "POST", "/v2/guests", `{"name": "John Smith", "table": 2, "accompanying_guests": 3}`)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the walk-in to take the table: %s", resp.Body.String())
+	resp = serve(s, "PUT", "/v2/guests/1/arrival", `{"accompanying_guests": 1}`)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the late guest to have lost the table")
+	assert.Equal(t, CodeTableReserved, problemCode(t, resp), "Expected the table to be taken")
+	resp = serve(s, "PUT", "/v1/guests/Jane+Doe", `{"accompanying_guests": 0}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the late guest to get the free table: %s",
+		resp.Body.String())
+	assert.Equal(t, "ARRIVED", store.guest(defaultEventId, "Jane Doe").Status, "Expected the late guest to arrive")
+}
+
+// Test that no guest is marked before the cutoff, while the doors are not open, or if the guests are never marked
+func TestServerNoShowsNotMarked(t *testing.T) {
+	store := newPartyStore()
+	s := newTestServer(store)
+	s.config.SchedulerInterval = time.Hour
+	assert.Nil(t, s.StartJobs(), "Expected the jobs to be started")
+	defer s.StopJobs()
+
+	s.scheduler.RunDue(context.Background())
+	resp := serve(s, "GET", "/v2/events/1/no_shows", "")
+	assert.JSONEq(t, `{"event_id": 1, "cutoff": "2020-12-31T21:00:00Z", "released_seats": 0, "guests": []}`,
+		resp.Body.String(), "Expected no guest to be marked before the cutoff")
+
+	// The event started long ago, but its doors were never opened
+	store.event(defaultEventId).Date = testNow.Add(-2 * time.Hour)
+	store.event(defaultEventId).Phase = PhaseLocked
+	for _, noShowAfter := range []time.Duration{time.Hour, 0} {
+		s.config.NoShowAfter = noShowAfter
+		run, err := s.scheduler.Trigger(context.Background(), JobMarkNoShows, "alice")
+		assert.Nil(t, err, "Expected the job to be triggered")
+		s.scheduler.Wait()
+		assert.Equal(t, 0, store.runs[run.Id-1].Affected, "Expected no guest to be marked")
+		store.event(defaultEventId).Phase = PhaseOpen
+	}
+	assert.Equal(t, "NOT_ARRIVED", store.guest(defaultEventId, "Mary Queen").Status, "Expected the guest to be kept")
+	resp = serve(s, "GET", "/v2/events/1/no_shows", "")
+	assert.Contains(t, resp.Body.String(), `"cutoff":null`, "Expected no cutoff")
+}
@@ -0,0 +1,570 @@
+package common
+
+import (
+	"GuestList/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openAPI is the decoded OpenAPI document of the repository
+type openAPI map[string]interface{}
+
+// Loads the OpenAPI document served by the test server
+func loadOpenAPI(t *testing.T) openAPI {
+	content, err := ioutil.ReadFile("../../api/openapi.json")
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when reading the OpenAPI document", err)
+	}
+	spec := openAPI{}
+	if err := json.Unmarshal(content, &spec); err != nil {
+		t.Fatalf("an error '%s' was not expected when decoding the OpenAPI document", err)
+	}
+	return spec
+}
+
+// Returns the object referenced by a $ref of the form #/components/..., or the object itself
+func (spec openAPI) resolve(object map[string]interface{}) map[string]interface{} {
+	ref, ok := object["$ref"].(string)
+	if !ok {
+		return object
+	}
+	target := map[string]interface{}(spec)
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		target, _ = target[part].(map[string]interface{})
+	}
+	return target
+}
+
+// Returns the operation of the path or nil if it is not documented
+func (spec openAPI) operation(path string, method string) map[string]interface{} {
+	paths, _ := spec["paths"].(map[string]interface{})
+	item, _ := paths[path].(map[string]interface{})
+	operation, _ := item[strings.ToLower(method)].(map[string]interface{})
+	return operation
+}
+
+/*
+	This function validates a decoded JSON value against a schema of the OpenAPI document. Only the keywords used
+
+by the document are supported.
+Arguments:
+
+	schema map[string]interface{} - schema, may be a $ref
+	value interface{} - value decoded by encoding/json
+	path string - location of the value, used in the violations
+
+Return:
+
+	[]string - violations of the schema
+*/
+func (spec openAPI) validate(schema map[string]interface{}, value interface{}, path string) []string {
+	schema = spec.resolve(schema)
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+		return []string{path + ": must not be null"}
+	}
+
+	var violations []string
+	violate := func(format string, args ...interface{}) {
+		violations = append(violations, path+": "+fmt.Sprintf(format, args...))
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			found = found || allowed == value
+		}
+		if !found {
+			violate("%v is not one of %v", value, enum)
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			violate("must be an object")
+			break
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, present := object[name.(string)]; !present {
+				violate("property %s is required", name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, property := range object {
+			if propertySchema, ok := properties[name].(map[string]interface{}); ok {
+				violations = append(violations, spec.validate(propertySchema, property, path+"."+name)...)
+			} else if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+				violations = append(violations, spec.validate(additional, property, path+"."+name)...)
+			} else if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				violate("property %s is not allowed", name)
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			violate("must be an array")
+			break
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range array {
+			violations = append(violations, spec.validate(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			violate("must be a string")
+			break
+		}
+		if minLength, ok := schema["minLength"].(float64); ok && float64(len([]rune(text))) < minLength {
+			violate("is shorter than %v", minLength)
+		}
+		if maxLength, ok := schema["maxLength"].(float64); ok && float64(len([]rune(text))) > maxLength {
+			violate("is longer than %v", maxLength)
+		}
+		if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(text) {
+			violate("does not match %s", pattern)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, text); err != nil {
+				violate("must be a date-time")
+			}
+		}
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok || (schema["type"] == "integer" && number != math.Trunc(number)) {
+			violate("must be of type %s", schema["type"])
+			break
+		}
+		if minimum, ok := schema["minimum"].(float64); ok && number < minimum {
+			violate("%v is less than %v", number, minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && number > maximum {
+			violate("%v is greater than %v", number, maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			violate("must be a boolean")
+		}
+	}
+	return violations
+}
+
+// Converts the path template of a route, e.g. /guests/{name:[a-zA-Z\+]+}, to the path in the document
+var routeVariable = regexp.MustCompile(`\{(\w+):[^}]*\}`)
+
+// Test that the document describes exactly the routes of the server
+func TestOpenAPIRoutes(t *testing.T) {
+	spec := loadOpenAPI(t)
+	s := newTestServer(newPartyStore())
+
+	var routes []string
+	err := s.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		// The prefixes of the versions have no methods
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			routes = append(routes, method+" "+routeVariable.ReplaceAllString(template, "{$1}"))
+		}
+		return nil
+	})
+	assert.Nil(t, err, "Expected the routes to be walked")
+
+	var documented []string
+	for path, item := range spec["paths"].(map[string]interface{}) {
+		for method := range item.(map[string]interface{}) {
+			if method != "parameters" {
+				documented = append(documented, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(routes)
+	sort.Strings(documented)
+	assert.Equal(t, routes, documented, "Expected every route to be documented and every documented route to exist")
+}
+
+// Test that the responses of the handlers are documented and match the schemas of the document
+func TestOpenAPIContract(t *testing.T) {
+	spec := loadOpenAPI(t)
+	storeErr := errors.New("sql: database is closed")
+	type contractTest struct {
+		path     string // path in the document
+		method   string
+		url      string
+		body     string
+		storeErr error
+	}
+	// Requests to the version 1, sent with and without the prefix of the version
+	v1 := []contractTest{
+		{"/guest_list/{name}", "POST", "/guest_list/John+Smith", `{"table": 1, "accompanying_guests": 2}`, nil},
+		{"/guest_list/{name}", "POST", "/guest_list/John+Smith", `{"table": `, nil},
+		{"/guest_list/{name}", "POST", "/guest_list/John+Smith", `{"table": 7}`, nil},
+		{"/guest_list/{name}", "POST", "/guest_list/John+Smith", `{"table": 2}`, nil},
+		{"/guest_list/{name}", "POST", "/guest_list/John+Smith", `{"table": 4, "accompanying_guests": 2}`, nil},
+		{"/guest_list/{name}", "POST", "/guest_list/John+Smith", `{"table": "1", "seats": 2}`, nil},
+		{"/guest_list/{name}", "POST", "/guest_list/John+Smith", `{"table": 1}`, storeErr},
+		{"/guest_list/{name}", "DELETE", "/guest_list/Mary+Queen", "", nil},
+		{"/guest_list/{name}", "DELETE", "/guest_list/John+Smith", "", nil},
+		{"/guest_list/{name}", "GET", "/guest_list/Mary+Queen", "", nil},
+		{"/guest_list/{name}", "GET", "/guest_list/Brad+Pitt", "", nil},
+		{"/guest_list/{name}", "GET", "/guest_list/John+Smith", "", nil},
+		{"/guest_list", "GET", "/guest_list", "", nil},
+		{"/guest_list", "GET", "/guest_list?limit=1&offset=5", "", nil},
+		{"/guest_list", "GET", "/guest_list?limit=-1&offset=one", "", nil},
+		{"/guest_list", "GET", "/guest_list", "", storeErr},
+		{"/invitation/{name}", "GET", "/invitation/Mary+Queen", "", nil},
+		{"/invitation/{name}", "GET", "/invitation/John+Smith", "", nil},
+		{"/guests/{name}", "PUT", "/guests/Mary+Queen", `{"accompanying_guests": 3}`, nil},
+		{"/guests/{name}", "PUT", "/guests/Mary+Queen", `{"accompanying_guests": 4}`, nil},
+		{"/guests/{name}", "PUT", "/guests/Mary+Queen", `[]`, nil},
+		{"/guests/{name}", "PUT", "/guests/John+Smith", `{}`, nil},
+		{"/guests/{name}", "PUT", "/guests/Mary+Queen", `{"accompanying_guests": 100}`, nil},
+		{"/guests/{name}", "DELETE", "/guests/Brad+Pitt", "", nil},
+		{"/guests/{name}", "DELETE", "/guests/Mary+Queen", "", nil},
+		{"/guests/{name}", "GET", "/guests/Brad+Pitt", "", nil},
+		{"/guests/{name}", "GET", "/guests/Mary+Queen", "", nil},
+		{"/guests", "GET", "/guests", "", nil},
+		{"/guests", "GET", "/guests?offset=3", "", nil},
+		{"/guests", "GET", "/guests?limit=x", "", nil},
+		{"/seats_empty", "GET", "/seats_empty", "", nil},
+		{"/seats_empty", "GET", "/seats_empty", "", storeErr},
+	}
+	tests := []contractTest{
+		{"/v2/guests", "POST", "/v2/guests", `{"name": "John Smith", "table": 1, "accompanying_guests": 2}`, nil},
+		{"/v2/guests", "POST", "/v2/guests", `{"name": "John Smith", "table": 2}`, nil},
+		{"/v2/guests", "POST", "/v2/guests", `{"name": "John Smith", "table": 7}`, nil},
+		{"/v2/guests", "POST", "/v2/guests", `{"name": "John Smith", "table": 4, "accompanying_guests": 2}`, nil},
+		{"/v2/guests", "POST", "/v2/guests", `{"name": "John  Smith"}`, nil},
+		{"/v2/guests", "POST", "/v2/guests", `"John Smith"`, nil},
+		{"/v2/guests", "POST", "/v2/guests", `{"name": "John Smith", "table": 1}`, storeErr},
+		{"/v2/guests", "GET", "/v2/guests", "", nil},
+		{"/v2/guests", "GET", "/v2/guests?status=ARRIVED", "", nil},
+		{"/v2/guests", "GET", "/v2/guests?limit=1", "", nil},
+		{"/v2/guests", "GET", "/v2/guests?offset=9", "", nil},
+		{"/v2/guests", "GET", "/v2/guests?status=LATE", "", nil},
+		{"/v2/guests", "GET", "/v2/guests", "", storeErr},
+		{"/v2/guests/{id}", "GET", "/v2/guests/1", "", nil},
+		{"/v2/guests/{id}", "GET", "/v2/guests/2", "", nil},
+		{"/v2/guests/{id}", "GET", "/v2/guests/99999999999999999999", "", nil},
+		{"/v2/guests/{id}", "DELETE", "/v2/guests/1", "", nil},
+		{"/v2/guests/{id}", "DELETE", "/v2/guests/7", "", nil},
+		{"/v2/guests/{id}/invitation", "GET", "/v2/guests/1/invitation", "", nil},
+		{"/v2/guests/{id}/invitation", "GET", "/v2/guests/7/invitation", "", nil},
+		{"/v2/guests/{id}/arrival", "PUT", "/v2/guests/1/arrival", `{"accompanying_guests": 3}`, nil},
+		{"/v2/guests/{id}/arrival", "PUT", "/v2/guests/1/arrival", `{"accompanying_guests": 4}`, nil},
+		{"/v2/guests/{id}/arrival", "PUT", "/v2/guests/1/arrival", `{"accompanying_guests": "3"}`, nil},
+		{"/v2/guests/{id}/arrival", "PUT", "/v2/guests/7/arrival", `{}`, nil},
+		{"/v2/guests/{id}/departure", "PUT", "/v2/guests/2/departure", "", nil},
+		{"/v2/guests/{id}/departure", "PUT", "/v2/guests/1/departure", "", nil},
+		{"/v2/seats_empty", "GET", "/v2/seats_empty", "", nil},
+		{"/v2/events", "POST", "/v2/events", `{"name": "Summer party", "date": "2021-07-01T18:00:00Z"}`, nil},
+		{"/v2/events", "POST", "/v2/events", `{"name": "Summer party", "date": "July"}`, nil},
+		{"/v2/events", "POST", "/v2/events", `{"name": "Summer party", "date": "2021-07-01T18:00:00Z", "status": "LATE"}`,
+			nil},
+		{"/v2/events", "GET", "/v2/events", "", nil},
+		{"/v2/events", "GET", "/v2/events?status=ACTIVE&limit=1", "", nil},
+		{"/v2/events", "GET", "/v2/events?status=LATE", "", nil},
+		{"/v2/events/{event}", "GET", "/v2/events/1", "", nil},
+		{"/v2/events/{event}", "GET", "/v2/events/9", "", nil},
+		{"/v2/events/{event}", "PUT", "/v2/events/1", `{"name": "New year party", "date": "2021-01-01T00:00:00Z"}`,
+			nil},
+		{"/v2/events/{event}", "PUT", "/v2/events/9", `{"name": "New year party", "date": "2021-01-01T00:00:00Z"}`,
+			nil},
+		{"/v2/events/{event}/tables", "GET", "/v2/events/1/tables?limit=2", "", nil},
+		{"/v2/events/{event}/tables", "GET", "/v2/events/9/tables", "", nil},
+		{"/v2/events/{event}/tables/{table}", "PUT", "/v2/events/1/tables/5", `{"capacity": 6}`, nil},
+		{"/v2/events/{event}/tables/{table}", "PUT", "/v2/events/1/tables/1", `{"capacity": 12}`, nil},
+		{"/v2/events/{event}/tables/{table}", "PUT", "/v2/events/1/tables/0", `{"capacity": 12}`, nil},
+		{"/v2/events/{event}/tables/{table}", "DELETE", "/v2/events/1/tables/1", "", nil},
+		{"/v2/events/{event}/tables/{table}", "DELETE", "/v2/events/1/tables/2", "", nil},
+		{"/v2/events/{event}/tables/{table}", "DELETE", "/v2/events/1/tables/5", "", nil},
+		{"/v2/events/{event}/phase", "PUT", "/v2/events/1/phase", `{"phase": "CLOSED"}`, nil},
+		{"/v2/events/{event}/phase", "PUT", "/v2/events/1/phase", `{"phase": "PLANNING"}`, nil},
+		{"/v2/events/{event}/phase", "PUT", "/v2/events/1/phase", `{"phase": "DONE"}`, nil},
+		{"/v2/events/{event}/phase", "PUT", "/v2/events/9/phase", `{"phase": "LOCKED"}`, nil},
+		{"/v2/events/{event}/summary", "GET", "/v2/events/1/summary", "", nil},
+		{"/v2/events/{event}/summary", "GET", "/v2/events/9/summary", "", nil},
+		{"/v2/events/{event}/freeze_report", "GET", "/v2/events/1/freeze_report", "", nil},
+		{"/v2/events/{event}/freeze_report", "GET", "/v2/events/9/freeze_report", "", nil},
+		{"/v2/events/{event}/no_shows", "GET", "/v2/events/1/no_shows", "", nil},
+		{"/v2/events/{event}/no_shows", "GET", "/v2/events/9/no_shows", "", nil},
+		{"/v2/events/{event}/clone/preview", "POST", "/v2/events/1/clone/preview", `{"shift_days": 365}`, nil},
+		{"/v2/events/{event}/clone/preview", "POST", "/v2/events/1/clone/preview", `{"reset_state": "no"}`, nil},
+		{"/v2/events/{event}/clone/preview", "POST", "/v2/events/9/clone/preview", `{}`, nil},
+		{"/v2/events/{event}/clone", "POST", "/v2/events/1/clone", `{"name": "Next year end party",
+			"date": "2021-12-31T20:00:00Z", "reset_state": false, "exclude_no_shows": true}`, nil},
+		{"/v2/events/{event}/clone", "POST", "/v2/events/1/clone", `{"date": "2021-12-31T20:00:00Z", "shift_days": 1}`,
+			nil},
+		{"/v2/events/{event}/guests", "POST", "/v2/events/1/guests", `{"name": "John Smith", "table": 1}`, nil},
+		{"/v2/events/{event}/guests", "POST", "/v2/events/9/guests", `{"name": "John Smith", "table": 1}`, nil},
+		{"/v2/events/{event}/guests", "GET", "/v2/events/1/guests?status=ARRIVED", "", nil},
+		{"/v2/events/{event}/guests/{id}", "GET", "/v2/events/1/guests/1", "", nil},
+		{"/v2/events/{event}/guests/{id}", "GET", "/v2/events/1/guests/7", "", nil},
+		{"/v2/events/{event}/guests/{id}", "DELETE", "/v2/events/9/guests/1", "", nil},
+		{"/v2/events/{event}/guests/{id}/invitation", "GET", "/v2/events/1/guests/1/invitation", "", nil},
+		{"/v2/events/{event}/guests/{id}/arrival", "PUT", "/v2/events/1/guests/1/arrival", `{"accompanying_guests": 1}`,
+			nil},
+		{"/v2/events/{event}/guests/{id}/departure", "PUT", "/v2/events/1/guests/2/departure", "", nil},
+		{"/v2/events/{event}/seats_empty", "GET", "/v2/events/1/seats_empty", "", nil},
+		{"/v2/events/{event}/seats_empty", "GET", "/v2/events/9/seats_empty", "", nil},
+		{"/admin/api_keys", "POST", "/admin/api_keys", `{"name": "door-tablet-1", "role": "organizer"}`, nil},
+		{"/admin/api_keys", "POST", "/admin/api_keys", `{"name": "door-tablet-1", "role": "owner"}`, nil},
+		{"/admin/api_keys", "GET", "/admin/api_keys", "", nil},
+		{"/admin/api_keys/{id}", "DELETE", "/admin/api_keys/7", "", nil},
+		{"/admin/audit_log", "GET", "/admin/audit_log?action=GUEST_ADDED&from=2020-12-31T00:00:00Z&limit=1", "", nil},
+		{"/admin/audit_log", "GET", "/admin/audit_log?action=GUEST_INVITED&to=tomorrow", "", nil},
+		{"/admin/audit_log/export", "GET", "/admin/audit_log/export?actor=anonymous", "", nil},
+		{"/admin/audit_log/export", "GET", "/admin/audit_log/export?from=yesterday", "", nil},
+		{"/admin/audit_log/verify", "GET", "/admin/audit_log/verify", "", nil},
+		{"/admin/jobs", "GET", "/admin/jobs", "", nil},
+		{"/admin/jobs/{name}", "PUT", "/admin/jobs/purge_idempotency_keys", `{"paused": true}`, nil},
+		{"/admin/jobs/{name}", "PUT", "/admin/jobs/purge_idempotency_keys", `{"paused": 1}`, nil},
+		{"/admin/jobs/{name}", "PUT", "/admin/jobs/unknown", `{"paused": false}`, nil},
+		{"/admin/jobs/{name}/runs", "POST", "/admin/jobs/purge_idempotency_keys/runs", "", nil},
+		{"/admin/jobs/{name}/runs", "POST", "/admin/jobs/unknown/runs", "", nil},
+		{"/admin/jobs/{name}/runs", "GET", "/admin/jobs/purge_idempotency_keys/runs?limit=1", "", nil},
+		{"/admin/jobs/{name}/runs", "GET", "/admin/jobs/purge_idempotency_keys/runs?offset=-1", "", nil},
+		{"/admin/jobs/{name}/runs", "GET", "/admin/jobs/unknown/runs", "", nil},
+		{"/healthz", "GET", "/healthz", "", nil},
+		{"/readyz", "GET", "/readyz", "", nil},
+		{"/readyz", "GET", "/readyz", "", storeErr},
+		{"/version", "GET", "/version", "", nil},
+		{"/metrics", "GET", "/metrics", "", nil},
+		{"/openapi.json", "GET", "/openapi.json", "", nil},
+		{"/docs", "GET", "/docs", "", nil},
+	}
+	for _, prefix := range []string{v1Prefix, ""} {
+		for _, test := range v1 {
+			test.path, test.url = prefix+test.path, prefix+test.url
+			tests = append(tests, test)
+		}
+	}
+	// The event scoped requests to the version 1, to the default event and to an event which does not exist
+	for _, event := range []string{"1", "9"} {
+		for _, test := range v1 {
+			test.path, test.url = v1Prefix+"/events/{event}"+test.path, v1Prefix+"/events/"+event+test.url
+			tests = append(tests, test)
+		}
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.url, func(t *testing.T) {
+			store := newPartyStore()
+			store.err = test.storeErr
+			s := newTestServer(store)
+
+			resp := serve(s, test.method, test.url, test.body)
+
+			operation := spec.operation(test.path, test.method)
+			if !assert.NotNil(t, operation, "Expected the operation to be documented") {
+				return
+			}
+			if deprecated, _ := operation["deprecated"].(bool); deprecated {
+				assert.Equal(t, "true", resp.Header().Get("Deprecation"), "Expected the deprecation header")
+			} else {
+				assert.Empty(t, resp.Header().Get("Deprecation"), "Expected no deprecation header")
+			}
+			responses := operation["responses"].(map[string]interface{})
+			documented, ok := responses[strconv.Itoa(resp.Code)].(map[string]interface{})
+			if !assert.True(t, ok, "Expected status %d to be documented: %s", resp.Code, resp.Body.String()) {
+				return
+			}
+			assert.NotEmpty(t, resp.Header().Get("X-Correlation-ID"), "Expected correlation id")
+			content, _ := spec.resolve(documented)["content"].(map[string]interface{})
+			if len(content) == 0 {
+				assert.Empty(t, resp.Body.String(), "Expected no response body")
+				return
+			}
+			mediaType, _, err := mime.ParseMediaType(resp.Header().Get("Content-Type"))
+			assert.Nil(t, err, "Expected a content type")
+			media, ok := content[mediaType].(map[string]interface{})
+			if !assert.True(t, ok, "Expected content type %s to be documented", mediaType) ||
+				!strings.HasSuffix(mediaType, "json") {
+				return
+			}
+			var body interface{}
+			assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &body), "Expected a JSON body")
+			schema := media["schema"].(map[string]interface{})
+			assert.Empty(t, spec.validate(schema, body, "body"), "Expected the body to match the schema")
+		})
+	}
+}
+
+// Test that the request bodies are validated by the handlers as the document describes
+func TestOpenAPIRequestValidation(t *testing.T) {
+	spec := loadOpenAPI(t)
+	urls := map[string]string{
+		"/guest_list/{name}":                     "/guest_list/John+Smith",
+		"/guests/{name}":                         "/guests/Mary+Queen",
+		"/v1/guest_list/{name}":                  "/v1/guest_list/John+Smith",
+		"/v1/guests/{name}":                      "/v1/guests/Mary+Queen",
+		"/v1/events/{event}/guest_list/{name}":   "/v1/events/1/guest_list/John+Smith",
+		"/v1/events/{event}/guests/{name}":       "/v1/events/1/guests/Mary+Queen",
+		"/v2/guests":                             "/v2/guests",
+		"/v2/guests/{id}/arrival":                "/v2/guests/1/arrival",
+		"/v2/guests/{id}/rsvp":                   "/v2/guests/1/rsvp",
+		"/v2/events/{event}/guests":              "/v2/events/1/guests",
+		"/v2/events/{event}/guests/{id}/arrival": "/v2/events/1/guests/1/arrival",
+		"/v2/events/{event}/guests/{id}/rsvp":    "/v2/events/1/guests/1/rsvp",
+		"/v2/events":                             "/v2/events",
+		"/v2/events/{event}":                     "/v2/events/1",
+		"/v2/events/{event}/tables/{table}":      "/v2/events/1/tables/5",
+		"/v2/events/{event}/phase":               "/v2/events/1/phase",
+		"/v2/events/{event}/clone/preview":       "/v2/events/1/clone/preview",
+		"/v2/events/{event}/clone":               "/v2/events/1/clone",
+		"/admin/api_keys":                        "/admin/api_keys",
+		"/admin/jobs/{name}":                     "/admin/jobs/purge_idempotency_keys",
+	}
+
+	for path, item := range spec["paths"].(map[string]interface{}) {
+		for method, operation := range item.(map[string]interface{}) {
+			operation, _ := operation.(map[string]interface{})
+			requestBody, ok := operation["requestBody"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			url, ok := urls[path]
+			if !assert.True(t, ok, "Expected a request path for %s", path) {
+				continue
+			}
+			media := requestBody["content"].(map[string]interface{})["application/json"].(map[string]interface{})
+			schema := spec.resolve(media["schema"].(map[string]interface{}))
+			properties := schema["properties"].(map[string]interface{})
+			required, _ := schema["required"].([]interface{})
+
+			// A body with the required properties at their minimum or example, which the other bodies are derived from
+			valid := map[string]interface{}{}
+			for _, name := range required {
+				property := properties[name.(string)].(map[string]interface{})
+				if property["type"] == "string" || property["type"] == "boolean" {
+					valid[name.(string)] = property["example"]
+				} else {
+					valid[name.(string)] = property["minimum"]
+				}
+			}
+			with := func(name string, value interface{}) map[string]interface{} {
+				body := map[string]interface{}{}
+				for key, value := range valid {
+					body[key] = value
+				}
+				if value == nil {
+					delete(body, name)
+				} else {
+					body[name] = value
+				}
+				return body
+			}
+
+			type violation struct {
+				body  map[string]interface{}
+				field string
+				code  string
+			}
+			var violations []violation
+			for _, name := range required {
+				violations = append(violations, violation{with(name.(string), nil), name.(string), FieldRequired})
+			}
+			for name, property := range properties {
+				property := property.(map[string]interface{})
+				if property["type"] == "string" {
+					violations = append(violations, violation{with(name, 1), name, FieldInvalidType})
+					if minLength, ok := property["minLength"].(float64); ok && minLength > 0 {
+						violations = append(violations, violation{with(name, strings.Repeat("a", int(minLength)-1)),
+							name, FieldOutOfRange})
+					}
+					if maxLength, ok := property["maxLength"].(float64); ok {
+						violations = append(violations, violation{with(name, strings.Repeat("a", int(maxLength)+1)),
+							name, FieldOutOfRange})
+					}
+					if _, ok := property["pattern"].(string); ok {
+						violations = append(violations, violation{with(name, "R2-D2!"), name, FieldInvalid})
+					}
+					continue
+				}
+				violations = append(violations, violation{with(name, "1"), name, FieldInvalidType})
+				if minimum, ok := property["minimum"].(float64); ok {
+					violations = append(violations, violation{with(name, minimum-1), name, FieldOutOfRange})
+				}
+				if maximum, ok := property["maximum"].(float64); ok {
+					violations = append(violations, violation{with(name, maximum+1), name, FieldOutOfRange})
+				}
+			}
+			if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				violations = append(violations, violation{with("unknown", 1), "unknown", FieldUnknown})
+			}
+
+			t.Run(strings.ToUpper(method)+" "+path+" valid body", func(t *testing.T) {
+				body, _ := json.Marshal(valid)
+				assert.Empty(t, spec.validate(schema, valid, "body"), "Expected the body to match the schema")
+				resp := serve(newTestServer(newPartyStore()), strings.ToUpper(method), url, string(body))
+				assert.True(t, resp.Code < 300, "Expected the body to be accepted: %s", resp.Body.String())
+			})
+			for _, v := range violations {
+				v := v
+				body, _ := json.Marshal(v.body)
+				t.Run(strings.ToUpper(method)+" "+path+" "+string(body), func(t *testing.T) {
+					assert.NotEmpty(t, spec.validate(schema, v.body, "body"), "Expected the body to violate the schema")
+
+					resp := serve(newTestServer(newPartyStore()), strings.ToUpper(method), url, string(body))
+
+					assert.Equal(t, http.StatusUnprocessableEntity, resp.Code, "Expected the body to be rejected")
+					problem := &model.Problem{}
+					assert.Nil(t, json.NewDecoder(resp.Body).Decode(problem), "Expected problem details")
+					assert.Equal(t, CodeValidationFailed, problem.Code, "Expected validation failure")
+					var codes []string
+					for _, fieldError := range problem.Errors {
+						if fieldError.Field == v.field {
+							codes = append(codes, fieldError.Code)
+						}
+					}
+					assert.Equal(t, []string{v.code}, codes, "Expected the field error")
+				})
+			}
+		}
+	}
+}
+
+// Test that every mutation documents the idempotency key and the responses to a conflicting key
+func TestOpenAPIIdempotencyKey(t *testing.T) {
+	spec := loadOpenAPI(t)
+	for path, item := range spec["paths"].(map[string]interface{}) {
+		for method, operation := range item.(map[string]interface{}) {
+			if !mutatingMethods[strings.ToUpper(method)] {
+				continue
+			}
+			operation := operation.(map[string]interface{})
+			documented := false
+			parameters, _ := operation["parameters"].([]interface{})
+			for _, parameter := range parameters {
+				parameter := spec.resolve(parameter.(map[string]interface{}))
+				documented = documented || (parameter["in"] == "header" && parameter["name"] == IdempotencyKeyHeader)
+			}
+			assert.True(t, documented, "Expected %s %s to document the idempotency key", method, path)
+			responses := operation["responses"].(map[string]interface{})
+			for _, status := range []string{"409", "422"} {
+				assert.Contains(t, responses, status, "Expected %s %s to document status %s", method, path, status)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package common
+
+import (
+	"GuestList/internal/model"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Phases of an event: the guest list is prepared while planning and is final once locked, the guests are checked
+// in and out while the doors are open, and nothing changes anymore once the event is closed
+const (
+	PhasePlanning = "PLANNING"
+	PhaseLocked   = "LOCKED"
+	PhaseOpen     = "OPEN"
+	PhaseClosed   = "CLOSED"
+)
+
+// Phases an event can move to from every phase, the closing cannot be undone
+var phaseTransitions = map[string][]string{
+	PhasePlanning: {PhaseLocked},
+	PhaseLocked:   {PhasePlanning, PhaseOpen},
+	PhaseOpen:     {PhaseClosed},
+	PhaseClosed:   nil,
+}
+
+// Reports whether the phase is one of the phases
+func inPhase(phase string, phases []string) bool {
+	for _, allowed := range phases {
+		if phase == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the error of a request which is not allowed in the phase of the event
+func errWrongPhase(event *model.Event, phases []string) error {
+	return &apiError{status: http.StatusConflict, code: CodeWrongPhase,
+		detail: fmt.Sprintf("not allowed while the event is %s, only while it is %s", event.Phase,
+			strings.Join(phases, " or "))}
+}
+
+/*
+This function moves the event of the path to another phase and responds with the event. Closing the event checks
+out the guests still at the party and generates the summary of the event.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) ChangeEventPhase(resp http.ResponseWriter, req *http.Request) {
+	var phase *string
+	if errDecoder := decodeBody(req, bodyField{name: "phase", required: true, min: 1, max: len(PhasePlanning),
+		text: &phase}); errDecoder != nil {
+		s.encodeError(resp, req, errDecoder)
+		return
+	}
+	if _, ok := phaseTransitions[*phase]; !ok {
+		s.encodeError(resp, req, &apiError{status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+			detail: "invalid fields: phase", fields: []model.FieldError{{Field: "phase", Code: FieldOutOfRange,
+				Message: "field must be PLANNING, LOCKED, OPEN or CLOSED"}}})
+		return
+	}
+
+	ctx := req.Context()
+	event, err := s.store.GetEvent(ctx, eventFromContext(ctx))
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	if !inPhase(*phase, phaseTransitions[event.Phase]) {
+		s.encodeError(resp, req, &apiError{status: http.StatusConflict, code: CodeInvalidTransition,
+			detail: fmt.Sprintf("event cannot move from %s to %s", event.Phase, *phase)})
+		return
+	}
+	if *phase == PhaseClosed {
+		_, err = s.store.CloseEvent(ctx, event.Id, s.clock())
+	} else {
+		err = s.store.UpdateEventPhase(ctx, event.Id, event.Phase, *phase)
+	}
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	event.Phase = *phase
+	encodeResponse(resp, event, http.StatusOK)
+}
+
+/*
+This function gets the summary of the event of the path, which is generated when the event is closed.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+*/
+func (s *Server) GetEventSummary(resp http.ResponseWriter, req *http.Request) {
+	summary, err := s.store.GetEventSummary(req.Context(), eventFromContext(req.Context()))
+	if err != nil {
+		s.encodeError(resp, req, err)
+		return
+	}
+	encodeResponse(resp, summary, http.StatusOK)
+}
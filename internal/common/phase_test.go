@@ -0,0 +1,86 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+// Test moving a new event through its phases, with the routes allowed in every phase
+func TestServerEventPhases(t *testing.T) {
+	store := newPartyStore()
+	s := newTestServer(store)
+	resp := serve(s, "POST", "/v2/events", `{"name": "Summer party", "date": "2021-07-01T18:00:00Z"}`)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the event to be created: %s", resp.Body.String())
+	for _, table := range []string{"1", "2"} {
+		resp = serve(s, "PUT", "/v2/events/2/tables/"+table, `{"capacity": 4}`)
+		assert.Equal(t, http.StatusCreated, resp.Code, "Expected the table to be added: %s", resp.Body.String())
+	}
+	resp = serve(s, "POST", "/v2/events/2/guests", `{"name": "Mary Queen", "table": 1, "accompanying_guests": 1}`)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the guest to be added: %s", resp.Body.String())
+
+	resp = serve(s, "PUT", "/v2/events/2/guests/3/arrival", `{"accompanying_guests": 1}`)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the doors to be closed while planning")
+	assert.Equal(t, CodeWrongPhase, problemCode(t, resp), "Expected the phase to be reported")
+	resp = serve(s, "PUT", "/v2/events/2/phase", `{"phase": "OPEN"}`)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the guest list to be locked first")
+	assert.Equal(t, CodeInvalidTransition, problemCode(t, resp), "Expected an invalid transition")
+
+	resp = serve(s, "PUT", "/v2/events/2/phase", `{"phase": "LOCKED"}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the guest list to be locked: %s", resp.Body.String())
+	assert.Contains(t, resp.Body.String(), `"phase":"LOCKED"`, "Expected the event in the new phase")
+	resp = serve(s, "POST", "/v2/events/2/guests", `{"name": "Brad Pitt", "table": 2}`)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the locked guest list to be kept")
+	resp = serve(s, "GET", "/v2/events/2/guests/3/invitation", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the invitations to be sent while locked")
+
+	resp = serve(s, "PUT", "/v2/events/2/phase", `{"phase": "OPEN"}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the doors to open: %s", resp.Body.String())
+	resp = serve(s, "PUT", "/v2/events/2/guests/3/arrival", `{"accompanying_guests": 1}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the guest to arrive: %s", resp.Body.String())
+	resp = serve(s, "POST", "/v2/events/2/guests", `{"name": "Brad Pitt", "table": 2}`)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the walk-in to be added: %s", resp.Body.String())
+	resp = serve(s, "DELETE", "/v2/events/2/guests/4", "")
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the guests to be kept once the doors are open")
+	resp = serve(s, "GET", "/v2/events/2/summary", "")
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Expected no summary before the closing")
+	assert.Equal(t, CodeSummaryNotFound, problemCode(t, resp), "Expected summary not found")
+
+	resp = serve(s, "PUT", "/v2/events/2/phase", `{"phase": "CLOSED"}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the event to close: %s", resp.Body.String())
+	resp = serve(s, "GET", "/v2/events/2/guests/3", "")
+	assert.Contains(t, resp.Body.String(), `"status":"DEPARTED","rsvp_status":"PENDING",`+
+		`"time_arrived":"2020-12-31T20:00:00Z","time_departed":"2020-12-31T20:00:00Z"`,
+		"Expected the guest to be checked out")
+	resp = serve(s, "GET", "/v2/events/2/summary", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the summary: %s", resp.Body.String())
+	assert.JSONEq(t, `{"event_id": 2, "closed_at": "2020-12-31T20:00:00Z", "invited_guests": 2,
+		"arrived_guests": 1, "arrived_people": 2, "no_shows": 1, "declined": 0, "checked_out": 1, "seats": 8}`,
+		resp.Body.String(), "Expected the summary of the event")
+
+	resp = serve(s, "PUT", "/v2/events/2/guests/4/arrival", `{"accompanying_guests": 0}`)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the doors of the closed event to stay closed")
+	resp = serve(s, "GET", "/v2/events/2/guests/3/invitation", "")
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected no invitation to a closed event")
+	resp = serve(s, "PUT", "/v2/events/2/phase", `{"phase": "OPEN"}`)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the closing not to be undone")
+
+	var actions []string
+	for _, entry := range store.audit {
+		if entry.Action == AuditPhaseChanged || entry.Action == AuditEventClosed {
+			actions = append(actions, entry.Action)
+		}
+	}
+	assert.Equal(t, []string{AuditPhaseChanged, AuditPhaseChanged, AuditEventClosed}, actions,
+		"Expected the changes of the phase to be audited")
+}
+
+// Test that an unknown phase is rejected
+func TestServerUnknownPhase(t *testing.T) {
+	s := newTestServer(newPartyStore())
+
+	resp := serve(s, "PUT", "/v2/events/1/phase", `{"phase": "DONE"}`)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code, "Expected the phase to be rejected")
+	assert.Contains(t, resp.Body.String(), `"field":"phase","code":"OUT_OF_RANGE"`, "Expected the invalid field")
+}
@@ -0,0 +1,173 @@
+package common
+
+import (
+	"GuestList/internal/databse"
+	"GuestList/internal/logging"
+	"GuestList/internal/model"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Stable error codes reported to the clients in the problem details
+const (
+	CodeEventNotFound        = "EVENT_NOT_FOUND"
+	CodeWrongPhase           = "WRONG_PHASE"
+	CodeInvalidTransition    = "INVALID_TRANSITION"
+	CodeSummaryNotFound      = "SUMMARY_NOT_FOUND"
+	CodeGuestListFrozen      = "GUEST_LIST_FROZEN"
+	CodeGuestNotFound        = "GUEST_NOT_FOUND"
+	CodeGuestArrived         = "GUEST_ALREADY_ARRIVED"
+	CodeGuestExists          = "GUEST_EXISTS"
+	CodeTableNotFound        = "TABLE_NOT_FOUND"
+	CodeTableReserved        = "TABLE_RESERVED"
+	CodeInsufficientSeats    = "INSUFFICIENT_SEATS"
+	CodeInvalidBody          = "INVALID_BODY"
+	CodeValidationFailed     = "VALIDATION_FAILED"
+	CodeBodyTooLarge         = "BODY_TOO_LARGE"
+	CodeTimeout              = "TIMEOUT"
+	CodeRouteNotFound        = "ROUTE_NOT_FOUND"
+	CodeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	CodeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+	CodeIdempotencyKeyInUse  = "IDEMPOTENCY_KEY_IN_USE"
+	CodeUnauthenticated      = "UNAUTHENTICATED"
+	CodeForbidden            = "FORBIDDEN"
+	CodeAPIKeyNotFound       = "API_KEY_NOT_FOUND"
+	CodeJobNotFound          = "JOB_NOT_FOUND"
+	CodeJobRunning           = "JOB_RUNNING"
+	CodeInternalError        = "INTERNAL_ERROR"
+)
+
+// Header carrying the correlation id of the request
+const CorrelationIdHeader = "X-Correlation-ID"
+
+// Maximum length of a correlation id given by the client
+const maxCorrelationIdLength = 64
+
+// Content type of the error responses
+const problemContentType = "application/problem+json"
+
+// apiError is an error which is reported to the client as it is
+type apiError struct {
+	status int
+	code   string
+	detail string
+	fields []model.FieldError
+}
+
+func (e *apiError) Error() string {
+	return e.detail
+}
+
+/* This is a helper function to build the problem details for an error.
+The errors of the database queries are mapped to their codes, unknown errors are reported as an internal error
+without any details so that the database internals are not leaked to the client.
+Arguments:
+	err error - error to be reported
+Return:
+	*model.Problem - problem details without the request specific fields
+*/
+func problemFor(err error) *model.Problem {
+	var apiErr *apiError
+	switch {
+	case errors.As(err, &apiErr):
+		return newProblem(apiErr.status, apiErr.code, apiErr.detail, apiErr.fields)
+	case errors.Is(err, databse.ErrEventNotFound):
+		return newProblem(http.StatusNotFound, CodeEventNotFound, err.Error(), nil)
+	case errors.Is(err, databse.ErrPhaseChanged):
+		return newProblem(http.StatusConflict, CodeInvalidTransition, err.Error(), nil)
+	case errors.Is(err, databse.ErrSummaryNotFound):
+		return newProblem(http.StatusNotFound, CodeSummaryNotFound, err.Error(), nil)
+	case errors.Is(err, databse.ErrGuestNotFound):
+		return newProblem(http.StatusNotFound, CodeGuestNotFound, err.Error(), nil)
+	case errors.Is(err, databse.ErrGuestExists):
+		return newProblem(http.StatusConflict, CodeGuestExists, err.Error(), nil)
+	case errors.Is(err, databse.ErrGuestArrived):
+		return newProblem(http.StatusConflict, CodeGuestArrived, err.Error(), nil)
+	case errors.Is(err, databse.ErrTableNotFound):
+		return newProblem(http.StatusNotFound, CodeTableNotFound, err.Error(), nil)
+	case errors.Is(err, databse.ErrTableReserved):
+		return newProblem(http.StatusConflict, CodeTableReserved, err.Error(), nil)
+	case errors.Is(err, databse.ErrInsufficientSeats):
+		return newProblem(http.StatusUnprocessableEntity, CodeInsufficientSeats, err.Error(), nil)
+	case errors.Is(err, databse.ErrAPIKeyNotFound):
+		return newProblem(http.StatusNotFound, CodeAPIKeyNotFound, err.Error(), nil)
+	case errors.Is(err, databse.ErrJobNotFound):
+		return newProblem(http.StatusNotFound, CodeJobNotFound, err.Error(), nil)
+	case errors.Is(err, databse.ErrJobRunning):
+		return newProblem(http.StatusConflict, CodeJobRunning, err.Error(), nil)
+	}
+	return newProblem(http.StatusInternalServerError, CodeInternalError, "an unexpected error occurred", nil)
+}
+
+func newProblem(status int, code string, detail string, fields []model.FieldError) *model.Problem {
+	return &model.Problem{
+		Type:   "/problems/" + strings.ToLower(strings.Replace(code, "_", "-", -1)),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Errors: fields,
+	}
+}
+
+/* This is a helper function to get the correlation id of the request. The id assigned by the RequestId middleware
+is used if present, then the id given by the client if it is valid, otherwise a new one is generated.
+Arguments:
+	req *http.Request - HTTP request to the REST API
+Return:
+	string - correlation id
+*/
+func correlationId(req *http.Request) string {
+	if id, ok := req.Context().Value(requestIdKey{}).(string); ok {
+		return id
+	}
+	if id := req.Header.Get(CorrelationIdHeader); validCorrelationId(id) {
+		return id
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		logging.FromContext(req.Context()).Error("generating the correlation id failed", logging.Err(err))
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// Returns whether the id given by the client has 1 to 64 letters, digits, dots, underscores or hyphens
+func validCorrelationId(id string) bool {
+	if id == "" || len(id) > maxCorrelationIdLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+/* This is a helper function to encode an error in the HTTP response as problem details.
+Arguments:
+	response http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+	err error - error to be encoded
+Return:
+	*model.Problem - encoded problem details
+*/
+func encodeError(response http.ResponseWriter, req *http.Request, err error) *model.Problem {
+	problem := problemFor(err)
+	problem.Instance = req.URL.Path
+	problem.CorrelationId = correlationId(req)
+
+	response.Header().Set("Content-Type", problemContentType)
+	response.Header().Set(CorrelationIdHeader, problem.CorrelationId)
+	response.WriteHeader(problem.Status)
+	if err := json.NewEncoder(response).Encode(problem); err != nil {
+		logging.FromContext(req.Context()).Error("encoding the problem failed", logging.Err(err))
+	}
+	return problem
+}
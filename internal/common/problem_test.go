@@ -0,0 +1,57 @@
+package common
+
+import (
+	"GuestList/internal/databse"
+	"GuestList/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Test mapping the errors to the problem details
+func TestProblemFor(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{databse.ErrGuestNotFound, http.StatusNotFound, CodeGuestNotFound},
+		{databse.ErrPhaseChanged, http.StatusConflict, CodeInvalidTransition},
+		{databse.ErrSummaryNotFound, http.StatusNotFound, CodeSummaryNotFound},
+		{databse.ErrTableNotFound, http.StatusNotFound, CodeTableNotFound},
+		{fmt.Errorf("table 3: %w", databse.ErrTableReserved), http.StatusConflict, CodeTableReserved},
+		{databse.ErrInsufficientSeats, http.StatusUnprocessableEntity, CodeInsufficientSeats},
+		{databse.ErrJobNotFound, http.StatusNotFound, CodeJobNotFound},
+		{databse.ErrJobRunning, http.StatusConflict, CodeJobRunning},
+		{&apiError{status: http.StatusBadRequest, code: CodeInvalidBody}, http.StatusBadRequest, CodeInvalidBody},
+		{databse.ErrGuestExists, http.StatusConflict, CodeGuestExists},
+		{errors.New("Error 1146: Table 'party.guest_list' doesn't exist"), http.StatusInternalServerError,
+			CodeInternalError},
+	}
+	for _, test := range tests {
+		problem := problemFor(test.err)
+		assert.Equal(t, test.status, problem.Status, "Expected different status for %v", test.err)
+		assert.Equal(t, test.code, problem.Code, "Expected different code for %v", test.err)
+	}
+}
+
+// Test encoding an unexpected error without leaking its details
+func TestEncodeError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/guest_list", nil)
+	req.Header.Set(CorrelationIdHeader, "abc123")
+	resp := httptest.NewRecorder()
+
+	encodeError(resp, req, errors.New("Error 1146: Table 'party.guest_list' doesn't exist"))
+
+	problem := &model.Problem{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(problem), "Expected problem details")
+	assert.Equal(t, http.StatusInternalServerError, resp.Code, "Expected internal error")
+	assert.Equal(t, problemContentType, resp.Header().Get("Content-Type"), "Expected problem content type")
+	assert.Equal(t, "abc123", problem.CorrelationId, "Expected correlation id of the request")
+	assert.Equal(t, "/guest_list", problem.Instance, "Expected request path as instance")
+	assert.NotContains(t, problem.Detail, "party.guest_list", "Expected no database details")
+}
@@ -0,0 +1,275 @@
+package common
+
+import (
+	"GuestList/config"
+	"GuestList/internal/auth"
+	"GuestList/internal/databse"
+	"GuestList/internal/logging"
+	"GuestList/internal/scheduler"
+	"GuestList/internal/tracing"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+// Server serves the REST API of the guest list
+type Server struct {
+	store     databse.Store
+	config    config.Config
+	logger    *logging.Logger
+	tracer    *tracing.Tracer
+	clock     func() time.Time
+	router    *mux.Router
+	metrics   *serverMetrics
+	verifier  *auth.Verifier
+	scheduler *scheduler.Scheduler
+
+	shuttingDown int32 // set to 1 once the shutdown has started
+}
+
+/* This function creates a server and sets-up the routes of the REST API.
+Arguments:
+	store databse.Store - store of the guest list
+	cfg config.Config - configuration of the service
+	logger *logging.Logger - logger, the entries of a request carry its id
+	tracer *tracing.Tracer - tracer of the requests and the calls to the store
+	clock func() time.Time - source of the current time
+Return:
+	*Server - server
+*/
+func NewServer(store databse.Store, cfg config.Config, logger *logging.Logger, tracer *tracing.Tracer,
+	clock func() time.Time) *Server {
+	s := &Server{
+		config: cfg,
+		logger: logger,
+		tracer: tracer,
+		clock:  clock,
+		router: mux.NewRouter().StrictSlash(true),
+	}
+	// Measure and trace every call to the store, and audit every change
+	s.metrics = newServerMetrics(store, logger)
+	s.store = &auditedStore{Store: &instrumentedStore{store: store, metrics: s.metrics, tracer: tracer, clock: clock},
+		clock: clock}
+	s.verifier = s.newVerifier()
+	s.scheduler = scheduler.New(s.store, logger, clock)
+	s.registerJobs()
+	s.routes()
+	return s
+}
+
+// Adds the fields to the logger of the request, so that the entries of the handler and the store carry them
+func withLogFields(req *http.Request, fields ...logging.Field) *http.Request {
+	logger := logging.FromContext(req.Context()).With(fields...)
+	return req.WithContext(logging.NewContext(req.Context(), logger))
+}
+
+// Prefixes of the versions of the REST API, and of the routes of a version scoped to an event
+const (
+	v1Prefix    = "/v1"
+	v2Prefix    = "/v2"
+	eventPrefix = "/events/{event:[0-9]+}"
+)
+
+// route is a handler of the REST API together with its time limit and the roles allowed to call it
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+	timeout time.Duration
+	roles   []string // roles allowed besides the administrators, who may call every route
+	phases  []string // phases of the event the route is allowed in, every phase if empty
+}
+
+// Sets-up the middlewares and the handlers for different requests
+func (s *Server) routes() {
+	// Middlewares applied to every request, the first one is the outermost
+	s.router.Use(RequestId, s.requestLogger, s.trace, s.measure, s.accessLog, s.recover, LimitBody(s.config.MaxBodyBytes))
+
+	// Roles allowed to call the routes: the organizers prepare the guest list before the party, the door staff
+	// checks the guests in and out, and every role may read the guests. The door staff looks up a guest who has not
+	// arrived yet on the guest list, it does not read the invitations.
+	organizers := []string{auth.RoleOrganizer}
+	door := []string{auth.RoleDoor}
+	readers := []string{auth.RoleOrganizer, auth.RoleViewer}
+	everyone := []string{auth.RoleOrganizer, auth.RoleDoor, auth.RoleViewer}
+
+	// Phases of the event the routes are allowed in: the guest list is changed while planning, walk-ins are added
+	// and the guests are checked in and out while the doors are open, and a closed event is only read
+	planning := []string{PhasePlanning}
+	planningOrOpen := []string{PhasePlanning, PhaseOpen}
+	open := []string{PhaseOpen}
+	notClosed := []string{PhasePlanning, PhaseLocked, PhaseOpen}
+
+	// Routes of the version 1 of the REST API, also served without the prefix as deprecated aliases. They serve the
+	// default event, and every event under the event prefix
+	v1 := []route{
+		// Add a guest to the guest list
+		{"POST", "/guest_list/{name:[a-zA-Z\\+]+}", s.AddGuest, s.config.RequestTimeout, organizers, planningOrOpen},
+		// Delete a guest from the guest list
+		{"DELETE", "/guest_list/{name:[a-zA-Z\\+]+}", s.DeleteGuest, s.config.RequestTimeout, organizers, planning},
+		// Get a single guest from the guest list
+		{"GET", "/guest_list/{name:[a-zA-Z\\+]+}", s.GetGuest, s.config.RequestTimeout, everyone, nil},
+		// Get the list of guests
+		{"GET", "/guest_list", s.GetGuestList, s.config.RequestTimeout, everyone, nil},
+		// Generate an invitation HTML file for the guest
+		{"GET", "/invitation/{name:[a-zA-Z\\+]+}", s.GenerateInvitation,
+			s.config.InvitationTimeout, readers, notClosed},
+		// Update the status of the guest upon arrival
+		{"PUT", "/guests/{name:[a-zA-Z\\+]+}", s.UpdateArrivedGuest, s.config.RequestTimeout, door, open},
+		// Record the departure of the guest
+		{"DELETE", "/guests/{name:[a-zA-Z\\+]+}", s.DepartGuest, s.config.RequestTimeout, door, open},
+		// Get a single guest who has arrived at the party
+		{"GET", "/guests/{name:[a-zA-Z\\+]+}", s.GetArrivedGuest, s.config.RequestTimeout, everyone, nil},
+		// List guests which have arrived at the party
+		{"GET", "/guests", s.GetArrivedGuests, s.config.RequestTimeout, everyone, nil},
+		// Get the number of empty seats
+		{"GET", "/seats_empty", s.CountEmptySeats, s.config.RequestTimeout, everyone, nil},
+	}
+	// Routes of the version 2 of the REST API, the guests are identified by their ID. They serve the default event,
+	// and every event under the event prefix
+	v2 := []route{
+		// Add a guest to the guest list
+		{"POST", "/guests", s.CreateGuest, s.config.RequestTimeout, organizers, planningOrOpen},
+		// List the guests, optionally by status
+		{"GET", "/guests", s.ListGuests, s.config.RequestTimeout, everyone, nil},
+		// Get a single guest
+		{"GET", "/guests/{id:[0-9]+}", s.GetGuestById, s.config.RequestTimeout, everyone, nil},
+		// Delete a guest from the guest list
+		{"DELETE", "/guests/{id:[0-9]+}", s.DeleteGuestById, s.config.RequestTimeout, organizers, planning},
+		// Generate an invitation HTML file for the guest
+		{"GET", "/guests/{id:[0-9]+}/invitation", s.GenerateGuestInvitation,
+			s.config.InvitationTimeout, readers, notClosed},
+		// Record the answer of the guest to the invitation
+		{"PUT", "/guests/{id:[0-9]+}/rsvp", s.UpdateRSVP, s.config.RequestTimeout, organizers, notClosed},
+		// Record the arrival of the guest
+		{"PUT", "/guests/{id:[0-9]+}/arrival", s.RecordArrival, s.config.RequestTimeout, door, open},
+		// Record the departure of the guest
+		{"PUT", "/guests/{id:[0-9]+}/departure", s.RecordDeparture, s.config.RequestTimeout, door, open},
+		// Get the number of empty seats
+		{"GET", "/seats_empty", s.CountEmptySeats, s.config.RequestTimeout, everyone, nil},
+	}
+	// Routes of the version 2 of the REST API managing the events and their tables
+	events := []route{
+		// Create an event
+		{"POST", "/events", s.CreateEvent, s.config.RequestTimeout, organizers, nil},
+		// List the events, optionally by status
+		{"GET", "/events", s.ListEvents, s.config.RequestTimeout, everyone, nil},
+		// Get a single event
+		{"GET", eventPrefix, s.GetEventById, s.config.RequestTimeout, everyone, nil},
+		// Change an event
+		{"PUT", eventPrefix, s.UpdateEvent, s.config.RequestTimeout, organizers, nil},
+		// Move an event to another phase, closing it checks the guests out and generates its summary
+		{"PUT", eventPrefix + "/phase", s.ChangeEventPhase, s.config.RequestTimeout, organizers, nil},
+		// Get the summary of a closed event
+		{"GET", eventPrefix + "/summary", s.GetEventSummary, s.config.RequestTimeout, everyone, nil},
+		// Report the changes of the guest list of an event after it was frozen, for the caterer
+		{"GET", eventPrefix + "/freeze_report", s.GetFreezeReport, s.config.RequestTimeout, everyone, nil},
+		// Report the guests of an event who never arrived, whose tables were released
+		{"GET", eventPrefix + "/no_shows", s.GetNoShowReport, s.config.RequestTimeout, everyone, nil},
+		// Preview a new event cloned from an event with its tables and guest list
+		{"POST", eventPrefix + "/clone/preview", s.PreviewEventClone, s.config.RequestTimeout, organizers, nil},
+		// Create a new event cloned from an event with its tables and guest list
+		{"POST", eventPrefix + "/clone", s.CloneEvent, s.config.RequestTimeout, organizers, nil},
+		// List the tables of an event with their occupancy
+		{"GET", eventPrefix + "/tables", s.ListTables, s.config.RequestTimeout, everyone, nil},
+		// Add a table to an event or change its number of seats
+		{"PUT", eventPrefix + "/tables/{table:[0-9]+}", s.SaveTable,
+			s.config.RequestTimeout, organizers, planningOrOpen},
+		// Remove a table from an event
+		{"DELETE", eventPrefix + "/tables/{table:[0-9]+}", s.DeleteTable,
+			s.config.RequestTimeout, organizers, planning},
+	}
+	// Routes for the administration of the service, which are not versioned and only allowed to the administrators
+	admin := []route{
+		// Create an API key
+		{"POST", "/admin/api_keys", s.CreateAPIKey, s.config.RequestTimeout, nil, nil},
+		// List the API keys
+		{"GET", "/admin/api_keys", s.ListAPIKeys, s.config.RequestTimeout, nil, nil},
+		// Revoke an API key
+		{"DELETE", "/admin/api_keys/{id:[0-9]+}", s.RevokeAPIKey, s.config.RequestTimeout, nil, nil},
+		// Query the audit log
+		{"GET", "/admin/audit_log", s.ListAuditLog, s.config.RequestTimeout, nil, nil},
+		// Export the audit log as CSV file
+		{"GET", "/admin/audit_log/export", s.ExportAuditLog, s.config.InvitationTimeout, nil, nil},
+		// Verify the hash chain of the audit log
+		{"GET", "/admin/audit_log/verify", s.VerifyAuditLog, s.config.InvitationTimeout, nil, nil},
+		// List the scheduled jobs
+		{"GET", "/admin/jobs", s.ListJobs, s.config.RequestTimeout, nil, nil},
+		// Pause or resume a job
+		{"PUT", "/admin/jobs/{name:[a-z_]+}", s.UpdateJob, s.config.RequestTimeout, nil, nil},
+		// Trigger a run of a job
+		{"POST", "/admin/jobs/{name:[a-z_]+}/runs", s.TriggerJob, s.config.RequestTimeout, nil, nil},
+		// List the runs of a job
+		{"GET", "/admin/jobs/{name:[a-z_]+}/runs", s.ListJobRuns, s.config.RequestTimeout, nil, nil},
+	}
+	// Routes for the operation of the service, which are not versioned and do not require authentication
+	operations := []route{
+		// Check if the process is alive
+		{"GET", "/healthz", s.Healthz, s.config.RequestTimeout, nil, nil},
+		// Check if the service can serve requests
+		{"GET", "/readyz", s.Readyz, s.config.RequestTimeout, nil, nil},
+		// Get the build information
+		{"GET", "/version", s.Version, s.config.RequestTimeout, nil, nil},
+		// Get the metrics in the Prometheus format
+		{"GET", "/metrics", s.Metrics, s.config.RequestTimeout, nil, nil},
+		// Get the OpenAPI document of the REST API
+		{"GET", "/openapi.json", s.OpenAPI, s.config.RequestTimeout, nil, nil},
+		// Get the documentation page rendering the OpenAPI document
+		{"GET", "/docs", s.Docs, s.config.RequestTimeout, nil, nil},
+	}
+
+	v1Router := s.router.PathPrefix(v1Prefix).Subrouter()
+	v2Router := s.router.PathPrefix(v2Prefix).Subrouter()
+	// Unknown routes of the version 2 are reported as problem details like any other error
+	v2Router.NotFoundHandler = http.HandlerFunc(s.RouteNotFound)
+	v2Router.MethodNotAllowedHandler = http.HandlerFunc(s.MethodNotAllowed)
+	// The caller is authenticated and authorized before the event and the idempotency key are looked up, so that
+	// the keys of the principals are kept apart and a forbidden request does not reserve a key
+	for _, r := range v1 {
+		for _, path := range []string{r.path, eventPrefix + r.path} {
+			v1Router.Handle(path, Chain(r.handler, s.authenticate, s.requireRole(r.roles...), s.scopeEvent(r.phases...),
+				s.idempotency, Timeout(r.timeout))).Methods(r.method)
+		}
+		// The legacy routes are marked deprecated before the phase of the event is checked
+		s.router.Handle(r.path, Chain(r.handler, s.authenticate, s.requireRole(r.roles...), Deprecated(v1Prefix),
+			s.scopeEvent(r.phases...), s.idempotency, Timeout(r.timeout))).Methods(r.method)
+	}
+	for _, r := range v2 {
+		for _, path := range []string{r.path, eventPrefix + r.path} {
+			v2Router.Handle(path, Chain(r.handler, s.authenticate, s.requireRole(r.roles...), s.scopeEvent(r.phases...),
+				s.idempotency, Timeout(r.timeout))).Methods(r.method)
+		}
+	}
+	for _, r := range events {
+		v2Router.Handle(r.path, Chain(r.handler, s.authenticate, s.requireRole(r.roles...), s.scopeEvent(r.phases...),
+			s.idempotency, Timeout(r.timeout))).Methods(r.method)
+	}
+	for _, r := range admin {
+		s.router.Handle(r.path, Chain(r.handler, s.authenticate, s.requireRole(r.roles...), s.idempotency,
+			Timeout(r.timeout))).Methods(r.method)
+	}
+	for _, r := range operations {
+		s.router.Handle(r.path, Timeout(r.timeout)(r.handler)).Methods(r.method)
+	}
+}
+
+// ServeHTTP serves the requests to the REST API
+func (s *Server) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	s.router.ServeHTTP(resp, req)
+}
+
+/* This function encodes an error in the HTTP response and logs it, the unexpected errors with the error level.
+Arguments:
+	resp http.ResponseWriter - HTTP response writer
+	req *http.Request - HTTP request to the REST API
+	err error - error to be encoded
+*/
+func (s *Server) encodeError(resp http.ResponseWriter, req *http.Request, err error) {
+	problem := encodeError(resp, req, err)
+	logger := logging.FromContext(req.Context()).With(logging.String("code", problem.Code))
+	if problem.Status == http.StatusInternalServerError {
+		logger.Error("request failed", logging.SensitiveErr(err))
+	} else {
+		logger.Debug("request rejected", logging.SensitiveErr(err))
+	}
+}
@@ -0,0 +1,310 @@
+package common
+
+import (
+	"GuestList/config"
+	"GuestList/internal/databse"
+	"GuestList/internal/logging"
+	"GuestList/internal/model"
+	"GuestList/internal/tracing"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Creates a server for the tests with the templates and the API documentation of the repository
+func newTestServer(store databse.Store) *Server {
+	cfg := config.Default()
+	cfg.InvitationTemplate = "../../templates/invitation.html"
+	cfg.APIDocsDir = "../../api"
+	// The guest list of the party starting now is not frozen unless a test freezes it
+	cfg.FreezeBefore = 0
+	// Every caller is an anonymous administrator unless a test enables the authentication
+	cfg.AuthEnabled, cfg.AuthInsecureDev = false, true
+	clock := func() time.Time { return testNow }
+	return NewServer(store, cfg, logging.Discard(), tracing.NewTracer(nil, clock), clock)
+}
+
+// Creates a store with four tables: Mary Queen is invited and Brad Pitt has arrived
+func newPartyStore() *fakeStore {
+	store := newFakeStore()
+	store.tables[defaultEventId] = map[int]int{1: 10, 2: 4, 3: 2, 4: 2}
+	store.jobs[JobPurgeIdempotencyKeys] = &model.Job{Name: JobPurgeIdempotencyKeys, IntervalSeconds: 3600,
+		NextRunAt: testNow}
+	return store.
+		seed("Mary Queen", 2, 1, "NOT_ARRIVED", 0).
+		seed("Brad Pitt", 3, 1, "ARRIVED", 1)
+}
+
+// Sends the request to the server and returns the recorded response
+func serve(s *Server, method string, path string, body string) *httptest.ResponseRecorder {
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, path, nil)
+	} else {
+		req = httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp := httptest.NewRecorder()
+	s.ServeHTTP(resp, req)
+	return resp
+}
+
+// Test every route of the REST API
+func TestServerRoutes(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		storeErr error
+		status   int
+		code     string // code of the problem details, if an error is expected
+		contains string // part of the response body, if a success is expected
+	}{
+		// Add a guest to the guest list
+		{"add guest", "POST", "/guest_list/John+Smith", `{"table": 1, "accompanying_guests": 2}`, nil,
+			http.StatusCreated, "", `"name":"John Smith"`},
+		{"add guest to reserved table", "POST", "/guest_list/John+Smith", `{"table": 2}`, nil,
+			http.StatusConflict, CodeTableReserved, ""},
+		{"add guest filling the table", "POST", "/guest_list/John+Smith", `{"table": 1, "accompanying_guests": 9}`,
+			nil, http.StatusCreated, "", ""},
+		{"add guest to small table", "POST", "/guest_list/John+Smith", `{"table": 4, "accompanying_guests": 2}`,
+			nil, http.StatusUnprocessableEntity, CodeInsufficientSeats, ""},
+		{"add guest to unknown table", "POST", "/guest_list/John+Smith", `{"table": 7}`, nil,
+			http.StatusNotFound, CodeTableNotFound, ""},
+		{"add guest with invalid json", "POST", "/guest_list/John+Smith", `{"table": `, nil,
+			http.StatusBadRequest, CodeInvalidBody, ""},
+		{"add guest without table", "POST", "/guest_list/John+Smith", `{"accompanying_guests": 2}`, nil,
+			http.StatusUnprocessableEntity, CodeValidationFailed, ""},
+		{"add guest already on the guest list", "POST", "/guest_list/Mary+Queen", `{"table": 1}`, nil,
+			http.StatusConflict, CodeGuestExists, ""},
+		{"add guest with store failure", "POST", "/guest_list/John+Smith", `{"table": 1}`,
+			errors.New("dial tcp 127.0.0.1:3306: connect: connection refused"),
+			http.StatusInternalServerError, CodeInternalError, ""},
+		{"add guest with invalid name", "POST", "/guest_list/John1", `{"table": 1}`, nil,
+			http.StatusNotFound, "", ""},
+
+		// Delete a guest from the guest list
+		{"delete guest", "DELETE", "/guest_list/Mary+Queen", "", nil, http.StatusNoContent, "", ""},
+		{"delete unknown guest", "DELETE", "/guest_list/John+Smith", "", nil,
+			http.StatusNotFound, CodeGuestNotFound, ""},
+
+		// Get a single guest from the guest list
+		{"get guest", "GET", "/guest_list/Mary+Queen", "", nil, http.StatusOK, "",
+			`"planned_accompanying_guests":1,"actual_accompanying_guests":null,"status":"NOT_ARRIVED"`},
+		{"get unknown guest", "GET", "/guest_list/John+Smith", "", nil,
+			http.StatusNotFound, CodeGuestNotFound, ""},
+
+		// Get the list of guests
+		{"get guest list", "GET", "/guest_list", "", nil, http.StatusOK, "",
+			`{"guests":[{"name":"Mary Queen","accompanying_guests":1,"table":2},` +
+				`{"name":"Brad Pitt","accompanying_guests":1,"table":3}]}`},
+		{"get guest list page", "GET", "/guest_list?limit=1&offset=1", "", nil, http.StatusOK, "",
+			`{"guests":[{"name":"Brad Pitt","accompanying_guests":1,"table":3}]}`},
+		{"get guest list with store failure", "GET", "/guest_list", "", errors.New("sql: database is closed"),
+			http.StatusInternalServerError, CodeInternalError, ""},
+
+		// Generate an invitation HTML file for the guest
+		{"generate invitation", "GET", "/invitation/Mary+Queen", "", nil, http.StatusOK, "",
+			"Dear Mary Queen"},
+		{"generate invitation for unknown guest", "GET", "/invitation/John+Smith", "", nil,
+			http.StatusNotFound, CodeGuestNotFound, ""},
+
+		// Update the status of the guest upon arrival
+		{"guest arrives", "PUT", "/guests/Mary+Queen", `{"accompanying_guests": 3}`, nil,
+			http.StatusOK, "", `"name":"Mary Queen"`},
+		{"guest arrives with too large entourage", "PUT", "/guests/Mary+Queen", `{"accompanying_guests": 4}`,
+			nil, http.StatusUnprocessableEntity, CodeInsufficientSeats, ""},
+		{"unknown guest arrives", "PUT", "/guests/John+Smith", `{"accompanying_guests": 1}`, nil,
+			http.StatusNotFound, CodeGuestNotFound, ""},
+		{"guest arrives with unknown field", "PUT", "/guests/Mary+Queen", `{"table": 1}`, nil,
+			http.StatusUnprocessableEntity, CodeValidationFailed, ""},
+
+		// Record the departure of the guest
+		{"guest departs", "DELETE", "/guests/Brad+Pitt", "", nil, http.StatusNoContent, "", ""},
+		{"guest departs before arrival", "DELETE", "/guests/Mary+Queen", "", nil,
+			http.StatusNotFound, CodeGuestNotFound, ""},
+
+		// Get a single guest who has arrived at the party
+		{"get arrived guest", "GET", "/guests/Brad+Pitt", "", nil, http.StatusOK, "",
+			`"actual_accompanying_guests":1,"status":"ARRIVED"`},
+		{"get guest who has not arrived", "GET", "/guests/Mary+Queen", "", nil,
+			http.StatusNotFound, CodeGuestNotFound, ""},
+
+		// List guests which have arrived at the party
+		{"get arrived guests", "GET", "/guests", "", nil, http.StatusOK, "",
+			`{"guests":[{"name":"Brad Pitt","accompanying_guests":1,"time_arrived":"2020-12-31T20:00:00Z"}]}`},
+		{"get arrived guests with store failure", "GET", "/guests", "", errors.New("sql: database is closed"),
+			http.StatusInternalServerError, CodeInternalError, ""},
+
+		// Get the number of empty seats
+		{"count empty seats", "GET", "/seats_empty", "", nil, http.StatusOK, "", `{"seats_empty":16}`},
+		{"count empty seats with store failure", "GET", "/seats_empty", "", errors.New("sql: database is closed"),
+			http.StatusInternalServerError, CodeInternalError, ""},
+
+		// Unknown routes and methods
+		{"unknown route", "GET", "/tables", "", nil, http.StatusNotFound, "", ""},
+		{"method not allowed", "PATCH", "/guests/Mary+Queen", "", nil, http.StatusMethodNotAllowed, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newPartyStore()
+			store.err = test.storeErr
+			if test.method == "DELETE" && strings.HasPrefix(test.path, "/guest_list/") {
+				// The guests are only removed while planning
+				store.event(defaultEventId).Phase = PhasePlanning
+			}
+			s := newTestServer(store)
+
+			resp := serve(s, test.method, test.path, test.body)
+
+			assert.Equal(t, test.status, resp.Code, "Expected different status: %s", resp.Body.String())
+			if test.code != "" {
+				problem := &model.Problem{}
+				assert.Nil(t, json.NewDecoder(resp.Body).Decode(problem), "Expected problem details")
+				assert.Equal(t, test.code, problem.Code, "Expected different error code")
+				assert.NotEmpty(t, problem.CorrelationId, "Expected correlation id")
+				if test.storeErr != nil {
+					assert.NotContains(t, problem.Detail, test.storeErr.Error(), "Expected no database details")
+				}
+			}
+			if test.contains != "" {
+				assert.Contains(t, resp.Body.String(), test.contains, "Expected different response body")
+			}
+		})
+	}
+}
+
+// Test the state of the party after a guest has arrived and departed
+func TestServerArrivalAndDeparture(t *testing.T) {
+	s := newTestServer(newPartyStore())
+
+	resp := serve(s, "PUT", "/guests/Mary+Queen", `{"accompanying_guests": 2}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected guest to arrive")
+	resp = serve(s, "GET", "/seats_empty", "")
+	assert.JSONEq(t, `{"seats_empty": 13}`, resp.Body.String(), "Expected seats taken by the guest")
+
+	resp = serve(s, "DELETE", "/guests/Mary+Queen", "")
+	assert.Equal(t, http.StatusNoContent, resp.Code, "Expected guest to depart")
+	resp = serve(s, "GET", "/guest_list/Mary+Queen", "")
+	assert.Contains(t, resp.Body.String(), `"status":"DEPARTED"`, "Expected guest to be departed")
+	assert.Contains(t, resp.Body.String(), `"time_departed":"2020-12-31T20:00:00Z"`, "Expected departure time")
+	resp = serve(s, "GET", "/seats_empty", "")
+	assert.JSONEq(t, `{"seats_empty": 16}`, resp.Body.String(), "Expected seats released by the guest")
+	resp = serve(s, "POST", "/v2/guests", `{"name": "John Smith", "table": 2}`)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected the table of the guest to be free: %s",
+		resp.Body.String())
+
+	// The seats of the departed guest were handed out, the guest is not checked in again
+	resp = serve(s, "PUT", "/guests/Mary+Queen", `{"accompanying_guests": 0}`)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the departed guest to be rejected")
+	assert.Contains(t, resp.Body.String(), `"code":"GUEST_ALREADY_ARRIVED"`, "Expected the guest to have arrived")
+	resp = serve(s, "PUT", "/guests/Brad+Pitt", `{"accompanying_guests": 1}`)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the arrived guest to be rejected")
+}
+
+// Test the guests of the version 2 of the REST API through their life cycle
+func TestServerV2Guests(t *testing.T) {
+	store := newPartyStore()
+	s := newTestServer(store)
+
+	resp := serve(s, "POST", "/v2/guests", `{"name": "John Smith", "table": 1, "accompanying_guests": 2}`)
+	assert.Equal(t, http.StatusCreated, resp.Code, "Expected guest to be added: %s", resp.Body.String())
+	assert.Equal(t, "/v2/guests/3", resp.Header().Get("Location"), "Expected location of the guest")
+	assert.Contains(t, resp.Body.String(), `{"id":3,"name":"John Smith","table":1,"planned_accompanying_guests":2,`,
+		"Expected the record of the guest")
+
+	resp = serve(s, "PUT", "/v2/guests/3/arrival", `{"accompanying_guests": 1}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected guest to arrive: %s", resp.Body.String())
+	assert.Contains(t, resp.Body.String(), `"actual_accompanying_guests":1,"status":"ARRIVED"`, "Expected arrival")
+
+	resp = serve(s, "GET", "/v2/guests?status=ARRIVED&limit=1", "")
+	assert.JSONEq(t, `{"items": [{"id": 2, "name": "Brad Pitt", "table": 3, "planned_accompanying_guests": 1,
+		"actual_accompanying_guests": 1, "status": "ARRIVED", "rsvp_status": "PENDING",
+		"time_arrived": "2020-12-31T20:00:00Z", "time_departed": null}],
+		"page": {"limit": 1, "offset": 0, "total": 2, "next": "/v2/guests?limit=1&offset=1&status=ARRIVED"}}`,
+		resp.Body.String(), "Expected the first page of the arrived guests")
+	resp = serve(s, "GET", "/v2/guests?status=ARRIVED&limit=1&offset=1", "")
+	assert.Contains(t, resp.Body.String(), `"page":{"limit":1,"offset":1,"total":2,"next":null}`,
+		"Expected the last page")
+
+	resp = serve(s, "PUT", "/v2/guests/3/departure", "")
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected guest to depart: %s", resp.Body.String())
+	assert.Contains(t, resp.Body.String(), `"status":"DEPARTED"`, "Expected departure")
+
+	store.event(defaultEventId).Phase = PhasePlanning
+	resp = serve(s, "DELETE", "/v2/guests/3", "")
+	assert.Equal(t, http.StatusNoContent, resp.Code, "Expected guest to be deleted")
+	resp = serve(s, "GET", "/v2/guests/3", "")
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Expected guest to be gone")
+	resp = serve(s, "GET", "/v2/guests?offset=5", "")
+	assert.Contains(t, resp.Body.String(), `{"items":[],`, "Expected an empty page and not null")
+}
+
+// Test the answers of the guests to the invitation
+func TestServerRSVP(t *testing.T) {
+	store := newPartyStore()
+	s := newTestServer(store)
+
+	resp := serve(s, "PUT", "/v2/guests/1/rsvp", `{"rsvp_status": "ACCEPTED"}`)
+	assert.Equal(t, http.StatusOK, resp.Code, "Expected the answer to be recorded: %s", resp.Body.String())
+	assert.Contains(t, resp.Body.String(), `"rsvp_status":"ACCEPTED"`, "Expected the updated record")
+	resp = serve(s, "GET", "/v1/guest_list/Mary+Queen", "")
+	assert.Contains(t, resp.Body.String(), `"rsvp_status":"ACCEPTED"`, "Expected the answer to be stored")
+	if assert.Len(t, store.audit, 1, "Expected the answer to be audited") {
+		assert.Equal(t, AuditGuestAnswered, store.audit[0].Action, "Expected the answer of the guest")
+		assert.Contains(t, string(store.audit[0].Before), `"rsvp_status":"PENDING"`, "Expected the former answer")
+	}
+
+	resp = serve(s, "PUT", "/v2/guests/1/rsvp", `{"rsvp_status": "MAYBE"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code, "Expected an unknown answer to be rejected")
+	assert.Contains(t, resp.Body.String(), `"field":"rsvp_status","code":"OUT_OF_RANGE"`, "Expected the field")
+	resp = serve(s, "PUT", "/v2/guests/9/rsvp", `{"rsvp_status": "DECLINED"}`)
+	assert.Equal(t, http.StatusNotFound, resp.Code, "Expected an unknown guest")
+	store.event(defaultEventId).Phase = PhaseClosed
+	resp = serve(s, "PUT", "/v2/guests/1/rsvp", `{"rsvp_status": "DECLINED"}`)
+	assert.Equal(t, http.StatusConflict, resp.Code, "Expected the answers of a closed event to be kept")
+}
+
+// Test that the version 2 reports unknown routes and methods as problem details
+func TestServerV2UnknownRoutes(t *testing.T) {
+	s := newTestServer(newPartyStore())
+	tests := []struct {
+		method string
+		path   string
+		status int
+		code   string
+	}{
+		{"GET", "/v2/tables", http.StatusNotFound, CodeRouteNotFound},
+		{"GET", "/v2/guests/Mary+Queen", http.StatusNotFound, CodeRouteNotFound},
+		{"PATCH", "/v2/guests/1", http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+	}
+	for _, test := range tests {
+		resp := serve(s, test.method, test.path, "")
+
+		assert.Equal(t, test.status, resp.Code, "Expected different status for %s %s", test.method, test.path)
+		assert.Equal(t, problemContentType, resp.Header().Get("Content-Type"), "Expected problem details")
+		assert.Contains(t, resp.Body.String(), `"code":"`+test.code+`"`, "Expected different error code")
+	}
+}
+
+// Test that the unversioned routes are deprecated aliases of the version 1
+func TestDeprecatedRoutes(t *testing.T) {
+	s := newTestServer(newPartyStore())
+
+	legacy := serve(s, "GET", "/guest_list?limit=1", "")
+	v1 := serve(s, "GET", "/v1/guest_list?limit=1", "")
+
+	assert.Equal(t, v1.Body.String(), legacy.Body.String(), "Expected the same response from both versions")
+	assert.Equal(t, "true", legacy.Header().Get("Deprecation"), "Expected the legacy route to be deprecated")
+	assert.Equal(t, `</v1/guest_list?limit=1>; rel="successor-version"`, legacy.Header().Get("Link"),
+		"Expected a link to the successor version")
+	assert.Empty(t, v1.Header().Get("Deprecation"), "Expected the version 1 not to be deprecated")
+	resp := serve(s, "GET", "/healthz", "")
+	assert.Empty(t, resp.Header().Get("Deprecation"), "Expected the operational routes not to be deprecated")
+}
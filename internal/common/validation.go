@@ -0,0 +1,191 @@
+package common
+
+import (
+	"GuestList/internal/model"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Codes of the field-level validation errors
+const (
+	FieldRequired    = "REQUIRED"
+	FieldUnknown     = "UNKNOWN_FIELD"
+	FieldInvalidType = "INVALID_TYPE"
+	FieldOutOfRange  = "OUT_OF_RANGE"
+	FieldInvalid     = "INVALID_FORMAT"
+)
+
+// bodyField describes an integer, a string or a boolean field of a request body, its constraints and where its
+// value is stored
+type bodyField struct {
+	name     string
+	required bool
+	min      int            // minimum of an integer, minimum length of a string
+	max      int            // maximum of an integer, maximum length of a string
+	pattern  *regexp.Regexp // pattern a string has to match
+	value    **int          // value of an integer field
+	text     **string       // value of a string field, set instead of value
+	flag     **bool         // value of a boolean field, set instead of value
+}
+
+/* This is a helper function to decode and validate a JSON request body.
+The body has to be a JSON object which contains only the given fields. All violations are collected and
+reported at once: a body which is not a JSON object results in 400, invalid fields in 422 with the field errors.
+Arguments:
+	req *http.Request - HTTP request to the REST API
+	fields ...bodyField - fields allowed in the body
+Return:
+	error - *apiError describing the violations, or nil if the body is valid
+*/
+func decodeBody(req *http.Request, fields ...bodyField) error {
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "application/json" {
+			return &apiError{status: http.StatusBadRequest, code: CodeInvalidBody,
+				detail: "request body must be application/json"}
+		}
+	}
+
+	var body map[string]json.RawMessage
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&body)
+	if isBodyTooLarge(err) {
+		return errBodyTooLarge
+	}
+	if err != nil || body == nil || decoder.More() {
+		return &apiError{status: http.StatusBadRequest, code: CodeInvalidBody,
+			detail: "request body must be a single JSON object"}
+	}
+
+	var violations []model.FieldError
+	known := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		known[field.name] = true
+		raw, present := body[field.name]
+		if !present || string(raw) == "null" {
+			if field.required {
+				violations = append(violations, model.FieldError{Field: field.name, Code: FieldRequired,
+					Message: "field is required"})
+			}
+			continue
+		}
+		if field.text != nil {
+			violations = append(violations, decodeText(field, raw)...)
+			continue
+		}
+		if field.flag != nil {
+			var flag bool
+			if err := json.Unmarshal(raw, &flag); err != nil {
+				violations = append(violations, model.FieldError{Field: field.name, Code: FieldInvalidType,
+					Message: "field must be a boolean"})
+				continue
+			}
+			*field.flag = &flag
+			continue
+		}
+		var value int
+		if err := json.Unmarshal(raw, &value); err != nil {
+			violations = append(violations, model.FieldError{Field: field.name, Code: FieldInvalidType,
+				Message: "field must be an integer"})
+			continue
+		}
+		if value < field.min || value > field.max {
+			violations = append(violations, model.FieldError{Field: field.name, Code: FieldOutOfRange,
+				Message: fmt.Sprintf("field must be between %d and %d", field.min, field.max)})
+			continue
+		}
+		*field.value = &value
+	}
+
+	// Report the unknown fields in a stable order
+	var unknown []string
+	for name := range body {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		violations = append(violations, model.FieldError{Field: name, Code: FieldUnknown,
+			Message: "field is not allowed"})
+	}
+
+	if len(violations) > 0 {
+		names := make([]string, len(violations))
+		for i, violation := range violations {
+			names[i] = violation.Field
+		}
+		return &apiError{status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+			detail: "invalid fields: " + strings.Join(names, ", "), fields: violations}
+	}
+	return nil
+}
+
+// Decodes and validates the value of a string field
+func decodeText(field bodyField, raw json.RawMessage) []model.FieldError {
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return []model.FieldError{{Field: field.name, Code: FieldInvalidType, Message: "field must be a string"}}
+	}
+	if length := len([]rune(text)); length < field.min || length > field.max {
+		return []model.FieldError{{Field: field.name, Code: FieldOutOfRange,
+			Message: fmt.Sprintf("field must have between %d and %d characters", field.min, field.max)}}
+	}
+	if field.pattern != nil && !field.pattern.MatchString(text) {
+		return []model.FieldError{{Field: field.name, Code: FieldInvalid,
+			Message: "field must match " + field.pattern.String()}}
+	}
+	*field.text = &text
+	return nil
+}
+
+/* This is a helper function to decode and validate the pagination parameters of a list.
+Arguments:
+	req *http.Request - HTTP request to the REST API
+	defaultLimit int - limit used if the request does not give one
+	defaultOffset int - offset used if the request does not give one
+Return:
+	int - maximum number of entries of the page
+	int - number of entries to skip
+	error - *apiError describing the violations, or nil if the parameters are valid
+*/
+func decodePage(req *http.Request, defaultLimit int, defaultOffset int) (int, int, error) {
+	params := req.URL.Query()
+	var violations []model.FieldError
+	parse := func(name string, value int) int {
+		text := params.Get(name)
+		if text == "" {
+			return value
+		}
+		parsed, err := strconv.Atoi(text)
+		if err != nil {
+			violations = append(violations, model.FieldError{Field: name, Code: FieldInvalidType,
+				Message: "parameter must be an integer"})
+			return value
+		}
+		if parsed < 0 {
+			violations = append(violations, model.FieldError{Field: name, Code: FieldOutOfRange,
+				Message: "parameter must not be negative"})
+			return value
+		}
+		return parsed
+	}
+	limit := parse("limit", defaultLimit)
+	offset := parse("offset", defaultOffset)
+
+	if len(violations) > 0 {
+		names := make([]string, len(violations))
+		for i, violation := range violations {
+			names[i] = violation.Field
+		}
+		return 0, 0, &apiError{status: http.StatusUnprocessableEntity, code: CodeValidationFailed,
+			detail: "invalid parameters: " + strings.Join(names, ", "), fields: violations}
+	}
+	return limit, offset, nil
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test decoding and validating request bodies
+func TestDecodeBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		fields      []string
+	}{
+		{"valid body", "application/json", `{"table": 1, "accompanying_guests": 2, "notify": true}`, 0, nil},
+		{"optional field missing", "application/json; charset=utf-8", `{"table": 1}`, 0, nil},
+		{"not json", "text/plain", `table=1`, http.StatusBadRequest, nil},
+		{"malformed json", "application/json", `{"table": 1`, http.StatusBadRequest, nil},
+		{"not an object", "application/json", `[1, 2]`, http.StatusBadRequest, nil},
+		{"several values", "", `{"table": 1} {"table": 2}`, http.StatusBadRequest, nil},
+		{"missing table", "application/json", `{"accompanying_guests": 2}`, http.StatusUnprocessableEntity,
+			[]string{"table"}},
+		{"all violations", "application/json", `{"table": "one", "accompanying_guests": -1, "vip": true}`,
+			http.StatusUnprocessableEntity, []string{"table", "accompanying_guests", "vip"}},
+		{"not a boolean", "application/json", `{"table": 1, "notify": "yes"}`, http.StatusUnprocessableEntity,
+			[]string{"notify"}},
+		{"party too large", "application/json", `{"table": 1, "accompanying_guests": 100}`,
+			http.StatusUnprocessableEntity, []string{"accompanying_guests"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/guest_list/John", strings.NewReader(test.body))
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+			var table, accompanyingGuests *int
+			var notify *bool
+
+			err := decodeBody(req,
+				bodyField{name: "table", required: true, min: 1, max: 100, value: &table},
+				bodyField{name: "accompanying_guests", min: 0, max: 9, value: &accompanyingGuests},
+				bodyField{name: "notify", flag: &notify})
+
+			if test.status == 0 {
+				assert.Nil(t, err, "Expected no error")
+				assert.Equal(t, 1, *table, "Expected the table to be decoded")
+				if notify != nil {
+					assert.True(t, *notify, "Expected the flag to be decoded")
+				}
+				return
+			}
+			apiErr, ok := err.(*apiError)
+			assert.True(t, ok, "Expected an API error")
+			assert.Equal(t, test.status, apiErr.status, "Expected different status")
+			var fields []string
+			for _, field := range apiErr.fields {
+				fields = append(fields, field.Field)
+			}
+			assert.Equal(t, test.fields, fields, "Expected different invalid fields")
+		})
+	}
+}
+
+// Test decoding and validating the pagination parameters
+func TestDecodePage(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		limit  int
+		offset int
+		fields []string
+	}{
+		{"defaults", "", 100, 0, nil},
+		{"page", "?limit=10&offset=20", 10, 20, nil},
+		{"empty page", "?limit=0", 0, 0, nil},
+		{"not integers", "?limit=ten&offset=1.5", 0, 0, []string{"limit", "offset"}},
+		{"negative offset", "?offset=-1", 0, 0, []string{"offset"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/guest_list"+test.query, nil)
+
+			limit, offset, err := decodePage(req, 100, 0)
+
+			if test.fields == nil {
+				assert.Nil(t, err, "Expected no error")
+				assert.Equal(t, test.limit, limit, "Expected different limit")
+				assert.Equal(t, test.offset, offset, "Expected different offset")
+				return
+			}
+			apiErr, ok := err.(*apiError)
+			assert.True(t, ok, "Expected an API error")
+			assert.Equal(t, http.StatusUnprocessableEntity, apiErr.status, "Expected different status")
+			var fields []string
+			for _, field := range apiErr.fields {
+				fields = append(fields, field.Field)
+			}
+			assert.Equal(t, test.fields, fields, "Expected different invalid fields")
+		})
+	}
+}
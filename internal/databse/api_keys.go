@@ -0,0 +1,114 @@
+package databse
+
+import (
+	"GuestList/internal/model"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Columns of an API key as scanned by scanAPIKey
+const apiKeyColumns = "key_id, name, role, key_hash, created_at, revoked_at"
+
+// Scans a row with the apiKeyColumns into the API key
+func scanAPIKey(row interface{ Scan(...interface{}) error }, key *model.APIKey) error {
+	return row.Scan(&key.Id, &key.Name, &key.Role, &key.Hash, &key.CreatedAt, &key.RevokedAt)
+}
+
+/* This function stores a new API key.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	key *model.APIKey - name, role, hash and creation time of the key, the ID of the stored key is set
+Return:
+	error - any error that occurred
+*/
+func CreateAPIKey(ctx context.Context, db *sql.DB, key *model.APIKey) error {
+	result, err := db.ExecContext(ctx, "INSERT INTO api_keys(name, role, key_hash, created_at) VALUES ( ?, ?, ?, ? )",
+		key.Name, key.Role, key.Hash, key.CreatedAt)
+	if err == nil {
+		key.Id, err = result.LastInsertId()
+	}
+	if err != nil {
+		logQueryError(ctx, "CreateAPIKey", err)
+		return err
+	}
+	return nil
+}
+
+/* This function gets the API key with the hash, also if it was revoked.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	hash string - SHA-256 of the API key
+Return:
+	*model.APIKey - API key
+	error - ErrAPIKeyNotFound if no key has the hash, or any other error that occurred
+*/
+func GetAPIKeyByHash(ctx context.Context, db *sql.DB, hash string) (*model.APIKey, error) {
+	key := &model.APIKey{}
+	err := scanAPIKey(db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash=?", hash), key)
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		logQueryError(ctx, "GetAPIKeyByHash", err)
+		return nil, err
+	}
+	return key, nil
+}
+
+/* This function lists the API keys in the order they were created, including the revoked keys.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+Return:
+	[]model.APIKey - API keys
+	error - any error that occurred
+*/
+func ListAPIKeys(ctx context.Context, db *sql.DB) ([]model.APIKey, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY key_id")
+	if err != nil {
+		logQueryError(ctx, "ListAPIKeys", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		var key model.APIKey
+		if err := scanAPIKey(rows, &key); err != nil {
+			logQueryError(ctx, "ListAPIKeys", err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+/* This function revokes an API key, so that it is no longer accepted. A revoked key keeps its revocation time.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	keyId int64 - API key ID
+	revokedAt time.Time - time of the revocation
+Return:
+	error - ErrAPIKeyNotFound if no key has the ID, or any other error that occurred
+*/
+func RevokeAPIKey(ctx context.Context, db *sql.DB, keyId int64, revokedAt time.Time) error {
+	result, err := db.ExecContext(ctx, "UPDATE api_keys SET revoked_at=COALESCE(revoked_at, ?) WHERE key_id=?",
+		revokedAt, keyId)
+	if err != nil {
+		logQueryError(ctx, "RevokeAPIKey", err)
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logQueryError(ctx, "RevokeAPIKey", err)
+		return err
+	}
+	if rows == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
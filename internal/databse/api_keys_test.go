@@ -0,0 +1,77 @@
+package databse
+
+import (
+	"GuestList/internal/model"
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Columns of an API key
+var apiKeyColumnNames = []string{"key_id", "name", "role", "key_hash", "created_at", "revoked_at"}
+
+// Test storing an API key and looking it up by its hash
+func TestCreateAndGetAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	created := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+	key := &model.APIKey{Name: "door-tablet-1", Role: "door", Hash: "abc", CreatedAt: created}
+
+	mock.ExpectExec("^INSERT INTO api_keys").WithArgs("door-tablet-1", "door", "abc", created).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectQuery(`^SELECT key_id, (.+) FROM api_keys WHERE key_hash=\?`).WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows(apiKeyColumnNames).AddRow(4, "door-tablet-1", "door", "abc", created, nil))
+	mock.ExpectQuery(`^SELECT key_id, (.+) FROM api_keys WHERE key_hash=\?`).WithArgs("def").
+		WillReturnRows(sqlmock.NewRows(apiKeyColumnNames))
+
+	assert.Nil(t, CreateAPIKey(context.Background(), db, key), "Expected no error")
+	assert.Equal(t, int64(4), key.Id, "Expected the ID assigned by the database")
+
+	stored, err := GetAPIKeyByHash(context.Background(), db, "abc")
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, "door-tablet-1", stored.Name, "Expected different name")
+	assert.Nil(t, stored.RevokedAt, "Expected the key not to be revoked")
+
+	_, err = GetAPIKeyByHash(context.Background(), db, "def")
+	assert.Equal(t, ErrAPIKeyNotFound, err, "Expected key not found")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test listing and revoking the API keys
+func TestListAndRevokeAPIKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	created := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+	revoked := created.Add(time.Hour)
+
+	mock.ExpectQuery("^SELECT key_id, (.+) FROM api_keys ORDER BY key_id").
+		WillReturnRows(sqlmock.NewRows(apiKeyColumnNames).
+			AddRow(1, "admin-console", "admin", "abc", created, nil).
+			AddRow(2, "door-tablet-1", "door", "def", created, revoked))
+	mock.ExpectExec(`^UPDATE api_keys SET revoked_at=COALESCE\(revoked_at, \?\) WHERE key_id=\?`).
+		WithArgs(revoked, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^UPDATE api_keys").WithArgs(revoked, 9).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	keys, err := ListAPIKeys(context.Background(), db)
+	assert.Nil(t, err, "Expected no error")
+	assert.Len(t, keys, 2, "Expected every key")
+	assert.Equal(t, revoked, *keys[1].RevokedAt, "Expected the revocation time")
+
+	assert.Nil(t, RevokeAPIKey(context.Background(), db, 1, revoked), "Expected no error")
+	assert.Equal(t, ErrAPIKeyNotFound, RevokeAPIKey(context.Background(), db, 9, revoked), "Expected key not found")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
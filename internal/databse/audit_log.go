@@ -0,0 +1,166 @@
+package databse
+
+import (
+	"GuestList/internal/audit"
+	"GuestList/internal/model"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Columns of an audit entry as scanned by scanAuditEntry
+const auditColumns = "audit_id, occurred_at, actor, role, action, subject, before_value, after_value, source_ip, " +
+	"correlation_id, prev_hash, entry_hash"
+
+// Scans a row with the auditColumns into the audit entry
+func scanAuditEntry(row interface{ Scan(...interface{}) error }, entry *model.AuditEntry) error {
+	var before, after, prevHash, hash sql.NullString
+	if err := row.Scan(&entry.Id, &entry.OccurredAt, &entry.Actor, &entry.Role, &entry.Action, &entry.Subject,
+		&before, &after, &entry.SourceIP, &entry.CorrelationId, &prevHash, &hash); err != nil {
+		return err
+	}
+	entry.PrevHash, entry.Hash = prevHash.String, hash.String
+	if before.Valid {
+		entry.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		entry.After = json.RawMessage(after.String)
+	}
+	return nil
+}
+
+// Returns the record as a nullable column, a missing record is stored as NULL
+func nullableRecord(record json.RawMessage) interface{} {
+	if record == nil {
+		return nil
+	}
+	return string(record)
+}
+
+/* This function appends an entry to the audit log and chains it to the last entry. The head of the chain is locked
+until the entry is stored, so that the concurrent entries are chained one after the other. The table only accepts
+inserts, the entries cannot be changed.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	entry *model.AuditEntry - entry to be appended, the ID and the hashes of the stored entry are set
+Return:
+	error - any error that occurred
+*/
+func AppendAuditEntry(ctx context.Context, db *sql.DB, entry *model.AuditEntry) (err error) {
+	defer func() {
+		if err != nil {
+			logQueryError(ctx, "AppendAuditEntry", err)
+		}
+	}()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var head string
+	if err = tx.QueryRowContext(ctx, "SELECT head_hash FROM audit_chain WHERE chain_id=1 FOR UPDATE").
+		Scan(&head); err != nil {
+		return err
+	}
+	// The database keeps the microseconds, the hash has to cover the time as it is read back
+	entry.OccurredAt = entry.OccurredAt.UTC().Truncate(time.Microsecond)
+	entry.PrevHash, entry.Hash = head, audit.Hash(head, entry)
+	result, err := tx.ExecContext(ctx, "INSERT INTO audit_log(occurred_at, actor, role, action, subject, "+
+		"before_value, after_value, source_ip, correlation_id, prev_hash, entry_hash) "+
+		"VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? )", entry.OccurredAt, entry.Actor, entry.Role, entry.Action,
+		entry.Subject, nullableRecord(entry.Before), nullableRecord(entry.After), entry.SourceIP, entry.CorrelationId,
+		entry.PrevHash, entry.Hash)
+	if err != nil {
+		return err
+	}
+	if entry.Id, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE audit_chain SET head_hash=? WHERE chain_id=1", entry.Hash); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+/* This function gets the hash of the last entry of the audit log.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+Return:
+	string - hash of the last entry, audit.GenesisHash if no entry is chained yet
+	error - any error that occurred
+*/
+func GetAuditChainHead(ctx context.Context, db *sql.DB) (string, error) {
+	var head string
+	if err := db.QueryRowContext(ctx, "SELECT head_hash FROM audit_chain WHERE chain_id=1").Scan(&head); err != nil {
+		logQueryError(ctx, "GetAuditChainHead", err)
+		return "", err
+	}
+	return head, nil
+}
+
+/* This function lists the entries of the audit log matching the filter in the order they were appended.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	filter model.AuditFilter - filter, limit and offset of the entries
+Return:
+	[]model.AuditEntry - entries of the page
+	int - number of entries matching the filter
+	error - any error that occurred
+*/
+func ListAuditEntries(ctx context.Context, db *sql.DB, filter model.AuditFilter) ([]model.AuditEntry, int, error) {
+	var conditions []string
+	var args []interface{}
+	for _, condition := range []struct {
+		clause string
+		value  interface{}
+		set    bool
+	}{
+		{"actor=?", filter.Actor, filter.Actor != ""},
+		{"action=?", filter.Action, filter.Action != ""},
+		{"subject=?", filter.Subject, filter.Subject != ""},
+		{"occurred_at>=?", filter.From, !filter.From.IsZero()},
+		{"occurred_at<?", filter.To, !filter.To.IsZero()},
+	} {
+		if condition.set {
+			conditions, args = append(conditions, condition.clause), append(args, condition.value)
+		}
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		logQueryError(ctx, "ListAuditEntries", err)
+		return nil, 0, err
+	}
+	rows, err := db.QueryContext(ctx, "SELECT "+auditColumns+" FROM audit_log"+where+
+		" ORDER BY audit_id LIMIT ? OFFSET ?", append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		logQueryError(ctx, "ListAuditEntries", err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []model.AuditEntry{}
+	for rows.Next() {
+		var entry model.AuditEntry
+		if err := scanAuditEntry(rows, &entry); err != nil {
+			logQueryError(ctx, "ListAuditEntries", err)
+			return nil, 0, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, rows.Err()
+}
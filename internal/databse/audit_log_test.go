@@ -0,0 +1,116 @@
+package databse
+
+import (
+	"GuestList/internal/audit"
+	"GuestList/internal/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Columns of an audit entry
+var auditColumnNames = []string{"audit_id", "occurred_at", "actor", "role", "action", "subject", "before_value",
+	"after_value", "source_ip", "correlation_id", "prev_hash", "entry_hash"}
+
+// Test appending an entry to the audit log, a missing record is stored as NULL
+func TestAppendAuditEntry(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	occurred := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+	entry := &model.AuditEntry{OccurredAt: occurred, Actor: "door-tablet-1", Role: "door", Action: "GUEST_REMOVED",
+		Subject: "Mary Queen", Before: json.RawMessage(`{"name":"Mary Queen"}`), SourceIP: "10.0.0.7",
+		CorrelationId: "abc"}
+
+	head := strings.Repeat("a", 64)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT head_hash FROM audit_chain WHERE chain_id=1 FOR UPDATE$`).
+		WillReturnRows(sqlmock.NewRows([]string{"head_hash"}).AddRow(head))
+	hash := audit.Hash(head, entry)
+	mock.ExpectExec("^INSERT INTO audit_log").WithArgs(occurred, "door-tablet-1", "door", "GUEST_REMOVED",
+		"Mary Queen", `{"name":"Mary Queen"}`, nil, "10.0.0.7", "abc", head, hash).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec(`^UPDATE audit_chain SET head_hash=\? WHERE chain_id=1$`).WithArgs(hash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, AppendAuditEntry(context.Background(), db, entry), "Expected no error")
+	assert.Equal(t, int64(3), entry.Id, "Expected the ID assigned by the database")
+	assert.Equal(t, head, entry.PrevHash, "Expected the entry to be chained to the head")
+	assert.Equal(t, hash, entry.Hash, "Expected the hash of the entry")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test that the entry is not appended and the head is kept if the insert fails
+func TestAppendAuditEntryRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^SELECT head_hash FROM audit_chain").
+		WillReturnRows(sqlmock.NewRows([]string{"head_hash"}).AddRow(audit.GenesisHash))
+	mock.ExpectExec("^INSERT INTO audit_log").WillReturnError(errors.New("lock wait timeout"))
+	mock.ExpectRollback()
+
+	err = AppendAuditEntry(context.Background(), db, &model.AuditEntry{Action: "GUEST_ADDED"})
+	assert.NotNil(t, err, "Expected the error of the insert")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test listing the entries of the audit log matching a filter
+func TestListAuditEntries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	from := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM audit_log WHERE actor=\? AND occurred_at>=\?$`).
+		WithArgs("door-tablet-1", from).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+	mock.ExpectQuery(`^SELECT audit_id, (.+) FROM audit_log WHERE actor=\? AND occurred_at>=\? ORDER BY audit_id `+
+		`LIMIT \? OFFSET \?`).WithArgs("door-tablet-1", from, 2, 4).
+		WillReturnRows(sqlmock.NewRows(auditColumnNames).
+			AddRow(5, from, "door-tablet-1", "door", "GUEST_ARRIVED", "Mary Queen", `{"status":"NOT_ARRIVED"}`,
+				`{"status":"ARRIVED"}`, "10.0.0.7", "abc", nil, nil).
+			AddRow(6, from, "door-tablet-1", "door", "GUEST_ADDED", "John Smith", nil, `{"name":"John Smith"}`,
+				"10.0.0.7", "def", audit.GenesisHash, strings.Repeat("b", 64)))
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM audit_log$`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`^SELECT audit_id, (.+) FROM audit_log ORDER BY audit_id`).WithArgs(100, 0).
+		WillReturnRows(sqlmock.NewRows(auditColumnNames))
+
+	entries, total, err := ListAuditEntries(context.Background(), db,
+		model.AuditFilter{Actor: "door-tablet-1", From: from, Limit: 2, Offset: 4})
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, 7, total, "Expected the number of matching entries")
+	assert.Len(t, entries, 2, "Expected the entries of the page")
+	assert.JSONEq(t, `{"status":"ARRIVED"}`, string(entries[0].After), "Expected the record after the change")
+	assert.Nil(t, entries[1].Before, "Expected no record before the guest was added")
+	assert.Equal(t, "", entries[0].Hash, "Expected no hash for an entry appended before the chain")
+	assert.Equal(t, audit.GenesisHash, entries[1].PrevHash, "Expected the hash of the entry before")
+
+	entries, total, err = ListAuditEntries(context.Background(), db, model.AuditFilter{Limit: 100})
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, 0, total, "Expected an empty log")
+	assert.NotNil(t, entries, "Expected an empty list rather than null")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
@@ -1,28 +1,37 @@
 package databse
 
 import (
-	"GuestList/config"
+	"GuestList/internal/logging"
 	"database/sql"
-	_ "github.com/go-sql-driver/mysql"
-	"log"
+	"github.com/go-sql-driver/mysql"
 )
 
 /* This function takes care of connecting to the given Mysql and returns the required database
+Arguments:
+	dsn string - DSN of the MySQL database
 Returns:
 	*sql.DB - database
 	error - HTTP status
 */
-func ConnectDB() (*sql.DB, error) {
-	db, err := sql.Open("mysql", config.MYSQL_DSN+config.MYSQL_DATABASE+"?parseTime=true")
+func ConnectDB(dsn string) (*sql.DB, error) {
+	cfg, err := mysql.ParseDSN(dsn)
 	if err != nil {
-		log.Fatal(err.Error())
+		return nil, err
+	}
+	// clientFoundRows makes UPDATE report the matched rows, so that an unchanged row is not taken for a missing one
+	cfg.ParseTime = true
+	cfg.ClientFoundRows = true
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
 	}
 	// Check if the Mysql is accessible
 	err = db.Ping()
 	if err != nil {
 		return nil, err
 	}
-	log.Println("Connected to MySQL database")
+	logging.Default().Info("connected to the MySQL database", logging.String("address", cfg.Addr),
+		logging.String("database", cfg.DBName))
 
 	return db, nil
 }
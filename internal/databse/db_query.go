@@ -1,52 +1,73 @@
 package databse
 
 import (
+	"GuestList/internal/logging"
 	"GuestList/internal/model"
+	"GuestList/internal/tracing"
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"time"
 )
 
 /* This function adds guest to a guest list table.
 Arguments:
+	ctx context.Context - context of the request
 	db *sql.DB - MySQL database
-	guest *model.GuestsList - guest information
+	eventId int64 - event ID
+	guest *model.GuestsList - guest information, the ID of the added guest is set
 Return:
-	error - any error that occurred
+	error - ErrGuestExists if the guest is already on the guest list of the event, or any other error that occurred
 */
-func AddGuestToList(db *sql.DB, guest *model.GuestsList) error {
+func AddGuestToList(ctx context.Context, db *sql.DB, eventId int64, guest *model.GuestsList) error {
 
 	// Prepare sql query
-	query, err := db.Prepare("INSERT INTO guest_list(guest_name, planned_accompanying_guests, table_id, " +
-		"status, actual_accompanying_guests) VALUES ( ?, ?, ?, ?, ? )")
+	query, err := db.PrepareContext(ctx, "INSERT INTO guest_list(event_id, guest_name, planned_accompanying_guests, "+
+		"table_id, status, actual_accompanying_guests) VALUES ( ?, ?, ?, ?, ?, ? )")
 	if err != nil {
-		log.Println(err)
+		logQueryError(ctx, "AddGuestToList", err)
 		return err
 	}
 	defer query.Close()
 
 	// Execute query
-	_, err = query.Exec(guest.Name, guest.AccompanyingGuests, guest.TableId,
+	result, err := query.ExecContext(ctx, eventId, guest.Name, guest.AccompanyingGuests, guest.TableId,
 		guest.Status, -1)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		return ErrGuestExists
+	}
 	if err != nil {
+		logQueryError(ctx, "AddGuestToList", err)
 		return err
 	}
-	log.Printf("Guest %s: successfully added to the guest list", guest.Name)
+	// The ID of the guest is assigned by the database
+	if guest.Id, err = result.LastInsertId(); err != nil {
+		logQueryError(ctx, "AddGuestToList", err)
+		return err
+	}
+	logging.FromContext(ctx).Info("guest added to the guest list")
 	return nil
 }
 
-/* This function checks if the table is available.
+/* This function checks if the table is available. The table of a guest who has departed or was marked as no-show is
+released.
 Arguments:
+	ctx context.Context - context of the request
 	db *sql.DB - database
+	eventId int64 - event ID
 	table int - guest information
 Return:
 	int - number of the available seats
 	error - any error that occurred
 */
-func IsTableFree(db *sql.DB, tableId int) (bool, error) {
+func IsTableFree(ctx context.Context, db *sql.DB, eventId int64, tableId int) (bool, error) {
 
-	rows, err := db.Query("SELECT * from guest_list WHERE table_id=?", tableId)
+	rows, err := db.QueryContext(ctx, "SELECT * from guest_list WHERE event_id=? AND table_id=? AND status NOT IN (?, ?)",
+		eventId, tableId, "DEPARTED", "NO_SHOW")
 	if err != nil {
-		log.Println(err)
+		logQueryError(ctx, "IsTableFree", err)
 		return false, err
 	}
 	defer rows.Close()
@@ -57,76 +78,124 @@ func IsTableFree(db *sql.DB, tableId int) (bool, error) {
 	return true, nil
 }
 
-/* This function adds guest to a guest list table.
+/* This function gets the seating capacity of a table.
 Arguments:
+	ctx context.Context - context of the request
 	db *sql.DB - database
+	eventId int64 - event ID
 	table int - guest information
 Return:
 	int - number of the available seats
-	error - any error that occurred
+	error - ErrTableNotFound if the table does not exist, or any other error that occurred
 */
-func GetTableCapacity(db *sql.DB, tableId int) (int, error) {
+func GetTableCapacity(ctx context.Context, db *sql.DB, eventId int64, tableId int) (int, error) {
 	var availableSeats int
 	// Select all available seats
-	rows, err := db.Query("SELECT available_seats from tables WHERE table_id=?", tableId)
+	rows, err := db.QueryContext(ctx, "SELECT available_seats from tables WHERE event_id=? AND table_id=?", eventId,
+		tableId)
 	if err != nil {
-		log.Println(err)
+		logQueryError(ctx, "GetTableCapacity", err)
 		return 0, err
 	}
 	defer rows.Close()
-	for rows.Next() {
-		// Scan rows into variable
-		if err := rows.Scan(&availableSeats); err != nil {
-			log.Println(err)
-			return 0, err
-		}
+	if !rows.Next() {
+		return 0, ErrTableNotFound
+	}
+	// Scan rows into variable
+	if err := rows.Scan(&availableSeats); err != nil {
+		logQueryError(ctx, "GetTableCapacity", err)
+		return 0, err
 	}
 	return availableSeats, nil
 }
 
+/* This function checks if a party of the given size can be seated at the table.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - database
+	eventId int64 - event ID
+	tableId int - table ID
+	partySize int - guest together with the accompanying guests
+Return:
+	error - ErrTableNotFound, ErrTableReserved or ErrInsufficientSeats if the party cannot be seated,
+		or any other error that occurred
+*/
+func CheckTableForGuest(ctx context.Context, db *sql.DB, eventId int64, tableId int, partySize int) error {
+	// Get the available seats on the table, the queries are traced separately to tell the slow one apart
+	spanCtx, span := tracing.Start(ctx, "GetTableCapacity", tracing.KindClient)
+	availableSeats, err := GetTableCapacity(spanCtx, db, eventId, tableId)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return err
+	}
+	// Check if the table is available
+	spanCtx, span = tracing.Start(ctx, "IsTableFree", tracing.KindClient)
+	free, err := IsTableFree(spanCtx, db, eventId, tableId)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return err
+	}
+	if !free {
+		return ErrTableReserved
+	}
+	// Check if the table have enough empty seats
+	if partySize > availableSeats {
+		return ErrInsufficientSeats
+	}
+	return nil
+}
+
 /* This function deletes guest from the guest list table.
 Arguments:
+	ctx context.Context - context of the request
 	db *sql.DB - MySQL database
+	eventId int64 - event ID
 	guest *model.GuestsList - guest information
 Return:
-	error - gives error if the guest could not be added to the guest list, or nil if the guest was added
+	error - ErrGuestNotFound if the guest is not on the guest list, or any other error that occurred
 */
-func DeleteGuestFromList(db *sql.DB, guestName string) error {
+func DeleteGuestFromList(ctx context.Context, db *sql.DB, eventId int64, guestName string) error {
 	// Prepare sql query
-	query, err := db.Prepare("DELETE FROM guest_list WHERE guest_name=?")
+	query, err := db.PrepareContext(ctx, "DELETE FROM guest_list WHERE event_id=? AND guest_name=?")
 	if err != nil {
-		log.Println(err)
+		logQueryError(ctx, "DeleteGuestFromList", err)
 		return err
 	}
 	defer query.Close()
 
 	// Execute query
-	_, err = query.Exec(guestName)
+	result, err := query.ExecContext(ctx, eventId, guestName)
 	if err != nil {
-		log.Println(err)
+		logQueryError(ctx, "DeleteGuestFromList", err)
 		return err
 	}
-	log.Printf("Guest %s: successfully deleted from the guest list", guestName)
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return ErrGuestNotFound
+	}
+	logging.FromContext(ctx).Info("guest deleted from the guest list")
 	return nil
 }
 
 /* This function gets all guest from the guest list table.
 Arguments:
+	ctx context.Context - context of the request
 	db *sql.DB - MySQL database
+	eventId int64 - event ID
 	limit int - limit for pagination
 	offset int- offset
 Return:
 	[]model.GuestsList - slice Guests
 	error - any error that occurred
 */
-func GetAllGuests(db *sql.DB, limit int, offset int) ([]model.GuestsList, error) {//([]map[string]interface{}, error) {
+func GetAllGuests(ctx context.Context, db *sql.DB, eventId int64, limit int, offset int) ([]model.GuestsList, error) {
 	var guestList []model.GuestsList
-	//var guestList []map[string]interface{}
 	// Select all guests
-	rows, err := db.Query("SELECT guest_name, table_id, "+
-		"planned_accompanying_guests from guest_list LIMIT ? OFFSET ?", limit, offset)
+	rows, err := db.QueryContext(ctx, "SELECT guest_name, table_id, "+
+		"planned_accompanying_guests from guest_list WHERE event_id=? LIMIT ? OFFSET ?", eventId, limit, offset)
 	if err != nil {
-		log.Println(err)
+		logQueryError(ctx, "GetAllGuests", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -135,7 +204,7 @@ func GetAllGuests(db *sql.DB, limit int, offset int) ([]model.GuestsList, error)
 	for rows.Next() {
 		// Scan rows into Guest structure
 		if err := rows.Scan(&guest.Name, &guest.TableId, &guest.AccompanyingGuests); err != nil {
-			log.Println(err)
+			logQueryError(ctx, "GetAllGuests", err)
 			return nil, err
 		}
 		// Add guest to the slice
@@ -146,17 +215,19 @@ func GetAllGuests(db *sql.DB, limit int, offset int) ([]model.GuestsList, error)
 
 /* This function gets all empty seats.
 Arguments:
+	ctx context.Context - context of the request
 	db *sql.DB - MySQL database
+	eventId int64 - event ID
 Return:
 	int - number of empty seats
 	error - any error that occurred
 */
-func EmptySeats(db *sql.DB) (int, error) {
+func EmptySeats(ctx context.Context, db *sql.DB, eventId int64) (int, error) {
 	// Retrieve all arrived guests
-	rows, err := db.Query("SELECT SUM(actual_accompanying_guests + 1)"+
-		"FROM guest_list WHERE status=?", "ARRIVED")
+	rows, err := db.QueryContext(ctx, "SELECT COALESCE(SUM(actual_accompanying_guests + 1), 0) "+
+		"FROM guest_list WHERE event_id=? AND status=?", eventId, "ARRIVED")
 	if err != nil {
-		log.Println(err)
+		logQueryError(ctx, "EmptySeats", err)
 		return 0, err
 	}
 	defer rows.Close()
@@ -165,14 +236,14 @@ func EmptySeats(db *sql.DB) (int, error) {
 	for rows.Next() {
 		// Scan rows into variable
 		if err := rows.Scan(&totalArrivedGuests); err != nil {
-			log.Println(err)
+			logQueryError(ctx, "EmptySeats", err)
 			return 0, err
 		}
 	}
 	// Retrieve the capacity of all tables
-	rows, err = db.Query("SELECT SUM(available_seats) FROM tables")
+	rows, err = db.QueryContext(ctx, "SELECT COALESCE(SUM(available_seats), 0) FROM tables WHERE event_id=?", eventId)
 	if err != nil {
-		log.Println(err)
+		logQueryError(ctx, "EmptySeats", err)
 		return 0, err
 	}
 	defer rows.Close()
@@ -181,7 +252,7 @@ func EmptySeats(db *sql.DB) (int, error) {
 	for rows.Next() {
 		// Scan rows into variable
 		if err := rows.Scan(&totalSeats); err != nil {
-			log.Println(err)
+			logQueryError(ctx, "EmptySeats", err)
 			return 0, err
 		}
 	}
@@ -189,108 +260,458 @@ func EmptySeats(db *sql.DB) (int, error) {
 	return totalSeats - totalArrivedGuests, nil
 }
 
+/* This function gets the statistics of the party: invited guests, people at the party and the occupancy
+of every table.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+Return:
+	*model.PartyStats - statistics of the party
+	error - any error that occurred
+*/
+func GetPartyStats(ctx context.Context, db *sql.DB, eventId int64) (*model.PartyStats, error) {
+	stats := &model.PartyStats{}
+	// Count the guests on the guest list
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM guest_list WHERE event_id=?", eventId).
+		Scan(&stats.InvitedGuests); err != nil {
+		logQueryError(ctx, "GetPartyStats", err)
+		return nil, err
+	}
+
+	// Retrieve the people seated at every table
+	rows, err := db.QueryContext(ctx, "SELECT t.table_id, t.available_seats, "+
+		"COALESCE(SUM(CASE WHEN g.status='ARRIVED' THEN g.actual_accompanying_guests + 1 ELSE 0 END), 0) " +
+		"FROM tables t LEFT JOIN guest_list g ON g.event_id = t.event_id AND g.table_id = t.table_id " +
+		"WHERE t.event_id=? GROUP BY t.table_id, t.available_seats ORDER BY t.table_id", eventId)
+	if err != nil {
+		logQueryError(ctx, "GetPartyStats", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table model.TableOccupancy
+		// Scan rows into the table structure
+		if err := rows.Scan(&table.TableId, &table.Capacity, &table.Occupied); err != nil {
+			logQueryError(ctx, "GetPartyStats", err)
+			return nil, err
+		}
+		stats.Tables = append(stats.Tables, table)
+		stats.ArrivedPeople += table.Occupied
+		stats.EmptySeats += table.Capacity - table.Occupied
+	}
+	return stats, rows.Err()
+}
+
 /* This function gets information about invited guest.
 Arguments:
+	ctx context.Context - context of the request
 	db *sql.DB - MySQL database
+	eventId int64 - event ID
 	guestName string - guest name
 Return:
 	model.GuestsList - guest information
-	error - any error that occurred
+	error - ErrGuestNotFound if the guest is not on the guest list, or any other error that occurred
 */
-func GetGuestInvite(db *sql.DB, guestName string) (*model.GuestsList, error) {
+func GetGuestInvite(ctx context.Context, db *sql.DB, eventId int64, guestName string) (*model.GuestsList, error) {
 	// Retrieve guest info
-	rows, err := db.Query("SELECT guest_name, table_id FROM guest_list WHERE guest_name=?", guestName)
+	rows, err := db.QueryContext(ctx, "SELECT guest_name, table_id FROM guest_list WHERE event_id=? AND guest_name=?",
+		eventId, guestName)
 	if err != nil {
-		log.Println(err)
+		logQueryError(ctx, "GetGuestInvite", err)
 		return nil, err
 	}
 	defer rows.Close()
 
 	guest := &model.GuestsList{}
-	for rows.Next() {
-		// Scan rows into Guest structure
-		if err := rows.Scan(&guest.Name, &guest.TableId); err != nil {
-			log.Println(err)
-			return nil, err
-		}
+	if !rows.Next() {
+		return nil, ErrGuestNotFound
+	}
+	// Scan rows into Guest structure
+	if err := rows.Scan(&guest.Name, &guest.TableId); err != nil {
+		logQueryError(ctx, "GetGuestInvite", err)
+		return nil, err
 	}
 
 	return guest, nil
 }
 
+/* This function gets the full record of a guest from the guest list table.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+	guestName string - guest name
+Return:
+	*model.GuestDetails - guest information
+	error - ErrGuestNotFound if the guest is not on the guest list, or any other error that occurred
+*/
+func GetGuestDetails(ctx context.Context, db *sql.DB, eventId int64, guestName string) (*model.GuestDetails, error) {
+	var actualGuests int
+	guest := &model.GuestDetails{}
+	// Retrieve guest info
+	err := db.QueryRowContext(ctx, "SELECT guest_name, table_id, planned_accompanying_guests, "+
+		"actual_accompanying_guests, status, rsvp_status, arrived_time, departed_time FROM guest_list "+
+		"WHERE event_id=? AND guest_name=?", eventId, guestName).
+		Scan(&guest.Name, &guest.TableId, &guest.PlannedAccompanyingGuests, &actualGuests,
+			&guest.Status, &guest.RSVPStatus, &guest.ArrivedTime, &guest.DepartedTime)
+	if err == sql.ErrNoRows {
+		return nil, ErrGuestNotFound
+	}
+	if err != nil {
+		logQueryError(ctx, "GetGuestDetails", err)
+		return nil, err
+	}
+	// Actual accompanying guests are stored as -1 until the guest arrives
+	if actualGuests >= 0 {
+		guest.ActualAccompanyingGuests = &actualGuests
+	}
+	return guest, nil
+}
+
+// Columns of a guest as scanned by scanGuest
+const guestColumns = "guest_id, guest_name, table_id, planned_accompanying_guests, actual_accompanying_guests, " +
+	"status, rsvp_status, arrived_time, departed_time"
+
+// Scans a row with the guestColumns into the guest
+func scanGuest(row interface{ Scan(...interface{}) error }, guest *model.Guest) error {
+	var actualGuests int
+	err := row.Scan(&guest.Id, &guest.Name, &guest.TableId, &guest.PlannedAccompanyingGuests, &actualGuests,
+		&guest.Status, &guest.RSVPStatus, &guest.ArrivedTime, &guest.DepartedTime)
+	// Actual accompanying guests are stored as -1 until the guest arrives
+	if err == nil && actualGuests >= 0 {
+		guest.ActualAccompanyingGuests = &actualGuests
+	}
+	return err
+}
+
+/* This function gets the full record of a guest by its ID.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+	guestId int64 - guest ID
+Return:
+	*model.Guest - guest information
+	error - ErrGuestNotFound if no guest of the event has the ID, or any other error that occurred
+*/
+func GetGuest(ctx context.Context, db *sql.DB, eventId int64, guestId int64) (*model.Guest, error) {
+	guest := &model.Guest{}
+	err := scanGuest(db.QueryRowContext(ctx, "SELECT "+guestColumns+" FROM guest_list WHERE event_id=? AND guest_id=?",
+		eventId, guestId), guest)
+	if err == sql.ErrNoRows {
+		return nil, ErrGuestNotFound
+	}
+	if err != nil {
+		logQueryError(ctx, "GetGuest", err)
+		return nil, err
+	}
+	return guest, nil
+}
+
+/* This function gets a page of the full records of the guests in the order they were added.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+	status string - status of the listed guests, or empty to list all guests
+	limit int - limit for pagination
+	offset int - offset
+Return:
+	[]model.Guest - guests of the page
+	int - number of guests with the status
+	error - any error that occurred
+*/
+func ListGuests(ctx context.Context, db *sql.DB, eventId int64, status string, limit int, offset int) ([]model.Guest,
+	int, error) {
+	where, args := " WHERE event_id=?", []interface{}{eventId}
+	if status != "" {
+		where, args = where+" AND status=?", append(args, status)
+	}
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM guest_list"+where, args...).Scan(&total); err != nil {
+		logQueryError(ctx, "ListGuests", err)
+		return nil, 0, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT "+guestColumns+" FROM guest_list"+where+
+		" ORDER BY guest_id LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		logQueryError(ctx, "ListGuests", err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	guests := []model.Guest{}
+	for rows.Next() {
+		var guest model.Guest
+		if err := scanGuest(rows, &guest); err != nil {
+			logQueryError(ctx, "ListGuests", err)
+			return nil, 0, err
+		}
+		guests = append(guests, guest)
+	}
+	return guests, total, rows.Err()
+}
+
 /*------------------------------ Once the Party Starts ------------------------------ */
 
-/* This function updates status of the guest to arrive.
+/* This function updates status of the guest to arrive. Only a guest who has not arrived yet or was marked as
+no-show is let in, so that the seats released by a departed guest are not handed out twice.
 Arguments:
+	ctx context.Context - context of the request
 	db *sql.DB - MySQL database
+	eventId int64 - event ID
 	guest *model.GuestsList - guest information
 Return:
-	error - any error that occurred
+	error - ErrGuestArrived if the guest is not expected anymore, or any other error that occurred
 */
-func UpdateGuestStatusToArrive(db *sql.DB, guest *model.GuestsList, arrGuests int) error {
+func UpdateGuestStatusToArrive(ctx context.Context, db *sql.DB, eventId int64, guest *model.GuestsList,
+	arrGuests int) error {
 	// Let the guest in and update the status and actual arrived guests. Arrival time will get updated automatically.
-	query, err := db.Prepare("UPDATE guest_list set status=?, actual_accompanying_guests=? WHERE guest_name=?")
+	query, err := db.PrepareContext(ctx, "UPDATE guest_list set status=?, actual_accompanying_guests=? "+
+		"WHERE event_id=? AND guest_name=? AND status IN (?, ?)")
 	if err != nil {
-		log.Println(err)
+		logQueryError(ctx, "UpdateGuestStatusToArrive", err)
 		return err
 	}
 	defer query.Close()
 
 	// Execute query
-	_, err = query.Exec("ARRIVED", arrGuests, guest.Name)
+	result, err := query.ExecContext(ctx, "ARRIVED", arrGuests, eventId, guest.Name, "NOT_ARRIVED", "NO_SHOW")
 	if err != nil {
-		log.Println(err)
+		logQueryError(ctx, "UpdateGuestStatusToArrive", err)
 		return err
 	}
-	log.Printf("Guest %s: successfully updated from the guest list", guest.Name)
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return ErrGuestArrived
+	}
+	logging.FromContext(ctx).Info("guest arrived at the party", logging.Int("accompanying_guests", arrGuests))
 	return nil
 }
 
-/* This function gets information about the arrived guest.
+/* This function updates status of the guest to departed. The arrival time is assigned explicitly so that
+it is not overwritten by the ON UPDATE clause of the column.
 Arguments:
+	ctx context.Context - context of the request
 	db *sql.DB - MySQL database
+	eventId int64 - event ID
 	guestName string - guest name
 Return:
-	*model.GuestsList - guest information
+	error - ErrGuestNotFound if the guest is not at the party, or any other error that occurred
+*/
+func UpdateGuestStatusToDepart(ctx context.Context, db *sql.DB, eventId int64, guestName string) error {
+	query, err := db.PrepareContext(ctx, "UPDATE guest_list set status=?, departed_time=NOW(), arrived_time=arrived_time "+
+		"WHERE event_id=? AND guest_name=? AND status=?")
+	if err != nil {
+		logQueryError(ctx, "UpdateGuestStatusToDepart", err)
+		return err
+	}
+	defer query.Close()
+
+	// Execute query
+	result, err := query.ExecContext(ctx, "DEPARTED", eventId, guestName, "ARRIVED")
+	if err != nil {
+		logQueryError(ctx, "UpdateGuestStatusToDepart", err)
+		return err
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return ErrGuestNotFound
+	}
+	logging.FromContext(ctx).Info("guest departed from the party")
+	return nil
+}
+
+/* This function records the answer of the guest to the invitation. The arrival time is assigned explicitly so that
+it is not set by the ON UPDATE clause of the column.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+	guestName string - guest name
+	rsvpStatus string - PENDING, ACCEPTED or DECLINED
+Return:
+	error - ErrGuestNotFound if the guest is not on the guest list, or any other error that occurred
+*/
+func UpdateGuestRSVP(ctx context.Context, db *sql.DB, eventId int64, guestName string, rsvpStatus string) error {
+	query, err := db.PrepareContext(ctx, "UPDATE guest_list set rsvp_status=?, arrived_time=arrived_time "+
+		"WHERE event_id=? AND guest_name=?")
+	if err != nil {
+		logQueryError(ctx, "UpdateGuestRSVP", err)
+		return err
+	}
+	defer query.Close()
+
+	// Execute query
+	result, err := query.ExecContext(ctx, rsvpStatus, eventId, guestName)
+	if err != nil {
+		logQueryError(ctx, "UpdateGuestRSVP", err)
+		return err
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return ErrGuestNotFound
+	}
+	logging.FromContext(ctx).Info("guest answered the invitation", logging.String("rsvp_status", rsvpStatus))
+	return nil
+}
+
+/* This function marks the guests of the open events who have not arrived by the cutoff as no-shows, which releases
+their tables. The guests who declined the invitation are not expected and are kept. The events are locked until all
+of them are marked, so that none is closed meanwhile. The arrival time is assigned explicitly so that it is not set by
+the ON UPDATE clause of the column.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	startedBefore time.Time - the guests of the events which started before are marked
+Return:
+	map[int64]int - number of guests marked as no-show by event ID, only the events with marked guests
 	error - any error that occurred
 */
-func GetEntryFromGuestList(db *sql.DB, guestName string) (*model.GuestsList, error) {
-	// Select all guests
-	rows, err := db.Query("SELECT guest_name, planned_accompanying_guests, "+
-		"table_id, status from guest_list WHERE guest_name=?", guestName)
+func MarkNoShows(ctx context.Context, db *sql.DB, startedBefore time.Time) (marked map[int64]int, err error) {
+	defer func() {
+		if err != nil {
+			logQueryError(ctx, "MarkNoShows", err)
+		}
+	}()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.QueryContext(ctx, "SELECT event_id FROM events WHERE phase=? AND event_date<=? FOR UPDATE",
+		"OPEN", startedBefore.UTC())
 	if err != nil {
-		log.Println(err)
+		return nil, err
+	}
+	var eventIds []int64
+	for rows.Next() {
+		var eventId int64
+		if err = rows.Scan(&eventId); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		eventIds = append(eventIds, eventId)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	marked = make(map[int64]int)
+	total := 0
+	for _, eventId := range eventIds {
+		var result sql.Result
+		if result, err = tx.ExecContext(ctx, "UPDATE guest_list SET status=?, arrived_time=arrived_time "+
+			"WHERE event_id=? AND status=? AND rsvp_status<>?", "NO_SHOW", eventId, "NOT_ARRIVED",
+			"DECLINED"); err != nil {
+			return nil, err
+		}
+		var updated int64
+		if updated, err = result.RowsAffected(); err != nil {
+			return nil, err
+		}
+		if updated > 0 {
+			marked[eventId] = int(updated)
+			total += int(updated)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	if total > 0 {
+		logging.FromContext(ctx).Info("guests marked as no-show", logging.Int("guests", total))
+	}
+	return marked, nil
+}
+
+/* This function gets the full records of the guests of an event who were marked as no-show.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+Return:
+	[]model.Guest - no-shows in the order they were added
+	error - any error that occurred
+*/
+func ListNoShows(ctx context.Context, db *sql.DB, eventId int64) ([]model.Guest, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+guestColumns+" FROM guest_list WHERE event_id=? AND status=? "+
+		"ORDER BY guest_id", eventId, "NO_SHOW")
+	if err != nil {
+		logQueryError(ctx, "ListNoShows", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	guest := &model.GuestsList{}
+	guests := []model.Guest{}
 	for rows.Next() {
-		// Scan rows into Guest structure
-		if err := rows.Scan(&guest.Name, &guest.AccompanyingGuests, &guest.TableId, &guest.Status); err != nil {
-			log.Println(err)
+		var guest model.Guest
+		if err := scanGuest(rows, &guest); err != nil {
+			logQueryError(ctx, "ListNoShows", err)
 			return nil, err
 		}
+		guests = append(guests, guest)
+	}
+	return guests, rows.Err()
+}
+
+/* This function gets information about the arrived guest.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+	guestName string - guest name
+Return:
+	*model.GuestsList - guest information
+	error - ErrGuestNotFound if the guest is not on the guest list, or any other error that occurred
+*/
+func GetEntryFromGuestList(ctx context.Context, db *sql.DB, eventId int64, guestName string) (*model.GuestsList,
+	error) {
+	// Select all guests
+	rows, err := db.QueryContext(ctx, "SELECT guest_name, planned_accompanying_guests, "+
+		"table_id, status from guest_list WHERE event_id=? AND guest_name=?", eventId, guestName)
+	if err != nil {
+		logQueryError(ctx, "GetEntryFromGuestList", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	guest := &model.GuestsList{}
+	if !rows.Next() {
+		return nil, ErrGuestNotFound
+	}
+	// Scan rows into Guest structure
+	if err := rows.Scan(&guest.Name, &guest.AccompanyingGuests, &guest.TableId, &guest.Status); err != nil {
+		logQueryError(ctx, "GetEntryFromGuestList", err)
+		return nil, err
 	}
 	return guest, nil
 }
 
 /* This function gets information about all the arrived guests.
 Arguments:
+	ctx context.Context - context of the request
 	db *sql.DB - MySQL database
+	eventId int64 - event ID
 	limit int - limit for pagination
 	offset int- offset
 Return:
 	[]*model.GuestsList - slice of guests information
 	error - any error that occurred
 */
-func GetArrivedGuests(db *sql.DB, limit int, offset int) ([]model.GuestsList, error) {
+func GetArrivedGuests(ctx context.Context, db *sql.DB, eventId int64, limit int, offset int) ([]model.GuestsList,
+	error) {
 	var guestList []model.GuestsList
 	// Select all guests
-	rows, err := db.Query("SELECT guest_name, actual_accompanying_guests, arrived_time "+
-		"FROM guest_list WHERE status=? LIMIT ? OFFSET ?", "ARRIVED", limit, offset)
+	rows, err := db.QueryContext(ctx, "SELECT guest_name, actual_accompanying_guests, arrived_time "+
+		"FROM guest_list WHERE event_id=? AND status=? LIMIT ? OFFSET ?", eventId, "ARRIVED", limit, offset)
 	if err != nil {
-		log.Println(err)
+		logQueryError(ctx, "GetArrivedGuests", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -299,7 +720,7 @@ func GetArrivedGuests(db *sql.DB, limit int, offset int) ([]model.GuestsList, er
 	for rows.Next() {
 		// Scan rows into Guest structure
 		if err := rows.Scan(&guest.Name, &guest.AccompanyingGuests, &guest.ArrivedTime); err != nil {
-			log.Println(err)
+			logQueryError(ctx, "GetArrivedGuests", err)
 			return nil, err
 		}
 		// Add guest to the slice
@@ -309,3 +730,8 @@ func GetArrivedGuests(db *sql.DB, limit int, offset int) ([]model.GuestsList, er
 	return guestList, nil
 }
 
+
+// Logs a failed query with the logger of the request, which carries the request id and the guest
+func logQueryError(ctx context.Context, function string, err error) {
+	logging.FromContext(ctx).Error("query failed", logging.String("function", function), logging.SensitiveErr(err))
+}
@@ -1,10 +1,18 @@
 package databse
 
 import (
+	"GuestList/internal/logging"
 	"GuestList/internal/model"
+	"GuestList/internal/tracing"
+	"bytes"
+	"context"
+	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Test adding a guest to the guest list
@@ -22,13 +30,24 @@ func TestAddGuestToList(t *testing.T) {
 	}
 	prep := mock.ExpectPrepare("^INSERT INTO guest_list*")
 	prep.ExpectExec().
-		WithArgs("John Smith", 2, &tableID, "NOT_ARRIVED", -1).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+		WithArgs(2, "John Smith", 2, &tableID, "NOT_ARRIVED", -1).
+		WillReturnResult(sqlmock.NewResult(5, 1))
 	defer db.Close()
 
-	err = AddGuestToList(db, guest)
+	err = AddGuestToList(context.Background(), db, 2, guest)
 
 	assert.Equal(t, nil, err, "Expected no error")
+	assert.Equal(t, int64(5), guest.Id, "Expected the ID assigned by the database")
+
+	// The name is unique within the event
+	prep = mock.ExpectPrepare("^INSERT INTO guest_list*")
+	prep.ExpectExec().
+		WithArgs(2, "John Smith", 2, &tableID, "NOT_ARRIVED", -1).
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '2-John Smith' for key 'guest_list_event_name'"})
+
+	err = AddGuestToList(context.Background(), db, 2, guest)
+
+	assert.Equal(t, ErrGuestExists, err, "Expected the guest to be on the guest list")
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expections: %s", err)
@@ -48,9 +67,9 @@ func TestGetTableCapacity(t *testing.T) {
 
 	//mock.ExpectQuery("^SELECT (.+) FROM menu_link_content_data*")
 	mock.ExpectQuery(
-		`^SELECT available_seats from tables*`).
-		WithArgs(tableID).WillReturnRows(rows)
-	availableSeats, _ := GetTableCapacity(db, 1)
+		`^SELECT available_seats from tables WHERE event_id=\? AND table_id=\?`).
+		WithArgs(2, tableID).WillReturnRows(rows)
+	availableSeats, _ := GetTableCapacity(context.Background(), db, 2, 1)
 	assert.Equal(t, 9, availableSeats,"Expected different number of table capacity")
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expections: %s", err)
@@ -72,9 +91,9 @@ func TestGetAllGuests(t *testing.T) {
 		AddRow("Brad Pitt", 2, 4)
 
 	mock.ExpectQuery(
-		`^SELECT guest_name, table_id, planned_accompanying_guests from guest_list*`).
-		WithArgs(10, 0).WillReturnRows(rows)
-	guestList, _ := GetAllGuests(db, 10, 0)
+		`^SELECT guest_name, table_id, planned_accompanying_guests from guest_list WHERE event_id=\?`).
+		WithArgs(2, 10, 0).WillReturnRows(rows)
+	guestList, _ := GetAllGuests(context.Background(), db, 2, 10, 0)
 
 	assert.Equal(t, 2, len(guestList),"Expected different number of guests")
 
@@ -92,12 +111,12 @@ func TestDeleteGuestFromList(t *testing.T) {
 	}
 	defer db.Close()
 
-	prep := mock.ExpectPrepare("^DELETE FROM guest_list WHERE guest_name*")
+	prep := mock.ExpectPrepare("^DELETE FROM guest_list WHERE event_id=\\? AND guest_name*")
 	prep.ExpectExec().
-		WithArgs("John Smith").
+		WithArgs(2, "John Smith").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err = DeleteGuestFromList(db, "John Smith")
+	err = DeleteGuestFromList(context.Background(), db, 2, "John Smith")
 
 	assert.Equal(t, nil, err, "Expected no error")
 
@@ -123,15 +142,423 @@ func TestUpdateGuestStatusToArrive(t *testing.T) {
 	arrivingAccompanyingGuests := 5
 	prep := mock.ExpectPrepare("^UPDATE guest_list*")
 	prep.ExpectExec().
-		WithArgs("ARRIVED", arrivingAccompanyingGuests, guest.Name).
+		WithArgs("ARRIVED", arrivingAccompanyingGuests, 2, guest.Name, "NOT_ARRIVED", "NO_SHOW").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err = UpdateGuestStatusToArrive(db, guest, arrivingAccompanyingGuests)
+	err = UpdateGuestStatusToArrive(context.Background(), db, 2, guest, arrivingAccompanyingGuests)
 
 	assert.Equal(t, nil, err, "Expected no error")
 
+	// A guest who has already arrived or departed is not let in again
+	prep = mock.ExpectPrepare("^UPDATE guest_list*")
+	prep.ExpectExec().
+		WithArgs("ARRIVED", arrivingAccompanyingGuests, 2, guest.Name, "NOT_ARRIVED", "NO_SHOW").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = UpdateGuestStatusToArrive(context.Background(), db, 2, guest, arrivingAccompanyingGuests)
+
+	assert.Equal(t, ErrGuestArrived, err, "Expected the guest to have arrived")
+
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expections: %s", err)
 	}
 
 }
+
+// Test getting the full record of a guest
+func TestGetGuestDetails(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"guest_name", "table_id", "planned_accompanying_guests",
+		"actual_accompanying_guests", "status", "rsvp_status", "arrived_time", "departed_time"}).
+		AddRow("John Smith", 1, 2, -1, "NOT_ARRIVED", "PENDING", nil, nil)
+
+	mock.ExpectQuery(`^SELECT guest_name, table_id, planned_accompanying_guests, actual_accompanying_guests*`).
+		WithArgs(2, "John Smith").WillReturnRows(rows)
+	guest, err := GetGuestDetails(context.Background(), db, 2, "John Smith")
+
+	assert.Equal(t, nil, err, "Expected no error")
+	assert.Equal(t, 2, guest.PlannedAccompanyingGuests, "Expected different number of planned guests")
+	assert.Nil(t, guest.ActualAccompanyingGuests, "Expected no actual guests before arrival")
+	assert.Equal(t, "PENDING", guest.RSVPStatus, "Expected different RSVP status")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Columns of a guest as selected by guestColumns
+var guestColumnNames = []string{"guest_id", "guest_name", "table_id", "planned_accompanying_guests",
+	"actual_accompanying_guests", "status", "rsvp_status", "arrived_time", "departed_time"}
+
+// Test getting a guest by its ID
+func TestGetGuest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	arrived := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`^SELECT guest_id, guest_name, (.+) FROM guest_list WHERE event_id=\? AND guest_id=\?`).
+		WithArgs(2, 3).WillReturnRows(sqlmock.NewRows(guestColumnNames).
+		AddRow(3, "John Smith", 1, 2, 1, "ARRIVED", "ACCEPTED", arrived, nil))
+	mock.ExpectQuery(`^SELECT guest_id, guest_name, (.+) FROM guest_list WHERE event_id=\? AND guest_id=\?`).
+		WithArgs(2, 4).WillReturnRows(sqlmock.NewRows(guestColumnNames))
+
+	guest, err := GetGuest(context.Background(), db, 2, 3)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, int64(3), guest.Id, "Expected different ID")
+	assert.Equal(t, "John Smith", guest.Name, "Expected different name")
+	assert.Equal(t, 1, *guest.ActualAccompanyingGuests, "Expected actual guests after arrival")
+	assert.Equal(t, arrived, *guest.ArrivedTime, "Expected different arrival time")
+
+	_, err = GetGuest(context.Background(), db, 2, 4)
+	assert.Equal(t, ErrGuestNotFound, err, "Expected guest not found")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test listing a page of the guests with a status
+func TestListGuests(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM guest_list WHERE event_id=\? AND status=\?`).WithArgs(2, "NOT_ARRIVED").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`^SELECT guest_id, (.+) WHERE event_id=\? AND status=\? ORDER BY guest_id LIMIT \? OFFSET \?`).
+		WithArgs(2, "NOT_ARRIVED", 2, 1).WillReturnRows(sqlmock.NewRows(guestColumnNames).
+		AddRow(2, "Mary Queen", 2, 1, -1, "NOT_ARRIVED", "PENDING", nil, nil).
+		AddRow(5, "John Smith", 1, 2, -1, "NOT_ARRIVED", "PENDING", nil, nil))
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM guest_list WHERE event_id=\?$`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`^SELECT guest_id, (.+) FROM guest_list WHERE event_id=\? ORDER BY guest_id LIMIT \? OFFSET \?`).
+		WithArgs(2, 100, 0).WillReturnRows(sqlmock.NewRows(guestColumnNames))
+
+	guests, total, err := ListGuests(context.Background(), db, 2, "NOT_ARRIVED", 2, 1)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, 3, total, "Expected the number of guests with the status")
+	assert.Equal(t, 2, len(guests), "Expected a page of two guests")
+	assert.Equal(t, int64(5), guests[1].Id, "Expected different ID")
+	assert.Nil(t, guests[1].ActualAccompanyingGuests, "Expected no actual guests before arrival")
+
+	guests, total, err = ListGuests(context.Background(), db, 2, "", 100, 0)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, 0, total, "Expected no guests")
+	assert.NotNil(t, guests, "Expected an empty page and not nil")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test marking the guests who have not arrived at the open events as no-shows, keeping their arrival time and
+// leaving out the guests who declined
+func TestMarkNoShows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	startedBefore := time.Date(2020, 12, 31, 19, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT event_id FROM events WHERE phase=\? AND event_date<=\? FOR UPDATE$`).
+		WithArgs("OPEN", startedBefore).WillReturnRows(sqlmock.NewRows([]string{"event_id"}).AddRow(1).AddRow(2))
+	markGuests := `^UPDATE guest_list SET status=\?, arrived_time=arrived_time ` +
+		`WHERE event_id=\? AND status=\? AND rsvp_status<>\?$`
+	mock.ExpectExec(markGuests).WithArgs("NO_SHOW", 1, "NOT_ARRIVED", "DECLINED").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(markGuests).WithArgs("NO_SHOW", 2, "NOT_ARRIVED", "DECLINED").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	marked, err := MarkNoShows(context.Background(), db, startedBefore)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, map[int64]int{1: 3}, marked, "Expected the number of marked guests of the events")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test listing the no-shows of an event
+func TestListNoShows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`^SELECT guest_id, (.+) FROM guest_list WHERE event_id=\? AND status=\? ORDER BY guest_id$`).
+		WithArgs(2, "NO_SHOW").WillReturnRows(sqlmock.NewRows(guestColumnNames).
+		AddRow(2, "Mary Queen", 2, 1, -1, "NO_SHOW", "ACCEPTED", nil, nil))
+	mock.ExpectQuery(`^SELECT guest_id, (.+) FROM guest_list WHERE event_id=\? AND status=\?`).
+		WithArgs(3, "NO_SHOW").WillReturnRows(sqlmock.NewRows(guestColumnNames))
+
+	guests, err := ListNoShows(context.Background(), db, 2)
+	assert.Nil(t, err, "Expected no error")
+	tableId := 2
+	assert.Equal(t, []model.Guest{{Id: 2, GuestDetails: model.GuestDetails{Name: "Mary Queen", TableId: &tableId,
+		PlannedAccompanyingGuests: 1, Status: "NO_SHOW", RSVPStatus: "ACCEPTED"}}}, guests, "Expected the no-show")
+	guests, err = ListNoShows(context.Background(), db, 3)
+	assert.Nil(t, err, "Expected no error")
+	assert.NotNil(t, guests, "Expected an empty list and not nil")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test recording the departure of a guest
+func TestUpdateGuestStatusToDepart(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	prep := mock.ExpectPrepare("^UPDATE guest_list set status=\\?, departed_time=NOW\\(\\)*")
+	prep.ExpectExec().
+		WithArgs("DEPARTED", 2, "John Smith", "ARRIVED").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = UpdateGuestStatusToDepart(context.Background(), db, 2, "John Smith")
+
+	assert.Equal(t, nil, err, "Expected no error")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test recording the answer of a guest to the invitation
+func TestUpdateGuestRSVP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	prep := mock.ExpectPrepare("^UPDATE guest_list set rsvp_status=\\?, arrived_time=arrived_time*")
+	prep.ExpectExec().
+		WithArgs("DECLINED", 2, "John Smith").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	prep = mock.ExpectPrepare("^UPDATE guest_list set rsvp_status=*")
+	prep.ExpectExec().
+		WithArgs("ACCEPTED", 2, "Jane Doe").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = UpdateGuestRSVP(context.Background(), db, 2, "John Smith", "DECLINED")
+	assert.Equal(t, nil, err, "Expected no error")
+	err = UpdateGuestRSVP(context.Background(), db, 2, "Jane Doe", "ACCEPTED")
+	assert.Equal(t, ErrGuestNotFound, err, "Expected the guest not to be found")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test getting the seating capacity of a table which does not exist
+func TestGetTableCapacityNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`^SELECT available_seats from tables*`).
+		WithArgs(2, 7).WillReturnRows(sqlmock.NewRows([]string{"available_seats"}))
+	_, err = GetTableCapacity(context.Background(), db, 2, 7)
+
+	assert.Equal(t, ErrTableNotFound, err, "Expected table not found")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test checking the table for a guest
+func TestCheckTableForGuest(t *testing.T) {
+	tests := []struct {
+		name      string
+		reserved  bool
+		partySize int
+		expected  error
+	}{
+		{"free table", false, 3, nil},
+		{"reserved table", true, 3, ErrTableReserved},
+		{"too many guests", false, 10, ErrInsufficientSeats},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`^SELECT available_seats from tables*`).
+				WithArgs(2, 1).WillReturnRows(sqlmock.NewRows([]string{"available_seats"}).AddRow(9))
+			guests := sqlmock.NewRows([]string{"guest_name"})
+			if test.reserved {
+				guests.AddRow("John Smith")
+			}
+			mock.ExpectQuery(`^SELECT \* from guest_list WHERE event_id=\? AND table_id=\? AND status NOT IN \(\?, \?\)`).
+				WithArgs(2, 1, "DEPARTED", "NO_SHOW").WillReturnRows(guests)
+
+			err = CheckTableForGuest(context.Background(), db, 2, 1, test.partySize)
+
+			assert.Equal(t, test.expected, err, "Expected different result of the table check")
+		})
+	}
+}
+
+// Test deleting a guest who is not on the guest list
+func TestDeleteGuestFromListNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	prep := mock.ExpectPrepare("^DELETE FROM guest_list WHERE event_id=\\? AND guest_name*")
+	prep.ExpectExec().
+		WithArgs(2, "Nobody").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = DeleteGuestFromList(context.Background(), db, 2, "Nobody")
+
+	assert.Equal(t, ErrGuestNotFound, err, "Expected guest not found")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test getting the invitation of a guest who is not on the guest list
+func TestGetGuestInviteNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`^SELECT guest_name, table_id FROM guest_list*`).
+		WithArgs(2, "Nobody").WillReturnRows(sqlmock.NewRows([]string{"guest_name", "table_id"}))
+	guest, err := GetGuestInvite(context.Background(), db, 2, "Nobody")
+
+	assert.Nil(t, guest, "Expected no guest")
+	assert.Equal(t, ErrGuestNotFound, err, "Expected guest not found")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test getting the version of the applied migrations
+func TestGetSchemaVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`^SELECT version, dirty FROM schema_migrations*`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(SchemaVersion, false))
+	version, dirty, err := GetSchemaVersion(context.Background(), db)
+
+	assert.Equal(t, nil, err, "Expected no error")
+	assert.Equal(t, uint(SchemaVersion), version, "Expected different schema version")
+	assert.False(t, dirty, "Expected clean schema")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test getting the statistics of the party
+func TestGetPartyStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM guest_list WHERE event_id=\?`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`^SELECT t.table_id, t.available_seats*`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"table_id", "available_seats", "occupied"}).
+			AddRow(1, 10, 3).
+			AddRow(2, 4, 0))
+	stats, err := GetPartyStats(context.Background(), db, 2)
+
+	assert.Equal(t, nil, err, "Expected no error")
+	assert.Equal(t, 3, stats.InvitedGuests, "Expected different number of invited guests")
+	assert.Equal(t, 3, stats.ArrivedPeople, "Expected different number of arrived people")
+	assert.Equal(t, 11, stats.EmptySeats, "Expected different number of empty seats")
+	assert.Equal(t, 2, len(stats.Tables), "Expected occupancy of every table")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test logging a failed query with the logger of the request
+func TestQueryErrorLogging(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	out := &bytes.Buffer{}
+	logger := logging.New(out, logging.LevelInfo, false, "").With(logging.RequestId("door-1"))
+	mock.ExpectPrepare(`^UPDATE guest_list set status=\?, departed_time*`).
+		ExpectExec().WithArgs("DEPARTED", 1, "Mary Queen", "ARRIVED").WillReturnError(errors.New("connection reset"))
+	err = UpdateGuestStatusToDepart(logging.NewContext(context.Background(), logger), db, 1, "Mary Queen")
+
+	assert.NotNil(t, err, "Expected error")
+	assert.Contains(t, out.String(), `"msg":"query failed","request_id":"door-1",`+
+		`"function":"UpdateGuestStatusToDepart","error":"connection reset"`, "Expected the request id in the log")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test tracing the queries of the table check separately
+func TestCheckTableForGuestSpans(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	out := &bytes.Buffer{}
+	ctx, span := tracing.NewTracer(tracing.NewWriterExporter(out), time.Now).
+		Start(context.Background(), "store.CheckTableForGuest", tracing.KindClient)
+	mock.ExpectQuery(`^SELECT available_seats from tables*`).
+		WithArgs(1, 1).WillReturnRows(sqlmock.NewRows([]string{"available_seats"}).AddRow(9))
+	mock.ExpectQuery(`^SELECT \* from guest_list WHERE event_id=\? AND table_id*`).WithArgs(1, 1, "DEPARTED",
+		"NO_SHOW").WillReturnError(errors.New("connection reset"))
+	err = CheckTableForGuest(ctx, db, 1, 1, 3)
+	span.End()
+
+	assert.NotNil(t, err, "Expected error")
+	spans := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, spans, 3, "Expected a span per query and the parent")
+	assert.Contains(t, spans[0], `"name":"GetTableCapacity","kind":"client"`, "Expected the capacity query")
+	assert.Contains(t, spans[0], `"parent_span_id":"`+span.Context().SpanId.String()+`"`, "Expected the parent")
+	assert.Contains(t, spans[1], `"name":"IsTableFree"`, "Expected the reservation query")
+	assert.Contains(t, spans[1], `"status":"error","status_message":"connection reset"`, "Expected the failure")
+}
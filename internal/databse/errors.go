@@ -0,0 +1,25 @@
+package databse
+
+import "errors"
+
+// Errors returned by the queries so that the callers can tell apart the expected failures from database errors
+var (
+	ErrEventNotFound     = errors.New("event not found")
+	ErrPhaseChanged      = errors.New("event phase has changed")
+	ErrSummaryNotFound   = errors.New("event summary not found")
+	ErrGuestNotFound     = errors.New("guest not found")
+	ErrGuestExists       = errors.New("guest is already on the guest list")
+	ErrGuestArrived      = errors.New("guest has already arrived")
+	ErrTableNotFound     = errors.New("table not found")
+	ErrTableReserved     = errors.New("table is already reserved")
+	ErrInsufficientSeats = errors.New("insufficient space at the specified table")
+
+	ErrIdempotencyKeyExists   = errors.New("idempotency key is already used")
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+
+	ErrAPIKeyNotFound = errors.New("API key not found")
+
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobNotDue   = errors.New("job is not due")
+	ErrJobRunning  = errors.New("job is already running")
+)
@@ -0,0 +1,407 @@
+package databse
+
+import (
+	"GuestList/internal/logging"
+	"GuestList/internal/model"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Columns of an event as scanned by scanEvent
+const eventColumns = "event_id, name, event_date, venue, status, phase"
+
+// Scans a row with the eventColumns into the event
+func scanEvent(row interface{ Scan(...interface{}) error }, event *model.Event) error {
+	return row.Scan(&event.Id, &event.Name, &event.Date, &event.Venue, &event.Status, &event.Phase)
+}
+
+/* This function stores a new event without any guest or table.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	event *model.Event - name, date, venue, status and phase of the event, the ID of the stored event is set
+Return:
+	error - any error that occurred
+*/
+func CreateEvent(ctx context.Context, db *sql.DB, event *model.Event) error {
+	result, err := db.ExecContext(ctx, "INSERT INTO events(name, event_date, venue, status, phase) "+
+		"VALUES ( ?, ?, ?, ?, ? )", event.Name, event.Date, event.Venue, event.Status, event.Phase)
+	if err == nil {
+		event.Id, err = result.LastInsertId()
+	}
+	if err != nil {
+		logQueryError(ctx, "CreateEvent", err)
+		return err
+	}
+	return nil
+}
+
+/* This function gets an event by its ID.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+Return:
+	*model.Event - event
+	error - ErrEventNotFound if no event has the ID, or any other error that occurred
+*/
+func GetEvent(ctx context.Context, db *sql.DB, eventId int64) (*model.Event, error) {
+	event := &model.Event{}
+	err := scanEvent(db.QueryRowContext(ctx, "SELECT "+eventColumns+" FROM events WHERE event_id=?", eventId), event)
+	if err == sql.ErrNoRows {
+		return nil, ErrEventNotFound
+	}
+	if err != nil {
+		logQueryError(ctx, "GetEvent", err)
+		return nil, err
+	}
+	return event, nil
+}
+
+/* This function gets a page of the events by date.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	status string - status of the listed events, or empty to list all events
+	limit int - limit for pagination
+	offset int - offset
+Return:
+	[]model.Event - events of the page
+	int - number of events with the status
+	error - any error that occurred
+*/
+func ListEvents(ctx context.Context, db *sql.DB, status string, limit int, offset int) ([]model.Event, int, error) {
+	where, args := "", []interface{}{}
+	if status != "" {
+		where, args = " WHERE status=?", append(args, status)
+	}
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM events"+where, args...).Scan(&total); err != nil {
+		logQueryError(ctx, "ListEvents", err)
+		return nil, 0, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT "+eventColumns+" FROM events"+where+
+		" ORDER BY event_date, event_id LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		logQueryError(ctx, "ListEvents", err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []model.Event{}
+	for rows.Next() {
+		var event model.Event
+		if err := scanEvent(rows, &event); err != nil {
+			logQueryError(ctx, "ListEvents", err)
+			return nil, 0, err
+		}
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
+
+/* This function updates the name, date, venue and status of an event, the phase is only changed by a transition.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	event *model.Event - event with the new values
+Return:
+	error - ErrEventNotFound if no event has the ID, or any other error that occurred
+*/
+func UpdateEvent(ctx context.Context, db *sql.DB, event *model.Event) error {
+	// The connection reports the matched rows, so an update without any change is not taken for a missing event
+	result, err := db.ExecContext(ctx, "UPDATE events SET name=?, event_date=?, venue=?, status=? WHERE event_id=?",
+		event.Name, event.Date, event.Venue, event.Status, event.Id)
+	if err != nil {
+		logQueryError(ctx, "UpdateEvent", err)
+		return err
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return ErrEventNotFound
+	}
+	return nil
+}
+
+/* This function gets a page of the tables of an event with the people seated at them.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+	limit int - limit for pagination
+	offset int - offset
+Return:
+	[]model.TableOccupancy - tables of the page
+	int - number of tables of the event
+	error - any error that occurred
+*/
+func ListTables(ctx context.Context, db *sql.DB, eventId int64, limit int, offset int) ([]model.TableOccupancy, int,
+	error) {
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM tables WHERE event_id=?", eventId).
+		Scan(&total); err != nil {
+		logQueryError(ctx, "ListTables", err)
+		return nil, 0, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT t.table_id, t.available_seats, "+
+		"COALESCE(SUM(CASE WHEN g.status='ARRIVED' THEN g.actual_accompanying_guests + 1 ELSE 0 END), 0) "+
+		"FROM tables t LEFT JOIN guest_list g ON g.event_id = t.event_id AND g.table_id = t.table_id "+
+		"WHERE t.event_id=? GROUP BY t.table_id, t.available_seats ORDER BY t.table_id LIMIT ? OFFSET ?",
+		eventId, limit, offset)
+	if err != nil {
+		logQueryError(ctx, "ListTables", err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	tables := []model.TableOccupancy{}
+	for rows.Next() {
+		var table model.TableOccupancy
+		if err := rows.Scan(&table.TableId, &table.Capacity, &table.Occupied); err != nil {
+			logQueryError(ctx, "ListTables", err)
+			return nil, 0, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, total, rows.Err()
+}
+
+/* This function adds a table to an event, or changes the number of seats of the table if the event has it.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+	tableId int - table number, unique within the event
+	capacity int - number of seats at the table
+Return:
+	bool - true if the table was added
+	error - any error that occurred
+*/
+func SaveTable(ctx context.Context, db *sql.DB, eventId int64, tableId int, capacity int) (bool, error) {
+	// The affected rows do not tell an insert from an update which keeps the seats, so the table is looked up first
+	_, err := GetTableCapacity(ctx, db, eventId, tableId)
+	created := err == ErrTableNotFound
+	if err != nil && !created {
+		return false, err
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO tables(event_id, table_id, available_seats) VALUES ( ?, ?, ? ) "+
+		"ON DUPLICATE KEY UPDATE available_seats=VALUES(available_seats)", eventId, tableId, capacity); err != nil {
+		logQueryError(ctx, "SaveTable", err)
+		return false, err
+	}
+	return created, nil
+}
+
+/* This function removes a table from an event if no guest has reserved it.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+	tableId int - table number
+Return:
+	error - ErrTableReserved if a guest has reserved the table, ErrTableNotFound if the event has no such table,
+		or any other error that occurred
+*/
+func DeleteTable(ctx context.Context, db *sql.DB, eventId int64, tableId int) error {
+	result, err := db.ExecContext(ctx, "DELETE FROM tables WHERE event_id=? AND table_id=? AND NOT EXISTS "+
+		"(SELECT 1 FROM guest_list WHERE event_id=? AND table_id=?)", eventId, tableId, eventId, tableId)
+	if err != nil {
+		logQueryError(ctx, "DeleteTable", err)
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		// Tell a reserved table apart from a missing one
+		if _, err := GetTableCapacity(ctx, db, eventId, tableId); err != nil {
+			return err
+		}
+		return ErrTableReserved
+	}
+	return nil
+}
+
+/* This function stores an event cloned from a previous event together with its tables and guest list. Either the
+whole clone is stored or nothing.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	clone *model.EventClone - new event, its tables and guests, the ID of the stored event is set
+Return:
+	error - any error that occurred
+*/
+func CloneEvent(ctx context.Context, db *sql.DB, clone *model.EventClone) (err error) {
+	defer func() {
+		if err != nil {
+			logQueryError(ctx, "CloneEvent", err)
+		}
+	}()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	event := &clone.Event
+	result, err := tx.ExecContext(ctx, "INSERT INTO events(name, event_date, venue, status, phase) "+
+		"VALUES ( ?, ?, ?, ?, ? )", event.Name, event.Date, event.Venue, event.Status, event.Phase)
+	if err != nil {
+		return err
+	}
+	if event.Id, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	for _, table := range clone.Tables {
+		if _, err = tx.ExecContext(ctx, "INSERT INTO tables(event_id, table_id, available_seats) VALUES ( ?, ?, ? )",
+			event.Id, table.TableId, table.Capacity); err != nil {
+			return err
+		}
+	}
+	for _, guest := range clone.Guests {
+		// Actual accompanying guests are stored as -1 until the guest arrives
+		actualGuests := -1
+		if guest.ActualAccompanyingGuests != nil {
+			actualGuests = *guest.ActualAccompanyingGuests
+		}
+		if _, err = tx.ExecContext(ctx, "INSERT INTO guest_list(event_id, guest_name, planned_accompanying_guests, "+
+			"table_id, status, actual_accompanying_guests, rsvp_status, arrived_time, departed_time) "+
+			"VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ? )", event.Id, guest.Name, guest.PlannedAccompanyingGuests,
+			guest.TableId, guest.Status, actualGuests, guest.RSVPStatus, guest.ArrivedTime,
+			guest.DepartedTime); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+/* This function moves an event from one phase to another one. The event is only changed if it is still in the
+phase the transition starts from, so that concurrent transitions do not overwrite each other.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+	from string - phase the event is in
+	to string - phase the event moves to
+Return:
+	error - ErrPhaseChanged if the event is no longer in the phase, or any other error that occurred
+*/
+func UpdateEventPhase(ctx context.Context, db *sql.DB, eventId int64, from string, to string) error {
+	result, err := db.ExecContext(ctx, "UPDATE events SET phase=? WHERE event_id=? AND phase=?", to, eventId, from)
+	if err != nil {
+		logQueryError(ctx, "UpdateEventPhase", err)
+		return err
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return ErrPhaseChanged
+	}
+	logging.FromContext(ctx).Info("event phase changed", logging.String("phase", to))
+	return nil
+}
+
+/* This function closes an event whose doors are open. The guests still at the party are checked out and the
+summary of the event is stored, either all of it or nothing.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+	closedAt time.Time - time of the closing, which is the departure time of the guests checked out
+Return:
+	*model.EventSummary - summary of the event
+	error - ErrPhaseChanged if the doors of the event are not open, or any other error that occurred
+*/
+func CloseEvent(ctx context.Context, db *sql.DB, eventId int64, closedAt time.Time) (summary *model.EventSummary,
+	err error) {
+	defer func() {
+		if err != nil && err != ErrPhaseChanged {
+			logQueryError(ctx, "CloseEvent", err)
+		}
+	}()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Moving the phase first locks the event against a concurrent closing
+	result, err := tx.ExecContext(ctx, "UPDATE events SET phase=? WHERE event_id=? AND phase=?", "CLOSED", eventId,
+		"OPEN")
+	if err != nil {
+		return nil, err
+	}
+	if updated, errRows := result.RowsAffected(); errRows == nil && updated == 0 {
+		return nil, ErrPhaseChanged
+	}
+
+	summary = &model.EventSummary{EventId: eventId, ClosedAt: closedAt.UTC().Truncate(time.Second)}
+	result, err = tx.ExecContext(ctx, "UPDATE guest_list SET status=?, departed_time=?, arrived_time=arrived_time "+
+		"WHERE event_id=? AND status=?", "DEPARTED", summary.ClosedAt, eventId, "ARRIVED")
+	if err != nil {
+		return nil, err
+	}
+	checkedOut, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	summary.CheckedOut = int(checkedOut)
+
+	if err = tx.QueryRowContext(ctx, "SELECT COUNT(*), "+
+		"COALESCE(SUM(CASE WHEN status IN ('ARRIVED', 'DEPARTED') THEN 1 ELSE 0 END), 0), "+
+		"COALESCE(SUM(CASE WHEN status IN ('ARRIVED', 'DEPARTED') THEN actual_accompanying_guests + 1 "+
+		"ELSE 0 END), 0), "+
+		"COALESCE(SUM(CASE WHEN status IN ('NOT_ARRIVED', 'NO_SHOW') AND rsvp_status<>'DECLINED' THEN 1 "+
+		"ELSE 0 END), 0), "+
+		"COALESCE(SUM(CASE WHEN rsvp_status='DECLINED' THEN 1 ELSE 0 END), 0) "+
+		"FROM guest_list WHERE event_id=?", eventId).Scan(&summary.InvitedGuests, &summary.ArrivedGuests,
+		&summary.ArrivedPeople, &summary.NoShows, &summary.Declined); err != nil {
+		return nil, err
+	}
+	if err = tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(available_seats), 0) FROM tables WHERE event_id=?",
+		eventId).Scan(&summary.Seats); err != nil {
+		return nil, err
+	}
+	if _, err = tx.ExecContext(ctx, "INSERT INTO event_summaries(event_id, closed_at, invited_guests, "+
+		"arrived_guests, arrived_people, no_shows, declined, checked_out, seats) "+
+		"VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ? )", eventId, summary.ClosedAt, summary.InvitedGuests,
+		summary.ArrivedGuests, summary.ArrivedPeople, summary.NoShows, summary.Declined, summary.CheckedOut,
+		summary.Seats); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	logging.FromContext(ctx).Info("event closed", logging.Int("checked_out", summary.CheckedOut))
+	return summary, nil
+}
+
+/* This function gets the summary of a closed event.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+Return:
+	*model.EventSummary - summary of the event
+	error - ErrSummaryNotFound if the event is not closed, or any other error that occurred
+*/
+func GetEventSummary(ctx context.Context, db *sql.DB, eventId int64) (*model.EventSummary, error) {
+	summary := &model.EventSummary{}
+	err := db.QueryRowContext(ctx, "SELECT event_id, closed_at, invited_guests, arrived_guests, arrived_people, "+
+		"no_shows, declined, checked_out, seats FROM event_summaries WHERE event_id=?", eventId).Scan(
+		&summary.EventId, &summary.ClosedAt, &summary.InvitedGuests, &summary.ArrivedGuests, &summary.ArrivedPeople,
+		&summary.NoShows, &summary.Declined, &summary.CheckedOut, &summary.Seats)
+	if err == sql.ErrNoRows {
+		return nil, ErrSummaryNotFound
+	}
+	if err != nil {
+		logQueryError(ctx, "GetEventSummary", err)
+		return nil, err
+	}
+	return summary, nil
+}
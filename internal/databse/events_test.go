@@ -0,0 +1,345 @@
+package databse
+
+import (
+	"GuestList/internal/model"
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Columns of an event as selected by eventColumns
+var eventColumnNames = []string{"event_id", "name", "event_date", "venue", "status", "phase"}
+
+// Test storing an event, getting it and changing it
+func TestCreateGetAndUpdateEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	date := time.Date(2021, 7, 1, 18, 0, 0, 0, time.UTC)
+	event := &model.Event{Name: "Summer party", Date: date, Venue: "Rooftop", Status: "ACTIVE", Phase: "PLANNING"}
+
+	mock.ExpectExec(`^INSERT INTO events\(name, event_date, venue, status, phase\)`).
+		WithArgs("Summer party", date, "Rooftop", "ACTIVE", "PLANNING").WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectQuery(`^SELECT event_id, (.+) FROM events WHERE event_id=\?`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(eventColumnNames).AddRow(2, "Summer party", date, "Rooftop", "ACTIVE",
+			"PLANNING"))
+	mock.ExpectQuery(`^SELECT event_id, (.+) FROM events WHERE event_id=\?`).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(eventColumnNames))
+	mock.ExpectExec(`^UPDATE events SET name=\?, event_date=\?, venue=\?, status=\? WHERE event_id=\?`).
+		WithArgs("Summer party", date, "Rooftop", "CANCELLED", 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^UPDATE events`).WithArgs("Summer party", date, "Rooftop", "CANCELLED", 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, CreateEvent(context.Background(), db, event), "Expected no error")
+	assert.Equal(t, int64(2), event.Id, "Expected the ID assigned by the database")
+
+	stored, err := GetEvent(context.Background(), db, 2)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, *event, *stored, "Expected the stored event")
+	_, err = GetEvent(context.Background(), db, 3)
+	assert.Equal(t, ErrEventNotFound, err, "Expected event not found")
+
+	event.Status = "CANCELLED"
+	assert.Nil(t, UpdateEvent(context.Background(), db, event), "Expected no error")
+	event.Id = 3
+	assert.Equal(t, ErrEventNotFound, UpdateEvent(context.Background(), db, event), "Expected event not found")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test listing a page of the events with a status
+func TestListEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	date := time.Date(2021, 7, 1, 18, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM events WHERE status=\?`).WithArgs("ACTIVE").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`^SELECT event_id, (.+) WHERE status=\? ORDER BY event_date, event_id LIMIT \? OFFSET \?`).
+		WithArgs("ACTIVE", 1, 1).
+		WillReturnRows(sqlmock.NewRows(eventColumnNames).AddRow(2, "Summer party", date, "", "ACTIVE", "OPEN"))
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM events$`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`^SELECT event_id, (.+) FROM events ORDER BY event_date, event_id LIMIT \? OFFSET \?`).
+		WithArgs(100, 0).WillReturnRows(sqlmock.NewRows(eventColumnNames))
+
+	events, total, err := ListEvents(context.Background(), db, "ACTIVE", 1, 1)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, 3, total, "Expected the number of events with the status")
+	assert.Equal(t, []model.Event{{Id: 2, Name: "Summer party", Date: date, Status: "ACTIVE", Phase: "OPEN"}}, events,
+		"Expected a page of one event")
+
+	events, total, err = ListEvents(context.Background(), db, "", 100, 0)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, 0, total, "Expected no events")
+	assert.NotNil(t, events, "Expected an empty page and not nil")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test listing the tables of an event with their occupancy
+func TestListTables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM tables WHERE event_id=\?`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`^SELECT t.table_id, t.available_seats, (.+) WHERE t.event_id=\? (.+) LIMIT \? OFFSET \?`).
+		WithArgs(2, 10, 0).WillReturnRows(sqlmock.NewRows([]string{"table_id", "available_seats", "occupied"}).
+		AddRow(1, 10, 3).
+		AddRow(2, 4, 0))
+
+	tables, total, err := ListTables(context.Background(), db, 2, 10, 0)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, 2, total, "Expected the number of tables of the event")
+	assert.Equal(t, []model.TableOccupancy{{TableId: 1, Capacity: 10, Occupied: 3}, {TableId: 2, Capacity: 4}},
+		tables, "Expected the occupancy of the tables")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test adding a table to an event and changing its number of seats
+func TestSaveTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`^SELECT available_seats from tables WHERE event_id=\? AND table_id=\?`).WithArgs(2, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"available_seats"}))
+	mock.ExpectExec(`^INSERT INTO tables\(event_id, table_id, available_seats\) (.+) ON DUPLICATE KEY UPDATE`).
+		WithArgs(2, 5, 6).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`^SELECT available_seats from tables`).WithArgs(2, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"available_seats"}).AddRow(6))
+	mock.ExpectExec(`^INSERT INTO tables`).WithArgs(2, 5, 8).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	created, err := SaveTable(context.Background(), db, 2, 5, 6)
+	assert.Nil(t, err, "Expected no error")
+	assert.True(t, created, "Expected the table to be added")
+	created, err = SaveTable(context.Background(), db, 2, 5, 8)
+	assert.Nil(t, err, "Expected no error")
+	assert.False(t, created, "Expected the seats of the table to change")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test removing a table from an event, unless it is reserved or missing
+func TestDeleteTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		deleted  int64
+		seats    *sqlmock.Rows
+		expected error
+	}{
+		{"free table", 1, nil, nil},
+		{"reserved table", 0, sqlmock.NewRows([]string{"available_seats"}).AddRow(4), ErrTableReserved},
+		{"unknown table", 0, sqlmock.NewRows([]string{"available_seats"}), ErrTableNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectExec(`^DELETE FROM tables WHERE event_id=\? AND table_id=\? AND NOT EXISTS`).
+				WithArgs(2, 4, 2, 4).WillReturnResult(sqlmock.NewResult(0, test.deleted))
+			if test.seats != nil {
+				mock.ExpectQuery(`^SELECT available_seats from tables`).WithArgs(2, 4).WillReturnRows(test.seats)
+			}
+
+			err = DeleteTable(context.Background(), db, 2, 4)
+
+			assert.Equal(t, test.expected, err, "Expected different result of the removal")
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expections: %s", err)
+			}
+		})
+	}
+}
+
+// Test storing a cloned event with its tables and guests in one transaction
+func TestCloneEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	date := time.Date(2021, 12, 31, 20, 0, 0, 0, time.UTC)
+	table, actualGuests := 2, 1
+	clone := &model.EventClone{SourceId: 1,
+		Event: model.Event{Name: "Year end party", Date: date, Venue: "Main hall", Status: "ACTIVE",
+			Phase: "PLANNING"},
+		Tables: []model.Table{{TableId: 2, Capacity: 4}},
+		Guests: []model.GuestDetails{
+			{Name: "Mary Queen", TableId: &table, PlannedAccompanyingGuests: 1, Status: "NOT_ARRIVED",
+				RSVPStatus: "PENDING"},
+			{Name: "Brad Pitt", TableId: &table, PlannedAccompanyingGuests: 1, ActualAccompanyingGuests: &actualGuests,
+				Status: "ARRIVED", RSVPStatus: "ACCEPTED", ArrivedTime: &date}}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO events`).WithArgs("Year end party", date, "Main hall", "ACTIVE", "PLANNING").
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec(`^INSERT INTO tables\(event_id, table_id, available_seats\)`).WithArgs(3, 2, 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO guest_list\(event_id, guest_name, (.+), departed_time\)`).
+		WithArgs(3, "Mary Queen", 1, &table, "NOT_ARRIVED", -1, "PENDING", nil, nil).
+		WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectExec(`^INSERT INTO guest_list`).
+		WithArgs(3, "Brad Pitt", 1, &table, "ARRIVED", 1, "ACCEPTED", &date, nil).
+		WillReturnResult(sqlmock.NewResult(6, 1))
+	mock.ExpectCommit()
+
+	assert.Nil(t, CloneEvent(context.Background(), db, clone), "Expected no error")
+	assert.Equal(t, int64(3), clone.Event.Id, "Expected the ID of the new event")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test that nothing of a clone is stored if a guest cannot be copied
+func TestCloneEventRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	clone := &model.EventClone{Event: model.Event{Name: "Year end party", Status: "ACTIVE"},
+		Tables: []model.Table{}, Guests: []model.GuestDetails{{Name: "Mary Queen", Status: "NOT_ARRIVED"}}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO events`).WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec(`^INSERT INTO guest_list`).WillReturnError(errors.New("Error 1452: foreign key constraint fails"))
+	mock.ExpectRollback()
+
+	assert.NotNil(t, CloneEvent(context.Background(), db, clone), "Expected the error of the guest")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test moving an event to another phase unless its phase has changed meanwhile
+func TestUpdateEventPhase(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`^UPDATE events SET phase=\? WHERE event_id=\? AND phase=\?`).WithArgs("LOCKED", 2, "PLANNING").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^UPDATE events SET phase=\?`).WithArgs("OPEN", 2, "PLANNING").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, UpdateEventPhase(context.Background(), db, 2, "PLANNING", "LOCKED"), "Expected no error")
+	assert.Equal(t, ErrPhaseChanged, UpdateEventPhase(context.Background(), db, 2, "PLANNING", "OPEN"),
+		"Expected the phase to have changed")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test closing an event, checking out the guests still at the party and storing its summary in one transaction
+func TestCloseEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	closedAt := time.Date(2021, 1, 1, 2, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE events SET phase=\? WHERE event_id=\? AND phase=\?`).WithArgs("CLOSED", 2, "OPEN").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^UPDATE guest_list SET status=\?, departed_time=\?, (.+) WHERE event_id=\? AND status=\?`).
+		WithArgs("DEPARTED", closedAt, 2, "ARRIVED").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(`^SELECT COUNT\(\*\), (.+) FROM guest_list WHERE event_id=\?`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"invited", "arrived", "people", "no_shows", "declined"}).
+			AddRow(5, 3, 7, 1, 1))
+	mock.ExpectQuery(`^SELECT COALESCE\(SUM\(available_seats\), 0\) FROM tables WHERE event_id=\?`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"seats"}).AddRow(14))
+	mock.ExpectExec(`^INSERT INTO event_summaries`).WithArgs(2, closedAt, 5, 3, 7, 1, 1, 2, 14).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	summary, err := CloseEvent(context.Background(), db, 2, closedAt)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, &model.EventSummary{EventId: 2, ClosedAt: closedAt, InvitedGuests: 5, ArrivedGuests: 3,
+		ArrivedPeople: 7, NoShows: 1, Declined: 1, CheckedOut: 2, Seats: 14}, summary, "Expected the summary")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test that an event whose doors are not open is not closed and that nothing is changed
+func TestCloseEventNotOpen(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE events SET phase=\?`).WithArgs("CLOSED", 2, "OPEN").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	_, err = CloseEvent(context.Background(), db, 2, time.Now())
+	assert.Equal(t, ErrPhaseChanged, err, "Expected the phase to have changed")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test getting the summary of a closed event, and of an event which is not closed
+func TestGetEventSummary(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	closedAt := time.Date(2021, 1, 1, 2, 0, 0, 0, time.UTC)
+	columns := []string{"event_id", "closed_at", "invited_guests", "arrived_guests", "arrived_people", "no_shows",
+		"declined", "checked_out", "seats"}
+
+	mock.ExpectQuery(`^SELECT event_id, (.+) FROM event_summaries WHERE event_id=\?`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(2, closedAt, 5, 3, 7, 1, 1, 2, 14))
+	mock.ExpectQuery(`^SELECT event_id, (.+) FROM event_summaries WHERE event_id=\?`).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	summary, err := GetEventSummary(context.Background(), db, 2)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, 7, summary.ArrivedPeople, "Expected the stored summary")
+	_, err = GetEventSummary(context.Background(), db, 3)
+	assert.Equal(t, ErrSummaryNotFound, err, "Expected summary not found")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
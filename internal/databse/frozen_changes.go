@@ -0,0 +1,63 @@
+package databse
+
+import (
+	"GuestList/internal/model"
+	"context"
+	"database/sql"
+	"time"
+)
+
+/* This function stores a change of the guest list made after it was frozen.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	change *model.FrozenChange - change of the guest list with the reason of the override, the ID of the stored
+		change is set
+Return:
+	error - any error that occurred
+*/
+func AppendFrozenChange(ctx context.Context, db *sql.DB, change *model.FrozenChange) error {
+	change.OccurredAt = change.OccurredAt.UTC().Truncate(time.Second)
+	result, err := db.ExecContext(ctx, "INSERT INTO frozen_changes(event_id, occurred_at, actor, action, guest_name, "+
+		"people, table_id, reason) VALUES ( ?, ?, ?, ?, ?, ?, ?, ? )", change.EventId, change.OccurredAt, change.Actor,
+		change.Action, change.GuestName, change.People, change.TableId, change.Reason)
+	if err == nil {
+		change.Id, err = result.LastInsertId()
+	}
+	if err != nil {
+		logQueryError(ctx, "AppendFrozenChange", err)
+		return err
+	}
+	return nil
+}
+
+/* This function lists the changes made to the guest list of an event after it was frozen.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	eventId int64 - event ID
+Return:
+	[]model.FrozenChange - changes in the order they were made, empty if there are none
+	error - any error that occurred
+*/
+func ListFrozenChanges(ctx context.Context, db *sql.DB, eventId int64) ([]model.FrozenChange, error) {
+	rows, err := db.QueryContext(ctx, "SELECT change_id, event_id, occurred_at, actor, action, guest_name, people, "+
+		"table_id, reason FROM frozen_changes WHERE event_id=? ORDER BY change_id", eventId)
+	if err != nil {
+		logQueryError(ctx, "ListFrozenChanges", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []model.FrozenChange{}
+	for rows.Next() {
+		var change model.FrozenChange
+		if err := rows.Scan(&change.Id, &change.EventId, &change.OccurredAt, &change.Actor, &change.Action,
+			&change.GuestName, &change.People, &change.TableId, &change.Reason); err != nil {
+			logQueryError(ctx, "ListFrozenChanges", err)
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,79 @@
+package databse
+
+import (
+	"GuestList/internal/model"
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Test storing a change of the frozen guest list, the time is stored in seconds
+func TestAppendFrozenChange(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	occurred := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+	table := 2
+	change := &model.FrozenChange{EventId: 1, OccurredAt: occurred.Add(300 * time.Millisecond), Actor: "alice",
+		Action: "GUEST_ADDED", GuestName: "Mary Queen", People: 2, TableId: &table, Reason: "Plus one of the CEO"}
+
+	mock.ExpectExec(`^INSERT INTO frozen_changes\(event_id, occurred_at, actor, action, guest_name, people, `+
+		`table_id, reason\) VALUES`).WithArgs(int64(1), occurred, "alice", "GUEST_ADDED", "Mary Queen", 2, 2,
+		"Plus one of the CEO").WillReturnResult(sqlmock.NewResult(4, 1))
+
+	assert.Nil(t, AppendFrozenChange(context.Background(), db, change), "Expected no error")
+	assert.Equal(t, int64(4), change.Id, "Expected the ID assigned by the database")
+	assert.Equal(t, occurred, change.OccurredAt, "Expected the time in seconds")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test listing the changes of the frozen guest list of an event, a change without table has no table ID
+func TestListFrozenChanges(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	occurred := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`^SELECT change_id, (.+) FROM frozen_changes WHERE event_id=\? ORDER BY change_id$`).
+		WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"change_id", "event_id", "occurred_at", "actor",
+		"action", "guest_name", "people", "table_id", "reason"}).
+		AddRow(1, 1, occurred, "alice", "GUEST_ADDED", "Mary Queen", 2, 2, "Plus one of the CEO").
+		AddRow(2, 1, occurred, "bob", "GUEST_REMOVED", "Brad Pitt", 1, nil, "Sick"))
+
+	changes, err := ListFrozenChanges(context.Background(), db, 1)
+	assert.Nil(t, err, "Expected no error")
+	if assert.Len(t, changes, 2, "Expected both changes") {
+		assert.Equal(t, 2, *changes[0].TableId, "Expected the table of the first change")
+		assert.Equal(t, "Plus one of the CEO", changes[0].Reason, "Expected the reason of the first change")
+		assert.Nil(t, changes[1].TableId, "Expected no table for the second change")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test that the error of the query is returned
+func TestListFrozenChangesError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("^SELECT change_id").WillReturnError(errors.New("connection refused"))
+
+	changes, err := ListFrozenChanges(context.Background(), db, 1)
+	assert.NotNil(t, err, "Expected the error of the query")
+	assert.Nil(t, changes, "Expected no changes")
+}
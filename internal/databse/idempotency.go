@@ -0,0 +1,133 @@
+package databse
+
+import (
+	"GuestList/internal/model"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"time"
+)
+
+// Error number of MySQL for a duplicate entry of a unique key
+const mysqlDuplicateEntry = 1062
+
+/* This function reserves an idempotency key for a request which is being processed.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	record *model.IdempotencyRecord - key, fingerprint and expiry of the request
+Return:
+	error - ErrIdempotencyKeyExists if the key is already reserved, or any other error that occurred
+*/
+func CreateIdempotencyRecord(ctx context.Context, db *sql.DB, record *model.IdempotencyRecord) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO idempotency_keys(idempotency_key, fingerprint, status, expires_at) "+
+		"VALUES ( ?, ?, ?, ? )", record.Key, record.Fingerprint, 0, record.ExpiresAt)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		return ErrIdempotencyKeyExists
+	}
+	if err != nil {
+		logQueryError(ctx, "CreateIdempotencyRecord", err)
+		return err
+	}
+	return nil
+}
+
+/* This function gets the request and its response stored under an idempotency key.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	key string - idempotency key
+Return:
+	*model.IdempotencyRecord - stored request, the status is 0 while the request is processed
+	error - ErrIdempotencyKeyNotFound if the key is not reserved, or any other error that occurred
+*/
+func GetIdempotencyRecord(ctx context.Context, db *sql.DB, key string) (*model.IdempotencyRecord, error) {
+	record := &model.IdempotencyRecord{}
+	var header sql.NullString
+	err := db.QueryRowContext(ctx, "SELECT idempotency_key, fingerprint, status, header, body, expires_at "+
+		"FROM idempotency_keys WHERE idempotency_key=?", key).
+		Scan(&record.Key, &record.Fingerprint, &record.Status, &header, &record.Body, &record.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrIdempotencyKeyNotFound
+	}
+	if err == nil && header.Valid {
+		err = json.Unmarshal([]byte(header.String), &record.Header)
+	}
+	if err != nil {
+		logQueryError(ctx, "GetIdempotencyRecord", err)
+		return nil, err
+	}
+	return record, nil
+}
+
+/* This function stores the response to the request reserved under an idempotency key.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	record *model.IdempotencyRecord - key together with the response and the time until it is replayed
+Return:
+	error - ErrIdempotencyKeyNotFound if the key is not reserved, or any other error that occurred
+*/
+func CompleteIdempotencyRecord(ctx context.Context, db *sql.DB, record *model.IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+	result, err := db.ExecContext(ctx, "UPDATE idempotency_keys SET status=?, header=?, body=?, "+
+		"expires_at=? WHERE idempotency_key=?", record.Status, string(header), record.Body, record.ExpiresAt, record.Key)
+	if err != nil {
+		logQueryError(ctx, "CompleteIdempotencyRecord", err)
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		logQueryError(ctx, "CompleteIdempotencyRecord", err)
+		return err
+	}
+	if rows == 0 {
+		return ErrIdempotencyKeyNotFound
+	}
+	return nil
+}
+
+/* This function releases an idempotency key, so that it can be used by another request.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	key string - idempotency key
+Return:
+	error - any error that occurred
+*/
+func DeleteIdempotencyRecord(ctx context.Context, db *sql.DB, key string) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE idempotency_key=?", key); err != nil {
+		logQueryError(ctx, "DeleteIdempotencyRecord", err)
+		return err
+	}
+	return nil
+}
+
+/* This function deletes the idempotency keys which expired, the requests sent with them are not replayed anymore.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	before time.Time - keys which expired before are deleted
+Return:
+	int - number of deleted keys
+	error - any error that occurred
+*/
+func PurgeIdempotencyRecords(ctx context.Context, db *sql.DB, before time.Time) (int, error) {
+	result, err := db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at<?", before.UTC())
+	if err != nil {
+		logQueryError(ctx, "PurgeIdempotencyRecords", err)
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		logQueryError(ctx, "PurgeIdempotencyRecords", err)
+		return 0, err
+	}
+	return int(deleted), nil
+}
@@ -0,0 +1,101 @@
+package databse
+
+import (
+	"GuestList/internal/model"
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Test reserving an idempotency key which may already be reserved
+func TestCreateIdempotencyRecord(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expires := time.Date(2020, 12, 31, 20, 0, 30, 0, time.UTC)
+	record := &model.IdempotencyRecord{Key: "retry-1", Fingerprint: "abc", ExpiresAt: expires}
+
+	mock.ExpectExec("^INSERT INTO idempotency_keys").WithArgs("retry-1", "abc", 0, expires).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^INSERT INTO idempotency_keys").WithArgs("retry-1", "abc", 0, expires).
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'retry-1' for key 'PRIMARY'"})
+
+	assert.Nil(t, CreateIdempotencyRecord(context.Background(), db, record), "Expected the key to be reserved")
+	assert.Equal(t, ErrIdempotencyKeyExists, CreateIdempotencyRecord(context.Background(), db, record),
+		"Expected the key to be reserved already")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test getting a completed, a reserved and an unknown idempotency key
+func TestGetIdempotencyRecord(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expires := time.Date(2021, 1, 1, 20, 0, 0, 0, time.UTC)
+	columns := []string{"idempotency_key", "fingerprint", "status", "header", "body", "expires_at"}
+
+	mock.ExpectQuery(`^SELECT (.+) FROM idempotency_keys WHERE idempotency_key=\?`).WithArgs("retry-1").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("retry-1", "abc", 201, `{"Content-Type":["application/json"]}`, []byte(`{"name":"John"}`), expires))
+	mock.ExpectQuery(`^SELECT (.+) FROM idempotency_keys WHERE idempotency_key=\?`).WithArgs("retry-2").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("retry-2", "def", 0, nil, nil, expires))
+	mock.ExpectQuery(`^SELECT (.+) FROM idempotency_keys WHERE idempotency_key=\?`).WithArgs("retry-3").
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	record, err := GetIdempotencyRecord(context.Background(), db, "retry-1")
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, 201, record.Status, "Expected the stored status")
+	assert.Equal(t, []string{"application/json"}, record.Header["Content-Type"], "Expected the stored headers")
+	assert.Equal(t, `{"name":"John"}`, string(record.Body), "Expected the stored body")
+	assert.Equal(t, expires, record.ExpiresAt, "Expected the stored expiry")
+
+	record, err = GetIdempotencyRecord(context.Background(), db, "retry-2")
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, 0, record.Status, "Expected a request being processed")
+	assert.Nil(t, record.Header, "Expected no headers before the response")
+
+	_, err = GetIdempotencyRecord(context.Background(), db, "retry-3")
+	assert.Equal(t, ErrIdempotencyKeyNotFound, err, "Expected key not found")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test storing the response to a reserved idempotency key
+func TestCompleteIdempotencyRecord(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	expires := time.Date(2021, 1, 1, 20, 0, 0, 0, time.UTC)
+	record := &model.IdempotencyRecord{Key: "retry-1", Status: 201, ExpiresAt: expires,
+		Header: map[string][]string{"Content-Type": {"application/json"}}, Body: []byte(`{"name":"John"}`)}
+
+	mock.ExpectExec(`^UPDATE idempotency_keys SET status=\?, header=\?, body=\?, expires_at=\? WHERE`).
+		WithArgs(201, `{"Content-Type":["application/json"]}`, []byte(`{"name":"John"}`), expires, "retry-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^UPDATE idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^DELETE FROM idempotency_keys WHERE idempotency_key=\?`).WithArgs("retry-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.Nil(t, CompleteIdempotencyRecord(context.Background(), db, record), "Expected no error")
+	assert.Equal(t, ErrIdempotencyKeyNotFound, CompleteIdempotencyRecord(context.Background(), db, record),
+		"Expected key not found after it was released")
+	assert.Nil(t, DeleteIdempotencyRecord(context.Background(), db, "retry-1"), "Expected no error")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
@@ -0,0 +1,265 @@
+package databse
+
+import (
+	"GuestList/internal/model"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Columns of a job and of a run of a job, in the order scanned by scanJob and scanJobRun
+const (
+	jobColumns    = "job_name, description, interval_seconds, paused, next_run_at"
+	jobRunColumns = "run_id, job_name, run_trigger, actor, scheduled_at, started_at, finished_at, status, affected, " +
+		"error"
+)
+
+// Scans a row with the jobColumns into the job
+func scanJob(row interface{ Scan(...interface{}) error }, job *model.Job) error {
+	return row.Scan(&job.Name, &job.Description, &job.IntervalSeconds, &job.Paused, &job.NextRunAt)
+}
+
+// Scans a row with the jobRunColumns into the run
+func scanJobRun(row interface{ Scan(...interface{}) error }, run *model.JobRun) error {
+	return row.Scan(&run.Id, &run.JobName, &run.Trigger, &run.Actor, &run.ScheduledAt, &run.StartedAt,
+		&run.FinishedAt, &run.Status, &run.Affected, &run.Error)
+}
+
+/* This function stores the definition of a job. A job which is already stored keeps its next run and whether it is
+paused, so that its schedule survives a restart.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	job *model.Job - job, with the time of its first run if it is not stored yet
+Return:
+	error - any error that occurred
+*/
+func SaveJob(ctx context.Context, db *sql.DB, job *model.Job) error {
+	_, err := db.ExecContext(ctx, "INSERT INTO jobs("+jobColumns+") VALUES ( ?, ?, ?, ?, ? ) "+
+		"ON DUPLICATE KEY UPDATE description=VALUES(description), interval_seconds=VALUES(interval_seconds)",
+		job.Name, job.Description, job.IntervalSeconds, job.Paused, job.NextRunAt.UTC().Truncate(time.Second))
+	if err != nil {
+		logQueryError(ctx, "SaveJob", err)
+		return err
+	}
+	return nil
+}
+
+/* This function gets a job.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	name string - name of the job
+Return:
+	*model.Job - job
+	error - ErrJobNotFound if the job does not exist, or any other error that occurred
+*/
+func GetJob(ctx context.Context, db *sql.DB, name string) (*model.Job, error) {
+	job := &model.Job{}
+	err := scanJob(db.QueryRowContext(ctx, "SELECT "+jobColumns+" FROM jobs WHERE job_name=?", name), job)
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		logQueryError(ctx, "GetJob", err)
+		return nil, err
+	}
+	return job, nil
+}
+
+/* This function lists the jobs by name.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+Return:
+	[]model.Job - jobs, empty if there are none
+	error - any error that occurred
+*/
+func ListJobs(ctx context.Context, db *sql.DB) ([]model.Job, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+jobColumns+" FROM jobs ORDER BY job_name")
+	if err != nil {
+		logQueryError(ctx, "ListJobs", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []model.Job{}
+	for rows.Next() {
+		var job model.Job
+		if err := scanJob(rows, &job); err != nil {
+			logQueryError(ctx, "ListJobs", err)
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+/* This function pauses or resumes the scheduled runs of a job.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	name string - name of the job
+	paused bool - true to skip the scheduled runs
+Return:
+	error - ErrJobNotFound if the job does not exist, or any other error that occurred
+*/
+func UpdateJobPaused(ctx context.Context, db *sql.DB, name string, paused bool) error {
+	result, err := db.ExecContext(ctx, "UPDATE jobs SET paused=? WHERE job_name=?", paused, name)
+	if err != nil {
+		logQueryError(ctx, "UpdateJobPaused", err)
+		return err
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+/* This function claims a run of a job before the job is run, so that the job is run at most once even if the
+process stops during the run. A scheduled run moves the next run of the job past the time of the claim, the runs
+missed in between are skipped. A run still running after abandonBefore was interrupted and is marked ABANDONED.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	run *model.JobRun - run with the job name, trigger, actor and start time, the ID, status and scheduled time of
+		the claimed run are set
+	abandonBefore time.Time - runs started before are abandoned
+Return:
+	error - ErrJobNotFound if the job does not exist, ErrJobNotDue if a scheduled run is not due or the job is
+		paused, ErrJobRunning if a run of the job is still running, or any other error that occurred
+*/
+func ClaimJobRun(ctx context.Context, db *sql.DB, run *model.JobRun, abandonBefore time.Time) (err error) {
+	defer func() {
+		if err != nil && err != ErrJobNotFound && err != ErrJobNotDue && err != ErrJobRunning {
+			logQueryError(ctx, "ClaimJobRun", err)
+		}
+	}()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Locking the job keeps apart the claims of the scheduler, of the manual triggers and of the other instances
+	job := &model.Job{}
+	err = scanJob(tx.QueryRowContext(ctx, "SELECT "+jobColumns+" FROM jobs WHERE job_name=? FOR UPDATE",
+		run.JobName), job)
+	if err == sql.ErrNoRows {
+		return ErrJobNotFound
+	}
+	if err != nil {
+		return err
+	}
+	run.StartedAt = run.StartedAt.UTC().Truncate(time.Second)
+	run.ScheduledAt = run.StartedAt
+	if run.Trigger == "SCHEDULED" {
+		if job.Paused || job.NextRunAt.After(run.StartedAt) {
+			return ErrJobNotDue
+		}
+		run.ScheduledAt = job.NextRunAt
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE job_runs SET status=?, finished_at=? WHERE job_name=? AND status=? "+
+		"AND started_at<?", "ABANDONED", run.StartedAt, run.JobName, "RUNNING", abandonBefore.UTC()); err != nil {
+		return err
+	}
+	var running int
+	if err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM job_runs WHERE job_name=? AND status=?", run.JobName,
+		"RUNNING").Scan(&running); err != nil {
+		return err
+	}
+	if running > 0 {
+		return ErrJobRunning
+	}
+
+	if run.Trigger == "SCHEDULED" {
+		interval := time.Duration(job.IntervalSeconds) * time.Second
+		next := job.NextRunAt.Add(interval)
+		if !next.After(run.StartedAt) {
+			next = run.StartedAt.Add(interval)
+		}
+		if _, err = tx.ExecContext(ctx, "UPDATE jobs SET next_run_at=? WHERE job_name=?", next,
+			run.JobName); err != nil {
+			return err
+		}
+	}
+	run.Status = "RUNNING"
+	result, err := tx.ExecContext(ctx, "INSERT INTO job_runs(job_name, run_trigger, actor, scheduled_at, "+
+		"started_at, status) VALUES ( ?, ?, ?, ?, ?, ? )", run.JobName, run.Trigger, run.Actor, run.ScheduledAt,
+		run.StartedAt, run.Status)
+	if err != nil {
+		return err
+	}
+	if run.Id, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+/* This function stores the outcome of a run. A run which was abandoned in the meantime is kept abandoned.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	run *model.JobRun - run with its status, finish time, number of changed records and error
+Return:
+	error - any error that occurred
+*/
+func FinishJobRun(ctx context.Context, db *sql.DB, run *model.JobRun) error {
+	var finishedAt *time.Time
+	if run.FinishedAt != nil {
+		finished := run.FinishedAt.UTC().Truncate(time.Second)
+		finishedAt = &finished
+	}
+	_, err := db.ExecContext(ctx, "UPDATE job_runs SET status=?, finished_at=?, affected=?, error=? "+
+		"WHERE run_id=? AND status=?", run.Status, finishedAt, run.Affected, run.Error, run.Id, "RUNNING")
+	if err != nil {
+		logQueryError(ctx, "FinishJobRun", err)
+		return err
+	}
+	return nil
+}
+
+/* This function lists the runs of a job, the latest first.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+	name string - name of the job
+	limit int - maximum number of runs
+	offset int - number of runs skipped
+Return:
+	[]model.JobRun - runs of the page, empty if there are none
+	int - number of runs of the job
+	error - any error that occurred
+*/
+func ListJobRuns(ctx context.Context, db *sql.DB, name string, limit int, offset int) ([]model.JobRun, int, error) {
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM job_runs WHERE job_name=?", name).
+		Scan(&total); err != nil {
+		logQueryError(ctx, "ListJobRuns", err)
+		return nil, 0, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT "+jobRunColumns+" FROM job_runs WHERE job_name=? "+
+		"ORDER BY run_id DESC LIMIT ? OFFSET ?", name, limit, offset)
+	if err != nil {
+		logQueryError(ctx, "ListJobRuns", err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	runs := []model.JobRun{}
+	for rows.Next() {
+		var run model.JobRun
+		if err := scanJobRun(rows, &run); err != nil {
+			logQueryError(ctx, "ListJobRuns", err)
+			return nil, 0, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, total, rows.Err()
+}
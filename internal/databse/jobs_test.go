@@ -0,0 +1,200 @@
+package databse
+
+import (
+	"GuestList/internal/model"
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Columns of a job
+var jobColumnNames = []string{"job_name", "description", "interval_seconds", "paused", "next_run_at"}
+
+// Test storing a job, a stored job keeps its schedule
+func TestSaveJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	now := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(`^INSERT INTO jobs\(job_name, (.+)\) VALUES (.+) ON DUPLICATE KEY UPDATE `+
+		`description=VALUES\(description\), interval_seconds=VALUES\(interval_seconds\)$`).
+		WithArgs("purge", "Purges", int64(3600), false, now).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	job := &model.Job{Name: "purge", Description: "Purges", IntervalSeconds: 3600, NextRunAt: now.Add(time.Millisecond)}
+	assert.Nil(t, SaveJob(context.Background(), db, job), "Expected no error")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test pausing a job which does not exist
+func TestUpdateJobPausedNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`^UPDATE jobs SET paused=\? WHERE job_name=\?$`).WithArgs(true, "unknown").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Equal(t, ErrJobNotFound, UpdateJobPaused(context.Background(), db, "unknown", true),
+		"Expected the job not to be found")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test claiming a scheduled run: the interrupted runs are abandoned and the next run skips the missed runs
+func TestClaimJobRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	due := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+	now := due.Add(90 * time.Minute)
+	abandonBefore := now.Add(-6 * time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT job_name, (.+) FROM jobs WHERE job_name=\? FOR UPDATE$`).WithArgs("purge").
+		WillReturnRows(sqlmock.NewRows(jobColumnNames).AddRow("purge", "Purges", 3600, false, due))
+	mock.ExpectExec(`^UPDATE job_runs SET status=\?, finished_at=\? WHERE job_name=\? AND status=\? `+
+		`AND started_at<\?$`).WithArgs("ABANDONED", now, "purge", "RUNNING", abandonBefore).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM job_runs WHERE job_name=\? AND status=\?$`).
+		WithArgs("purge", "RUNNING").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`^UPDATE jobs SET next_run_at=\? WHERE job_name=\?$`).WithArgs(now.Add(time.Hour), "purge").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO job_runs\(job_name, run_trigger, actor, scheduled_at, started_at, status\)`).
+		WithArgs("purge", "SCHEDULED", "system", due, now, "RUNNING").WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectCommit()
+
+	run := &model.JobRun{JobName: "purge", Trigger: "SCHEDULED", Actor: "system", StartedAt: now}
+	assert.Nil(t, ClaimJobRun(context.Background(), db, run, abandonBefore), "Expected no error")
+	assert.Equal(t, model.JobRun{Id: 7, JobName: "purge", Trigger: "SCHEDULED", Actor: "system", ScheduledAt: due,
+		StartedAt: now, Status: "RUNNING"}, *run, "Expected the claimed run")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test that a scheduled run is not claimed before it is due or while the job is paused
+func TestClaimJobRunNotDue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	now := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+
+	for _, row := range [][]interface{}{{false, now.Add(time.Second)}, {true, now}} {
+		mock.ExpectBegin()
+		mock.ExpectQuery("^SELECT job_name").WillReturnRows(sqlmock.NewRows(jobColumnNames).
+			AddRow("purge", "Purges", 3600, row[0], row[1]))
+		mock.ExpectRollback()
+
+		run := &model.JobRun{JobName: "purge", Trigger: "SCHEDULED", Actor: "system", StartedAt: now}
+		assert.Equal(t, ErrJobNotDue, ClaimJobRun(context.Background(), db, run, now), "Expected no run")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test that a manual run of a paused job is claimed unless the job is still running, the schedule is kept
+func TestClaimJobRunManual(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	now := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+
+	for _, running := range []int{1, 0} {
+		mock.ExpectBegin()
+		mock.ExpectQuery("^SELECT job_name").WillReturnRows(sqlmock.NewRows(jobColumnNames).
+			AddRow("purge", "Purges", 3600, true, now.Add(time.Hour)))
+		mock.ExpectExec("^UPDATE job_runs SET status").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM job_runs`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(running))
+		if running > 0 {
+			mock.ExpectRollback()
+		}
+	}
+	mock.ExpectExec("^INSERT INTO job_runs").WithArgs("purge", "MANUAL", "alice", now, now, "RUNNING").
+		WillReturnResult(sqlmock.NewResult(8, 1))
+	mock.ExpectCommit()
+
+	run := &model.JobRun{JobName: "purge", Trigger: "MANUAL", Actor: "alice", StartedAt: now}
+	assert.Equal(t, ErrJobRunning, ClaimJobRun(context.Background(), db, run, now), "Expected the job to be running")
+	assert.Nil(t, ClaimJobRun(context.Background(), db, run, now), "Expected no error")
+	assert.Equal(t, int64(8), run.Id, "Expected the ID of the run")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test storing the outcome of a run and listing the runs of a job
+func TestFinishAndListJobRuns(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	now := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+	finished := now.Add(1500 * time.Millisecond)
+
+	mock.ExpectExec(`^UPDATE job_runs SET status=\?, finished_at=\?, affected=\?, error=\? `+
+		`WHERE run_id=\? AND status=\?$`).WithArgs("FAILED", now.Add(time.Second), 0, "timeout", 7, "RUNNING").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM job_runs WHERE job_name=\?$`).WithArgs("purge").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`^SELECT run_id, (.+) FROM job_runs WHERE job_name=\? ORDER BY run_id DESC LIMIT \? OFFSET \?$`).
+		WithArgs("purge", 1, 0).WillReturnRows(sqlmock.NewRows([]string{"run_id", "job_name", "run_trigger",
+		"actor", "scheduled_at", "started_at", "finished_at", "status", "affected", "error"}).
+		AddRow(7, "purge", "SCHEDULED", "system", now, now, nil, "RUNNING", 0, ""))
+
+	run := &model.JobRun{Id: 7, Status: "FAILED", FinishedAt: &finished, Error: "timeout"}
+	assert.Nil(t, FinishJobRun(context.Background(), db, run), "Expected no error")
+	runs, total, err := ListJobRuns(context.Background(), db, "purge", 1, 0)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, 3, total, "Expected the number of runs")
+	assert.Equal(t, []model.JobRun{{Id: 7, JobName: "purge", Trigger: "SCHEDULED", Actor: "system",
+		ScheduledAt: now, StartedAt: now, Status: "RUNNING"}}, runs, "Expected the run still running")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
+
+// Test deleting the expired idempotency keys
+func TestPurgeIdempotencyRecords(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	now := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(`^DELETE FROM idempotency_keys WHERE expires_at<\?$`).WithArgs(now).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	deleted, err := PurgeIdempotencyRecords(context.Background(), db, now)
+	assert.Nil(t, err, "Expected no error")
+	assert.Equal(t, 4, deleted, "Expected the number of deleted keys")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expections: %s", err)
+	}
+}
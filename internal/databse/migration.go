@@ -0,0 +1,32 @@
+package databse
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Version of the latest migration in the migration folder, the database has to be migrated to it
+const SchemaVersion = 11
+
+/* This function gets the version of the migrations applied to the database by golang-migrate.
+Arguments:
+	ctx context.Context - context of the request
+	db *sql.DB - MySQL database
+Return:
+	uint - version of the last applied migration
+	bool - true if the last migration failed and the database has to be fixed manually
+	error - any error that occurred
+*/
+func GetSchemaVersion(ctx context.Context, db *sql.DB) (uint, bool, error) {
+	var version uint
+	var dirty bool
+	err := db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		logQueryError(ctx, "GetSchemaVersion", err)
+		return 0, false, err
+	}
+	return version, dirty, nil
+}
@@ -0,0 +1,299 @@
+package databse
+
+import (
+	"GuestList/internal/model"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Store gives access to the events with their guest lists and tables. The logger carried by the context is used
+// for the log entries, so they have the request id and the fields added by the caller.
+type Store interface {
+	CreateEvent(ctx context.Context, event *model.Event) error
+	GetEvent(ctx context.Context, eventId int64) (*model.Event, error)
+	ListEvents(ctx context.Context, status string, limit int, offset int) ([]model.Event, int, error)
+	UpdateEvent(ctx context.Context, event *model.Event) error
+	ListTables(ctx context.Context, eventId int64, limit int, offset int) ([]model.TableOccupancy, int, error)
+	SaveTable(ctx context.Context, eventId int64, tableId int, capacity int) (bool, error)
+	DeleteTable(ctx context.Context, eventId int64, tableId int) error
+	CloneEvent(ctx context.Context, clone *model.EventClone) error
+	UpdateEventPhase(ctx context.Context, eventId int64, from string, to string) error
+	CloseEvent(ctx context.Context, eventId int64, closedAt time.Time) (*model.EventSummary, error)
+	GetEventSummary(ctx context.Context, eventId int64) (*model.EventSummary, error)
+	AppendFrozenChange(ctx context.Context, change *model.FrozenChange) error
+	ListFrozenChanges(ctx context.Context, eventId int64) ([]model.FrozenChange, error)
+	AddGuestToList(ctx context.Context, eventId int64, guest *model.GuestsList) error
+	DeleteGuestFromList(ctx context.Context, eventId int64, guestName string) error
+	GetAllGuests(ctx context.Context, eventId int64, limit int, offset int) ([]model.GuestsList, error)
+	GetGuestDetails(ctx context.Context, eventId int64, guestName string) (*model.GuestDetails, error)
+	GetGuest(ctx context.Context, eventId int64, guestId int64) (*model.Guest, error)
+	ListGuests(ctx context.Context, eventId int64, status string, limit int, offset int) ([]model.Guest, int, error)
+	GetGuestInvite(ctx context.Context, eventId int64, guestName string) (*model.GuestsList, error)
+	GetEntryFromGuestList(ctx context.Context, eventId int64, guestName string) (*model.GuestsList, error)
+	GetTableCapacity(ctx context.Context, eventId int64, tableId int) (int, error)
+	CheckTableForGuest(ctx context.Context, eventId int64, tableId int, partySize int) error
+	UpdateGuestStatusToArrive(ctx context.Context, eventId int64, guest *model.GuestsList, arrGuests int) error
+	UpdateGuestStatusToDepart(ctx context.Context, eventId int64, guestName string) error
+	UpdateGuestRSVP(ctx context.Context, eventId int64, guestName string, rsvpStatus string) error
+	GetArrivedGuests(ctx context.Context, eventId int64, limit int, offset int) ([]model.GuestsList, error)
+	MarkNoShows(ctx context.Context, startedBefore time.Time) (map[int64]int, error)
+	ListNoShows(ctx context.Context, eventId int64) ([]model.Guest, error)
+	EmptySeats(ctx context.Context, eventId int64) (int, error)
+	GetPartyStats(ctx context.Context, eventId int64) (*model.PartyStats, error)
+	CreateIdempotencyRecord(ctx context.Context, record *model.IdempotencyRecord) error
+	GetIdempotencyRecord(ctx context.Context, key string) (*model.IdempotencyRecord, error)
+	CompleteIdempotencyRecord(ctx context.Context, record *model.IdempotencyRecord) error
+	DeleteIdempotencyRecord(ctx context.Context, key string) error
+	PurgeIdempotencyRecords(ctx context.Context, before time.Time) (int, error)
+	CreateAPIKey(ctx context.Context, key *model.APIKey) error
+	GetAPIKeyByHash(ctx context.Context, hash string) (*model.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, keyId int64, revokedAt time.Time) error
+	AppendAuditEntry(ctx context.Context, entry *model.AuditEntry) error
+	ListAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, int, error)
+	GetAuditChainHead(ctx context.Context) (string, error)
+	SaveJob(ctx context.Context, job *model.Job) error
+	GetJob(ctx context.Context, name string) (*model.Job, error)
+	ListJobs(ctx context.Context) ([]model.Job, error)
+	UpdateJobPaused(ctx context.Context, name string, paused bool) error
+	ClaimJobRun(ctx context.Context, run *model.JobRun, abandonBefore time.Time) error
+	FinishJobRun(ctx context.Context, run *model.JobRun) error
+	ListJobRuns(ctx context.Context, name string, limit int, offset int) ([]model.JobRun, int, error)
+	Ping(ctx context.Context) error
+	GetSchemaVersion(ctx context.Context) (uint, bool, error)
+}
+
+// MySQLStore is the Store backed by the MySQL database
+type MySQLStore struct {
+	db *sql.DB
+}
+
+/* This function creates a Store backed by the given MySQL database.
+Arguments:
+	db *sql.DB - MySQL database
+Return:
+	*MySQLStore - store
+*/
+func NewMySQLStore(db *sql.DB) *MySQLStore {
+	return &MySQLStore{db: db}
+}
+
+func (s *MySQLStore) CreateEvent(ctx context.Context, event *model.Event) error {
+	return CreateEvent(ctx, s.db, event)
+}
+
+func (s *MySQLStore) GetEvent(ctx context.Context, eventId int64) (*model.Event, error) {
+	return GetEvent(ctx, s.db, eventId)
+}
+
+func (s *MySQLStore) ListEvents(ctx context.Context, status string, limit int, offset int) ([]model.Event, int,
+	error) {
+	return ListEvents(ctx, s.db, status, limit, offset)
+}
+
+func (s *MySQLStore) UpdateEvent(ctx context.Context, event *model.Event) error {
+	return UpdateEvent(ctx, s.db, event)
+}
+
+func (s *MySQLStore) ListTables(ctx context.Context, eventId int64, limit int, offset int) ([]model.TableOccupancy,
+	int, error) {
+	return ListTables(ctx, s.db, eventId, limit, offset)
+}
+
+func (s *MySQLStore) SaveTable(ctx context.Context, eventId int64, tableId int, capacity int) (bool, error) {
+	return SaveTable(ctx, s.db, eventId, tableId, capacity)
+}
+
+func (s *MySQLStore) DeleteTable(ctx context.Context, eventId int64, tableId int) error {
+	return DeleteTable(ctx, s.db, eventId, tableId)
+}
+
+func (s *MySQLStore) CloneEvent(ctx context.Context, clone *model.EventClone) error {
+	return CloneEvent(ctx, s.db, clone)
+}
+
+func (s *MySQLStore) UpdateEventPhase(ctx context.Context, eventId int64, from string, to string) error {
+	return UpdateEventPhase(ctx, s.db, eventId, from, to)
+}
+
+func (s *MySQLStore) CloseEvent(ctx context.Context, eventId int64, closedAt time.Time) (*model.EventSummary,
+	error) {
+	return CloseEvent(ctx, s.db, eventId, closedAt)
+}
+
+func (s *MySQLStore) GetEventSummary(ctx context.Context, eventId int64) (*model.EventSummary, error) {
+	return GetEventSummary(ctx, s.db, eventId)
+}
+
+func (s *MySQLStore) AppendFrozenChange(ctx context.Context, change *model.FrozenChange) error {
+	return AppendFrozenChange(ctx, s.db, change)
+}
+
+func (s *MySQLStore) ListFrozenChanges(ctx context.Context, eventId int64) ([]model.FrozenChange, error) {
+	return ListFrozenChanges(ctx, s.db, eventId)
+}
+
+func (s *MySQLStore) AddGuestToList(ctx context.Context, eventId int64, guest *model.GuestsList) error {
+	return AddGuestToList(ctx, s.db, eventId, guest)
+}
+
+func (s *MySQLStore) DeleteGuestFromList(ctx context.Context, eventId int64, guestName string) error {
+	return DeleteGuestFromList(ctx, s.db, eventId, guestName)
+}
+
+func (s *MySQLStore) GetAllGuests(ctx context.Context, eventId int64, limit int, offset int) ([]model.GuestsList,
+	error) {
+	return GetAllGuests(ctx, s.db, eventId, limit, offset)
+}
+
+func (s *MySQLStore) GetGuestDetails(ctx context.Context, eventId int64, guestName string) (*model.GuestDetails,
+	error) {
+	return GetGuestDetails(ctx, s.db, eventId, guestName)
+}
+
+func (s *MySQLStore) GetGuest(ctx context.Context, eventId int64, guestId int64) (*model.Guest, error) {
+	return GetGuest(ctx, s.db, eventId, guestId)
+}
+
+func (s *MySQLStore) ListGuests(ctx context.Context, eventId int64, status string, limit int,
+	offset int) ([]model.Guest, int, error) {
+	return ListGuests(ctx, s.db, eventId, status, limit, offset)
+}
+
+func (s *MySQLStore) GetGuestInvite(ctx context.Context, eventId int64, guestName string) (*model.GuestsList, error) {
+	return GetGuestInvite(ctx, s.db, eventId, guestName)
+}
+
+func (s *MySQLStore) GetEntryFromGuestList(ctx context.Context, eventId int64, guestName string) (*model.GuestsList,
+	error) {
+	return GetEntryFromGuestList(ctx, s.db, eventId, guestName)
+}
+
+func (s *MySQLStore) GetTableCapacity(ctx context.Context, eventId int64, tableId int) (int, error) {
+	return GetTableCapacity(ctx, s.db, eventId, tableId)
+}
+
+func (s *MySQLStore) CheckTableForGuest(ctx context.Context, eventId int64, tableId int, partySize int) error {
+	return CheckTableForGuest(ctx, s.db, eventId, tableId, partySize)
+}
+
+func (s *MySQLStore) UpdateGuestStatusToArrive(ctx context.Context, eventId int64, guest *model.GuestsList,
+	arrGuests int) error {
+	return UpdateGuestStatusToArrive(ctx, s.db, eventId, guest, arrGuests)
+}
+
+func (s *MySQLStore) UpdateGuestStatusToDepart(ctx context.Context, eventId int64, guestName string) error {
+	return UpdateGuestStatusToDepart(ctx, s.db, eventId, guestName)
+}
+
+func (s *MySQLStore) UpdateGuestRSVP(ctx context.Context, eventId int64, guestName string, rsvpStatus string) error {
+	return UpdateGuestRSVP(ctx, s.db, eventId, guestName, rsvpStatus)
+}
+
+func (s *MySQLStore) GetArrivedGuests(ctx context.Context, eventId int64, limit int, offset int) ([]model.GuestsList,
+	error) {
+	return GetArrivedGuests(ctx, s.db, eventId, limit, offset)
+}
+
+func (s *MySQLStore) MarkNoShows(ctx context.Context, startedBefore time.Time) (map[int64]int, error) {
+	return MarkNoShows(ctx, s.db, startedBefore)
+}
+
+func (s *MySQLStore) ListNoShows(ctx context.Context, eventId int64) ([]model.Guest, error) {
+	return ListNoShows(ctx, s.db, eventId)
+}
+
+func (s *MySQLStore) EmptySeats(ctx context.Context, eventId int64) (int, error) {
+	return EmptySeats(ctx, s.db, eventId)
+}
+
+func (s *MySQLStore) GetPartyStats(ctx context.Context, eventId int64) (*model.PartyStats, error) {
+	return GetPartyStats(ctx, s.db, eventId)
+}
+
+func (s *MySQLStore) CreateIdempotencyRecord(ctx context.Context, record *model.IdempotencyRecord) error {
+	return CreateIdempotencyRecord(ctx, s.db, record)
+}
+
+func (s *MySQLStore) GetIdempotencyRecord(ctx context.Context, key string) (*model.IdempotencyRecord, error) {
+	return GetIdempotencyRecord(ctx, s.db, key)
+}
+
+func (s *MySQLStore) CompleteIdempotencyRecord(ctx context.Context, record *model.IdempotencyRecord) error {
+	return CompleteIdempotencyRecord(ctx, s.db, record)
+}
+
+func (s *MySQLStore) DeleteIdempotencyRecord(ctx context.Context, key string) error {
+	return DeleteIdempotencyRecord(ctx, s.db, key)
+}
+
+func (s *MySQLStore) PurgeIdempotencyRecords(ctx context.Context, before time.Time) (int, error) {
+	return PurgeIdempotencyRecords(ctx, s.db, before)
+}
+
+func (s *MySQLStore) CreateAPIKey(ctx context.Context, key *model.APIKey) error {
+	return CreateAPIKey(ctx, s.db, key)
+}
+
+func (s *MySQLStore) GetAPIKeyByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	return GetAPIKeyByHash(ctx, s.db, hash)
+}
+
+func (s *MySQLStore) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	return ListAPIKeys(ctx, s.db)
+}
+
+func (s *MySQLStore) RevokeAPIKey(ctx context.Context, keyId int64, revokedAt time.Time) error {
+	return RevokeAPIKey(ctx, s.db, keyId, revokedAt)
+}
+
+func (s *MySQLStore) AppendAuditEntry(ctx context.Context, entry *model.AuditEntry) error {
+	return AppendAuditEntry(ctx, s.db, entry)
+}
+
+func (s *MySQLStore) ListAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, int,
+	error) {
+	return ListAuditEntries(ctx, s.db, filter)
+}
+
+func (s *MySQLStore) GetAuditChainHead(ctx context.Context) (string, error) {
+	return GetAuditChainHead(ctx, s.db)
+}
+
+func (s *MySQLStore) SaveJob(ctx context.Context, job *model.Job) error {
+	return SaveJob(ctx, s.db, job)
+}
+
+func (s *MySQLStore) GetJob(ctx context.Context, name string) (*model.Job, error) {
+	return GetJob(ctx, s.db, name)
+}
+
+func (s *MySQLStore) ListJobs(ctx context.Context) ([]model.Job, error) {
+	return ListJobs(ctx, s.db)
+}
+
+func (s *MySQLStore) UpdateJobPaused(ctx context.Context, name string, paused bool) error {
+	return UpdateJobPaused(ctx, s.db, name, paused)
+}
+
+func (s *MySQLStore) ClaimJobRun(ctx context.Context, run *model.JobRun, abandonBefore time.Time) error {
+	return ClaimJobRun(ctx, s.db, run, abandonBefore)
+}
+
+func (s *MySQLStore) FinishJobRun(ctx context.Context, run *model.JobRun) error {
+	return FinishJobRun(ctx, s.db, run)
+}
+
+func (s *MySQLStore) ListJobRuns(ctx context.Context, name string, limit int, offset int) ([]model.JobRun, int,
+	error) {
+	return ListJobRuns(ctx, s.db, name, limit, offset)
+}
+
+func (s *MySQLStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *MySQLStore) GetSchemaVersion(ctx context.Context) (uint, bool, error) {
+	return GetSchemaVersion(ctx, s.db)
+}
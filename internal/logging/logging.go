@@ -0,0 +1,295 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the name of the level as written in the log entries
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+/* This function parses the name of a level.
+Arguments:
+	name string - debug, info, warn or error
+Return:
+	Level - level
+	error - error if the name is not a level
+*/
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, expected one of %s", name, strings.Join(levelNames, ", "))
+}
+
+// Field is a key and value added to a log entry
+type Field struct {
+	Key   string
+	Value interface{}
+	pii   bool // the value identifies a person and is redacted if the logger redacts names
+}
+
+// String creates a field with a string value
+func String(key string, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int creates a field with an integer value
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Bool creates a field with a boolean value
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration creates a field with the duration in milliseconds
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: float64(value) / float64(time.Millisecond)}
+}
+
+// Err creates the error field
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: "error", Value: nil}
+	}
+	return Field{Key: "error", Value: err.Error()}
+}
+
+// SensitiveErr creates the error field for an error of the database, which may contain the name of a guest, e.g. a
+// duplicate entry. The error is redacted if the logger redacts names.
+func SensitiveErr(err error) Field {
+	if err == nil {
+		return Field{Key: "error", Value: nil}
+	}
+	return Sensitive("error", err.Error())
+}
+
+// RequestId creates the field with the id of the request
+func RequestId(id string) Field {
+	return Field{Key: "request_id", Value: id}
+}
+
+// Sensitive creates a field whose value may contain the name of a guest and is redacted if the logger redacts names
+func Sensitive(key string, value string) Field {
+	return Field{Key: key, Value: value, pii: true}
+}
+
+// Guest creates the field with the name of the guest, the name is redacted if the logger redacts names
+func Guest(name string) Field {
+	return Sensitive("guest", name)
+}
+
+// Event creates the field with the id of the event
+func Event(id int64) Field {
+	return Field{Key: "event", Value: id}
+}
+
+// Table creates the field with the id of the table
+func Table(id int) Field {
+	return Field{Key: "table", Value: id}
+}
+
+// output is the destination shared by a logger and the loggers derived from it
+type output struct {
+	mu          sync.Mutex
+	w           io.Writer
+	level       Level
+	redactNames bool
+	redactKey   []byte
+	clock       func() time.Time
+}
+
+// Logger writes leveled log entries as JSON lines, every entry carries the fields of the logger
+type Logger struct {
+	out    *output
+	fields []Field
+}
+
+/* This function creates a logger writing JSON lines.
+Arguments:
+	w io.Writer - destination of the log entries
+	level Level - entries below the level are dropped
+	redactNames bool - replace the names of the guests by a pseudonym
+	redactKey string - secret of the pseudonyms, the names are replaced by a placeholder if empty
+Return:
+	*Logger - logger
+*/
+func New(w io.Writer, level Level, redactNames bool, redactKey string) *Logger {
+	return &Logger{out: &output{w: w, level: level, redactNames: redactNames, redactKey: []byte(redactKey),
+		clock: time.Now}}
+}
+
+// Discard creates a logger which drops all entries
+func Discard() *Logger {
+	return New(ioutil.Discard, LevelError+1, false, "")
+}
+
+// With returns a logger which adds the fields to every entry
+func (l *Logger) With(fields ...Field) *Logger {
+	all := make([]Field, 0, len(l.fields)+len(fields))
+	return &Logger{out: l.out, fields: append(append(all, l.fields...), fields...)}
+}
+
+// Enabled reports whether entries of the level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.out.level
+}
+
+// Debug writes an entry with the debug level
+func (l *Logger) Debug(msg string, fields ...Field) {
+	l.write(LevelDebug, msg, fields)
+}
+
+// Info writes an entry with the info level
+func (l *Logger) Info(msg string, fields ...Field) {
+	l.write(LevelInfo, msg, fields)
+}
+
+// Warn writes an entry with the warn level
+func (l *Logger) Warn(msg string, fields ...Field) {
+	l.write(LevelWarn, msg, fields)
+}
+
+// Error writes an entry with the error level
+func (l *Logger) Error(msg string, fields ...Field) {
+	l.write(LevelError, msg, fields)
+}
+
+func (l *Logger) write(level Level, msg string, fields []Field) {
+	if !l.Enabled(level) {
+		return
+	}
+	entry := &bytes.Buffer{}
+	entry.WriteString(`{"time":`)
+	writeValue(entry, l.out.clock().UTC().Format(time.RFC3339Nano))
+	entry.WriteString(`,"level":`)
+	writeValue(entry, level.String())
+	entry.WriteString(`,"msg":`)
+	writeValue(entry, msg)
+	for _, list := range [][]Field{l.fields, fields} {
+		for _, field := range list {
+			entry.WriteByte(',')
+			writeValue(entry, field.Key)
+			entry.WriteByte(':')
+			if field.pii && l.out.redactNames {
+				writeValue(entry, l.out.redact(fmt.Sprint(field.Value)))
+			} else {
+				writeValue(entry, field.Value)
+			}
+		}
+	}
+	entry.WriteString("}\n")
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	_, _ = l.out.w.Write(entry.Bytes())
+}
+
+// Writes the value as JSON, values which cannot be encoded are written as strings
+func writeValue(entry *bytes.Buffer, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	entry.Write(encoded)
+}
+
+// Replaces a name by a pseudonym, so that the entries of the same guest can still be correlated. The pseudonym is
+// keyed by the secret, a plain hash could be reversed by hashing a list of names. Without the secret the name is
+// replaced by a placeholder.
+func (o *output) redact(name string) string {
+	if len(o.redactKey) == 0 {
+		return "redacted"
+	}
+	mac := hmac.New(sha256.New, o.redactKey)
+	mac.Write([]byte(name))
+	return "redacted:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+/* This function creates a standard library logger writing entries of the given level, e.g. for the errors
+of the HTTP server.
+Arguments:
+	level Level - level of the entries
+Return:
+	*log.Logger - standard library logger
+*/
+func (l *Logger) StdLogger(level Level) *log.Logger {
+	return log.New(writerFunc(func(p []byte) (int, error) {
+		l.write(level, strings.TrimSuffix(string(p), "\n"), nil)
+		return len(p), nil
+	}), "", 0)
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// Key of the logger in a context
+type contextKey struct{}
+
+var defaultLogger = struct {
+	sync.RWMutex
+	logger *Logger
+}{logger: New(os.Stderr, LevelInfo, false, "")}
+
+// SetDefault sets the logger used when a context carries no logger
+func SetDefault(l *Logger) {
+	defaultLogger.Lock()
+	defer defaultLogger.Unlock()
+	defaultLogger.logger = l
+}
+
+// Default returns the logger used when a context carries no logger
+func Default() *Logger {
+	defaultLogger.RLock()
+	defer defaultLogger.RUnlock()
+	return defaultLogger.logger
+}
+
+// NewContext returns a context carrying the logger
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger carried by the context, or the default logger
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return Default()
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Creates a logger writing to the buffer at a fixed time
+func newTestLogger(out *bytes.Buffer, level Level, redactNames bool, redactKey string) *Logger {
+	l := New(out, level, redactNames, redactKey)
+	l.out.clock = func() time.Time { return time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC) }
+	return l
+}
+
+// Test the JSON lines with the fields of the logger and the entry
+func TestLogger(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := newTestLogger(out, LevelInfo, false, "").With(RequestId("abc"))
+	l.Debug("dropped")
+	l.With(Guest("Mary Queen"), Table(2)).Info("guest added", Int("accompanying_guests", 1))
+	l.Error("query failed", Err(errors.New("connection refused")), Duration("duration", 1500*time.Microsecond))
+
+	assert.Equal(t, `{"time":"2020-12-31T20:00:00Z","level":"info","msg":"guest added","request_id":"abc",`+
+		`"guest":"Mary Queen","table":2,"accompanying_guests":1}`+"\n"+
+		`{"time":"2020-12-31T20:00:00Z","level":"error","msg":"query failed","request_id":"abc",`+
+		`"error":"connection refused","duration":1.5}`+"\n", out.String(), "Expected JSON lines")
+}
+
+// Test the redaction of the names of the guests
+func TestLoggerRedactNames(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := newTestLogger(out, LevelDebug, true, "a-secret-of-at-least-32-characters")
+	l.Info("guest added", Guest("Mary Queen"), String("status", "NOT_ARRIVED"))
+	l.Info("guest arrived", Guest("Mary Queen"))
+	l.Error("query failed", SensitiveErr(errors.New("Error 1062: Duplicate entry '1-Mary Queen'")))
+	other := &bytes.Buffer{}
+	newTestLogger(other, LevelDebug, true, "another-secret-of-at-least-32-chars").Info("guest", Guest("Mary Queen"))
+
+	assert.NotContains(t, out.String(), "Mary", "Expected the name to be redacted")
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	assert.Contains(t, string(lines[0]), `"guest":"redacted:`, "Expected a pseudonym")
+	assert.Contains(t, string(lines[0]), `"status":"NOT_ARRIVED"`, "Expected other fields to be kept")
+	pseudonym := bytes.SplitN(bytes.SplitN(lines[0], []byte(`"guest":`), 2)[1], []byte(","), 2)[0]
+	assert.Contains(t, string(lines[1]), string(pseudonym), "Expected the same pseudonym for the same guest")
+	assert.NotContains(t, other.String(), string(pseudonym), "Expected the pseudonym to depend on the secret")
+	assert.Contains(t, string(lines[2]), `"error":"redacted:`, "Expected the error of the database to be redacted")
+}
+
+// Test the placeholder of the names of the guests without the secret of the pseudonyms
+func TestLoggerRedactNamesWithoutKey(t *testing.T) {
+	out := &bytes.Buffer{}
+	newTestLogger(out, LevelDebug, true, "").Info("guest added", Guest("Mary Queen"))
+
+	assert.Equal(t, `{"time":"2020-12-31T20:00:00Z","level":"info","msg":"guest added","guest":"redacted"}`+"\n",
+		out.String(), "Expected a placeholder")
+}
+
+// Test the levels
+func TestParseLevel(t *testing.T) {
+	for _, name := range []string{"debug", "INFO", "Warn", "error"} {
+		level, err := ParseLevel(name)
+		assert.Nil(t, err, "Expected level %s", name)
+		assert.Equal(t, strings.ToLower(name), level.String(), "Expected level name")
+	}
+	_, err := ParseLevel("verbose")
+	assert.NotNil(t, err, "Expected unknown level")
+}
+
+// Test the logger carried by a context and the standard library adapter
+func TestContext(t *testing.T) {
+	out := &bytes.Buffer{}
+	l := newTestLogger(out, LevelInfo, false, "").With(RequestId("abc"))
+	assert.Equal(t, Default(), FromContext(context.Background()), "Expected the default logger")
+
+	FromContext(NewContext(context.Background(), l)).Info("from context")
+	l.StdLogger(LevelWarn).Println("http: TLS handshake error")
+	assert.Equal(t, `{"time":"2020-12-31T20:00:00Z","level":"info","msg":"from context","request_id":"abc"}`+"\n"+
+		`{"time":"2020-12-31T20:00:00Z","level":"warn","msg":"http: TLS handshake error","request_id":"abc"}`+"\n",
+		out.String(), "Expected entries of the logger")
+}
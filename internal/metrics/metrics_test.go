@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Test writing the metrics in the Prometheus text exposition format
+func TestWrite(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounterVec("requests_total", "Number of requests.", "route", "status")
+	latency := registry.NewHistogramVec("latency_seconds", "Latency of the requests.", []float64{0.5, 0.1}, "route")
+	seats := registry.NewGaugeVec("seats_empty", "Number of empty seats.")
+	collected := 0
+	registry.OnCollect(func() {
+		collected++
+		seats.Set(6)
+	})
+
+	requests.Inc("/guests/{name}", "200")
+	requests.Inc("/guests/{name}", "200")
+	requests.Inc(`/say"hi"`, "404")
+	latency.Observe(0.05, "/guests")
+	latency.Observe(0.2, "/guests")
+	latency.Observe(3, "/guests")
+
+	out := &bytes.Buffer{}
+	assert.Nil(t, registry.Write(out), "Expected no error")
+
+	assert.Equal(t, 1, collected, "Expected the hooks to be called")
+	assert.Equal(t, `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{route="/guests/{name}",status="200"} 2
+requests_total{route="/say\"hi\"",status="404"} 1
+# HELP latency_seconds Latency of the requests.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/guests",le="0.1"} 1
+latency_seconds_bucket{route="/guests",le="0.5"} 2
+latency_seconds_bucket{route="/guests",le="+Inf"} 3
+latency_seconds_sum{route="/guests"} 3.25
+latency_seconds_count{route="/guests"} 3
+# HELP seats_empty Number of empty seats.
+# TYPE seats_empty gauge
+seats_empty 6
+`, out.String(), "Expected different exposition")
+}
+
+// Test resetting a gauge
+func TestGaugeReset(t *testing.T) {
+	registry := NewRegistry()
+	occupancy := registry.NewGaugeVec("table_occupancy", "People seated per table.", "table")
+	occupancy.Set(3, "1")
+	occupancy.Reset()
+	occupancy.Set(2, "2")
+
+	out := &bytes.Buffer{}
+	assert.Nil(t, registry.Write(out), "Expected no error")
+	assert.NotContains(t, out.String(), `table="1"`, "Expected the old series to be removed")
+	assert.Contains(t, out.String(), `table_occupancy{table="2"} 2`, "Expected the new series")
+}
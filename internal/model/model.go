@@ -1,17 +1,271 @@
 package model
 
-import "time"
-
-const (
-	LIMIT  = 100
-	OFFSET = 0
+import (
+	"encoding/json"
+	"time"
 )
 
+// Model for an event, every event has its own guest list and tables
+type Event struct {
+	Id     int64     `json:"id"`     // Event ID
+	Name   string    `json:"name"`   // Name of the event
+	Date   time.Time `json:"date"`   // Time the event starts
+	Venue  string    `json:"venue"`  // Place of the event
+	Status string    `json:"status"` // ACTIVE/CANCELLED/ARCHIVED
+	Phase  string    `json:"phase"`  // PLANNING/LOCKED/OPEN/CLOSED
+}
+
+// Model for the summary of an event, generated when the event is closed
+type EventSummary struct {
+	EventId       int64     `json:"event_id"`       // Event ID
+	ClosedAt      time.Time `json:"closed_at"`      // Time the event was closed
+	InvitedGuests int       `json:"invited_guests"` // Number of guests on the guest list
+	ArrivedGuests int       `json:"arrived_guests"` // Number of guests who arrived, without the accompanying guests
+	ArrivedPeople int       `json:"arrived_people"` // Number of people who arrived including the accompanying guests
+	NoShows       int       `json:"no_shows"`       // Number of guests who never arrived without declining
+	Declined      int       `json:"declined"`       // Number of guests who declined the invitation
+	CheckedOut    int       `json:"checked_out"`    // Number of guests still at the party, checked out at the closing
+	Seats         int       `json:"seats"`          // Number of seats at the tables of the event
+}
+
+// Model for a change of the guest list after it was frozen, made by an organizer overriding the freeze
+type FrozenChange struct {
+	Id         int64     `json:"id"`          // Change ID, increasing with the time
+	EventId    int64     `json:"event_id"`    // Event ID
+	OccurredAt time.Time `json:"occurred_at"` // Time of the change
+	Actor      string    `json:"actor"`       // Principal who overrode the freeze
+	Action     string    `json:"action"`      // GUEST_ADDED/GUEST_REMOVED/GUEST_ARRIVED
+	GuestName  string    `json:"guest_name"`  // Name of the guest
+	People     int       `json:"people"`      // Number of people added or removed including the guest
+	TableId    *int      `json:"table"`       // Table of the guest
+	Reason     string    `json:"reason"`      // Reason given for the override
+}
+
+// Model for the report of the changes made to the guest list of an event after it was frozen, for the caterer
+type FreezeReport struct {
+	EventId       int64          `json:"event_id"`       // Event ID
+	FrozenSince   *time.Time     `json:"frozen_since"`   // Time the guest list is frozen from, nil if never
+	Frozen        bool           `json:"frozen"`         // Whether the guest list is frozen now
+	PeopleAdded   int            `json:"people_added"`   // Number of people added after the freeze
+	PeopleRemoved int            `json:"people_removed"` // Number of people removed after the freeze
+	Changes       []FrozenChange `json:"changes"`        // Changes in the order they were made
+}
+
+// Model for the report of the guests of an event who never arrived, whose tables were released
+type NoShowReport struct {
+	EventId       int64      `json:"event_id"`       // Event ID
+	Cutoff        *time.Time `json:"cutoff"`         // Time the guests who have not arrived are no-shows, nil if never
+	ReleasedSeats int        `json:"released_seats"` // Number of seats the no-shows reserved with their accompanying guests
+	Guests        []Guest    `json:"guests"`         // No-shows in the order they were added
+}
+
 // Model for Guests List
 type GuestsList struct {
+	Id                 int64     `json:"-"`							// Guest ID, set when the guest is added
 	Name               string    `json:"name"`  					// Guest name
 	AccompanyingGuests int       `json:"accompanying_guests"`		// Number of accompanying guests
 	TableId            *int       `json:"table,omitempty"`			// Table ID
 	Status             string    `json:"-"`							// ARRIVED/NOT_ARRIVED
 	ArrivedTime        *time.Time `json:"time_arrived,omitempty"`	// time of arrival in the party
 }
+
+// Model for a single guest record with the full party details
+type GuestDetails struct {
+	Name                      string     `json:"name"`                        // Guest name
+	TableId                   *int       `json:"table"`                       // Table ID
+	PlannedAccompanyingGuests int        `json:"planned_accompanying_guests"` // Accompanying guests on the guest list
+	ActualAccompanyingGuests  *int       `json:"actual_accompanying_guests"`  // Accompanying guests on arrival, null before
+	Status                    string     `json:"status"`                      // ARRIVED/NOT_ARRIVED/DEPARTED/NO_SHOW
+	RSVPStatus                string     `json:"rsvp_status"`                 // PENDING/ACCEPTED/DECLINED
+	ArrivedTime               *time.Time `json:"time_arrived"`                // time of arrival in the party
+	DepartedTime              *time.Time `json:"time_departed"`               // time of departure from the party
+}
+
+// Model for a guest in the version 2 of the REST API: the full record of the guest identified by its ID
+type Guest struct {
+	Id int64 `json:"id"` // Guest ID
+	GuestDetails
+}
+
+// Model for the pagination of a list in the version 2 of the REST API
+type Page struct {
+	Limit  int     `json:"limit"`  // Maximum number of items of the page
+	Offset int     `json:"offset"` // Number of items skipped
+	Total  int     `json:"total"`  // Number of items of the whole list
+	Next   *string `json:"next"`   // Path of the next page, null on the last page
+}
+
+// Model for a page of guests in the version 2 of the REST API
+type GuestPage struct {
+	Items []Guest `json:"items"` // Guests of the page, empty but never null
+	Page  Page    `json:"page"`  // Position of the page in the list
+}
+
+// Model for a page of events
+type EventPage struct {
+	Items []Event `json:"items"` // Events of the page, empty but never null
+	Page  Page    `json:"page"`  // Position of the page in the list
+}
+
+// Model for a page of the tables of an event
+type TablePage struct {
+	Items []TableOccupancy `json:"items"` // Tables of the page, empty but never null
+	Page  Page             `json:"page"`  // Position of the page in the list
+}
+
+// Model for an error response in the RFC 7807 problem details format
+type Problem struct {
+	Type          string       `json:"type"`             // URI reference identifying the problem type
+	Title         string       `json:"title"`            // Short summary of the problem type
+	Status        int          `json:"status"`           // HTTP status code
+	Detail        string       `json:"detail,omitempty"` // Explanation specific to this occurrence
+	Instance      string       `json:"instance"`         // Request path on which the problem occurred
+	Code          string       `json:"code"`             // Stable machine-readable error code
+	CorrelationId string       `json:"correlation_id"`   // ID to find the request in the logs
+	Errors        []FieldError `json:"errors,omitempty"` // Field-level validation errors
+}
+
+// Model for a validation error of a single request field
+type FieldError struct {
+	Field   string `json:"field"`   // Name of the field in the request
+	Code    string `json:"code"`    // Stable machine-readable error code
+	Message string `json:"message"` // Explanation of the error
+}
+
+// Model for a table of an event
+type Table struct {
+	TableId  int `json:"table"`    // Table ID, unique within the event
+	Capacity int `json:"capacity"` // Number of seats at the table
+}
+
+// Model for an event cloned from a previous event together with its tables and guest list
+type EventClone struct {
+	SourceId int64          `json:"source_id"` // ID of the cloned event
+	Event    Event          `json:"event"`     // New event, its ID is 0 in a preview
+	Tables   []Table        `json:"tables"`    // Tables copied to the new event
+	Guests   []GuestDetails `json:"guests"`    // Guests copied to the new event
+	Excluded []string       `json:"excluded"`  // Names of the no-shows left out of the new guest list
+}
+
+// Model for the occupancy of a table
+type TableOccupancy struct {
+	TableId  int `json:"table"`    // Table ID
+	Capacity int `json:"capacity"` // Number of seats at the table
+	Occupied int `json:"occupied"` // Number of people seated at the table
+}
+
+// Model for the statistics of the party
+type PartyStats struct {
+	InvitedGuests int              `json:"invited_guests"` // Number of guests on the guest list
+	ArrivedPeople int              `json:"arrived_people"` // Number of people at the party including the entourages
+	EmptySeats    int              `json:"seats_empty"`    // Number of empty seats at the venue
+	Tables        []TableOccupancy `json:"tables"`         // Occupancy of every table
+}
+
+// Model for the first response to a mutating request sent with an Idempotency-Key header
+type IdempotencyRecord struct {
+	Key         string              // Idempotency key given by the client
+	Fingerprint string              // SHA-256 of the method, path and body of the request
+	Status      int                 // Status of the response, 0 while the request is processed
+	Header      map[string][]string // Headers of the response
+	Body        []byte              // Body of the response
+	ExpiresAt   time.Time           // Time after which the key can be used again
+}
+
+// Model for an API key, only the hash of the key is stored
+type APIKey struct {
+	Id        int64      `json:"id"`            // API key ID
+	Name      string     `json:"name"`          // Name of the principal using the key
+	Role      string     `json:"role"`          // Role of the principal
+	Key       string     `json:"key,omitempty"` // API key, only returned once when the key is created
+	Hash      string     `json:"-"`             // SHA-256 of the API key
+	CreatedAt time.Time  `json:"created_at"`    // Time the key was created
+	RevokedAt *time.Time `json:"revoked_at"`    // Time the key was revoked, null while it is valid
+}
+
+// Model for the authenticated caller of the REST API
+type Principal struct {
+	Subject  string // Name of the API key or subject of the token
+	Role     string // Role of the principal
+	Method   string // Method of the authentication: api_key, jwt or none
+	KeyId    int64  // ID of the API key, 0 for the other methods
+	SourceIP string // IP address the principal called from
+}
+
+// Model for an entry of the audit log, the entries are only ever appended
+type AuditEntry struct {
+	Id            int64           `json:"id"`             // Audit entry ID, increasing with the time
+	OccurredAt    time.Time       `json:"occurred_at"`    // Time of the change
+	Actor         string          `json:"actor"`          // Principal who made the change
+	Role          string          `json:"role"`           // Role of the principal
+	Action        string          `json:"action"`         // Change, e.g. GUEST_ADDED
+	Subject       string          `json:"subject"`        // Guest or API key changed
+	Before        json.RawMessage `json:"before"`         // Record before the change, null if it was created
+	After         json.RawMessage `json:"after"`          // Record after the change, null if it was deleted
+	SourceIP      string          `json:"source_ip"`      // IP address the principal called from
+	CorrelationId string          `json:"correlation_id"` // ID of the request in the logs
+	PrevHash      string          `json:"prev_hash"`      // Hash of the entry before, empty before the chain
+	Hash          string          `json:"hash"`           // Hash of the entry chained to the entry before
+}
+
+// Model for the filter of the audit log, the empty fields do not filter
+type AuditFilter struct {
+	Actor   string    // Only the changes made by the principal
+	Action  string    // Only the changes of the kind
+	Subject string    // Only the changes of the guest or the API key
+	From    time.Time // Only the changes at or after the time
+	To      time.Time // Only the changes before the time
+	Limit   int       // Maximum number of entries
+	Offset  int       // Number of entries skipped
+}
+
+// Model for the result of the verification of the audit log
+type AuditVerification struct {
+	Intact     bool        `json:"intact"`      // Whether the whole chain verified
+	Verified   int         `json:"verified"`    // Number of chained entries verified up to the first break
+	Unchained  int         `json:"unchained"`   // Number of entries appended before the chain was introduced
+	HeadHash   string      `json:"head_hash"`   // Hash of the last entry, to be recorded outside of the database
+	FirstBreak *AuditBreak `json:"first_break"` // First break of the chain, null if it is intact
+}
+
+// Model for a break of the chain of the audit log
+type AuditBreak struct {
+	EntryId int64  `json:"entry_id"` // ID of the first entry which does not verify
+	Reason  string `json:"reason"`   // ENTRY_ALTERED, CHAIN_BROKEN, ENTRY_UNCHAINED or CHAIN_TRUNCATED
+	Detail  string `json:"detail"`   // Explanation of the break
+}
+
+// Model for a page of the audit log
+type AuditPage struct {
+	Items []AuditEntry `json:"items"` // Entries of the page, empty but never null
+	Page  Page         `json:"page"`  // Position of the page in the log
+}
+
+// Model for a job run by the scheduler, its definition is stored so that the schedule survives a restart
+type Job struct {
+	Name            string    `json:"name"`             // Name of the job
+	Description     string    `json:"description"`      // What the job does
+	IntervalSeconds int64     `json:"interval_seconds"` // Time between two scheduled runs
+	Paused          bool      `json:"paused"`           // Whether the scheduled runs are skipped
+	NextRunAt       time.Time `json:"next_run_at"`      // Time of the next scheduled run
+}
+
+// Model for a run of a job, claimed before the job is run so that it is run at most once
+type JobRun struct {
+	Id          int64      `json:"id"`           // Run ID
+	JobName     string     `json:"job_name"`     // Name of the job
+	Trigger     string     `json:"trigger"`      // SCHEDULED or MANUAL
+	Actor       string     `json:"actor"`        // Principal who triggered the run, system for a scheduled run
+	ScheduledAt time.Time  `json:"scheduled_at"` // Time the run was due
+	StartedAt   time.Time  `json:"started_at"`   // Time the run was claimed
+	FinishedAt  *time.Time `json:"finished_at"`  // Time the run finished, null while it is running
+	Status      string     `json:"status"`       // RUNNING, SUCCEEDED, FAILED or ABANDONED
+	Affected    int        `json:"affected"`     // Number of records changed by the run
+	Error       string     `json:"error"`        // Error of a failed run, empty otherwise
+}
+
+// Model for a page of the runs of a job
+type JobRunPage struct {
+	Items []JobRun `json:"items"` // Runs of the page, the latest first, empty but never null
+	Page  Page     `json:"page"`  // Position of the page in the history
+}
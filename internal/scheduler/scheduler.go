@@ -0,0 +1,249 @@
+package scheduler
+
+import (
+	"GuestList/internal/databse"
+	"GuestList/internal/logging"
+	"GuestList/internal/model"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Triggers of a run
+const (
+	TriggerScheduled = "SCHEDULED" // the job was due
+	TriggerManual    = "MANUAL"    // an administrator triggered the job
+)
+
+// Statuses of a run
+const (
+	StatusRunning   = "RUNNING"
+	StatusSucceeded = "SUCCEEDED"
+	StatusFailed    = "FAILED"
+	StatusAbandoned = "ABANDONED" // the run did not finish, e.g. because the process stopped, and is not repeated
+)
+
+// SystemActor is the actor of the scheduled runs
+const SystemActor = "system"
+
+// Time after the timeout of a job its unfinished run is taken as interrupted, so that a manual trigger or the next
+// scheduled run is not blocked forever
+const abandonGrace = time.Minute
+
+// Maximum length of the error of a failed run, the length of the column
+const maxErrorLength = 500
+
+// Store keeps the jobs and their runs
+type Store interface {
+	SaveJob(ctx context.Context, job *model.Job) error
+	ClaimJobRun(ctx context.Context, run *model.JobRun, abandonBefore time.Time) error
+	FinishJobRun(ctx context.Context, run *model.JobRun) error
+}
+
+// Job is a task run every interval by the scheduler
+type Job struct {
+	Name        string
+	Description string
+	Interval    time.Duration // time between two scheduled runs, at least a second
+	Timeout     time.Duration // time a run may take
+	// Run runs the job at the time now and returns the number of records it changed
+	Run func(ctx context.Context, now time.Time) (int, error)
+}
+
+// Scheduler runs the jobs when they are due. A run is claimed in the store before the job is run, so that a job is
+// run at most once even if several instances share the store or the process stops during the run.
+type Scheduler struct {
+	store  Store
+	logger *logging.Logger
+	clock  func() time.Time
+	jobs   []Job
+
+	runs sync.WaitGroup // runs in progress
+	stop chan struct{}  // closed to stop the loop
+	done chan struct{}  // closed once the loop has stopped
+}
+
+/* This function creates a scheduler without any job.
+Arguments:
+	store Store - store of the jobs and their runs
+	logger *logging.Logger - logger, the entries of a run carry the job and the run ID
+	clock func() time.Time - source of the current time
+Return:
+	*Scheduler - scheduler
+*/
+func New(store Store, logger *logging.Logger, clock func() time.Time) *Scheduler {
+	return &Scheduler{store: store, logger: logger, clock: clock}
+}
+
+/* This function adds a job to the scheduler, the jobs have to be registered before the scheduler is started.
+Arguments:
+	job Job - job with a unique name
+*/
+func (s *Scheduler) Register(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+/* This function returns a registered job.
+Arguments:
+	name string - name of the job
+Return:
+	Job - job
+	bool - false if no job has the name
+*/
+func (s *Scheduler) Job(name string) (Job, bool) {
+	for _, job := range s.jobs {
+		if job.Name == name {
+			return job, true
+		}
+	}
+	return Job{}, false
+}
+
+/* This function stores the definitions of the jobs and runs the due jobs every interval until the scheduler is
+stopped. A job stored for the first time is due at once, a stored job keeps its schedule.
+Arguments:
+	ctx context.Context - context of the start
+	interval time.Duration - time between two checks for due jobs
+Return:
+	error - any error that occurred storing the jobs, the scheduler is not started then
+*/
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) error {
+	now := s.clock().UTC()
+	for _, job := range s.jobs {
+		definition := &model.Job{Name: job.Name, Description: job.Description,
+			IntervalSeconds: int64(job.Interval / time.Second), NextRunAt: now}
+		if err := s.store.SaveJob(ctx, definition); err != nil {
+			return err
+		}
+	}
+
+	// The runs of the loop outlive the start, they log with the logger of the scheduler
+	ctx = logging.NewContext(context.Background(), s.logger)
+	s.stop, s.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.RunDue(ctx)
+			}
+		}
+	}()
+	s.logger.Info("scheduler started", logging.Int("jobs", len(s.jobs)), logging.Duration("interval_ms", interval))
+	return nil
+}
+
+// Stop stops checking for due jobs and waits for the runs in progress to finish
+func (s *Scheduler) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+	s.runs.Wait()
+}
+
+// Wait waits for the runs in progress, including the runs triggered manually, to finish
+func (s *Scheduler) Wait() {
+	s.runs.Wait()
+}
+
+/* This function runs the jobs which are due one after the other. A job which is not due, paused or still running
+is skipped.
+Arguments:
+	ctx context.Context - context carrying the logger
+*/
+func (s *Scheduler) RunDue(ctx context.Context) {
+	for _, job := range s.jobs {
+		run := &model.JobRun{JobName: job.Name, Trigger: TriggerScheduled, Actor: SystemActor}
+		err := s.claim(ctx, job, run)
+		if err == databse.ErrJobNotDue || err == databse.ErrJobRunning {
+			continue
+		}
+		if err != nil {
+			logging.FromContext(ctx).Error("job run not claimed", logging.String("job", job.Name), logging.Err(err))
+			continue
+		}
+		s.runs.Add(1)
+		s.execute(ctx, job, run)
+	}
+}
+
+/* This function runs a job at once in the background, whether it is paused or not.
+Arguments:
+	ctx context.Context - context of the request, carrying the logger. The run is not cancelled with the request
+	name string - name of the job
+	actor string - principal triggering the job
+Return:
+	*model.JobRun - claimed run, which is still running
+	error - databse.ErrJobNotFound if no job has the name, databse.ErrJobRunning if the job is still running, or
+		any other error that occurred
+*/
+func (s *Scheduler) Trigger(ctx context.Context, name string, actor string) (*model.JobRun, error) {
+	job, ok := s.Job(name)
+	if !ok {
+		return nil, databse.ErrJobNotFound
+	}
+	run := &model.JobRun{JobName: job.Name, Trigger: TriggerManual, Actor: actor}
+	if err := s.claim(ctx, job, run); err != nil {
+		return nil, err
+	}
+	// The run is copied, so that the caller gets the run as claimed
+	claimed := *run
+	s.runs.Add(1)
+	go s.execute(logging.NewContext(context.Background(), logging.FromContext(ctx)), job, run)
+	return &claimed, nil
+}
+
+// Claims a run of the job at the current time, the runs which outlived the timeout of the job are abandoned
+func (s *Scheduler) claim(ctx context.Context, job Job, run *model.JobRun) error {
+	run.StartedAt = s.clock().UTC()
+	return s.store.ClaimJobRun(ctx, run, run.StartedAt.Add(-job.Timeout-abandonGrace))
+}
+
+/* This function runs a claimed run of a job within the timeout of the job and stores its outcome. A panic of the
+job fails the run.
+Arguments:
+	ctx context.Context - context carrying the logger
+	job Job - job
+	run *model.JobRun - claimed run
+*/
+func (s *Scheduler) execute(ctx context.Context, job Job, run *model.JobRun) {
+	defer s.runs.Done()
+	logger := logging.FromContext(ctx).With(logging.String("job", job.Name), logging.Int("run_id", int(run.Id)))
+	ctx = logging.NewContext(ctx, logger)
+
+	affected, err := s.call(ctx, job, run.StartedAt)
+	finished := s.clock().UTC()
+	run.FinishedAt, run.Affected, run.Status = &finished, affected, StatusSucceeded
+	if err != nil {
+		run.Status, run.Error = StatusFailed, err.Error()
+		if len(run.Error) > maxErrorLength {
+			run.Error = run.Error[:maxErrorLength]
+		}
+		logger.Error("job run failed", logging.String("trigger", run.Trigger), logging.Err(err))
+	} else {
+		logger.Info("job run finished", logging.String("trigger", run.Trigger), logging.Int("affected", affected),
+			logging.Duration("duration_ms", finished.Sub(run.StartedAt)))
+	}
+	if err := s.store.FinishJobRun(ctx, run); err != nil {
+		logger.Error("job run not finished", logging.Err(err))
+	}
+}
+
+// Calls the job within its timeout and turns a panic into an error
+func (s *Scheduler) call(ctx context.Context, job Job, now time.Time) (affected int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			affected, err = 0, fmt.Errorf("job panicked: %v", recovered)
+		}
+	}()
+	return job.Run(ctx, now)
+}
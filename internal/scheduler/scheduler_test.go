@@ -0,0 +1,231 @@
+package scheduler
+
+import (
+	"GuestList/internal/databse"
+	"GuestList/internal/logging"
+	"GuestList/internal/model"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+
+// fakeClock is a clock which only moves when the test advances it
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// fakeStore keeps the jobs and their runs in memory, claiming a run the way the database does
+type fakeStore struct {
+	mutex sync.Mutex
+	jobs  map[string]*model.Job
+	runs  []*model.JobRun
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{jobs: map[string]*model.Job{}}
+}
+
+func (f *fakeStore) SaveJob(ctx context.Context, job *model.Job) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if stored, ok := f.jobs[job.Name]; ok {
+		stored.Description, stored.IntervalSeconds = job.Description, job.IntervalSeconds
+		return nil
+	}
+	saved := *job
+	f.jobs[job.Name] = &saved
+	return nil
+}
+
+func (f *fakeStore) ClaimJobRun(ctx context.Context, run *model.JobRun, abandonBefore time.Time) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	job, ok := f.jobs[run.JobName]
+	if !ok {
+		return databse.ErrJobNotFound
+	}
+	run.ScheduledAt = run.StartedAt
+	if run.Trigger == TriggerScheduled {
+		if job.Paused || job.NextRunAt.After(run.StartedAt) {
+			return databse.ErrJobNotDue
+		}
+		run.ScheduledAt = job.NextRunAt
+	}
+	for _, other := range f.runs {
+		if other.JobName == run.JobName && other.Status == StatusRunning {
+			if !other.StartedAt.Before(abandonBefore) {
+				return databse.ErrJobRunning
+			}
+			other.Status, other.FinishedAt = StatusAbandoned, &run.StartedAt
+		}
+	}
+	if run.Trigger == TriggerScheduled {
+		interval := time.Duration(job.IntervalSeconds) * time.Second
+		job.NextRunAt = job.NextRunAt.Add(interval)
+		if !job.NextRunAt.After(run.StartedAt) {
+			job.NextRunAt = run.StartedAt.Add(interval)
+		}
+	}
+	run.Id, run.Status = int64(len(f.runs)+1), StatusRunning
+	stored := *run
+	f.runs = append(f.runs, &stored)
+	return nil
+}
+
+func (f *fakeStore) FinishJobRun(ctx context.Context, run *model.JobRun) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if stored := f.runs[run.Id-1]; stored.Status == StatusRunning {
+		*stored = *run
+	}
+	return nil
+}
+
+// Returns a copy of the stored run
+func (f *fakeStore) run(id int64) model.JobRun {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return *f.runs[id-1]
+}
+
+// Creates a scheduler with a job counting its runs, the runs are returned in the order they were run
+func newCountingScheduler(store *fakeStore, clock *fakeClock) (*Scheduler, *[]time.Time) {
+	var runs []time.Time
+	s := New(store, logging.Discard(), clock.Now)
+	s.Register(Job{Name: "count", Description: "Counts its runs", Interval: time.Hour, Timeout: 5 * time.Minute,
+		Run: func(ctx context.Context, now time.Time) (int, error) {
+			runs = append(runs, now)
+			return len(runs), nil
+		}})
+	return s, &runs
+}
+
+// Test that a job is run once when it is due and that the missed runs are skipped
+func TestSchedulerRunDue(t *testing.T) {
+	store, clock := newFakeStore(), &fakeClock{now: testNow}
+	s, runs := newCountingScheduler(store, clock)
+	assert.Nil(t, s.Start(context.Background(), time.Hour), "Expected the scheduler to start")
+	defer s.Stop()
+	assert.Equal(t, model.Job{Name: "count", Description: "Counts its runs", IntervalSeconds: 3600,
+		NextRunAt: testNow}, *store.jobs["count"], "Expected the job to be stored")
+
+	s.RunDue(context.Background())
+	s.RunDue(context.Background())
+	assert.Equal(t, []time.Time{testNow}, *runs, "Expected the new job to be run once at once")
+	clock.Advance(59 * time.Minute)
+	s.RunDue(context.Background())
+	assert.Len(t, *runs, 1, "Expected the job not to be run before the interval")
+
+	clock.Advance(3*time.Hour + 31*time.Minute)
+	s.RunDue(context.Background())
+	s.RunDue(context.Background())
+	assert.Len(t, *runs, 2, "Expected the missed runs to be skipped")
+	run := store.run(2)
+	assert.Equal(t, testNow.Add(time.Hour), run.ScheduledAt, "Expected the run to be scheduled at the first miss")
+	assert.Equal(t, testNow.Add(4*time.Hour+30*time.Minute), run.StartedAt, "Expected the run to start now")
+	assert.Equal(t, StatusSucceeded, run.Status, "Expected the run to succeed")
+	assert.Equal(t, 2, run.Affected, "Expected the result of the run")
+	assert.Equal(t, SystemActor, run.Actor, "Expected the system to run the job")
+	assert.Equal(t, testNow.Add(5*time.Hour+30*time.Minute), store.jobs["count"].NextRunAt,
+		"Expected the next run an interval later")
+}
+
+// Test that a run interrupted by a restart is not repeated and that its job is run again on its next schedule
+func TestSchedulerAtMostOnce(t *testing.T) {
+	store, clock := newFakeStore(), &fakeClock{now: testNow}
+	store.jobs["count"] = &model.Job{Name: "count", IntervalSeconds: 3600, NextRunAt: testNow}
+	// The previous process claimed the run and stopped before it finished
+	interrupted := &model.JobRun{JobName: "count", Trigger: TriggerScheduled, Actor: SystemActor, StartedAt: testNow}
+	assert.Nil(t, store.ClaimJobRun(context.Background(), interrupted, testNow), "Expected the run to be claimed")
+
+	s, runs := newCountingScheduler(store, clock)
+	assert.Nil(t, s.Start(context.Background(), time.Hour), "Expected the scheduler to start")
+	defer s.Stop()
+	clock.Advance(time.Minute)
+	s.RunDue(context.Background())
+	_, err := s.Trigger(context.Background(), "count", "alice")
+	assert.Equal(t, databse.ErrJobRunning, err, "Expected the job to be running")
+	assert.Empty(t, *runs, "Expected the interrupted run not to be repeated")
+
+	clock.Advance(59 * time.Minute)
+	s.RunDue(context.Background())
+	assert.Len(t, *runs, 1, "Expected the job to be run on its next schedule")
+	assert.Equal(t, StatusAbandoned, store.run(1).Status, "Expected the interrupted run to be abandoned")
+	assert.Equal(t, StatusSucceeded, store.run(2).Status, "Expected the next run to succeed")
+}
+
+// Test that a paused job is only run when triggered, and that a job is not triggered twice at once
+func TestSchedulerTrigger(t *testing.T) {
+	store, clock := newFakeStore(), &fakeClock{now: testNow}
+	release := make(chan struct{})
+	s := New(store, logging.Discard(), clock.Now)
+	s.Register(Job{Name: "slow", Interval: time.Hour, Timeout: time.Minute,
+		Run: func(ctx context.Context, now time.Time) (int, error) {
+			<-release
+			return 3, nil
+		}})
+	assert.Nil(t, s.Start(context.Background(), time.Hour), "Expected the scheduler to start")
+	defer s.Stop()
+	store.jobs["slow"].Paused = true
+	s.RunDue(context.Background())
+	assert.Empty(t, store.runs, "Expected the paused job to be skipped")
+
+	run, err := s.Trigger(context.Background(), "slow", "alice")
+	assert.Nil(t, err, "Expected the job to be triggered")
+	assert.Equal(t, model.JobRun{Id: 1, JobName: "slow", Trigger: TriggerManual, Actor: "alice", ScheduledAt: testNow,
+		StartedAt: testNow, Status: StatusRunning}, *run, "Expected the claimed run")
+	_, err = s.Trigger(context.Background(), "slow", "bob")
+	assert.Equal(t, databse.ErrJobRunning, err, "Expected the running job not to be triggered again")
+	_, err = s.Trigger(context.Background(), "unknown", "alice")
+	assert.Equal(t, databse.ErrJobNotFound, err, "Expected an unknown job")
+
+	close(release)
+	s.Wait()
+	run2 := store.run(1)
+	assert.Equal(t, StatusSucceeded, run2.Status, "Expected the triggered run to succeed")
+	assert.Equal(t, 3, run2.Affected, "Expected the result of the run")
+	assert.Equal(t, testNow, store.jobs["slow"].NextRunAt, "Expected the schedule to be kept")
+}
+
+// Test that an error or a panic of a job fails its run
+func TestSchedulerFailedRun(t *testing.T) {
+	store, clock := newFakeStore(), &fakeClock{now: testNow}
+	s := New(store, logging.Discard(), clock.Now)
+	s.Register(Job{Name: "failing", Interval: time.Hour, Timeout: time.Minute,
+		Run: func(ctx context.Context, now time.Time) (int, error) {
+			return 0, errors.New("connection refused")
+		}})
+	s.Register(Job{Name: "panicking", Interval: time.Hour, Timeout: time.Minute,
+		Run: func(ctx context.Context, now time.Time) (int, error) {
+			panic("nil map")
+		}})
+	assert.Nil(t, s.Start(context.Background(), time.Hour), "Expected the scheduler to start")
+	defer s.Stop()
+
+	s.RunDue(context.Background())
+
+	failed, panicked := store.run(1), store.run(2)
+	assert.Equal(t, StatusFailed, failed.Status, "Expected the run to fail")
+	assert.Equal(t, "connection refused", failed.Error, "Expected the error of the job")
+	assert.Equal(t, testNow, *failed.FinishedAt, "Expected the time the run finished")
+	assert.Equal(t, StatusFailed, panicked.Status, "Expected the panic to fail the run")
+	assert.Equal(t, "job panicked: nil map", panicked.Error, "Expected the panic to be reported")
+}
@@ -0,0 +1,280 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header carrying the trace context, see https://www.w3.org/TR/trace-context/
+const TraceparentHeader = "traceparent"
+
+// Kind of a span
+const (
+	KindServer   = "server"   // handling of an incoming request
+	KindClient   = "client"   // call to the database
+	KindInternal = "internal" // any other operation
+)
+
+// TraceId identifies a trace
+type TraceId [16]byte
+
+// SpanId identifies a span within a trace
+type SpanId [8]byte
+
+func (id TraceId) String() string { return hex.EncodeToString(id[:]) }
+
+func (id SpanId) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext is the part of a span propagated to the other services
+type SpanContext struct {
+	TraceId TraceId
+	SpanId  SpanId
+	Sampled bool
+}
+
+// IsValid reports whether the trace and the span id are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceId != TraceId{} && sc.SpanId != SpanId{}
+}
+
+// Traceparent formats the span context as the value of the traceparent header
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceId.String() + "-" + sc.SpanId.String() + "-" + flags
+}
+
+/* This function parses the value of the traceparent header.
+Arguments:
+	value string - value of the header, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+Return:
+	SpanContext - span context of the caller
+	bool - false if the value is not a valid traceparent
+*/
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	// Later versions may append fields, version ff is invalid and the ids are lowercase
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) || value != strings.ToLower(value) {
+		return sc, false
+	}
+	version, errVersion := hex.DecodeString(parts[0])
+	traceId, errTrace := hex.DecodeString(parts[1])
+	spanId, errSpan := hex.DecodeString(parts[2])
+	flags, errFlags := hex.DecodeString(parts[3])
+	if errVersion != nil || errTrace != nil || errSpan != nil || errFlags != nil || len(version) != 1 ||
+		len(traceId) != len(sc.TraceId) || len(spanId) != len(sc.SpanId) || len(flags) != 1 {
+		return sc, false
+	}
+	copy(sc.TraceId[:], traceId)
+	copy(sc.SpanId[:], spanId)
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// SpanData is a finished span as exported
+type SpanData struct {
+	TraceId       string                 `json:"trace_id"`
+	SpanId        string                 `json:"span_id"`
+	ParentSpanId  string                 `json:"parent_span_id,omitempty"`
+	Name          string                 `json:"name"`
+	Kind          string                 `json:"kind"`
+	Start         time.Time              `json:"start"`
+	End           time.Time              `json:"end"`
+	DurationMs    float64                `json:"duration_ms"`
+	Status        string                 `json:"status"`
+	StatusMessage string                 `json:"status_message,omitempty"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Exporter receives the finished spans
+type Exporter interface {
+	ExportSpan(span SpanData)
+}
+
+// WriterExporter writes the finished spans as JSON lines, e.g. to stdout or a file
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter creates an exporter writing to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// ExportSpan writes the span as a JSON line
+func (e *WriterExporter) ExportSpan(span SpanData) {
+	line, err := json.Marshal(span)
+	if err != nil {
+		line, _ = json.Marshal(SpanData{TraceId: span.TraceId, SpanId: span.SpanId, Name: span.Name,
+			Status: "error", StatusMessage: fmt.Sprintf("span not encodable: %v", err)})
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, _ = e.w.Write(append(line, '\n'))
+}
+
+// Tracer creates the spans and hands the finished ones to the exporter
+type Tracer struct {
+	exporter Exporter
+	clock    func() time.Time
+}
+
+/* This function creates a tracer.
+Arguments:
+	exporter Exporter - receiver of the finished spans, or nil to propagate the trace context without recording
+	clock func() time.Time - source of the current time
+Return:
+	*Tracer - tracer
+*/
+func NewTracer(exporter Exporter, clock func() time.Time) *Tracer {
+	return &Tracer{exporter: exporter, clock: clock}
+}
+
+// Span is an operation within a trace
+type Span struct {
+	tracer  *Tracer
+	context SpanContext
+	parent  SpanId
+	name    string
+	kind    string
+	start   time.Time
+
+	mu         sync.Mutex
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+// Context returns the span context to be propagated
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetAttribute adds an attribute to the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]interface{})
+	}
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed, a nil error is ignored
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// End finishes the span and exports it if the trace is sampled
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		TraceId:    s.context.TraceId.String(),
+		SpanId:     s.context.SpanId.String(),
+		Name:       s.name,
+		Kind:       s.kind,
+		Start:      s.start,
+		End:        s.tracer.clock(),
+		Status:     "ok",
+		Attributes: s.attributes,
+	}
+	if s.parent != (SpanId{}) {
+		data.ParentSpanId = s.parent.String()
+	}
+	if s.err != nil {
+		data.Status, data.StatusMessage = "error", s.err.Error()
+	}
+	s.mu.Unlock()
+
+	if s.tracer.exporter == nil || !s.context.Sampled {
+		return
+	}
+	data.DurationMs = float64(data.End.Sub(data.Start)) / float64(time.Millisecond)
+	s.tracer.exporter.ExportSpan(data)
+}
+
+// Keys of the span and the remote span context in a context
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithRemote returns a context carrying the span context received from the caller
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanFromContext returns the current span, or nil if the context carries no span
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+/* This function starts a span. The span is a child of the current span of the context, or of the span context
+received from the caller, otherwise it starts a new trace.
+Arguments:
+	ctx context.Context - context of the operation
+	name string - name of the operation
+	kind string - kind of the span
+Return:
+	context.Context - context carrying the new span
+	*Span - span to be ended by the caller
+*/
+func (t *Tracer) Start(ctx context.Context, name string, kind string) (context.Context, *Span) {
+	span := &Span{tracer: t, name: name, kind: kind, start: t.clock(), context: SpanContext{Sampled: true}}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.context, span.parent = parent.context, parent.context.SpanId
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok && remote.IsValid() {
+		span.context, span.parent = remote, remote.SpanId
+	} else {
+		_, _ = rand.Read(span.context.TraceId[:])
+	}
+	_, _ = rand.Read(span.context.SpanId[:])
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+/* This function starts a child of the current span of the context with the same tracer. Without a current span
+nothing is recorded and the returned span is nil, which is safe to use.
+Arguments:
+	ctx context.Context - context of the operation
+	name string - name of the operation
+	kind string - kind of the span
+Return:
+	context.Context - context carrying the new span
+	*Span - span to be ended by the caller
+*/
+func Start(ctx context.Context, name string, kind string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind)
+}
@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Collects the exported spans
+type recorder struct {
+	spans []SpanData
+}
+
+func (r *recorder) ExportSpan(span SpanData) {
+	r.spans = append(r.spans, span)
+}
+
+// Returns a clock which advances by a millisecond on every call
+func stepClock() func() time.Time {
+	now := time.Date(2020, 12, 31, 20, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+}
+
+// Test parsing the traceparent header
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01", false},
+		{"not a traceparent", false},
+	}
+	for _, test := range tests {
+		sc, ok := ParseTraceparent(test.value)
+		assert.Equal(t, test.valid, ok, "Expected validity of %s", test.value)
+		if ok && strings.HasPrefix(test.value, "00-") {
+			assert.Equal(t, test.value, sc.Traceparent(), "Expected the same traceparent")
+		}
+	}
+}
+
+// Test the parent of the spans and the propagation of the trace
+func TestTracer(t *testing.T) {
+	exporter := &recorder{}
+	tracer := NewTracer(exporter, stepClock())
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, server := tracer.Start(ContextWithRemote(context.Background(), remote), "PUT /guests/{name}", KindServer)
+	server.SetAttribute("http.status_code", 200)
+	_, query := Start(ctx, "GetTableCapacity", KindClient)
+	query.SetError(errors.New("connection reset"))
+	query.End()
+	server.End()
+	server.End()
+
+	assert.Len(t, exporter.spans, 2, "Expected two spans exported once")
+	child, parent := exporter.spans[0], exporter.spans[1]
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", parent.TraceId, "Expected the trace of the caller")
+	assert.Equal(t, "00f067aa0ba902b7", parent.ParentSpanId, "Expected the span of the caller as parent")
+	assert.Equal(t, parent.TraceId, child.TraceId, "Expected the same trace")
+	assert.Equal(t, parent.SpanId, child.ParentSpanId, "Expected the server span as parent")
+	assert.Equal(t, "error", child.Status, "Expected failed query")
+	assert.Equal(t, "connection reset", child.StatusMessage, "Expected the error")
+	assert.Equal(t, "ok", parent.Status, "Expected successful request")
+	assert.Equal(t, 200, parent.Attributes["http.status_code"], "Expected the attribute")
+	assert.Equal(t, 3.0, parent.DurationMs, "Expected the duration of the request")
+}
+
+// Test the spans which are not recorded
+func TestTracerNotRecording(t *testing.T) {
+	exporter := &recorder{}
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, span := NewTracer(exporter, stepClock()).Start(ContextWithRemote(context.Background(), remote), "GET /guests",
+		KindServer)
+	span.End()
+	assert.Empty(t, exporter.spans, "Expected no spans of a trace which is not sampled")
+	assert.Equal(t, remote.TraceId, SpanFromContext(ctx).Context().TraceId, "Expected the trace to be propagated")
+
+	ctx, span = Start(context.Background(), "GetTableCapacity", KindClient)
+	assert.Nil(t, span, "Expected no span without a current span")
+	span.SetAttribute("db.system", "mysql")
+	span.End()
+	assert.Equal(t, context.Background(), ctx, "Expected the same context")
+}
+
+// Test writing the spans as JSON lines
+func TestWriterExporter(t *testing.T) {
+	out := &bytes.Buffer{}
+	_, span := NewTracer(NewWriterExporter(out), stepClock()).Start(context.Background(), "GET /seats_empty",
+		KindServer)
+	span.End()
+
+	var data SpanData
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &data), "Expected a JSON line")
+	assert.Equal(t, "GET /seats_empty", data.Name, "Expected the name of the span")
+	assert.Equal(t, "server", data.Kind, "Expected the kind of the span")
+	assert.Empty(t, data.ParentSpanId, "Expected a root span")
+	assert.Len(t, data.TraceId, 32, "Expected a new trace")
+}
@@ -0,0 +1,27 @@
+package version
+
+import "runtime"
+
+// Build information, set at build time with
+// go build -ldflags "-X GuestList/internal/version.Version=1.2.0 -X GuestList/internal/version.Commit=$(git rev-parse HEAD)"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info is the build information of the service
+type Info struct {
+	Version   string `json:"version"`    // Version of the service
+	Commit    string `json:"commit"`     // Git commit the service was built from
+	BuildDate string `json:"build_date"` // Time the service was built
+	GoVersion string `json:"go_version"` // Version of Go the service was built with
+}
+
+/* This function returns the build information of the service.
+Return:
+	Info - build information
+*/
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, BuildDate: BuildDate, GoVersion: runtime.Version()}
+}
@@ -2,64 +2,162 @@ package main
 
 import (
 	"GuestList/config"
+	"GuestList/internal/audit"
 	"GuestList/internal/common"
 	"GuestList/internal/databse"
-	"fmt"
-	"github.com/gorilla/mux"
-	"log"
+	"GuestList/internal/logging"
+	"GuestList/internal/tracing"
+	"context"
+	"encoding/json"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	// Establish a connection with a DB
-	db, err := databse.ConnectDB()
+	if len(os.Args) > 1 && os.Args[1] == "verify-audit-log" {
+		os.Exit(verifyAuditLog(os.Args[2:]))
+	}
 
+	// Load the configuration from the config file, environment and flags
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
 	if err != nil {
-		log.Fatal(fmt.Sprintf("Not able to connect to DB: %v", err))
+		logging.Default().Error("not able to load the configuration", logging.Err(err))
+		os.Exit(2)
+	}
+	logger := logging.New(os.Stderr, cfg.LogLevel, cfg.LogRedactNames, cfg.LogRedactKey)
+	logging.SetDefault(logger)
+	if !cfg.AuthEnabled {
+		logger.Warn("AUTHENTICATION IS DISABLED: every caller is an administrator who can change and delete the " +
+			"guest lists and the API keys, never run with auth_insecure_dev outside of local development")
 	}
 
-	// Creates a new instance of a mux router
-	router := mux.NewRouter().StrictSlash(true)
+	// Establish a connection with a DB
+	db, err := databse.ConnectDB(cfg.DatabaseDSN)
 
-	// Set-up handlers for different requests
-	// Add a guest to the guest list
-	router.HandleFunc("/guest_list/{name:[a-zA-Z\\+]+}", func(w http.ResponseWriter, r *http.Request) {
-		common.AddGuest(w, r, db)
-	}).Methods("POST")
+	if err != nil {
+		logger.Error("not able to connect to the DB", logging.Err(err))
+		os.Exit(1)
+	}
 
-	// Delete a guest from the guest list
-	router.HandleFunc("/guest_list/{name:[a-zA-Z\\+]+}", func(w http.ResponseWriter, r *http.Request) {
-		common.DeleteGuest(w, r, db)
-	}).Methods("DELETE")
+	// Export the spans to stdout or append them to the trace file
+	var exporter tracing.Exporter
+	var traceFile *os.File
+	switch cfg.TraceOutput {
+	case "":
+	case "stdout":
+		exporter = tracing.NewWriterExporter(os.Stdout)
+	default:
+		traceFile, err = os.OpenFile(cfg.TraceOutput, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			logger.Error("not able to open the trace file", logging.Err(err))
+			os.Exit(1)
+		}
+		exporter = tracing.NewWriterExporter(traceFile)
+	}
 
-	// Get the list of guests
-	router.HandleFunc("/guest_list", func(w http.ResponseWriter, r *http.Request) {
-		common.GetGuestList(w, r, db)
-	}).Methods("GET")
+	// Set-up the server with its dependencies
+	server := common.NewServer(databse.NewMySQLStore(db), cfg, logger, tracing.NewTracer(exporter, time.Now),
+		time.Now)
+	httpServer := &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           server,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          logger.StdLogger(logging.LevelWarn),
+	}
 
-	// Generate an invitation HTML file for the guest
-	router.HandleFunc("/invitation/{name:[a-zA-Z\\+]+}", func(w http.ResponseWriter, r *http.Request) {
-		common.GenerateInvitation(w, r, db)}).Methods("GET")
+	// Run the scheduled jobs in the background, their schedule is kept in the DB
+	if err := server.StartJobs(); err != nil {
+		logger.Error("not able to start the scheduled jobs", logging.Err(err))
+		os.Exit(1)
+	}
 
-	// Update the status of the guest upon arrival
-	router.HandleFunc("/guests/{name:[a-zA-Z\\+]+}", func(w http.ResponseWriter, r *http.Request) {
-		common.UpdateArrivedGuest(w, r, db)
-	}).Methods("PUT")
+	// Serve the requests until the process is asked to stop
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("listening", logging.String("address", cfg.ListenAddr),
+			logging.Bool("tls", cfg.TLSCertFile != ""))
+		if cfg.TLSCertFile != "" {
+			serveErr <- httpServer.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			serveErr <- httpServer.ListenAndServe()
+		}
+	}()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
-	// Delete the guest upon departure
-	router.HandleFunc("/guests/{name:[a-zA-Z\\+]+}", func(w http.ResponseWriter, r *http.Request) {
-		common.DeleteGuest(w, r, db)
-	}).Methods("DELETE")
+	exitCode := 0
+	select {
+	case err := <-serveErr:
+		logger.Error("server stopped", logging.Err(err))
+		exitCode = 1
+	case sig := <-stop:
+		// Report not ready and give the load balancer time to stop routing requests to the service
+		logger.Info("shutting down", logging.String("signal", sig.String()))
+		server.StartShutdown()
+		time.Sleep(cfg.ShutdownDelay)
 
-	// List guests which have arrived at the party
-	router.HandleFunc("/guests", func(w http.ResponseWriter, r *http.Request) {
-		common.GetArrivedGuests(w, r, db)
-	}).Methods("GET")
+		// Stop accepting new connections and let the in-flight requests finish within the deadline
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		if err := httpServer.Shutdown(ctx); err != nil {
+			logger.Error("requests did not finish in time", logging.Duration("shutdown_timeout_ms", cfg.ShutdownTimeout),
+				logging.Err(err))
+			exitCode = 1
+		}
+		cancel()
+	}
 
-	// Get the number of empty seats
-	router.HandleFunc("/seats_empty", func(w http.ResponseWriter, r *http.Request) {
-		common.CountEmptySeats(w, db)
-	}).Methods("GET")
+	// Let the runs of the jobs in progress finish, then close the DB pool once no request uses it
+	server.StopJobs()
+	if err := db.Close(); err != nil {
+		logger.Error("not able to close the DB", logging.Err(err))
+		exitCode = 1
+	}
+	if traceFile != nil {
+		if err := traceFile.Close(); err != nil {
+			logger.Error("not able to close the trace file", logging.Err(err))
+			exitCode = 1
+		}
+	}
+	logger.Info("server stopped")
+	os.Exit(exitCode)
+}
+
+/* This function verifies the hash chain of the audit log and prints the result as JSON.
+Arguments:
+	args []string - flags of the configuration
+Return:
+	int - exit code, 0 if the chain is intact and 1 if it is broken or could not be verified
+*/
+func verifyAuditLog(args []string) int {
+	cfg, err := config.Load(args, os.Getenv)
+	if err != nil {
+		logging.Default().Error("not able to load the configuration", logging.Err(err))
+		return 2
+	}
+	logger := logging.New(os.Stderr, cfg.LogLevel, cfg.LogRedactNames, cfg.LogRedactKey)
+	db, err := databse.ConnectDB(cfg.DatabaseDSN)
+	if err != nil {
+		logger.Error("not able to connect to the DB", logging.Err(err))
+		return 1
+	}
+	defer db.Close()
 
-	log.Fatal(http.ListenAndServe(config.API_PORT, router))
+	result, err := audit.Verify(context.Background(), databse.NewMySQLStore(db), audit.VerifyPageSize)
+	if err != nil {
+		logger.Error("not able to read the audit log", logging.Err(err))
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+	if !result.Intact {
+		return 1
+	}
+	return 0
 }
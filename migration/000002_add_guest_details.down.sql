@@ -0,0 +1,3 @@
+ALTER TABLE guest_list
+   DROP COLUMN departed_time,
+   DROP COLUMN rsvp_status;
@@ -0,0 +1,3 @@
+ALTER TABLE guest_list
+   ADD COLUMN rsvp_status VARCHAR(20) NOT NULL DEFAULT 'PENDING',
+   ADD COLUMN departed_time DATETIME NULL;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys(
+   idempotency_key VARCHAR(255) NOT NULL,
+   fingerprint CHAR(64) NOT NULL,
+   status INT NOT NULL DEFAULT 0,
+   header TEXT NULL,
+   body MEDIUMBLOB NULL,
+   expires_at DATETIME NOT NULL,
+   PRIMARY KEY (idempotency_key),
+   INDEX (expires_at)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS api_keys(
+   key_id serial,
+   name VARCHAR(100) NOT NULL,
+   role VARCHAR(20) NOT NULL,
+   key_hash CHAR(64) UNIQUE NOT NULL,
+   created_at DATETIME NOT NULL,
+   revoked_at DATETIME NULL,
+   PRIMARY KEY (key_id)
+);
@@ -0,0 +1 @@
+UPDATE api_keys SET role = 'user' WHERE role IN ('organizer', 'door', 'viewer');
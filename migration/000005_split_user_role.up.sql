@@ -0,0 +1,2 @@
+-- The keys of the former role user are only trusted to read, an administrator issues new keys to the organizers
+UPDATE api_keys SET role = 'viewer' WHERE role = 'user';
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS audit_log(
+   audit_id serial,
+   occurred_at DATETIME(6) NOT NULL,
+   actor VARCHAR(100) NOT NULL,
+   role VARCHAR(20) NOT NULL,
+   action VARCHAR(30) NOT NULL,
+   subject VARCHAR(100) NOT NULL,
+   before_value TEXT NULL,
+   after_value TEXT NULL,
+   source_ip VARCHAR(45) NOT NULL,
+   correlation_id VARCHAR(255) NOT NULL,
+   PRIMARY KEY (audit_id),
+   INDEX (occurred_at),
+   INDEX (actor),
+   INDEX (subject)
+);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log FOR EACH ROW
+   SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log FOR EACH ROW
+   SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS audit_chain;
+ALTER TABLE audit_log
+   DROP COLUMN entry_hash,
+   DROP COLUMN prev_hash;
@@ -0,0 +1,11 @@
+ALTER TABLE audit_log
+   ADD COLUMN prev_hash CHAR(64) NULL,
+   ADD COLUMN entry_hash CHAR(64) NULL;
+
+CREATE TABLE IF NOT EXISTS audit_chain(
+   chain_id INT NOT NULL,
+   head_hash CHAR(64) NOT NULL,
+   PRIMARY KEY (chain_id)
+);
+
+INSERT INTO audit_chain(chain_id, head_hash) VALUES (1, REPEAT('0', 64));
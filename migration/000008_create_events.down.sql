@@ -0,0 +1,22 @@
+DELETE FROM guest_list WHERE event_id <> 1;
+DELETE FROM tables WHERE event_id <> 1;
+
+ALTER TABLE guest_list
+   DROP FOREIGN KEY guest_list_table_fk,
+   DROP FOREIGN KEY guest_list_event_fk,
+   DROP INDEX guest_list_event_name,
+   ADD UNIQUE INDEX guest_name (guest_name),
+   DROP COLUMN event_id;
+
+ALTER TABLE tables
+   DROP FOREIGN KEY tables_event_fk,
+   DROP PRIMARY KEY,
+   DROP COLUMN event_id,
+   MODIFY COLUMN table_id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+   ADD PRIMARY KEY (table_id),
+   ADD UNIQUE INDEX table_id (table_id);
+
+ALTER TABLE guest_list
+   ADD CONSTRAINT guest_list_ibfk_1 FOREIGN KEY (table_id) REFERENCES tables(table_id);
+
+DROP TABLE IF EXISTS events;
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS events(
+   event_id serial,
+   name VARCHAR(100) NOT NULL,
+   event_date DATETIME NOT NULL,
+   venue VARCHAR(200) NOT NULL DEFAULT '',
+   status VARCHAR(20) NOT NULL,
+   PRIMARY KEY (event_id),
+   INDEX (event_date)
+);
+
+-- The date of the event is not known, it is set by an organizer after the upgrade. Until then the event is dated in the
+-- far future so that its guest list is not frozen and its guests are not marked as no-shows.
+INSERT INTO events(event_id, name, event_date, venue, status) VALUES (1, 'Year end party', '9999-12-31 00:00:00', '',
+   'ACTIVE');
+
+ALTER TABLE guest_list
+   DROP FOREIGN KEY guest_list_ibfk_1;
+
+ALTER TABLE tables
+   ADD COLUMN event_id BIGINT UNSIGNED NOT NULL DEFAULT 1 FIRST,
+   MODIFY COLUMN table_id BIGINT UNSIGNED NOT NULL,
+   DROP PRIMARY KEY,
+   DROP INDEX table_id,
+   ADD PRIMARY KEY (event_id, table_id),
+   ADD CONSTRAINT tables_event_fk FOREIGN KEY (event_id) REFERENCES events(event_id);
+
+ALTER TABLE guest_list
+   ADD COLUMN event_id BIGINT UNSIGNED NOT NULL DEFAULT 1 AFTER guest_id,
+   DROP INDEX guest_name,
+   ADD UNIQUE INDEX guest_list_event_name (event_id, guest_name),
+   ADD CONSTRAINT guest_list_event_fk FOREIGN KEY (event_id) REFERENCES events(event_id),
+   ADD CONSTRAINT guest_list_table_fk FOREIGN KEY (event_id, table_id) REFERENCES tables(event_id, table_id);
+
+ALTER TABLE tables ALTER COLUMN event_id DROP DEFAULT;
+ALTER TABLE guest_list ALTER COLUMN event_id DROP DEFAULT;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS event_summaries;
+ALTER TABLE events
+   DROP COLUMN phase;
@@ -0,0 +1,20 @@
+ALTER TABLE events
+   ADD COLUMN phase VARCHAR(20) NOT NULL DEFAULT 'PLANNING';
+
+-- The events were not gated before, the doors of an event where a guest has already arrived are open
+UPDATE events e SET phase = 'OPEN'
+   WHERE EXISTS (SELECT 1 FROM guest_list g WHERE g.event_id = e.event_id AND g.status <> 'NOT_ARRIVED');
+
+CREATE TABLE IF NOT EXISTS event_summaries(
+   event_id BIGINT UNSIGNED NOT NULL,
+   closed_at DATETIME NOT NULL,
+   invited_guests INT NOT NULL,
+   arrived_guests INT NOT NULL,
+   arrived_people INT NOT NULL,
+   no_shows INT NOT NULL,
+   declined INT NOT NULL,
+   checked_out INT NOT NULL,
+   seats INT NOT NULL,
+   PRIMARY KEY (event_id),
+   FOREIGN KEY (event_id) REFERENCES events(event_id)
+);
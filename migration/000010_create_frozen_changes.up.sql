@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS frozen_changes(
+   change_id serial,
+   event_id BIGINT UNSIGNED NOT NULL,
+   occurred_at DATETIME NOT NULL,
+   actor VARCHAR(100) NOT NULL,
+   action VARCHAR(30) NOT NULL,
+   guest_name VARCHAR(50) NOT NULL,
+   people INT NOT NULL,
+   table_id BIGINT UNSIGNED NULL,
+   reason VARCHAR(500) NOT NULL,
+   PRIMARY KEY (change_id),
+   INDEX (event_id, occurred_at),
+   FOREIGN KEY (event_id) REFERENCES events(event_id)
+);
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS jobs(
+   job_name VARCHAR(50) NOT NULL,
+   description VARCHAR(200) NOT NULL,
+   interval_seconds BIGINT NOT NULL,
+   paused BOOLEAN NOT NULL DEFAULT FALSE,
+   next_run_at DATETIME NOT NULL,
+   PRIMARY KEY (job_name)
+);
+
+CREATE TABLE IF NOT EXISTS job_runs(
+   run_id serial,
+   job_name VARCHAR(50) NOT NULL,
+   run_trigger VARCHAR(10) NOT NULL,
+   actor VARCHAR(100) NOT NULL,
+   scheduled_at DATETIME NOT NULL,
+   started_at DATETIME NOT NULL,
+   finished_at DATETIME NULL,
+   status VARCHAR(10) NOT NULL,
+   affected INT NOT NULL DEFAULT 0,
+   error VARCHAR(500) NOT NULL DEFAULT '',
+   PRIMARY KEY (run_id),
+   INDEX (job_name, status),
+   FOREIGN KEY (job_name) REFERENCES jobs(job_name)
+);